@@ -0,0 +1,338 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package auditevent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// OverflowPolicy determines what an asynchronous EventWriter does
+// when its queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock blocks the caller until there is room in the queue.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDropNewest drops the event that is being written.
+	OverflowDropNewest
+	// OverflowDropOldest drops the oldest queued event to make room
+	// for the event that is being written.
+	OverflowDropOldest
+	// OverflowFailClosed rejects the event that is being written and
+	// returns ErrQueueFull to the caller.
+	OverflowFailClosed
+)
+
+var (
+	// ErrQueueFull is returned when an event can't be queued because the
+	// queue is full and the writer uses the OverflowFailClosed policy.
+	ErrQueueFull = errors.New("audit event queue is full")
+	// ErrWriterClosed is returned when writing to an EventWriter that
+	// has been closed.
+	ErrWriterClosed = errors.New("audit event writer is closed")
+	// ErrInvalidQueueSize is returned when an asynchronous writer is
+	// configured with a queue size lower than one.
+	ErrInvalidQueueSize = errors.New("audit event queue size must be greater than zero")
+)
+
+// String returns the name of the policy.
+func (p OverflowPolicy) String() string {
+	switch p {
+	case OverflowBlock:
+		return "block"
+	case OverflowDropNewest:
+		return "drop-newest"
+	case OverflowDropOldest:
+		return "drop-oldest"
+	case OverflowFailClosed:
+		return "fail-closed"
+	default:
+		return fmt.Sprintf("OverflowPolicy(%d)", int(p))
+	}
+}
+
+// WithAsync makes this writer asynchronous. Events passed to `Write` are
+// placed in a bounded in-memory queue of the given size and encoded by a
+// background worker, so callers don't wait on the underlying encoder.
+// The policy determines what happens when the queue is full.
+// `Flush` and `Close` should be used to ensure queued events are persisted.
+// It returns the writer itself for ease of use as the Builder pattern.
+// This panics if the queue size is lower than one or if the writer is
+// already asynchronous.
+func (w *EventWriter) WithAsync(queueSize int, policy OverflowPolicy) *EventWriter {
+	if queueSize < 1 {
+		panic(ErrInvalidQueueSize)
+	}
+
+	if w.async != nil {
+		panic("auditevent: writer is already asynchronous")
+	}
+
+	w.async = newAsyncQueue(w, queueSize, policy)
+	go w.async.run()
+
+	return w
+}
+
+// AsyncPolicy returns the overflow policy of an asynchronous writer,
+// and whether the writer is asynchronous at all.
+func (w *EventWriter) AsyncPolicy() (OverflowPolicy, bool) {
+	if w.async == nil {
+		return 0, false
+	}
+
+	return w.async.policy, true
+}
+
+// Flush blocks until all the events queued so far have been written or
+// the context is done. Events written meanwhile aren't waited for, so it
+// returns under sustained writes too. It returns the last error the
+// background worker encountered since the previous call to Flush, if any.
+// For synchronous writers this is a no-op.
+func (w *EventWriter) Flush(ctx context.Context) error {
+	if w.async == nil {
+		return nil
+	}
+
+	return w.async.flush(ctx)
+}
+
+// Close stops accepting new events and waits until the queued events
+// have been written or the context is done. Calling `Write` after `Close`
+// returns ErrWriterClosed, as do the calls to `Write` that are blocked on
+// a full queue when it's called. The underlying writer is not closed.
+// For synchronous writers this is a no-op.
+func (w *EventWriter) Close(ctx context.Context) error {
+	if w.async == nil {
+		return nil
+	}
+
+	return w.async.close(ctx)
+}
+
+// asyncQueue holds the state of an asynchronous EventWriter.
+type asyncQueue struct {
+	w      *EventWriter
+	policy OverflowPolicy
+	queue  chan queuedEvent
+
+	// closeMu guards sends to the queue against closing it. closing is
+	// closed first, so writers blocked on a full queue give up the lock.
+	closeMu   sync.RWMutex
+	closed    bool
+	closing   chan struct{}
+	closeOnce sync.Once
+	done      chan struct{}
+
+	// mu guards the fields below. Every event gets the next sequence
+	// number once it's written, and the events before handled are no
+	// longer pending. Events may finish out of order, e.g. when they're
+	// dropped, so the ones after handled that did are kept in finished.
+	// progress is closed and replaced whenever handled moves forward.
+	mu       sync.Mutex
+	next     uint64
+	handled  uint64
+	finished map[uint64]struct{}
+	progress chan struct{}
+	lastErr  error
+}
+
+// queuedEvent is an event in the queue, along with its sequence number.
+type queuedEvent struct {
+	event *AuditEvent
+	seq   uint64
+}
+
+func newAsyncQueue(w *EventWriter, size int, policy OverflowPolicy) *asyncQueue {
+	return &asyncQueue{
+		w:        w,
+		policy:   policy,
+		queue:    make(chan queuedEvent, size),
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+		finished: map[uint64]struct{}{},
+		progress: make(chan struct{}),
+	}
+}
+
+func (q *asyncQueue) enqueue(e *AuditEvent) error {
+	q.closeMu.RLock()
+	defer q.closeMu.RUnlock()
+
+	if q.closed {
+		return ErrWriterClosed
+	}
+
+	qe := queuedEvent{event: e, seq: q.add()}
+
+	switch q.policy {
+	case OverflowDropNewest:
+		select {
+		case q.queue <- qe:
+		default:
+			q.drop(qe.seq)
+		}
+	case OverflowDropOldest:
+		for {
+			select {
+			case q.queue <- qe:
+				return nil
+			default:
+			}
+
+			// Make room by discarding the oldest event. The worker may
+			// have taken it in the meantime, in which case we just retry.
+			select {
+			case oldest := <-q.queue:
+				q.drop(oldest.seq)
+			default:
+			}
+		}
+	case OverflowFailClosed:
+		select {
+		case q.queue <- qe:
+		default:
+			q.drop(qe.seq)
+			return ErrQueueFull
+		}
+	default:
+		// OverflowBlock: wait for room in the queue, unless the writer
+		// is being closed
+		select {
+		case q.queue <- qe:
+		case <-q.closing:
+			q.drop(qe.seq)
+			return ErrWriterClosed
+		}
+	}
+
+	return nil
+}
+
+func (q *asyncQueue) run() {
+	defer close(q.done)
+
+	for qe := range q.queue {
+		err := q.w.write(qe.event)
+		q.finish(qe.seq, err)
+	}
+}
+
+// add records a new pending event, and returns its sequence number.
+func (q *asyncQueue) add() uint64 {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	seq := q.next
+	q.next++
+	q.setQueuedMetric()
+
+	return seq
+}
+
+// drop records that a pending event was discarded.
+func (q *asyncQueue) drop(seq uint64) {
+	if q.w.mts != nil {
+		q.w.mts.IncDropped()
+	}
+
+	q.finish(seq, nil)
+}
+
+// finish records that a pending event is no longer pending.
+func (q *asyncQueue) finish(seq uint64, err error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	if err != nil {
+		q.lastErr = err
+	}
+
+	if seq != q.handled {
+		q.finished[seq] = struct{}{}
+		q.setQueuedMetric()
+		return
+	}
+
+	q.handled++
+	for {
+		if _, ok := q.finished[q.handled]; !ok {
+			break
+		}
+		delete(q.finished, q.handled)
+		q.handled++
+	}
+
+	close(q.progress)
+	q.progress = make(chan struct{})
+	q.setQueuedMetric()
+}
+
+// setQueuedMetric must be called with mu held.
+func (q *asyncQueue) setQueuedMetric() {
+	if q.w.mts != nil {
+		q.w.mts.SetQueued(int(q.next-q.handled) - len(q.finished))
+	}
+}
+
+// flush waits until the events that were written before it's called
+// are no longer pending. Events written meanwhile aren't waited for.
+func (q *asyncQueue) flush(ctx context.Context) error {
+	q.mu.Lock()
+	target := q.next
+	for q.handled < target {
+		progress := q.progress
+		q.mu.Unlock()
+
+		select {
+		case <-progress:
+		case <-ctx.Done():
+			return fmt.Errorf("flushing audit events: %w", ctx.Err())
+		}
+
+		q.mu.Lock()
+	}
+	defer q.mu.Unlock()
+
+	err := q.lastErr
+	q.lastErr = nil
+
+	return err
+}
+
+func (q *asyncQueue) close(ctx context.Context) error {
+	// Writers blocked on a full queue hold closeMu, so they're released
+	// before taking it
+	q.closeOnce.Do(func() { close(q.closing) })
+
+	q.closeMu.Lock()
+	if !q.closed {
+		q.closed = true
+		close(q.queue)
+	}
+	q.closeMu.Unlock()
+
+	select {
+	case <-q.done:
+	case <-ctx.Done():
+		return fmt.Errorf("closing audit event writer: %w", ctx.Err())
+	}
+
+	return q.flush(ctx)
+}
@@ -0,0 +1,399 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package auditevent_test
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-toolbox/auditevent"
+	"github.com/metal-toolbox/auditevent/internal/testtools"
+	"github.com/metal-toolbox/auditevent/metrics"
+)
+
+// gatedEncoder records the type of every encoded event. Encoding
+// blocks until the gate is opened.
+type gatedEncoder struct {
+	started chan struct{}
+	gate    chan struct{}
+
+	mu    sync.Mutex
+	types []string
+}
+
+func newGatedEncoder() *gatedEncoder {
+	return &gatedEncoder{
+		started: make(chan struct{}, 100),
+		gate:    make(chan struct{}),
+	}
+}
+
+func (g *gatedEncoder) Encode(v any) error {
+	g.started <- struct{}{}
+	<-g.gate
+
+	e, ok := v.(*auditevent.AuditEvent)
+	if !ok {
+		return fmt.Errorf("unexpected type %T", v) //nolint:err113 //test
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.types = append(g.types, e.Type)
+
+	return nil
+}
+
+func (g *gatedEncoder) written() []string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]string{}, g.types...)
+}
+
+func newTestEvent(eventType string) *auditevent.AuditEvent {
+	return auditevent.NewAuditEvent(
+		eventType,
+		auditevent.EventSource{
+			Type:  "IP",
+			Value: "127.0.0.1",
+		},
+		auditevent.OutcomeSucceeded,
+		map[string]string{
+			"username": "ozz",
+		},
+		"test-async-component",
+	)
+}
+
+func TestAsyncWriterWritesAllEvents(t *testing.T) {
+	t.Parallel()
+
+	var buf strings.Builder
+	w := auditevent.NewDefaultAuditEventWriter(&buf).WithAsync(10, auditevent.OverflowBlock)
+
+	nevents := 1000
+	var wg sync.WaitGroup
+	for i := 0; i < nevents; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			require.NoError(t, w.Write(newTestEvent(fmt.Sprintf("Event%d", i))))
+		}(i)
+	}
+	wg.Wait()
+
+	require.NoError(t, w.Close(t.Context()))
+
+	var numlines int
+	s := bufio.NewScanner(strings.NewReader(buf.String()))
+	for s.Scan() {
+		numlines++
+	}
+	require.Equal(t, nevents, numlines, "all events should be written")
+}
+
+func TestAsyncWriterOverflowPolicies(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name        string
+		policy      auditevent.OverflowPolicy
+		wantErr     error
+		wantWritten []string
+		wantDropped float64
+	}{
+		{
+			name:        "block waits for room",
+			policy:      auditevent.OverflowBlock,
+			wantWritten: []string{"first", "second", "third"},
+			wantDropped: 0,
+		},
+		{
+			name:        "drop newest discards the written event",
+			policy:      auditevent.OverflowDropNewest,
+			wantWritten: []string{"first", "second"},
+			wantDropped: 1,
+		},
+		{
+			name:        "drop oldest discards the queued event",
+			policy:      auditevent.OverflowDropOldest,
+			wantWritten: []string{"first", "third"},
+			wantDropped: 1,
+		},
+		{
+			name:        "fail closed returns an error",
+			policy:      auditevent.OverflowFailClosed,
+			wantErr:     auditevent.ErrQueueFull,
+			wantWritten: []string{"first", "second"},
+			wantDropped: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			enc := newGatedEncoder()
+			pr := prometheus.NewRegistry()
+			w := auditevent.NewAuditEventWriter(enc).
+				WithPrometheusMetricsForRegisterer("test", pr).
+				WithAsync(1, tt.policy)
+
+			// The worker picks up the first event and blocks on it...
+			require.NoError(t, w.Write(newTestEvent("first")))
+			<-enc.started
+			// ... so the second one fills the queue.
+			require.NoError(t, w.Write(newTestEvent("second")))
+
+			var err error
+			if tt.policy == auditevent.OverflowBlock {
+				errch := make(chan error, 1)
+				go func() {
+					errch <- w.Write(newTestEvent("third"))
+				}()
+
+				select {
+				case <-errch:
+					require.Fail(t, "write should block while the queue is full")
+				case <-time.After(50 * time.Millisecond):
+				}
+
+				close(enc.gate)
+				err = <-errch
+			} else {
+				err = w.Write(newTestEvent("third"))
+				close(enc.gate)
+			}
+
+			if tt.wantErr != nil {
+				require.ErrorIs(t, err, tt.wantErr)
+			} else {
+				require.NoError(t, err)
+			}
+
+			require.NoError(t, w.Close(t.Context()))
+			require.Equal(t, tt.wantWritten, enc.written())
+
+			dropped := gatheredValue(t, pr, metrics.DroppedTotalMetricsName)
+			require.InDelta(t, tt.wantDropped, dropped, 0)
+			queued := gatheredValue(t, pr, metrics.QueuedMetricsName)
+			require.InDelta(t, 0, queued, 0, "queue should be empty after closing")
+		})
+	}
+}
+
+func TestAsyncWriterReportsQueuedEvents(t *testing.T) {
+	t.Parallel()
+
+	enc := newGatedEncoder()
+	pr := prometheus.NewRegistry()
+	w := auditevent.NewAuditEventWriter(enc).
+		WithPrometheusMetricsForRegisterer("test", pr).
+		WithAsync(5, auditevent.OverflowBlock)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, w.Write(newTestEvent("queued")))
+	}
+
+	queued := gatheredValue(t, pr, metrics.QueuedMetricsName)
+	require.InDelta(t, 3, queued, 0)
+
+	close(enc.gate)
+	require.NoError(t, w.Flush(t.Context()))
+
+	queued = gatheredValue(t, pr, metrics.QueuedMetricsName)
+	require.InDelta(t, 0, queued, 0)
+}
+
+func TestAsyncWriterFlushReturnsWriteErrors(t *testing.T) {
+	t.Parallel()
+
+	pr := prometheus.NewRegistry()
+	w := auditevent.NewDefaultAuditEventWriter(testtools.NewErrorWriter()).
+		WithPrometheusMetricsForRegisterer("test", pr).
+		WithAsync(1, auditevent.OverflowBlock)
+
+	require.NoError(t, w.Write(newTestEvent("UserLogin")), "errors are only known once the event is written")
+	require.Error(t, w.Flush(t.Context()))
+	require.NoError(t, w.Flush(t.Context()), "errors are reported only once")
+
+	errs := gatheredValue(t, pr, metrics.ErrorsTotalMetricsName)
+	require.InDelta(t, 1, errs, 0)
+}
+
+func TestAsyncWriterFlushHonoursContext(t *testing.T) {
+	t.Parallel()
+
+	enc := newGatedEncoder()
+	w := auditevent.NewAuditEventWriter(enc).WithAsync(1, auditevent.OverflowBlock)
+	defer close(enc.gate)
+
+	require.NoError(t, w.Write(newTestEvent("stuck")))
+
+	ctx, cancel := context.WithTimeout(t.Context(), 10*time.Millisecond)
+	defer cancel()
+
+	require.ErrorIs(t, w.Flush(ctx), context.DeadlineExceeded)
+	require.ErrorIs(t, w.Close(ctx), context.DeadlineExceeded)
+}
+
+func TestAsyncWriterFlushDoesntWaitForLaterEvents(t *testing.T) {
+	t.Parallel()
+
+	enc := newGatedEncoder()
+	w := auditevent.NewAuditEventWriter(enc).WithAsync(2, auditevent.OverflowBlock)
+
+	require.NoError(t, w.Write(newTestEvent("before")))
+	<-enc.started
+
+	// Every event is written once the next one is queued,
+	// so the queue never empties
+	stop := make(chan struct{})
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		for {
+			if err := w.Write(newTestEvent("after")); err != nil {
+				return
+			}
+
+			select {
+			case enc.gate <- struct{}{}:
+			case <-stop:
+				return
+			}
+
+			select {
+			case <-enc.started:
+			case <-stop:
+				return
+			}
+		}
+	}()
+
+	ctx, cancel := context.WithTimeout(t.Context(), time.Second)
+	defer cancel()
+
+	require.NoError(t, w.Flush(ctx), "flushing should only wait for the events written before")
+	require.Equal(t, "before", enc.written()[0])
+
+	close(stop)
+	<-stopped
+	close(enc.gate)
+	require.NoError(t, w.Close(ctx))
+}
+
+func TestAsyncWriterCloseReleasesBlockedWriters(t *testing.T) {
+	t.Parallel()
+
+	enc := newGatedEncoder()
+	w := auditevent.NewAuditEventWriter(enc).WithAsync(1, auditevent.OverflowBlock)
+	defer close(enc.gate)
+
+	// The worker is stuck on the first event and the second one fills
+	// the queue, so the third one blocks
+	require.NoError(t, w.Write(newTestEvent("stuck")))
+	<-enc.started
+	require.NoError(t, w.Write(newTestEvent("queued")))
+
+	blocked := make(chan error, 1)
+	go func() { blocked <- w.Write(newTestEvent("blocked")) }()
+
+	ctx, cancel := context.WithTimeout(t.Context(), 50*time.Millisecond)
+	defer cancel()
+
+	closed := make(chan error, 1)
+	go func() { closed <- w.Close(ctx) }()
+
+	select {
+	case err := <-closed:
+		require.ErrorIs(t, err, context.DeadlineExceeded)
+	case <-time.After(5 * time.Second):
+		t.Fatal("Close should honour its context while a writer is blocked")
+	}
+
+	select {
+	case err := <-blocked:
+		require.ErrorIs(t, err, auditevent.ErrWriterClosed)
+	case <-time.After(5 * time.Second):
+		t.Fatal("the blocked writer should be released by Close")
+	}
+}
+
+func TestAsyncWriterRejectsEventsAfterClose(t *testing.T) {
+	t.Parallel()
+
+	var buf strings.Builder
+	w := auditevent.NewDefaultAuditEventWriter(&buf).WithAsync(1, auditevent.OverflowBlock)
+
+	require.NoError(t, w.Close(t.Context()))
+	require.NoError(t, w.Close(t.Context()), "closing twice should be harmless")
+	require.ErrorIs(t, w.Write(newTestEvent("UserLogin")), auditevent.ErrWriterClosed)
+}
+
+func TestSyncWriterFlushAndCloseAreNoops(t *testing.T) {
+	t.Parallel()
+
+	var buf strings.Builder
+	w := auditevent.NewDefaultAuditEventWriter(&buf)
+
+	require.NoError(t, w.Flush(t.Context()))
+	require.NoError(t, w.Close(t.Context()))
+	require.NoError(t, w.Write(newTestEvent("UserLogin")))
+}
+
+func TestAsyncWriterPanicsWithInvalidQueueSize(t *testing.T) {
+	t.Parallel()
+
+	var buf strings.Builder
+	require.Panics(t, func() {
+		auditevent.NewDefaultAuditEventWriter(&buf).WithAsync(0, auditevent.OverflowBlock)
+	})
+}
+
+// gatheredValue returns the value of the metric with the given name in the
+// given registry. Metrics that haven't been set yet are reported as zero.
+func gatheredValue(t *testing.T, pr *prometheus.Registry, name string) float64 {
+	t.Helper()
+
+	gatheredmetrics, err := pr.Gather()
+	require.NoError(t, err)
+
+	for _, m := range gatheredmetrics {
+		if m.GetName() != name {
+			continue
+		}
+
+		require.Len(t, m.GetMetric(), 1, "expected a single metric")
+		metric := m.GetMetric()[0]
+
+		if metric.GetGauge() != nil {
+			return metric.GetGauge().GetValue()
+		}
+
+		return metric.GetCounter().GetValue()
+	}
+
+	return 0
+}
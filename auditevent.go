@@ -78,6 +78,12 @@ type EventMetadata struct {
 	// Extra allows for including additional information about the event
 	// that aids in tracking, parsing or auditing
 	Extra map[string]any `json:"extra,omitempty"`
+	// Chain links the event to the previous event written by the same
+	// writer. It's only set when the writer has hash chaining enabled.
+	Chain *EventChain `json:"chain,omitempty"`
+	// Signature attests which process produced the event. It's only set
+	// when the event was signed, e.g. by a writer with a Signer.
+	Signature *EventSignature `json:"signature,omitempty"`
 }
 
 type EventSource struct {
@@ -149,7 +155,7 @@ func (e *AuditEvent) WithData(data *json.RawMessage) *AuditEvent {
 
 // WithDataFromString sets the data of the event from a string.
 // Note that validating that this is properly JSON-formatted
-// is the responsibility of the caller.
+// is the responsibility of the caller (see Validate).
 func (e *AuditEvent) WithDataFromString(data string) *AuditEvent {
 	rawMsg := json.RawMessage(data)
 	return e.WithData(&rawMsg)
@@ -0,0 +1,336 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package auditevent
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"slices"
+	"strconv"
+	"strings"
+	"unicode/utf16"
+	"unicode/utf8"
+)
+
+// ErrNotCanonicalizable is returned when a JSON document can't be
+// represented in the canonical form; e.g. because it has duplicate
+// object keys or numbers outside of the IEEE 754 double range.
+var ErrNotCanonicalizable = errors.New("JSON document can't be canonicalized")
+
+// CanonicalEncoder is an EventEncoder that writes audit events using the
+// JSON Canonicalization Scheme (JCS) defined in RFC 8785, one event per line.
+// The output is byte-stable: the same event always produces the same bytes,
+// regardless of map ordering or of how the event's data was formatted.
+type CanonicalEncoder struct {
+	w io.Writer
+}
+
+// NewCanonicalEncoder returns a new CanonicalEncoder that writes to w.
+func NewCanonicalEncoder(w io.Writer) *CanonicalEncoder {
+	return &CanonicalEncoder{w: w}
+}
+
+// Encode writes the canonical JSON serialization of v, followed by a newline.
+// Each call results in a single write to the underlying writer.
+func (c *CanonicalEncoder) Encode(v any) error {
+	raw, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("serializing audit event: %w", err)
+	}
+
+	b, err := Canonicalize(raw)
+	if err != nil {
+		return err
+	}
+
+	_, err = c.w.Write(append(b, '\n'))
+
+	return err
+}
+
+// NewCanonicalAuditEventWriter returns an EventWriter that writes audit
+// events to w using a CanonicalEncoder.
+func NewCanonicalAuditEventWriter(w io.Writer) *EventWriter {
+	return NewAuditEventWriter(NewCanonicalEncoder(w))
+}
+
+// CanonicalBytes returns the RFC 8785 (JCS) canonical JSON serialization
+// of the event. This is the serialization that is hashed and signed.
+func (e *AuditEvent) CanonicalBytes() ([]byte, error) {
+	raw, err := json.Marshal(e)
+	if err != nil {
+		return nil, fmt.Errorf("serializing audit event: %w", err)
+	}
+
+	return Canonicalize(raw)
+}
+
+// Canonicalize transforms the given JSON document into its RFC 8785 (JCS)
+// canonical form: no insignificant whitespace, object keys sorted by their
+// UTF-16 code units, numbers serialized as ECMAScript does and strings with
+// the minimal amount of escaping.
+func Canonicalize(data []byte) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	var buf bytes.Buffer
+	if err := canonicalizeValue(dec, &buf); err != nil {
+		return nil, err
+	}
+
+	if _, err := dec.Token(); !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: trailing data after JSON value", ErrNotCanonicalizable)
+	}
+
+	return buf.Bytes(), nil
+}
+
+func canonicalizeValue(dec *json.Decoder, buf *bytes.Buffer) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrNotCanonicalizable, err)
+	}
+
+	switch t := tok.(type) {
+	case json.Delim:
+		if t == '{' {
+			return canonicalizeObject(dec, buf)
+		}
+
+		return canonicalizeArray(dec, buf)
+	case json.Number:
+		s, err := canonicalNumber(t)
+		if err != nil {
+			return err
+		}
+
+		buf.WriteString(s)
+	case string:
+		writeCanonicalString(buf, t)
+	case bool:
+		buf.WriteString(strconv.FormatBool(t))
+	case nil:
+		buf.WriteString("null")
+	default:
+		return fmt.Errorf("%w: unexpected token %v", ErrNotCanonicalizable, tok)
+	}
+
+	return nil
+}
+
+func canonicalizeObject(dec *json.Decoder, buf *bytes.Buffer) error {
+	type member struct {
+		key   string
+		value []byte
+	}
+
+	var members []member
+
+	seen := map[string]bool{}
+
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrNotCanonicalizable, err)
+		}
+
+		// Object keys are always strings when the decoder succeeds.
+		key, _ := tok.(string) //nolint:errcheck // see above
+
+		if seen[key] {
+			return fmt.Errorf("%w: duplicate key %q", ErrNotCanonicalizable, key)
+		}
+
+		seen[key] = true
+
+		var value bytes.Buffer
+		if err := canonicalizeValue(dec, &value); err != nil {
+			return err
+		}
+
+		members = append(members, member{key: key, value: value.Bytes()})
+	}
+
+	// consume the closing delimiter
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("%w: %w", ErrNotCanonicalizable, err)
+	}
+
+	slices.SortFunc(members, func(a, b member) int {
+		return compareUTF16(a.key, b.key)
+	})
+
+	buf.WriteByte('{')
+
+	for i, m := range members {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		writeCanonicalString(buf, m.key)
+		buf.WriteByte(':')
+		buf.Write(m.value)
+	}
+
+	buf.WriteByte('}')
+
+	return nil
+}
+
+func canonicalizeArray(dec *json.Decoder, buf *bytes.Buffer) error {
+	buf.WriteByte('[')
+
+	for i := 0; dec.More(); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+
+		if err := canonicalizeValue(dec, buf); err != nil {
+			return err
+		}
+	}
+
+	// consume the closing delimiter
+	if _, err := dec.Token(); err != nil {
+		return fmt.Errorf("%w: %w", ErrNotCanonicalizable, err)
+	}
+
+	buf.WriteByte(']')
+
+	return nil
+}
+
+// compareUTF16 compares two strings by their UTF-16 code units, as
+// required by RFC 8785 section 3.2.3.
+func compareUTF16(a, b string) int {
+	return slices.Compare(utf16.Encode([]rune(a)), utf16.Encode([]rune(b)))
+}
+
+// writeCanonicalString writes a JSON string as described in RFC 8785
+// section 3.2.2.2.
+func writeCanonicalString(buf *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+
+	buf.WriteByte('"')
+
+	for _, r := range s {
+		switch r {
+		case '"':
+			buf.WriteString(`\"`)
+		case '\\':
+			buf.WriteString(`\\`)
+		case '\b':
+			buf.WriteString(`\b`)
+		case '\f':
+			buf.WriteString(`\f`)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		default:
+			if r < 0x20 {
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[r>>4])
+				buf.WriteByte(hex[r&0xf])
+
+				continue
+			}
+
+			buf.WriteRune(r)
+		}
+	}
+
+	buf.WriteByte('"')
+}
+
+// canonicalNumber serializes a JSON number as described in RFC 8785
+// section 3.2.2.3, which follows ECMAScript's Number.prototype.toString.
+func canonicalNumber(n json.Number) (string, error) {
+	f, err := strconv.ParseFloat(string(n), 64)
+	if err != nil || math.IsInf(f, 0) || math.IsNaN(f) {
+		return "", fmt.Errorf("%w: number %s is out of range", ErrNotCanonicalizable, n)
+	}
+
+	if f == 0 {
+		// This also takes care of negative zero.
+		return "0", nil
+	}
+
+	var sb strings.Builder
+
+	if f < 0 {
+		sb.WriteByte('-')
+		f = -f
+	}
+
+	// The shortest representation that round-trips, as d.ddddde±x
+	sci := strconv.FormatFloat(f, 'e', -1, 64)
+	mantissa, exp, _ := strings.Cut(sci, "e")
+	digits := strings.Replace(mantissa, ".", "", 1)
+
+	// e is the exponent of the number written as 0.digits × 10^e
+	e, err := strconv.Atoi(exp)
+	if err != nil {
+		return "", fmt.Errorf("%w: number %s: %w", ErrNotCanonicalizable, n, err)
+	}
+
+	e++
+
+	k := utf8.RuneCountInString(digits)
+
+	const maxPlainExponent = 21
+
+	switch {
+	case k <= e && e <= maxPlainExponent:
+		// integers
+		sb.WriteString(digits)
+		sb.WriteString(strings.Repeat("0", e-k))
+	case 0 < e && e <= maxPlainExponent:
+		// fractions greater than one
+		sb.WriteString(digits[:e])
+		sb.WriteByte('.')
+		sb.WriteString(digits[e:])
+	case -6 < e && e <= 0:
+		// small fractions
+		sb.WriteString("0.")
+		sb.WriteString(strings.Repeat("0", -e))
+		sb.WriteString(digits)
+	default:
+		// exponential notation
+		sb.WriteString(digits[:1])
+
+		if k > 1 {
+			sb.WriteByte('.')
+			sb.WriteString(digits[1:])
+		}
+
+		sb.WriteByte('e')
+
+		if e-1 >= 0 {
+			sb.WriteByte('+')
+		}
+
+		sb.WriteString(strconv.Itoa(e - 1))
+	}
+
+	return sb.String(), nil
+}
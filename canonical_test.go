@@ -0,0 +1,178 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package auditevent_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+const canonicalFixtures = "testdata/canonical"
+
+func readFixture(t *testing.T, name string) []byte {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.Join(canonicalFixtures, name))
+	require.NoError(t, err)
+
+	return b
+}
+
+func TestCanonicalizeFixtures(t *testing.T) {
+	t.Parallel()
+
+	// The rfc8785-* fixtures are the examples from RFC 8785 section 3.2.
+	for _, name := range []string{"rfc8785-values", "rfc8785-sorting"} {
+		t.Run(name, func(t *testing.T) {
+			t.Parallel()
+
+			got, err := auditevent.Canonicalize(readFixture(t, name+".json"))
+			require.NoError(t, err)
+			require.Equal(t, string(readFixture(t, name+".golden")), string(got))
+
+			again, err := auditevent.Canonicalize(got)
+			require.NoError(t, err)
+			require.Equal(t, got, again, "canonicalizing canonical JSON should be a no-op")
+		})
+	}
+}
+
+func TestCanonicalBytesFixture(t *testing.T) {
+	t.Parallel()
+
+	var e auditevent.AuditEvent
+	require.NoError(t, json.Unmarshal(readFixture(t, "auditevent.json"), &e))
+
+	got, err := e.CanonicalBytes()
+	require.NoError(t, err)
+	require.Equal(t, string(readFixture(t, "auditevent.golden")), string(got))
+}
+
+func TestCanonicalBytesAreStable(t *testing.T) {
+	t.Parallel()
+
+	base := auditevent.NewAuditEventWithID(
+		"7c96380f-24e6-4fdb-8612-d50c3f1a9806",
+		"UserCreate",
+		auditevent.EventSource{
+			Type:  "IP",
+			Value: "127.0.0.1",
+			Extra: map[string]any{"z": 1, "a": "<tag>"},
+		},
+		auditevent.OutcomeSucceeded,
+		map[string]string{"username": "test", "role": "admin"},
+		"test-iam-component",
+	)
+
+	variants := []string{
+		`{"scope":"valid-scope","limits":{"rate":100,"burst":10}}`,
+		`{ "limits": { "burst": 10, "rate": 1e2 }, "scope": "valid-scope" }`,
+		"{\n\t\"limits\": {\"burst\": 10.0, \"rate\": 100.00},\n\t\"scope\": \"valid-\\u0073cope\"\n}",
+	}
+
+	var want []byte
+	for _, v := range variants {
+		e := *base
+		e.WithDataFromString(v)
+
+		got, err := e.CanonicalBytes()
+		require.NoError(t, err)
+
+		if want == nil {
+			want = got
+			continue
+		}
+
+		require.Equal(t, string(want), string(got), "equivalent events should serialize identically")
+	}
+}
+
+func TestCanonicalNumbers(t *testing.T) {
+	t.Parallel()
+
+	tests := map[string]string{
+		"0":                       "0",
+		"-0":                      "0",
+		"1":                       "1",
+		"-1.5":                    "-1.5",
+		"100":                     "100",
+		"1e20":                    "100000000000000000000",
+		"1e21":                    "1e+21",
+		"123456789012345678901":   "123456789012345680000",
+		"0.000001":                "0.000001",
+		"0.0000001":               "1e-7",
+		"123e-20":                 "1.23e-18",
+		"9007199254740993":        "9007199254740992",
+		"5e-324":                  "5e-324",
+		"1.7976931348623157e308":  "1.7976931348623157e+308",
+		"-1.7976931348623157e308": "-1.7976931348623157e+308",
+		"0.1":                     "0.1",
+		"12.34":                   "12.34",
+	}
+
+	for in, want := range tests {
+		got, err := auditevent.Canonicalize([]byte(in))
+		require.NoError(t, err, in)
+		require.Equal(t, want, string(got), in)
+	}
+}
+
+func TestCanonicalizeRejectsInvalidDocuments(t *testing.T) {
+	t.Parallel()
+
+	for _, in := range []string{
+		`{"a":1,"a":2}`,
+		`1e400`,
+		`{"a":`,
+		`{} {}`,
+		``,
+	} {
+		_, err := auditevent.Canonicalize([]byte(in))
+		require.ErrorIs(t, err, auditevent.ErrNotCanonicalizable, in)
+	}
+}
+
+func TestCanonicalEncoder(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	w := auditevent.NewCanonicalAuditEventWriter(&buf)
+
+	e := newTestEvent("UserLogin").WithDataFromString(`{"b": "<x>", "a": 1}`)
+	require.NoError(t, w.Write(e))
+	require.NoError(t, w.Write(e))
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	require.Len(t, lines, 2)
+	require.Equal(t, lines[0], lines[1])
+	require.Contains(t, lines[0], `"data":{"a":1,"b":"<x>"}`)
+
+	want, err := e.CanonicalBytes()
+	require.NoError(t, err)
+	require.Equal(t, string(want), lines[0])
+
+	var got auditevent.AuditEvent
+	require.NoError(t, json.Unmarshal([]byte(lines[0]), &got), "canonical output should be valid JSON")
+	require.Equal(t, e.Metadata.AuditID, got.Metadata.AuditID)
+}
@@ -0,0 +1,434 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package auditevent
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// ChainCheckpointEventType is the type of the checkpoint events that
+	// a hash-chaining EventWriter emits periodically.
+	ChainCheckpointEventType = "AuditChainCheckpoint"
+
+	// ChainCheckpointSourceType is the source type of checkpoint events.
+	ChainCheckpointSourceType = "AuditEventWriter"
+
+	// ChainCheckpointSubjectKey and ChainCheckpointSubject make up the
+	// subject of checkpoint events, which the writer emits on its own.
+	ChainCheckpointSubjectKey = "system"
+	ChainCheckpointSubject    = "auditevent"
+)
+
+// ErrChainBroken is returned when a hash chain doesn't verify.
+var ErrChainBroken = errors.New("audit event hash chain is broken")
+
+// EventChain links an audit event to the event that the same writer
+// wrote before it. The hash covers the whole event, including the
+// chain's ID, sequence number and previous hash.
+type EventChain struct {
+	// ID identifies the writer that produced the chain. Several writers
+	// may share a single audit log, each with its own chain.
+	ID string `json:"id"`
+	// Seq is the position of the event in the chain, starting at zero.
+	Seq uint64 `json:"seq"`
+	// PrevHash is the hash of the previous event in the chain. It is
+	// empty for the first event.
+	PrevHash string `json:"prevHash"`
+	// Hash is the hex-encoded SHA-256 hash of this event.
+	Hash string `json:"hash"`
+}
+
+// ChainCheckpoint is the data of a checkpoint event. It records the
+// head of the chain at the time the checkpoint was emitted.
+type ChainCheckpoint struct {
+	// Seq is the sequence number of the last event before the checkpoint.
+	Seq uint64 `json:"seq"`
+	// Hash is the hash of the last event before the checkpoint.
+	Hash string `json:"hash"`
+}
+
+// WithHashChain enables tamper-evident hash chaining for this writer.
+// Each written event gets its `Metadata.Chain` set, which links it
+// to the hash of the previously written event. Removing or editing
+// an event afterwards breaks the chain, which `VerifyHashChain` detects.
+// If checkpointInterval is greater than zero, a checkpoint event
+// (see ChainCheckpointEventType) is written after every
+// checkpointInterval events.
+// Note that the events passed to `Write` are modified.
+// It returns the writer itself for ease of use as the Builder pattern.
+func (w *EventWriter) WithHashChain(checkpointInterval int) *EventWriter {
+	w.chain = &hashChain{
+		id:                 uuid.New().String(),
+		checkpointInterval: checkpointInterval,
+	}
+	return w
+}
+
+// hashChain holds the state of a hash-chaining EventWriter.
+type hashChain struct {
+	id                 string
+	checkpointInterval int
+
+	// mu serializes chaining and encoding, so that the order
+	// of the chain matches the order of the output.
+	mu       sync.Mutex
+	next     uint64
+	lastHash string
+	sinceCP  int
+}
+
+// link sets the chain of the given event as the next event in the chain.
+// The state of the chain is only advanced by commit.
+func (c *hashChain) link(e *AuditEvent) error {
+	e.Metadata.Chain = &EventChain{
+		ID:       c.id,
+		Seq:      c.next,
+		PrevHash: c.lastHash,
+	}
+
+	h, err := hashEvent(e)
+	if err != nil {
+		e.Metadata.Chain = nil
+		return err
+	}
+
+	e.Metadata.Chain.Hash = h
+
+	return nil
+}
+
+// commit advances the chain past the given, successfully written, event.
+// It returns whether a checkpoint is due.
+func (c *hashChain) commit(e *AuditEvent) bool {
+	c.next = e.Metadata.Chain.Seq + 1
+	c.lastHash = e.Metadata.Chain.Hash
+
+	if e.Type == ChainCheckpointEventType || c.checkpointInterval <= 0 {
+		return false
+	}
+
+	c.sinceCP++
+	if c.sinceCP < c.checkpointInterval {
+		return false
+	}
+
+	c.sinceCP = 0
+
+	return true
+}
+
+// checkpoint returns a checkpoint event for the current head of the chain.
+func (c *hashChain) checkpoint(component string) *AuditEvent {
+	data, err := json.Marshal(&ChainCheckpoint{
+		Seq:  c.next - 1,
+		Hash: c.lastHash,
+	})
+	if err != nil {
+		// This can't happen given the checkpoint's fields.
+		panic(err)
+	}
+
+	raw := json.RawMessage(data)
+
+	return NewAuditEvent(
+		ChainCheckpointEventType,
+		EventSource{
+			Type:  ChainCheckpointSourceType,
+			Value: c.id,
+		},
+		OutcomeSucceeded,
+		map[string]string{ChainCheckpointSubjectKey: ChainCheckpointSubject},
+		component,
+	).WithData(&raw)
+}
+
+// writeChained links, encodes and commits the given event, followed
+// by a checkpoint if one is due.
+func (w *EventWriter) writeChained(e *AuditEvent) error {
+	w.chain.mu.Lock()
+	defer w.chain.mu.Unlock()
+
+	if err := w.chain.link(e); err != nil {
+		w.countResult(err)
+		return fmt.Errorf("chaining audit event: %w", err)
+	}
+
+	if err := w.encode(e); err != nil {
+		return err
+	}
+
+	if !w.chain.commit(e) {
+		return nil
+	}
+
+	cp := w.chain.checkpoint(e.Component)
+	if err := w.chain.link(cp); err != nil {
+		w.countResult(err)
+		return fmt.Errorf("chaining checkpoint event: %w", err)
+	}
+
+	if err := w.encode(cp); err != nil {
+		return err
+	}
+
+	w.chain.commit(cp)
+
+	return nil
+}
+
+// hashEvent returns the hex-encoded SHA-256 hash of the canonical
+// serialization of the given event, leaving out its own hash and
+// its signature (which is computed after chaining).
+func hashEvent(e *AuditEvent) (string, error) {
+	c := *e.Metadata.Chain
+	c.Hash = ""
+
+	cpy := *e
+	cpy.Metadata.Chain = &c
+	cpy.Metadata.Signature = nil
+
+	b, err := cpy.CanonicalBytes()
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(b)
+
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// ChainError describes where and why a hash chain is broken.
+type ChainError struct {
+	// Line is the line of the audit log where the chain breaks.
+	// It is zero when the error doesn't come from VerifyHashChain.
+	Line int
+	// AuditID is the ID of the offending event, if known.
+	AuditID string
+	// ChainID is the ID of the broken chain, if known.
+	ChainID string
+	// Reason describes why the chain is broken.
+	Reason string
+}
+
+func (e *ChainError) Error() string {
+	msg := ErrChainBroken.Error()
+	if e.Line > 0 {
+		msg = fmt.Sprintf("%s at line %d", msg, e.Line)
+	}
+
+	if e.AuditID != "" {
+		msg = fmt.Sprintf("%s (audit ID %s)", msg, e.AuditID)
+	}
+
+	return fmt.Sprintf("%s: %s", msg, e.Reason)
+}
+
+func (e *ChainError) Unwrap() error {
+	return ErrChainBroken
+}
+
+// ChainVerifier checks that a sequence of audit events forms unbroken
+// hash chains. It keeps track of every chain it sees, so events from
+// several writers may be interleaved.
+type ChainVerifier struct {
+	heads map[string]*EventChain
+
+	// Chained is the number of chained events that were verified.
+	Chained int
+	// Unchained is the number of events without a chain that were skipped.
+	Unchained int
+	// Checkpoints is the number of checkpoint events that were verified.
+	Checkpoints int
+}
+
+// NewChainVerifier returns a new ChainVerifier.
+func NewChainVerifier() *ChainVerifier {
+	return &ChainVerifier{
+		heads: map[string]*EventChain{},
+	}
+}
+
+// Chains returns the number of distinct chains seen so far.
+func (v *ChainVerifier) Chains() int {
+	return len(v.heads)
+}
+
+// Check verifies the next event. The first event of each chain is
+// taken as its anchor, so verification may start mid-chain (e.g. on
+// a rotated audit log). Events without a chain are skipped.
+// It returns a *ChainError if the event doesn't belong where it is.
+// The chain is then anchored on the event, so that the events after
+// it are only checked against it, and every break is reported once.
+func (v *ChainVerifier) Check(e *AuditEvent) error {
+	c := e.Metadata.Chain
+	if c == nil {
+		v.Unchained++
+		return nil
+	}
+
+	err := v.check(e)
+	v.heads[c.ID] = c
+
+	if err != nil {
+		return err
+	}
+
+	if e.Type == ChainCheckpointEventType {
+		v.Checkpoints++
+	}
+
+	v.Chained++
+
+	return nil
+}
+
+func (v *ChainVerifier) check(e *AuditEvent) error {
+	c := e.Metadata.Chain
+
+	fail := func(format string, args ...any) error {
+		return &ChainError{
+			AuditID: e.Metadata.AuditID,
+			ChainID: c.ID,
+			Reason:  fmt.Sprintf(format, args...),
+		}
+	}
+
+	h, err := hashEvent(e)
+	if err != nil {
+		return fail("hashing event: %s", err)
+	}
+
+	if h != c.Hash {
+		return fail("event hash mismatch: expected %s, got %s", c.Hash, h)
+	}
+
+	if head, ok := v.heads[c.ID]; ok {
+		if c.Seq != head.Seq+1 {
+			return fail("expected sequence number %d, got %d", head.Seq+1, c.Seq)
+		}
+
+		if c.PrevHash != head.Hash {
+			return fail("previous hash mismatch: expected %s, got %s", head.Hash, c.PrevHash)
+		}
+	}
+
+	if e.Type == ChainCheckpointEventType {
+		if err := checkCheckpoint(e, v.heads[c.ID]); err != nil {
+			return fail("%s", err)
+		}
+	}
+
+	return nil
+}
+
+func checkCheckpoint(e *AuditEvent, head *EventChain) error {
+	if e.Data == nil {
+		return errors.New("checkpoint without data") //nolint:err113 // wrapped in a ChainError
+	}
+
+	var cp ChainCheckpoint
+	if err := json.Unmarshal(*e.Data, &cp); err != nil {
+		return fmt.Errorf("malformed checkpoint: %w", err)
+	}
+
+	if cp.Seq+1 != e.Metadata.Chain.Seq || cp.Hash != e.Metadata.Chain.PrevHash {
+		return errors.New("checkpoint doesn't match the previous event") //nolint:err113 // wrapped in a ChainError
+	}
+
+	if head != nil && cp.Hash != head.Hash {
+		return errors.New("checkpoint doesn't match the head of the chain") //nolint:err113 // wrapped in a ChainError
+	}
+
+	return nil
+}
+
+// ChainReport summarizes a successful hash chain verification.
+type ChainReport struct {
+	// Events is the number of events read.
+	Events int
+	// Chained is the number of chained events that were verified.
+	Chained int
+	// Chains is the number of distinct chains seen.
+	Chains int
+	// Checkpoints is the number of checkpoint events that were verified.
+	Checkpoints int
+}
+
+// VerifyHashChain walks a JSON-lines audit log and verifies its hash chains.
+// It returns a *ChainError describing the first broken link, if any.
+// Other errors are returned when reading from the reader fails.
+func VerifyHashChain(r io.Reader) (*ChainReport, error) {
+	v := NewChainVerifier()
+	br := bufio.NewReader(r)
+	report := &ChainReport{}
+
+	for line := 1; ; line++ {
+		raw, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(raw)) > 0 {
+			report.Events++
+
+			if cerr := verifyLine(v, raw, line); cerr != nil {
+				return report, cerr
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			return report, fmt.Errorf("reading audit log: %w", err)
+		}
+	}
+
+	report.Chained = v.Chained
+	report.Chains = v.Chains()
+	report.Checkpoints = v.Checkpoints
+
+	return report, nil
+}
+
+func verifyLine(v *ChainVerifier, raw []byte, line int) error {
+	var e AuditEvent
+	if err := json.Unmarshal(raw, &e); err != nil {
+		return &ChainError{
+			Line:   line,
+			Reason: fmt.Sprintf("malformed event: %s", err),
+		}
+	}
+
+	if err := v.Check(&e); err != nil {
+		var cerr *ChainError
+		if errors.As(err, &cerr) {
+			cerr.Line = line
+		}
+
+		return err
+	}
+
+	return nil
+}
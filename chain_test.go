@@ -0,0 +1,228 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package auditevent_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+// writeChainedLog writes n chained events and returns the resulting log lines.
+func writeChainedLog(t *testing.T, n, checkpointInterval int) []string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := auditevent.NewDefaultAuditEventWriter(&buf).WithHashChain(checkpointInterval)
+
+	for i := 0; i < n; i++ {
+		e := newTestEvent(fmt.Sprintf("Event%d", i)).WithDataFromString(`{ "index": ` + fmt.Sprint(i) + ` }`)
+		require.NoError(t, w.Write(e))
+		require.NotNil(t, e.Metadata.Chain, "written events should be chained")
+	}
+
+	return strings.SplitAfter(strings.TrimSuffix(buf.String(), "\n"), "\n")
+}
+
+func TestHashChainVerifies(t *testing.T) {
+	t.Parallel()
+
+	lines := writeChainedLog(t, 10, 3)
+	// 10 events and a checkpoint after every 3 of them
+	require.Len(t, lines, 13)
+
+	report, err := auditevent.VerifyHashChain(strings.NewReader(strings.Join(lines, "")))
+	require.NoError(t, err)
+	require.Equal(t, 13, report.Events)
+	require.Equal(t, 13, report.Chained)
+	require.Equal(t, 1, report.Chains)
+	require.Equal(t, 3, report.Checkpoints)
+
+	var cp auditevent.AuditEvent
+	require.NoError(t, json.Unmarshal([]byte(lines[3]), &cp))
+	require.Equal(t, auditevent.ChainCheckpointEventType, cp.Type)
+	require.Equal(t, "test-async-component", cp.Component)
+	require.NoError(t, cp.Validate(), "checkpoints should be valid events")
+}
+
+func TestHashChainVerifiesFromTheMiddle(t *testing.T) {
+	t.Parallel()
+
+	lines := writeChainedLog(t, 10, 0)
+
+	// e.g. the beginning of the log was rotated away
+	_, err := auditevent.VerifyHashChain(strings.NewReader(strings.Join(lines[4:], "")))
+	require.NoError(t, err)
+}
+
+func TestHashChainVerifiesInterleavedWriters(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	w1 := auditevent.NewDefaultAuditEventWriter(&buf).WithHashChain(2)
+	w2 := auditevent.NewDefaultAuditEventWriter(&buf).WithHashChain(0)
+	unchained := auditevent.NewDefaultAuditEventWriter(&buf)
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, w1.Write(newTestEvent("FromWriter1")))
+		require.NoError(t, w2.Write(newTestEvent("FromWriter2")))
+		require.NoError(t, unchained.Write(newTestEvent("Unchained")))
+	}
+
+	report, err := auditevent.VerifyHashChain(&buf)
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Chains)
+	require.Equal(t, 12, report.Chained)
+	require.Equal(t, 17, report.Events)
+}
+
+func TestHashChainWithAsyncWriter(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	w := auditevent.NewDefaultAuditEventWriter(&buf).
+		WithHashChain(5).
+		WithAsync(10, auditevent.OverflowBlock)
+
+	for i := 0; i < 50; i++ {
+		require.NoError(t, w.Write(newTestEvent("Async")))
+	}
+
+	require.NoError(t, w.Close(t.Context()))
+
+	report, err := auditevent.VerifyHashChain(&buf)
+	require.NoError(t, err)
+	require.Equal(t, 60, report.Chained)
+}
+
+func TestHashChainDetectsTampering(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name     string
+		tamper   func(lines []string) []string
+		wantLine int
+		reason   string
+	}{
+		{
+			name: "edited event",
+			tamper: func(lines []string) []string {
+				lines[2] = strings.Replace(lines[2], auditevent.OutcomeSucceeded, auditevent.OutcomeDenied, 1)
+				return lines
+			},
+			wantLine: 3,
+			reason:   "event hash mismatch",
+		},
+		{
+			name: "edited data",
+			tamper: func(lines []string) []string {
+				lines[1] = strings.Replace(lines[1], `"index":1`, `"index":42`, 1)
+				return lines
+			},
+			wantLine: 2,
+			reason:   "event hash mismatch",
+		},
+		{
+			name: "removed event",
+			tamper: func(lines []string) []string {
+				return append(lines[:1], lines[2:]...)
+			},
+			wantLine: 2,
+			reason:   "expected sequence number 1, got 2",
+		},
+		{
+			name: "reordered events",
+			tamper: func(lines []string) []string {
+				lines[1], lines[2] = lines[2], lines[1]
+				return lines
+			},
+			wantLine: 2,
+			reason:   "expected sequence number 1, got 2",
+		},
+		{
+			name: "malformed event",
+			tamper: func(lines []string) []string {
+				lines[2] = "{not json\n"
+				return lines
+			},
+			wantLine: 3,
+			reason:   "malformed event",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			lines := tt.tamper(writeChainedLog(t, 5, 0))
+
+			_, err := auditevent.VerifyHashChain(strings.NewReader(strings.Join(lines, "")))
+			require.ErrorIs(t, err, auditevent.ErrChainBroken)
+
+			var cerr *auditevent.ChainError
+			require.ErrorAs(t, err, &cerr)
+			require.Equal(t, tt.wantLine, cerr.Line)
+			require.Contains(t, cerr.Reason, tt.reason)
+		})
+	}
+}
+
+func TestHashChainDetectsForgedCheckpoint(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	w := auditevent.NewDefaultAuditEventWriter(&buf).WithHashChain(0)
+
+	require.NoError(t, w.Write(newTestEvent("Event")))
+
+	// A checkpoint that is properly chained but lies about the head.
+	cp := newTestEvent(auditevent.ChainCheckpointEventType).WithDataFromString(`{"seq":7,"hash":"abc"}`)
+	require.NoError(t, w.Write(cp))
+
+	_, err := auditevent.VerifyHashChain(&buf)
+	require.ErrorIs(t, err, auditevent.ErrChainBroken)
+	require.ErrorContains(t, err, "checkpoint")
+}
+
+func TestChainVerifierReportsEveryBreakOnce(t *testing.T) {
+	t.Parallel()
+
+	lines := writeChainedLog(t, 6, 0)
+	lines[4] = strings.Replace(lines[4], auditevent.OutcomeSucceeded, auditevent.OutcomeDenied, 1)
+	lines = append(lines[:1], lines[2:]...)
+
+	v := auditevent.NewChainVerifier()
+	var broken []int
+	for i, line := range lines {
+		var e auditevent.AuditEvent
+		require.NoError(t, json.Unmarshal([]byte(line), &e))
+
+		if err := v.Check(&e); err != nil {
+			require.ErrorIs(t, err, auditevent.ErrChainBroken)
+			broken = append(broken, i)
+		}
+	}
+
+	// The events after a break are checked against the event that broke the chain
+	require.Equal(t, []int{1, 3}, broken)
+	require.Equal(t, 3, v.Chained)
+}
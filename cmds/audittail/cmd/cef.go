@@ -0,0 +1,411 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+// These are the severities of events in CEF and LEEF, which range from 0
+// to 10.
+const (
+	severityLow    = 3
+	severityMedium = 7
+)
+
+const (
+	cefVersion  = "CEF:0"
+	leefVersion = "LEEF:2.0"
+	// convertProductVersion is the version of the product in the CEF and
+	// LEEF headers. It's the version of the mapping, not of the component.
+	convertProductVersion = "1.0"
+	// leefTimeLayout is the layout of devTime, which is leefTimeFormat in
+	// the notation of Java's SimpleDateFormat.
+	leefTimeLayout = "2006-01-02T15:04:05.000Z07:00"
+	leefTimeFormat = "yyyy-MM-dd'T'HH:mm:ss.SSSXXX"
+	// leefDelimiter is the tab, which separates the attributes of LEEF
+	// events, in the notation of the header.
+	leefDelimiter = "x09"
+)
+
+// cefCustomStrings are the labels of the custom string fields of CEF
+// events, cs1 to cs5.
+var cefCustomStrings = []string{"sourceType", "sourceValue", "subjects", "target", "data"}
+
+// cefKey matches the keys of the extension of CEF events. Values escape
+// '=', so a key is a word right before an unescaped '='.
+var cefKey = regexp.MustCompile(`(?:^|\s)([A-Za-z0-9_.\[\]]+)=`)
+
+// failedOutcome returns whether an outcome is a failure or a denial.
+func failedOutcome(outcome string) bool {
+	return strings.EqualFold(outcome, auditevent.OutcomeFailed) ||
+		strings.EqualFold(outcome, auditevent.OutcomeDenied)
+}
+
+// eventSeverity returns the severity of an event in CEF and LEEF.
+func eventSeverity(e *auditevent.AuditEvent) int {
+	if failedOutcome(e.Outcome) {
+		return severityMedium
+	}
+
+	return severityLow
+}
+
+// sourceIP returns the source of an event if it's an IP address.
+func sourceIP(e *auditevent.AuditEvent) string {
+	if net.ParseIP(e.Source.Value) == nil {
+		return ""
+	}
+
+	return e.Source.Value
+}
+
+// lossyFields are the fields of an event that CEF and LEEF carry as
+// custom attributes. Maps and data are JSON.
+type lossyFields struct {
+	sourceType  string
+	sourceValue string
+	subjects    string
+	target      string
+	data        string
+}
+
+func newLossyFields(e *auditevent.AuditEvent) *lossyFields {
+	return &lossyFields{
+		sourceType:  e.Source.Type,
+		sourceValue: e.Source.Value,
+		subjects:    csvJSON(e.Subjects),
+		target:      csvJSON(e.Target),
+		data:        csvJSON(e.Data),
+	}
+}
+
+// apply sets the fields of an event, falling back to the standard
+// attributes of the format for the source, the user and the path, for
+// events that weren't written by audittail.
+func (f *lossyFields) apply(e *auditevent.AuditEvent, src, user, path string) error {
+	e.Source = auditevent.EventSource{Type: f.sourceType, Value: f.sourceValue}
+	if f.sourceType == "" && f.sourceValue == "" && src != "" {
+		e.Source = auditevent.EventSource{Type: "IP", Value: src}
+	}
+
+	if f.subjects != "" {
+		if err := json.Unmarshal([]byte(f.subjects), &e.Subjects); err != nil {
+			return fmt.Errorf("subjects: %w", err)
+		}
+	} else if user != "" {
+		e.Subjects = map[string]string{"user": user}
+	}
+
+	if f.target != "" {
+		if err := json.Unmarshal([]byte(f.target), &e.Target); err != nil {
+			return fmt.Errorf("target: %w", err)
+		}
+	} else if path != "" {
+		e.Target = map[string]string{"path": path}
+	}
+
+	if f.data != "" {
+		if !json.Valid([]byte(f.data)) {
+			return fmt.Errorf("%w: data isn't JSON", ErrInvalidConvertInput)
+		}
+		data := json.RawMessage(f.data)
+		e.Data = &data
+	}
+
+	return nil
+}
+
+// encodeCEF formats an event in ArcSight's Common Event Format.
+func encodeCEF(e *auditevent.AuditEvent) ([]byte, error) {
+	f := newLossyFields(e)
+
+	var b strings.Builder
+	for _, h := range []string{
+		cefVersion, convertVendor, e.Component, convertProductVersion, e.Type, e.Type, strconv.Itoa(eventSeverity(e)),
+	} {
+		b.WriteString(escapeHeader(h))
+		b.WriteByte('|')
+	}
+
+	ext := []string{
+		"rt", strconv.FormatInt(e.LoggedAt.UnixMilli(), 10),
+		"externalId", e.Metadata.AuditID,
+		"outcome", e.Outcome,
+		"src", sourceIP(e),
+		"suser", e.Subjects["user"],
+		"request", e.Target["path"],
+	}
+	for i, v := range []string{f.sourceType, f.sourceValue, f.subjects, f.target, f.data} {
+		key := "cs" + strconv.Itoa(i+1)
+		if v != "" {
+			ext = append(ext, key+"Label", cefCustomStrings[i], key, v)
+		}
+	}
+
+	writeAttributes(&b, ext, " ", escapeCEFValue)
+
+	return []byte(b.String()), nil
+}
+
+// decodeCEF parses an event in ArcSight's Common Event Format. Anything
+// before "CEF:", like a syslog header, is ignored.
+func decodeCEF(line []byte) (*auditevent.AuditEvent, error) {
+	s := string(line)
+	i := strings.Index(s, cefVersion+"|")
+	if i < 0 {
+		return nil, fmt.Errorf("%w: not a CEF event", ErrInvalidConvertInput)
+	}
+
+	const headerFields = 7
+	header, ext := splitHeader(s[i:], headerFields)
+	if header == nil {
+		return nil, fmt.Errorf("%w: truncated CEF header", ErrInvalidConvertInput)
+	}
+
+	attrs := parseCEFExtension(ext)
+
+	e := &auditevent.AuditEvent{
+		Metadata:  auditevent.EventMetadata{AuditID: attrs["externalId"]},
+		Type:      header[5],
+		Outcome:   attrs["outcome"],
+		Component: header[2],
+	}
+
+	if rt := attrs["rt"]; rt != "" {
+		ms, err := strconv.ParseInt(rt, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%w: rt: %w", ErrInvalidConvertInput, err)
+		}
+		e.LoggedAt = time.UnixMilli(ms).UTC()
+	}
+
+	// The custom strings are found by their labels, so events that number
+	// them differently are read as well
+	custom := map[string]string{}
+	for n := 1; n <= len(cefCustomStrings); n++ {
+		key := "cs" + strconv.Itoa(n)
+		if label, ok := attrs[key+"Label"]; ok {
+			custom[label] = attrs[key]
+		}
+	}
+
+	f := &lossyFields{
+		sourceType:  custom["sourceType"],
+		sourceValue: custom["sourceValue"],
+		subjects:    custom["subjects"],
+		target:      custom["target"],
+		data:        custom["data"],
+	}
+	if err := f.apply(e, attrs["src"], attrs["suser"], attrs["request"]); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// parseCEFExtension parses the key=value pairs of the extension of a CEF
+// event. Values may have spaces, so a value ends where the next key starts.
+func parseCEFExtension(ext string) map[string]string {
+	attrs := map[string]string{}
+	keys := cefKey.FindAllStringSubmatchIndex(ext, -1)
+	for i, loc := range keys {
+		end := len(ext)
+		if i+1 < len(keys) {
+			end = keys[i+1][0]
+		}
+		attrs[ext[loc[2]:loc[3]]] = unescapeCEFValue(strings.TrimRight(ext[loc[1]:end], " "))
+	}
+
+	return attrs
+}
+
+// encodeLEEF formats an event in IBM QRadar's Log Event Extended Format.
+func encodeLEEF(e *auditevent.AuditEvent) ([]byte, error) {
+	f := newLossyFields(e)
+
+	var b strings.Builder
+	for _, h := range []string{
+		leefVersion, convertVendor, e.Component, convertProductVersion, e.Type, leefDelimiter,
+	} {
+		b.WriteString(escapeHeader(h))
+		b.WriteByte('|')
+	}
+
+	writeAttributes(&b, []string{
+		"devTime", e.LoggedAt.UTC().Format(leefTimeLayout),
+		"devTimeFormat", leefTimeFormat,
+		"sev", strconv.Itoa(eventSeverity(e)),
+		"auditId", e.Metadata.AuditID,
+		"outcome", e.Outcome,
+		"src", sourceIP(e),
+		"sourceType", f.sourceType,
+		"sourceValue", f.sourceValue,
+		"usrName", e.Subjects["user"],
+		"subjects", f.subjects,
+		"resource", e.Target["path"],
+		"target", f.target,
+		"data", f.data,
+	}, "\t", escapeLEEFValue)
+
+	return []byte(b.String()), nil
+}
+
+// decodeLEEF parses an event in IBM QRadar's Log Event Extended Format 2.0.
+// Anything before "LEEF:", like a syslog header, is ignored.
+func decodeLEEF(line []byte) (*auditevent.AuditEvent, error) {
+	s := string(line)
+	i := strings.Index(s, leefVersion+"|")
+	if i < 0 {
+		return nil, fmt.Errorf("%w: not a LEEF 2.0 event", ErrInvalidConvertInput)
+	}
+
+	const headerFields = 6
+	header, rest := splitHeader(s[i:], headerFields)
+	if header == nil {
+		return nil, fmt.Errorf("%w: truncated LEEF header", ErrInvalidConvertInput)
+	}
+
+	delim, err := parseLEEFDelimiter(header[5])
+	if err != nil {
+		return nil, err
+	}
+
+	attrs := map[string]string{}
+	for _, attr := range strings.Split(rest, delim) {
+		if k, v, ok := strings.Cut(attr, "="); ok {
+			attrs[k] = unescapeLEEFValue(v)
+		}
+	}
+
+	e := &auditevent.AuditEvent{
+		Metadata:  auditevent.EventMetadata{AuditID: attrs["auditId"]},
+		Type:      header[4],
+		Outcome:   attrs["outcome"],
+		Component: header[2],
+	}
+
+	if t := attrs["devTime"]; t != "" {
+		if format := attrs["devTimeFormat"]; format != "" && format != leefTimeFormat {
+			return nil, fmt.Errorf("%w: unsupported devTimeFormat %q", ErrInvalidConvertInput, format)
+		}
+
+		loggedAt, err := time.Parse(leefTimeLayout, t)
+		if err != nil {
+			return nil, fmt.Errorf("%w: devTime: %w", ErrInvalidConvertInput, err)
+		}
+		e.LoggedAt = loggedAt.UTC()
+	}
+
+	f := &lossyFields{
+		sourceType:  attrs["sourceType"],
+		sourceValue: attrs["sourceValue"],
+		subjects:    attrs["subjects"],
+		target:      attrs["target"],
+		data:        attrs["data"],
+	}
+	if err := f.apply(e, attrs["src"], attrs["usrName"], attrs["resource"]); err != nil {
+		return nil, err
+	}
+
+	return e, nil
+}
+
+// parseLEEFDelimiter returns the attribute delimiter of a LEEF 2.0 header,
+// which is either a character or its hexadecimal code, like "^" or "x09".
+func parseLEEFDelimiter(h string) (string, error) {
+	switch {
+	case h == "":
+		return "\t", nil
+	case len(h) > 1 && (h[0] == 'x' || h[0] == 'X'):
+		c, err := strconv.ParseUint(h[1:], 16, 8)
+		if err != nil {
+			return "", fmt.Errorf("%w: LEEF delimiter %q", ErrInvalidConvertInput, h)
+		}
+		return string(rune(c)), nil
+	default:
+		return h, nil
+	}
+}
+
+// splitHeader splits the n fields of a CEF or LEEF header, which end with
+// an unescaped '|', from the rest of the event. It returns nil if the
+// header is truncated.
+func splitHeader(s string, n int) ([]string, string) {
+	fields := make([]string, 0, n)
+	var field strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == '\\' && i+1 < len(s):
+			i++
+			field.WriteByte(s[i])
+		case c == '|':
+			fields = append(fields, field.String())
+			field.Reset()
+			if len(fields) == n {
+				return fields, s[i+1:]
+			}
+		default:
+			field.WriteByte(c)
+		}
+	}
+
+	return nil, ""
+}
+
+// writeAttributes writes the key and value pairs of attrs that have a
+// value, separated by sep.
+func writeAttributes(b *strings.Builder, attrs []string, sep string, escape func(string) string) {
+	first := true
+	for i := 0; i+1 < len(attrs); i += 2 {
+		if attrs[i+1] == "" {
+			continue
+		}
+		if !first {
+			b.WriteString(sep)
+		}
+		first = false
+		b.WriteString(attrs[i] + "=" + escape(attrs[i+1]))
+	}
+}
+
+func escapeHeader(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "|", `\|`, "\n", " ", "\r", " ").Replace(s)
+}
+
+func escapeCEFValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "=", `\=`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
+
+func unescapeCEFValue(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\=`, "=", `\n`, "\n", `\r`, "\r").Replace(s)
+}
+
+func escapeLEEFValue(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "\t", `\t`, "\n", `\n`, "\r", `\r`).Replace(s)
+}
+
+func unescapeLEEFValue(s string) string {
+	return strings.NewReplacer(`\\`, `\`, `\t`, "\t", `\n`, "\n", `\r`, "\r").Replace(s)
+}
@@ -0,0 +1,70 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDecodeForeignCEF(t *testing.T) {
+	t.Parallel()
+
+	// Events written by other tools only have the standard fields, and
+	// may come with a syslog header
+	e, err := decodeCEF([]byte(`<134>Mar  1 12:00:00 host CEF:0|Acme|Gateway|2.1|login|User \| login|5|` +
+		`rt=1772366400000 externalId=42 src=192.0.2.1 suser=jane doe request=/login msg=a\=b cs1Label=other cs1=x`))
+	require.NoError(t, err)
+	require.Equal(t, "42", e.Metadata.AuditID)
+	require.Equal(t, "User | login", e.Type)
+	require.Equal(t, "Gateway", e.Component)
+	require.Equal(t, time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC), e.LoggedAt)
+	require.Equal(t, "IP", e.Source.Type)
+	require.Equal(t, "192.0.2.1", e.Source.Value)
+	require.Equal(t, map[string]string{"user": "jane doe"}, e.Subjects)
+	require.Equal(t, map[string]string{"path": "/login"}, e.Target)
+
+	require.Equal(t, map[string]string{"a": "b c", "d": "=e", "f": ""},
+		parseCEFExtension(`a=b c d=\=e f=`))
+
+	_, err = decodeCEF([]byte(`CEF:0|Acme|Gateway|2.1|login`))
+	require.ErrorIs(t, err, ErrInvalidConvertInput)
+
+	_, err = decodeCEF([]byte(`CEF:0|Acme|Gateway|2.1|login|login|5|rt=yesterday`))
+	require.ErrorIs(t, err, ErrInvalidConvertInput)
+}
+
+func TestDecodeForeignLEEF(t *testing.T) {
+	t.Parallel()
+
+	e, err := decodeLEEF([]byte("LEEF:2.0|Acme|Gateway|2.1|login|^|devTime=2026-03-01T14:00:00.250+02:00^" +
+		"devTimeFormat=yyyy-MM-dd'T'HH:mm:ss.SSSXXX^usrName=jane^src=192.0.2.1^resource=/login^outcome=failed"))
+	require.NoError(t, err)
+	require.Equal(t, "login", e.Type)
+	require.Equal(t, "failed", e.Outcome)
+	require.Equal(t, time.Date(2026, 3, 1, 12, 0, 0, 250000000, time.UTC), e.LoggedAt)
+	require.Equal(t, "192.0.2.1", e.Source.Value)
+	require.Equal(t, map[string]string{"user": "jane"}, e.Subjects)
+	require.Equal(t, map[string]string{"path": "/login"}, e.Target)
+
+	_, err = decodeLEEF([]byte("LEEF:2.0|Acme|Gateway|2.1|login|x09|devTime=Mar 01 2026\tdevTimeFormat=MMM dd yyyy"))
+	require.ErrorIs(t, err, ErrInvalidConvertInput)
+
+	_, err = decodeLEEF([]byte("LEEF:1.0|Acme|Gateway|2.1|login|devTime=2026-03-01"))
+	require.ErrorIs(t, err, ErrInvalidConvertInput)
+}
@@ -0,0 +1,113 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+const (
+	cloudEventsVersion = "1.0"
+	// cloudEventsTypePrefix is prepended to the types of audit events to
+	// make them CloudEvents types, which are reverse DNS names.
+	cloudEventsTypePrefix = "com.github.metal-toolbox.auditevent."
+	// cloudEventsDefaultSource is the source of events with no component,
+	// as CloudEvents require one.
+	cloudEventsDefaultSource = "auditevent"
+)
+
+// cloudEvent is a CloudEvent in the structured JSON mode. Its data is the
+// whole audit event, so it converts back to the same event.
+//
+//nolint:tagliatelle // These are the names of the CloudEvents specification
+type cloudEvent struct {
+	SpecVersion     string                 `json:"specversion"`
+	ID              string                 `json:"id"`
+	Source          string                 `json:"source"`
+	Type            string                 `json:"type"`
+	Time            string                 `json:"time,omitempty"`
+	DataContentType string                 `json:"datacontenttype"`
+	Subject         string                 `json:"subject,omitempty"`
+	Data            *auditevent.AuditEvent `json:"data"`
+}
+
+// encodeCloudEvent formats an event as a CloudEvent.
+func encodeCloudEvent(e *auditevent.AuditEvent) ([]byte, error) {
+	ce := &cloudEvent{
+		SpecVersion:     cloudEventsVersion,
+		ID:              e.Metadata.AuditID,
+		Source:          e.Component,
+		Type:            cloudEventsTypePrefix + e.Type,
+		DataContentType: "application/json",
+		Subject:         e.Target["path"],
+		Data:            e,
+	}
+
+	if ce.Source == "" {
+		ce.Source = cloudEventsDefaultSource
+	}
+
+	if !e.LoggedAt.IsZero() {
+		ce.Time = formatTime(e.LoggedAt)
+	}
+
+	return json.Marshal(ce) //nolint:wrapcheck // It's wrapped by the caller
+}
+
+// decodeCloudEvent parses a CloudEvent whose data is an audit event. The
+// attributes of the CloudEvent fill the fields the data doesn't have.
+func decodeCloudEvent(line []byte) (*auditevent.AuditEvent, error) {
+	ce := &cloudEvent{}
+	if err := json.Unmarshal(line, ce); err != nil {
+		return nil, err //nolint:wrapcheck // It's wrapped by the decoder
+	}
+
+	if ce.SpecVersion != cloudEventsVersion {
+		return nil, fmt.Errorf("%w: unsupported CloudEvents version %q", ErrInvalidConvertInput, ce.SpecVersion)
+	}
+
+	e := ce.Data
+	if e == nil {
+		e = &auditevent.AuditEvent{}
+	}
+
+	if e.Metadata.AuditID == "" {
+		e.Metadata.AuditID = ce.ID
+	}
+
+	if e.Type == "" {
+		e.Type = strings.TrimPrefix(ce.Type, cloudEventsTypePrefix)
+	}
+
+	if e.Component == "" && ce.Source != cloudEventsDefaultSource {
+		e.Component = ce.Source
+	}
+
+	if e.LoggedAt.IsZero() && ce.Time != "" {
+		loggedAt, err := time.Parse(time.RFC3339Nano, ce.Time)
+		if err != nil {
+			return nil, fmt.Errorf("%w: time: %w", ErrInvalidConvertInput, err)
+		}
+		e.LoggedAt = loggedAt
+	}
+
+	return e, nil
+}
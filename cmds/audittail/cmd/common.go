@@ -16,6 +16,8 @@ limitations under the License.
 package cmd
 
 import (
+	"crypto/tls"
+	"crypto/x509"
 	"errors"
 	"fmt"
 	"os"
@@ -35,20 +37,80 @@ func validateCommonArgs(cmd *cobra.Command, _ []string) error {
 		return ferr
 	}
 
-	if f == "" {
+	// Events received on a socket aren't read from a file
+	if f == "" && !cmd.Flags().Changed("listen") {
 		return ErrFileRequired
 	}
 
 	return nil
 }
 
-func createNamedPipe(file string) error {
-	if err := syscall.Mkfifo(file, ownerGroupOwnership); err != nil {
+// pipeOwnership is the mode and the owner of a named pipe. A uid or gid
+// of -1 keeps the one of the process.
+type pipeOwnership struct {
+	mode os.FileMode
+	uid  int
+	gid  int
+}
+
+var defaultPipeOwnership = pipeOwnership{mode: ownerGroupOwnership, uid: -1, gid: -1}
+
+func createNamedPipe(file string, own pipeOwnership) error {
+	if err := syscall.Mkfifo(file, uint32(own.mode.Perm())); err != nil {
 		// Don't fail if the file already exists.
 		if errors.Is(err, os.ErrExist) {
 			return nil
 		}
 		return fmt.Errorf("creating named pipe: %w", err)
 	}
+
+	return setPipeOwnership(file, own)
+}
+
+// setPipeOwnership sets the mode and the owner of a named pipe. The mode
+// is set even for new pipes, as Mkfifo masks it with the umask.
+func setPipeOwnership(file string, own pipeOwnership) error {
+	if err := os.Chmod(file, own.mode.Perm()); err != nil {
+		return fmt.Errorf("setting the mode of the named pipe: %w", err)
+	}
+
+	if own.uid != -1 || own.gid != -1 {
+		if err := os.Chown(file, own.uid, own.gid); err != nil {
+			return fmt.Errorf("setting the owner of the named pipe: %w", err)
+		}
+	}
+
 	return nil
 }
+
+// newClientTLSConfig returns the TLS configuration to verify a server
+// with the given CA, or the system's if it's empty. If a certificate
+// and key are given, they're used as the client certificate.
+func newClientTLSConfig(caFile, certFile, keyFile string) (*tls.Config, error) {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+	}
+
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading CA: %w", err)
+		}
+
+		cfg.RootCAs = x509.NewCertPool()
+		if !cfg.RootCAs.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: %s", ErrInvalidCA, caFile)
+		}
+	}
+
+	if certFile != "" || keyFile != "" {
+		cert, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("loading client certificate: %w", err)
+		}
+
+		cfg.Certificates = []tls.Certificate{cert}
+	}
+
+	return cfg, nil
+}
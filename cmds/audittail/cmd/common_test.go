@@ -16,7 +16,19 @@ limitations under the License.
 package cmd
 
 import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/stretchr/testify/require"
@@ -76,3 +88,69 @@ func Test_validateCommonArgsFailsWithoutArguments(t *testing.T) {
 	err := validateCommonArgs(c, []string{})
 	require.Error(t, err)
 }
+
+func TestNewClientTLSConfig(t *testing.T) {
+	t.Parallel()
+
+	cert, certFile, keyFile := newTestCertificate(t)
+
+	cfg, err := newClientTLSConfig(certFile, certFile, keyFile)
+	require.NoError(t, err)
+	require.NotNil(t, cfg.RootCAs, "the CA should be used")
+	require.Equal(t, cert.Certificate, cfg.Certificates[0].Certificate, "the client certificate should be used")
+
+	cfg, err = newClientTLSConfig("", "", "")
+	require.NoError(t, err)
+	require.Nil(t, cfg.RootCAs, "the system's CAs should be used")
+	require.Empty(t, cfg.Certificates)
+
+	_, err = newClientTLSConfig("", certFile, "")
+	require.ErrorContains(t, err, "loading client certificate")
+}
+
+func TestNewClientTLSConfigInvalidCA(t *testing.T) {
+	t.Parallel()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, []byte("not a certificate"), 0o600))
+
+	_, err := newClientTLSConfig(caFile, "", "")
+	require.ErrorIs(t, err, ErrInvalidCA)
+}
+
+// newTestCertificate returns a self-signed certificate for 127.0.0.1, which
+// may be used by both servers and clients, and the paths of its PEM
+// encoding and of its key's.
+func newTestCertificate(t *testing.T) (tls.Certificate, string, string) {
+	t.Helper()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	tmpl := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "syslog"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth, x509.ExtKeyUsageClientAuth},
+		IsCA:         true,
+
+		BasicConstraintsValid: true,
+	}
+
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	certFile := filepath.Join(dir, "cert.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	keyFile := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}, certFile, keyFile
+}
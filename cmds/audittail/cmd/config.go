@@ -0,0 +1,214 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+var sinkNamePattern = regexp.MustCompile(`^[A-Za-z0-9._-]+$`)
+
+// routingConfig is the configuration file of audittail. It names the
+// sinks events are sent to, and the routes that pick them.
+type routingConfig struct {
+	Sinks map[string]sinkConfig `yaml:"sinks"`
+	// Routes are tried in order, and an event is sent to the sinks
+	// of the first one that matches it
+	Routes []routeConfig `yaml:"routes"`
+	// Default are the sinks of the events that match no route
+	Default []string `yaml:"default"`
+}
+
+// sinkConfig configures a sink. Exactly one of its fields is set.
+type sinkConfig struct {
+	Stdout  *stdoutSinkConfig  `yaml:"stdout"`
+	Syslog  *syslogSinkConfig  `yaml:"syslog"`
+	Webhook *webhookSinkConfig `yaml:"webhook"`
+}
+
+// stdoutSinkConfig has no settings, it's only there to pick stdout.
+type stdoutSinkConfig struct{}
+
+type syslogSinkConfig struct {
+	URL              string `yaml:"url"`
+	StructuredDataID string `yaml:"structuredDataId"`
+	CA               string `yaml:"ca"`
+	Cert             string `yaml:"cert"`
+	Key              string `yaml:"key"`
+}
+
+type webhookSinkConfig struct {
+	URL           string        `yaml:"url"`
+	BatchSize     int           `yaml:"batchSize"`
+	FlushInterval time.Duration `yaml:"flushInterval"`
+	Gzip          bool          `yaml:"gzip"`
+	TokenFile     string        `yaml:"tokenFile"`
+	CA            string        `yaml:"ca"`
+	Cert          string        `yaml:"cert"`
+	Key           string        `yaml:"key"`
+}
+
+// routeConfig sends the events that match all of its conditions to its
+// sinks. A condition that isn't set matches every event.
+type routeConfig struct {
+	Name  string      `yaml:"name"`
+	Match matchConfig `yaml:"match"`
+	Sinks []string    `yaml:"sinks"`
+}
+
+// matchConfig holds the conditions of a route. Values are patterns,
+// where '*' matches any sequence of characters. A list matches if any
+// of its patterns does, and a map if every key it has is in the event
+// with a value that matches its pattern.
+type matchConfig struct {
+	Type      []string          `yaml:"type"`
+	Outcome   []string          `yaml:"outcome"`
+	Component []string          `yaml:"component"`
+	Subjects  map[string]string `yaml:"subjects"`
+	Target    map[string]string `yaml:"target"`
+}
+
+// loadRoutingConfig reads and validates the configuration file.
+func loadRoutingConfig(path string) (*routingConfig, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("opening config: %w", err)
+	}
+	defer f.Close()
+
+	return decodeRoutingConfig(f)
+}
+
+func decodeRoutingConfig(r io.Reader) (*routingConfig, error) {
+	cfg := &routingConfig{}
+
+	dec := yaml.NewDecoder(r)
+	dec.KnownFields(true)
+	if err := dec.Decode(cfg); err != nil && !errors.Is(err, io.EOF) {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidConfig, err)
+	}
+
+	if err := cfg.validate(); err != nil {
+		return nil, err
+	}
+	cfg.setDefaults()
+
+	return cfg, nil
+}
+
+// setDefaults sets the settings of the sinks that aren't in the file to
+// the defaults of their flags.
+func (cfg *routingConfig) setDefaults() {
+	for _, sink := range cfg.Sinks {
+		if sink.Syslog != nil && sink.Syslog.StructuredDataID == "" {
+			sink.Syslog.StructuredDataID = defaultSyslogSDID
+		}
+
+		if sink.Webhook != nil {
+			if sink.Webhook.BatchSize == 0 {
+				sink.Webhook.BatchSize = defaultWebhookBatchSize
+			}
+			if sink.Webhook.FlushInterval == 0 {
+				sink.Webhook.FlushInterval = defaultWebhookFlushInterval
+			}
+		}
+	}
+}
+
+func (cfg *routingConfig) validate() error {
+	if len(cfg.Sinks) == 0 {
+		return fmt.Errorf("%w: no sinks", ErrInvalidConfig)
+	}
+
+	for name, sink := range cfg.Sinks {
+		// Sinks are spooled in a directory named after them
+		if !sinkNamePattern.MatchString(name) || name == "." || name == ".." {
+			return fmt.Errorf("%w: sink %q must only have letters, digits, '.', '_' or '-'", ErrInvalidConfig, name)
+		}
+
+		if sink.kinds() != 1 {
+			return fmt.Errorf("%w: sink %q must be exactly one of 'stdout', 'syslog' or 'webhook'",
+				ErrInvalidConfig, name)
+		}
+	}
+
+	if len(cfg.Default) == 0 {
+		return fmt.Errorf("%w: no default sinks", ErrInvalidConfig)
+	}
+
+	if err := cfg.checkSinks("the default route", cfg.Default); err != nil {
+		return err
+	}
+
+	for i, r := range cfg.Routes {
+		name := r.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+		}
+
+		if len(r.Sinks) == 0 {
+			return fmt.Errorf("%w: route %s has no sinks", ErrInvalidConfig, name)
+		}
+
+		if err := cfg.checkSinks("route "+name, r.Sinks); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// checkSinks checks that every sink of a route is defined.
+func (cfg *routingConfig) checkSinks(route string, sinks []string) error {
+	for _, s := range sinks {
+		if _, ok := cfg.Sinks[s]; !ok {
+			return fmt.Errorf("%w: %s uses the unknown sink %q", ErrInvalidConfig, route, s)
+		}
+	}
+
+	return nil
+}
+
+// kinds returns how many kinds of sinks are set.
+func (s sinkConfig) kinds() int {
+	n := 0
+	for _, set := range []bool{s.Stdout != nil, s.Syslog != nil, s.Webhook != nil} {
+		if set {
+			n++
+		}
+	}
+
+	return n
+}
+
+// compilePattern turns a pattern, where '*' matches any sequence of
+// characters, into a regular expression.
+func compilePattern(pattern string) *regexp.Regexp {
+	parts := strings.Split(pattern, "*")
+	for i, p := range parts {
+		parts[i] = regexp.QuoteMeta(p)
+	}
+
+	return regexp.MustCompile("^" + strings.Join(parts, ".*") + "$")
+}
@@ -0,0 +1,188 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testRoutingConfig = `
+sinks:
+  siem:
+    syslog:
+      url: tls://siem.example.com:6514
+  collector:
+    webhook:
+      url: https://collector.example.com/events
+      flushInterval: 5s
+  stdout:
+    stdout: {}
+routes:
+  - name: failures
+    match:
+      outcome: [failed, denied]
+    sinks: [siem, collector]
+  - match:
+      component: [billing-*]
+      subjects:
+        user: "*@example.com"
+    sinks: [collector]
+default: [stdout]
+`
+
+func TestLoadRoutingConfig(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audittail.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(testRoutingConfig), ownerGroupOwnership))
+
+	cfg, err := loadRoutingConfig(path)
+	require.NoError(t, err)
+
+	require.Len(t, cfg.Sinks, 3)
+	require.Equal(t, &syslogSinkConfig{
+		URL:              "tls://siem.example.com:6514",
+		StructuredDataID: defaultSyslogSDID,
+	}, cfg.Sinks["siem"].Syslog, "unset settings should have the defaults of their flags")
+	require.Equal(t, &webhookSinkConfig{
+		URL:           "https://collector.example.com/events",
+		BatchSize:     defaultWebhookBatchSize,
+		FlushInterval: 5 * time.Second,
+	}, cfg.Sinks["collector"].Webhook)
+	require.NotNil(t, cfg.Sinks["stdout"].Stdout)
+
+	require.Equal(t, []routeConfig{
+		{
+			Name:  "failures",
+			Match: matchConfig{Outcome: []string{"failed", "denied"}},
+			Sinks: []string{"siem", "collector"},
+		},
+		{
+			Match: matchConfig{
+				Component: []string{"billing-*"},
+				Subjects:  map[string]string{"user": "*@example.com"},
+			},
+			Sinks: []string{"collector"},
+		},
+	}, cfg.Routes)
+	require.Equal(t, []string{"stdout"}, cfg.Default)
+
+	_, err = loadRoutingConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestInvalidRoutingConfig(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name   string
+		config string
+		errMsg string
+	}{
+		{
+			name:   "malformed",
+			config: "sinks: [",
+			errMsg: "yaml",
+		},
+		{
+			name:   "unknown field",
+			config: "sinks: {out: {stdout: {}}}\ndefault: [out]\nfilters: []",
+			errMsg: "field filters not found",
+		},
+		{
+			name:   "no sinks",
+			config: "default: [out]",
+			errMsg: "no sinks",
+		},
+		{
+			name:   "sink without a kind",
+			config: "sinks: {out: {}}\ndefault: [out]",
+			errMsg: `sink "out" must be exactly one of`,
+		},
+		{
+			name:   "sink with two kinds",
+			config: "sinks: {out: {stdout: {}, syslog: {url: 'udp://localhost:514'}}}\ndefault: [out]",
+			errMsg: `sink "out" must be exactly one of`,
+		},
+		{
+			name:   "sink name that isn't a directory name",
+			config: "sinks: {'../out': {stdout: {}}}\ndefault: ['../out']",
+			errMsg: `sink "../out" must only have`,
+		},
+		{
+			name:   "no default",
+			config: "sinks: {out: {stdout: {}}}",
+			errMsg: "no default sinks",
+		},
+		{
+			name:   "unknown default sink",
+			config: "sinks: {out: {stdout: {}}}\ndefault: [siem]",
+			errMsg: `the default route uses the unknown sink "siem"`,
+		},
+		{
+			name:   "route without sinks",
+			config: "sinks: {out: {stdout: {}}}\ndefault: [out]\nroutes: [{match: {type: [foo]}}]",
+			errMsg: "route #1 has no sinks",
+		},
+		{
+			name:   "unknown route sink",
+			config: "sinks: {out: {stdout: {}}}\ndefault: [out]\nroutes: [{name: foo, sinks: [siem]}]",
+			errMsg: `route foo uses the unknown sink "siem"`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := decodeRoutingConfig(strings.NewReader(tt.config))
+			require.ErrorIs(t, err, ErrInvalidConfig)
+			require.ErrorContains(t, err, tt.errMsg)
+		})
+	}
+}
+
+func TestCompilePattern(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		pattern string
+		matches []string
+		misses  []string
+	}{
+		{pattern: "foo", matches: []string{"foo"}, misses: []string{"foobar", "barfoo", ""}},
+		{pattern: "foo*", matches: []string{"foo", "foobar"}, misses: []string{"barfoo"}},
+		{pattern: "*@example.com", matches: []string{"jane@example.com"}, misses: []string{"jane@example.org"}},
+		{pattern: "a.b", matches: []string{"a.b"}, misses: []string{"axb"}},
+		{pattern: "*", matches: []string{"", "anything"}},
+	}
+
+	for _, tt := range tests {
+		re := compilePattern(tt.pattern)
+		for _, v := range tt.matches {
+			require.True(t, re.MatchString(v), "%q should match %q", tt.pattern, v)
+		}
+		for _, v := range tt.misses {
+			require.False(t, re.MatchString(v), "%q shouldn't match %q", tt.pattern, v)
+		}
+	}
+}
@@ -0,0 +1,430 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+// These are the formats convert reads and writes.
+const (
+	formatNative      = "native"
+	formatCEF         = "cef"
+	formatLEEF        = "leef"
+	formatOCSF        = "ocsf"
+	formatCloudEvents = "cloudevents"
+	formatCSV         = "csv"
+)
+
+// convertVendor is the vendor of the events, in the formats that have one.
+const convertVendor = "metal-toolbox"
+
+// errMalformedRecord is wrapped by the errors of records that can't be
+// converted, which are skipped.
+var errMalformedRecord = errors.New("malformed record")
+
+// eventDecoder reads audit events in a format.
+type eventDecoder interface {
+	// decode returns the next event, or io.EOF once there's none.
+	// Errors of records that can't be converted wrap errMalformedRecord.
+	decode() (*auditevent.AuditEvent, error)
+}
+
+// eventEncoder writes audit events in a format.
+type eventEncoder interface {
+	encode(e *auditevent.AuditEvent) error
+	flush() error
+}
+
+// convertFormat is a format convert reads and writes.
+type convertFormat struct {
+	newDecoder func(r io.Reader) eventDecoder
+	newEncoder func(w io.Writer) eventEncoder
+}
+
+var convertFormats = map[string]convertFormat{
+	formatNative: {
+		newDecoder: func(r io.Reader) eventDecoder { return newLineDecoder(r, decodeNative) },
+		newEncoder: func(w io.Writer) eventEncoder { return newLineEncoder(w, encodeNative) },
+	},
+	formatCEF: {
+		newDecoder: func(r io.Reader) eventDecoder { return newLineDecoder(r, decodeCEF) },
+		newEncoder: func(w io.Writer) eventEncoder { return newLineEncoder(w, encodeCEF) },
+	},
+	formatLEEF: {
+		newDecoder: func(r io.Reader) eventDecoder { return newLineDecoder(r, decodeLEEF) },
+		newEncoder: func(w io.Writer) eventEncoder { return newLineEncoder(w, encodeLEEF) },
+	},
+	formatOCSF: {
+		newDecoder: func(r io.Reader) eventDecoder { return newLineDecoder(r, decodeOCSF) },
+		newEncoder: func(w io.Writer) eventEncoder { return newLineEncoder(w, encodeOCSF) },
+	},
+	formatCloudEvents: {
+		newDecoder: func(r io.Reader) eventDecoder { return newLineDecoder(r, decodeCloudEvent) },
+		newEncoder: func(w io.Writer) eventEncoder { return newLineEncoder(w, encodeCloudEvent) },
+	},
+	formatCSV: {
+		newDecoder: newCSVDecoder,
+		newEncoder: newCSVEncoder,
+	},
+}
+
+// convertCmd represents the convert command.
+var convertCmd = NewConvertCommand()
+
+func NewConvertCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "convert [file...]",
+		Short: "Convert audit logs between formats",
+		Long: `Convert audit logs between formats.
+
+This reads audit logs, from the given files or stdin, and writes their events
+to stdout in another format. Logs compressed with gzip are decompressed.
+The formats are:
+
+  native       the JSON lines written by auditevent
+  cef          ArcSight Common Event Format
+  leef         IBM QRadar Log Event Extended Format 2.0
+  ocsf         OCSF 1.1.0 API Activity events, as JSON lines
+  cloudevents  CloudEvents 1.0 in structured mode, as JSON lines
+  csv          CSV with a header, with maps as JSON
+
+Every format can be converted back to the native one. CEF and LEEF lose some
+fields on the way, the other formats keep every field, so hash chains and
+signatures still verify.`,
+		Args: cobra.ArbitraryArgs,
+		RunE: convertMain,
+	}
+
+	formats := strings.Join(slices.Sorted(maps.Keys(convertFormats)), ", ")
+	c.Flags().String("from", formatNative, "format to read: "+formats)
+	c.Flags().String("to", formatNative, "format to write: "+formats)
+
+	return c
+}
+
+//nolint:gochecknoinits // this is a practice recommended by cobra
+func init() {
+	rootCmd.AddCommand(convertCmd)
+}
+
+func convertMain(cmd *cobra.Command, args []string) error {
+	//nolint:errcheck // This is already verified by cobra
+	from, _ := cmd.Flags().GetString("from")
+	//nolint:errcheck // This is already verified by cobra
+	to, _ := cmd.Flags().GetString("to")
+
+	in, ok := convertFormats[from]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrInvalidConvertFormat, from)
+	}
+
+	out, ok := convertFormats[to]
+	if !ok {
+		return fmt.Errorf("%w: %q", ErrInvalidConvertFormat, to)
+	}
+
+	// Failing to read the audit logs isn't a usage error
+	cmd.SilenceUsage = true
+
+	enc := out.newEncoder(cmd.OutOrStdout())
+	skipped := 0
+	for _, name := range auditLogNames(args) {
+		l, err := openAuditLog(cmd, name)
+		if err != nil {
+			return err
+		}
+
+		n, err := convertEvents(in.newDecoder(l), enc)
+		l.Close()
+		skipped += n
+		if err != nil {
+			return fmt.Errorf("converting audit log %s: %w", name, err)
+		}
+	}
+
+	if err := enc.flush(); err != nil {
+		return fmt.Errorf("writing events: %w", err)
+	}
+
+	if skipped > 0 {
+		fmt.Fprintf(cmd.ErrOrStderr(), "audittail: skipped %d records that couldn't be converted\n", skipped)
+	}
+
+	return nil
+}
+
+// convertEvents writes every event of the decoder to the encoder. It
+// returns the number of records that were skipped.
+func convertEvents(dec eventDecoder, enc eventEncoder) (int, error) {
+	skipped := 0
+	for {
+		e, err := dec.decode()
+		switch {
+		case errors.Is(err, io.EOF):
+			return skipped, nil
+		case errors.Is(err, errMalformedRecord):
+			skipped++
+			continue
+		case err != nil:
+			return skipped, err
+		}
+
+		if err := enc.encode(e); err != nil {
+			return skipped, fmt.Errorf("writing events: %w", err)
+		}
+	}
+}
+
+// lineDecoder reads formats that have a record per line.
+type lineDecoder struct {
+	br    *bufio.Reader
+	parse func(line []byte) (*auditevent.AuditEvent, error)
+}
+
+func newLineDecoder(r io.Reader, parse func(line []byte) (*auditevent.AuditEvent, error)) *lineDecoder {
+	return &lineDecoder{br: bufio.NewReader(r), parse: parse}
+}
+
+func (d *lineDecoder) decode() (*auditevent.AuditEvent, error) {
+	for {
+		raw, err := d.br.ReadBytes('\n')
+		if line := bytes.TrimSpace(raw); len(line) > 0 {
+			e, perr := d.parse(line)
+			if perr != nil {
+				return nil, fmt.Errorf("%w: %w", errMalformedRecord, perr)
+			}
+			return e, nil
+		}
+
+		if err != nil {
+			return nil, err //nolint:wrapcheck // io.EOF must not be wrapped
+		}
+	}
+}
+
+// lineEncoder writes formats that have a record per line.
+type lineEncoder struct {
+	w      *bufio.Writer
+	format func(e *auditevent.AuditEvent) ([]byte, error)
+}
+
+func newLineEncoder(w io.Writer, format func(e *auditevent.AuditEvent) ([]byte, error)) *lineEncoder {
+	return &lineEncoder{w: bufio.NewWriter(w), format: format}
+}
+
+func (e *lineEncoder) encode(ev *auditevent.AuditEvent) error {
+	line, err := e.format(ev)
+	if err != nil {
+		return err
+	}
+
+	return writeLine(e.w, line)
+}
+
+func (e *lineEncoder) flush() error {
+	return e.w.Flush() //nolint:wrapcheck // It's wrapped by the caller
+}
+
+func decodeNative(line []byte) (*auditevent.AuditEvent, error) {
+	e := &auditevent.AuditEvent{}
+	if err := json.Unmarshal(line, e); err != nil {
+		return nil, err //nolint:wrapcheck // It's wrapped by the decoder
+	}
+
+	return e, nil
+}
+
+func encodeNative(e *auditevent.AuditEvent) ([]byte, error) {
+	return json.Marshal(e) //nolint:wrapcheck // It's wrapped by the caller
+}
+
+// csvColumns are the columns of the CSV format. Maps, data, and the chain
+// and signature of events are JSON.
+var csvColumns = []string{
+	"auditId", "loggedAt", "type", "outcome", "component",
+	"source.type", "source.value", "source.extra",
+	"subjects", "target", "data",
+	"metadata.extra", "metadata.chain", "metadata.signature",
+}
+
+type csvEncoder struct {
+	w           *csv.Writer
+	wroteHeader bool
+}
+
+func newCSVEncoder(w io.Writer) eventEncoder {
+	return &csvEncoder{w: csv.NewWriter(w)}
+}
+
+func (c *csvEncoder) encode(e *auditevent.AuditEvent) error {
+	if !c.wroteHeader {
+		if err := c.w.Write(csvColumns); err != nil {
+			return err //nolint:wrapcheck // It's wrapped by the caller
+		}
+		c.wroteHeader = true
+	}
+
+	subjects, err := json.Marshal(e.Subjects)
+	if err != nil {
+		return err //nolint:wrapcheck // It's wrapped by the caller
+	}
+
+	loggedAt, err := e.LoggedAt.MarshalText()
+	if err != nil {
+		return err //nolint:wrapcheck // It's wrapped by the caller
+	}
+
+	row := []string{
+		e.Metadata.AuditID, string(loggedAt), e.Type, e.Outcome, e.Component,
+		e.Source.Type, e.Source.Value, csvJSON(e.Source.Extra),
+		string(subjects), csvJSON(e.Target), csvJSON(e.Data),
+		csvJSON(e.Metadata.Extra), csvJSON(e.Metadata.Chain), csvJSON(e.Metadata.Signature),
+	}
+
+	return c.w.Write(row) //nolint:wrapcheck // It's wrapped by the caller
+}
+
+func (c *csvEncoder) flush() error {
+	c.w.Flush()
+	return c.w.Error() //nolint:wrapcheck // It's wrapped by the caller
+}
+
+// csvJSON returns the JSON encoding of v, or an empty string if it's nil.
+func csvJSON[T any](v T) string {
+	b, err := json.Marshal(v)
+	if err != nil || string(b) == "null" {
+		return ""
+	}
+
+	return string(b)
+}
+
+type csvDecoder struct {
+	r *csv.Reader
+	// columns are the indexes of the csvColumns in the records
+	columns map[string]int
+	err     error
+}
+
+func newCSVDecoder(r io.Reader) eventDecoder {
+	cr := csv.NewReader(r)
+	cr.FieldsPerRecord = -1
+	cr.ReuseRecord = true
+
+	return &csvDecoder{r: cr}
+}
+
+func (d *csvDecoder) decode() (*auditevent.AuditEvent, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+
+	if d.columns == nil {
+		header, err := d.r.Read()
+		if err != nil {
+			return nil, err //nolint:wrapcheck // io.EOF must not be wrapped
+		}
+
+		d.columns = map[string]int{}
+		for i, name := range header {
+			d.columns[strings.TrimSpace(name)] = i
+		}
+
+		for _, required := range []string{"auditId", "loggedAt", "type"} {
+			if _, ok := d.columns[required]; !ok {
+				// Every record would be malformed
+				d.err = fmt.Errorf("%w: missing CSV column %q", ErrInvalidConvertInput, required)
+				return nil, d.err
+			}
+		}
+	}
+
+	record, err := d.r.Read()
+	var perr *csv.ParseError
+	if errors.As(err, &perr) {
+		return nil, fmt.Errorf("%w: %w", errMalformedRecord, err)
+	}
+	if err != nil {
+		return nil, err //nolint:wrapcheck // io.EOF must not be wrapped
+	}
+
+	e, err := d.parse(record)
+	if err != nil {
+		line, _ := d.r.FieldPos(0)
+		return nil, fmt.Errorf("%w: line %d: %w", errMalformedRecord, line, err)
+	}
+
+	return e, nil
+}
+
+func (d *csvDecoder) parse(record []string) (*auditevent.AuditEvent, error) {
+	col := func(name string) string {
+		if i, ok := d.columns[name]; ok && i < len(record) {
+			return record[i]
+		}
+		return ""
+	}
+
+	e := &auditevent.AuditEvent{
+		Metadata:  auditevent.EventMetadata{AuditID: col("auditId")},
+		Type:      col("type"),
+		Outcome:   col("outcome"),
+		Component: col("component"),
+		Source:    auditevent.EventSource{Type: col("source.type"), Value: col("source.value")},
+	}
+
+	if err := e.LoggedAt.UnmarshalText([]byte(col("loggedAt"))); err != nil {
+		return nil, fmt.Errorf("loggedAt: %w", err)
+	}
+
+	for name, v := range map[string]any{
+		"source.extra":       &e.Source.Extra,
+		"subjects":           &e.Subjects,
+		"target":             &e.Target,
+		"data":               &e.Data,
+		"metadata.extra":     &e.Metadata.Extra,
+		"metadata.chain":     &e.Metadata.Chain,
+		"metadata.signature": &e.Metadata.Signature,
+	} {
+		if s := col(name); s != "" {
+			if err := json.Unmarshal([]byte(s), v); err != nil {
+				return nil, fmt.Errorf("%s: %w", name, err)
+			}
+		}
+	}
+
+	return e, nil
+}
+
+// formatTime formats a time as an RFC 3339 time with nanoseconds.
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
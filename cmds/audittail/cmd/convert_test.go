@@ -0,0 +1,206 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+const convertFixtures = "testdata/convert"
+
+func readConvertFixture(t *testing.T, name string) string {
+	t.Helper()
+
+	b, err := os.ReadFile(filepath.Join(convertFixtures, name))
+	require.NoError(t, err)
+
+	return string(b)
+}
+
+func runConvert(t *testing.T, stdin string, args ...string) (stdout, stderr string, err error) {
+	t.Helper()
+
+	c := NewConvertCommand()
+	var out, errOut bytes.Buffer
+	c.SetOut(&out)
+	c.SetErr(&errOut)
+	c.SetIn(strings.NewReader(stdin))
+	c.SetArgs(args)
+
+	err = c.Execute()
+
+	return out.String(), errOut.String(), err
+}
+
+func TestConvertGolden(t *testing.T) {
+	t.Parallel()
+
+	events := readConvertFixture(t, "events.jsonl")
+
+	tests := []struct {
+		format string
+		// lossy formats don't convert back to the same events
+		lossy bool
+	}{
+		{format: formatCEF, lossy: true},
+		{format: formatLEEF, lossy: true},
+		{format: formatOCSF},
+		{format: formatCloudEvents},
+		{format: formatCSV},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.format, func(t *testing.T) {
+			t.Parallel()
+
+			golden := readConvertFixture(t, "events."+tc.format+".golden")
+
+			out, errOut, err := runConvert(t, events, "--to", tc.format)
+			require.NoError(t, err)
+			require.Empty(t, errOut)
+			require.Equal(t, golden, out)
+
+			want := events
+			if tc.lossy {
+				want = readConvertFixture(t, "events."+tc.format+".native.golden")
+			}
+
+			out, errOut, err = runConvert(t, golden, "--from", tc.format)
+			require.NoError(t, err)
+			require.Empty(t, errOut)
+			require.Equal(t, want, out)
+		})
+	}
+}
+
+// TestConvertFixtureSetsEveryField makes sure the golden tests cover new
+// fields of audit events.
+func TestConvertFixtureSetsEveryField(t *testing.T) {
+	t.Parallel()
+
+	e, err := decodeNative([]byte(strings.SplitN(readConvertFixture(t, "events.jsonl"), "\n", 2)[0]))
+	require.NoError(t, err)
+
+	var check func(v reflect.Value, path string)
+	check = func(v reflect.Value, path string) {
+		for i := range v.NumField() {
+			f := v.Field(i)
+			name := path + v.Type().Field(i).Name
+			require.False(t, f.IsZero(), "the first event of events.jsonl doesn't set %s", name)
+
+			switch f.Interface().(type) {
+			case auditevent.EventMetadata, auditevent.EventSource:
+				check(f, name+".")
+			}
+		}
+	}
+	check(reflect.ValueOf(*e), "")
+}
+
+func TestConvertBetweenFormats(t *testing.T) {
+	t.Parallel()
+
+	events := readConvertFixture(t, "events.jsonl")
+
+	// Converting between two formats goes through the native one
+	out, _, err := runConvert(t, readConvertFixture(t, "events.ocsf.golden"), "--from", "ocsf", "--to", "csv")
+	require.NoError(t, err)
+	require.Equal(t, readConvertFixture(t, "events.csv.golden"), out)
+
+	dir := t.TempDir()
+	log := filepath.Join(dir, "audit.log")
+	require.NoError(t, os.WriteFile(log, []byte(events), ownerGroupOwnership))
+
+	out, _, err = runConvert(t, "", "--to", "native", log, log)
+	require.NoError(t, err)
+	require.Equal(t, events+events, out)
+}
+
+func TestConvertSkipsMalformedRecords(t *testing.T) {
+	t.Parallel()
+
+	event := strings.SplitN(readConvertFixture(t, "events.jsonl"), "\n", 2)[0] + "\n"
+
+	out, errOut, err := runConvert(t, "not an event\n"+event+"\n{\n", "--to", "cloudevents")
+	require.NoError(t, err)
+	require.Equal(t, strings.SplitN(readConvertFixture(t, "events.cloudevents.golden"), "\n", 2)[0]+"\n", out)
+	require.Equal(t, "audittail: skipped 2 records that couldn't be converted\n", errOut)
+
+	csv := "auditId,loggedAt,type\n1,yesterday,UserLogin\n2,2026-03-01T12:00:00Z,UserLogin\n"
+	out, errOut, err = runConvert(t, csv, "--from", "csv")
+	require.NoError(t, err)
+	require.Equal(t, `{"metadata":{"auditId":"2"},"type":"UserLogin","loggedAt":"2026-03-01T12:00:00Z",`+
+		`"source":{"type":"","value":""},"outcome":"","subjects":null,"component":""}`+"\n", out)
+	require.Equal(t, "audittail: skipped 1 records that couldn't be converted\n", errOut)
+}
+
+func TestConvertErrors(t *testing.T) {
+	t.Parallel()
+
+	_, _, err := runConvert(t, "", "--to", "xml")
+	require.ErrorIs(t, err, ErrInvalidConvertFormat)
+
+	_, _, err = runConvert(t, "", "--from", "syslog")
+	require.ErrorIs(t, err, ErrInvalidConvertFormat)
+
+	_, _, err = runConvert(t, "type,outcome\nUserLogin,failed\n", "--from", "csv")
+	require.ErrorIs(t, err, ErrInvalidConvertInput)
+
+	_, _, err = runConvert(t, "", filepath.Join(t.TempDir(), "missing.log"))
+	require.Error(t, err)
+}
+
+func TestDecodeForeignJSONEvents(t *testing.T) {
+	t.Parallel()
+
+	// Events written by other tools don't have the fields the mappings
+	// can't carry
+	e, err := decodeOCSF([]byte(`{"class_uid":6003,"time":1772366400000,"status_detail":"succeeded",` +
+		`"metadata":{"uid":"42","product":{"name":"gateway"}},"api":{"operation":"login"},` +
+		`"actor":{"user":{"name":"jane"}},"src_endpoint":{"ip":"192.0.2.1"},"http_request":{"url":{"path":"/login"}}}`))
+	require.NoError(t, err)
+	require.Equal(t, "42", e.Metadata.AuditID)
+	require.Equal(t, "login", e.Type)
+	require.Equal(t, "gateway", e.Component)
+	require.Equal(t, "succeeded", e.Outcome)
+	require.Equal(t, int64(1772366400000), e.LoggedAt.UnixMilli())
+	require.Equal(t, auditevent.EventSource{Type: "IP", Value: "192.0.2.1"}, e.Source)
+	require.Equal(t, map[string]string{"user": "jane"}, e.Subjects)
+	require.Equal(t, map[string]string{"path": "/login"}, e.Target)
+
+	_, err = decodeOCSF([]byte(`{"class_uid":3002}`))
+	require.ErrorIs(t, err, ErrInvalidConvertInput)
+
+	e, err = decodeCloudEvent([]byte(`{"specversion":"1.0","id":"42","source":"gateway",` +
+		`"type":"com.github.metal-toolbox.auditevent.UserLogin","time":"2026-03-01T12:00:00Z"}`))
+	require.NoError(t, err)
+	require.Equal(t, "42", e.Metadata.AuditID)
+	require.Equal(t, "UserLogin", e.Type)
+	require.Equal(t, "gateway", e.Component)
+	require.Equal(t, int64(1772366400000), e.LoggedAt.UnixMilli())
+
+	_, err = decodeCloudEvent([]byte(`{"specversion":"0.3","id":"42"}`))
+	require.ErrorIs(t, err, ErrInvalidConvertInput)
+}
@@ -0,0 +1,124 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+)
+
+const defaultDrainTimeout = 10 * time.Second
+
+// readDeadliner is implemented by the named pipe, so a read that
+// waits for more events can be stopped once the drain deadline passes.
+type readDeadliner interface {
+	SetReadDeadline(t time.Time) error
+}
+
+// newDrainContext returns the context of the sinks. It outlives ctx,
+// which is cancelled when shutdown is requested, by the drain timeout,
+// so the events read in the meantime can still be sent.
+// startDeadline starts the drain timeout if tailing stopped for another
+// reason, so sinks don't retry forever once they're closed.
+func newDrainContext(
+	ctx context.Context,
+	timeout time.Duration,
+) (drainCtx context.Context, startDeadline func(), cancel context.CancelFunc) {
+	drainCtx, cancelDrain := context.WithCancel(context.WithoutCancel(ctx))
+
+	var once sync.Once
+	startDeadline = func() {
+		once.Do(func() {
+			time.AfterFunc(timeout, cancelDrain)
+		})
+	}
+	stop := context.AfterFunc(ctx, startDeadline)
+
+	return drainCtx, startDeadline, func() {
+		stop()
+		cancelDrain()
+	}
+}
+
+// drainReport tells what happened to the pending events once
+// shutdown was requested.
+type drainReport struct {
+	// drainedLines is the number of lines read from the audit log
+	// after shutdown was requested
+	drainedLines int
+	// abandoned is set if the drain deadline passed before the
+	// writers closed the audit log, so events may be left in it
+	abandoned bool
+	// unfinished is the size of the unfinished line that was quarantined
+	unfinished int
+}
+
+// spooledOutput is an output that leaves the events it couldn't send
+// in spools, to be sent after a restart.
+type spooledOutput interface {
+	unsent() int64
+}
+
+// spoolOf returns the spools of the output, or nil if it has none.
+func spoolOf(out io.Writer) spooledOutput {
+	switch o := out.(type) {
+	case *spool:
+		return o
+	case *router:
+		for _, sink := range o.sinks {
+			if _, ok := sink.(*spool); ok {
+				return o
+			}
+		}
+	}
+
+	return nil
+}
+
+// print writes the report to w, along with the outcome of closing the
+// output. Events that weren't sent are left in the spools, if there are any.
+func (r *drainReport) print(w io.Writer, closeErr error, sp spooledOutput) {
+	fmt.Fprintf(w, "audittail: drained %d lines from the audit log after shutdown was requested\n", r.drainedLines)
+
+	if r.abandoned {
+		fmt.Fprintln(w, "audittail: the drain timeout passed before the audit log was closed, "+
+			"the events still in it were abandoned")
+	}
+
+	if r.unfinished > 0 {
+		fmt.Fprintf(w, "audittail: quarantined %d bytes of an unfinished event\n", r.unfinished)
+	}
+
+	switch {
+	case closeErr == nil:
+		fmt.Fprintln(w, "audittail: flushed the sink")
+	case sp == nil:
+		fmt.Fprintf(w, "audittail: abandoned the events in flight to the sink: %v\n", closeErr)
+	default:
+		fmt.Fprintf(w, "audittail: failed to flush the sink: %v\n", closeErr)
+	}
+
+	if sp == nil {
+		return
+	}
+
+	if n := sp.unsent(); n > 0 {
+		fmt.Fprintf(w, "audittail: left %d bytes of events in the spool, to be sent after a restart\n", n)
+	}
+}
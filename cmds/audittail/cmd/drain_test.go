@@ -0,0 +1,160 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// syncBuffer is a buffer that can be read while the tailer writes to it.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *syncBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+func TestTailFileDrainsUntilWritersClose(t *testing.T) {
+	t.Parallel()
+
+	event := `{"metadata":{"auditId":"1"},"type":"foo","loggedAt":"2026-01-01T00:00:00Z","outcome":"succeeded"}` + "\n"
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	t.Cleanup(func() { r.Close() })
+
+	var out syncBuffer
+	ft := &fileTailer{
+		r:            r,
+		w:            &out,
+		quarantine:   &out,
+		drainTimeout: 10 * time.Second,
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	ech := make(chan error)
+	go func() {
+		ech <- ft.tailFile(ctx)
+	}()
+
+	_, err = w.WriteString(event)
+	require.NoError(t, err)
+	require.Eventually(t, func() bool {
+		return out.String() == event
+	}, time.Second, 5*time.Millisecond)
+
+	// The events written once shutdown is requested are still forwarded
+	cancel()
+	_, err = w.WriteString(event + event)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+
+	require.NoError(t, <-ech)
+	require.Equal(t, strings.Repeat(event, 3), out.String())
+	require.Equal(t, drainReport{drainedLines: 2}, ft.report)
+}
+
+func TestTailFileAbandonsAfterDrainTimeout(t *testing.T) {
+	t.Parallel()
+
+	r, w, err := os.Pipe()
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		r.Close()
+		w.Close()
+	})
+
+	var out, quarantine syncBuffer
+	ft := &fileTailer{
+		r:            r,
+		w:            &out,
+		quarantine:   &quarantine,
+		drainTimeout: 50 * time.Millisecond,
+	}
+
+	// The writer never finishes the event, nor closes the audit log
+	_, err = w.WriteString(`{"type":`)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	cancel()
+
+	start := time.Now()
+	require.NoError(t, ft.tailFile(ctx))
+	require.Less(t, time.Since(start), time.Second, "the drain should stop once the timeout passes")
+
+	require.Empty(t, out.String())
+	require.Equal(t, "{\"type\":\n", quarantine.String())
+	require.Equal(t, drainReport{abandoned: true, unfinished: len(`{"type":`)}, ft.report)
+}
+
+func TestNewDrainContext(t *testing.T) {
+	t.Parallel()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	drainCtx, _, drainCancel := newDrainContext(ctx, 50*time.Millisecond)
+	t.Cleanup(drainCancel)
+
+	cancel()
+	require.NoError(t, drainCtx.Err(), "the drain context should outlive the shutdown")
+	require.Eventually(t, func() bool {
+		return drainCtx.Err() != nil
+	}, time.Second, 5*time.Millisecond, "the drain context should be cancelled once the timeout passes")
+
+	drainCtx, startDeadline, drainCancel := newDrainContext(t.Context(), 0)
+	t.Cleanup(drainCancel)
+
+	startDeadline()
+	require.Eventually(t, func() bool {
+		return drainCtx.Err() != nil
+	}, time.Second, 5*time.Millisecond, "the timeout should start if tailing stops on its own")
+}
+
+func TestDrainReport(t *testing.T) {
+	t.Parallel()
+
+	var b bytes.Buffer
+	(&drainReport{drainedLines: 3}).print(&b, nil, nil)
+	require.Equal(t, "audittail: drained 3 lines from the audit log after shutdown was requested\n"+
+		"audittail: flushed the sink\n", b.String())
+
+	b.Reset()
+	//nolint:err113 // test
+	(&drainReport{abandoned: true, unfinished: 4}).print(&b, errors.New("collector down"), nil)
+	require.Equal(t, "audittail: drained 0 lines from the audit log after shutdown was requested\n"+
+		"audittail: the drain timeout passed before the audit log was closed, the events still in it were abandoned\n"+
+		"audittail: quarantined 4 bytes of an unfinished event\n"+
+		"audittail: abandoned the events in flight to the sink: collector down\n", b.String())
+}
@@ -0,0 +1,238 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+// KubeExtraKey is the Extra key that holds the Kubernetes identity.
+const KubeExtraKey = "kubernetes"
+
+// These are where the enrichment adds the Kubernetes identity.
+const (
+	enrichTargetSource   = "source"
+	enrichTargetMetadata = "metadata"
+)
+
+// These are the policies that determine what happens when the
+// event already has a Kubernetes identity.
+const (
+	// collisionKeep keeps the identity set by the app.
+	collisionKeep = "keep"
+	// collisionOverwrite replaces the identity set by the app.
+	collisionOverwrite = "overwrite"
+	// collisionMerge adds the fields the app didn't set.
+	collisionMerge = "merge"
+)
+
+// kubeField is a field of the Kubernetes identity, which is read from
+// a downward API environment variable or file.
+type kubeField struct {
+	key    string
+	envVar string
+	file   string
+}
+
+var kubeFields = []kubeField{
+	{key: "pod", envVar: "POD_NAME", file: "pod_name"},
+	{key: "namespace", envVar: "POD_NAMESPACE", file: "pod_namespace"},
+	{key: "node", envVar: "NODE_NAME", file: "node_name"},
+	{key: "container", envVar: "CONTAINER_NAME", file: "container_name"},
+}
+
+// kubeEnricher adds the Kubernetes identity of the pod to events.
+type kubeEnricher struct {
+	target    string
+	collision string
+	identity  map[string]any
+}
+
+// newKubeEnricher reads the Kubernetes identity. Each field is read from
+// its file in dir, if set and the file exists, or its environment variable.
+func newKubeEnricher(target, collision, dir string) (*kubeEnricher, error) {
+	if target != enrichTargetSource && target != enrichTargetMetadata {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidEnrichTarget, target)
+	}
+
+	if collision != collisionKeep && collision != collisionOverwrite && collision != collisionMerge {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidCollisionPolicy, collision)
+	}
+
+	identity := map[string]any{}
+	for _, f := range kubeFields {
+		v, err := readKubeField(f, dir)
+		if err != nil {
+			return nil, err
+		}
+
+		if v != "" {
+			identity[f.key] = v
+		}
+	}
+
+	return &kubeEnricher{
+		target:    target,
+		collision: collision,
+		identity:  identity,
+	}, nil
+}
+
+func readKubeField(f kubeField, dir string) (string, error) {
+	if dir != "" {
+		b, err := os.ReadFile(filepath.Join(dir, f.file))
+		if err == nil {
+			return strings.TrimSpace(string(b)), nil
+		}
+
+		if !errors.Is(err, os.ErrNotExist) {
+			return "", fmt.Errorf("reading kubernetes %s: %w", f.key, err)
+		}
+	}
+
+	return os.Getenv(f.envVar), nil
+}
+
+// enrich adds the Kubernetes identity to the event. It returns whether
+// the event changed. Signed or hash chained events are never changed, as
+// that would break their verification.
+func (ke *kubeEnricher) enrich(e *auditevent.AuditEvent) bool {
+	if len(ke.identity) == 0 || e.Metadata.Signature != nil || e.Metadata.Chain != nil {
+		return false
+	}
+
+	extra := &e.Metadata.Extra
+	if ke.target == enrichTargetSource {
+		extra = &e.Source.Extra
+	}
+
+	if *extra == nil {
+		*extra = map[string]any{}
+	}
+
+	existing, ok := (*extra)[KubeExtraKey]
+	if !ok || ke.collision == collisionOverwrite {
+		(*extra)[KubeExtraKey] = ke.identityCopy()
+		return true
+	}
+
+	if ke.collision != collisionMerge {
+		return false
+	}
+
+	// Only maps can be merged; anything else is kept
+	set, ok := existing.(map[string]any)
+	if !ok {
+		return false
+	}
+
+	changed := false
+	for k, v := range ke.identity {
+		if _, ok := set[k]; !ok {
+			set[k] = v
+			changed = true
+		}
+	}
+
+	return changed
+}
+
+// patch returns the line of an event enriched by enrich. Only the
+// Kubernetes identity is spliced into the extra field of the target,
+// so the rest of the line is kept as is, including the fields
+// AuditEvent doesn't declare and the precision of its numbers.
+func (ke *kubeEnricher) patch(line []byte) ([]byte, error) {
+	var event map[string]json.RawMessage
+	if err := json.Unmarshal(line, &event); err != nil {
+		return nil, err //nolint:wrapcheck // It's wrapped by the caller
+	}
+
+	target, err := rawObject(event[ke.target])
+	if err != nil {
+		return nil, err
+	}
+
+	extra, err := rawObject(target["extra"])
+	if err != nil {
+		return nil, err
+	}
+
+	if extra[KubeExtraKey], err = ke.patchIdentity(extra[KubeExtraKey]); err != nil {
+		return nil, err
+	}
+
+	if target["extra"], err = json.Marshal(extra); err != nil {
+		return nil, err //nolint:wrapcheck // It's wrapped by the caller
+	}
+
+	if event[ke.target], err = json.Marshal(target); err != nil {
+		return nil, err //nolint:wrapcheck // It's wrapped by the caller
+	}
+
+	return json.Marshal(event) //nolint:wrapcheck // It's wrapped by the caller
+}
+
+// patchIdentity returns the Kubernetes identity to replace the existing
+// one with, as enrich does. Merged identities keep their existing fields.
+func (ke *kubeEnricher) patchIdentity(existing json.RawMessage) (json.RawMessage, error) {
+	if existing == nil || ke.collision != collisionMerge {
+		return json.Marshal(ke.identity) //nolint:wrapcheck // It's wrapped by the caller
+	}
+
+	set, err := rawObject(existing)
+	if err != nil {
+		return nil, err
+	}
+
+	for k, v := range ke.identity {
+		if _, ok := set[k]; !ok {
+			if set[k], err = json.Marshal(v); err != nil {
+				return nil, err //nolint:wrapcheck // It's wrapped by the caller
+			}
+		}
+	}
+
+	return json.Marshal(set) //nolint:wrapcheck // It's wrapped by the caller
+}
+
+// rawObject decodes a JSON object without decoding its fields. A missing
+// or null object is an empty one.
+func rawObject(raw json.RawMessage) (map[string]json.RawMessage, error) {
+	var obj map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &obj); err != nil && raw != nil {
+		return nil, err //nolint:wrapcheck // It's wrapped by the caller
+	}
+	if obj == nil {
+		obj = map[string]json.RawMessage{}
+	}
+
+	return obj, nil
+}
+
+func (ke *kubeEnricher) identityCopy() map[string]any {
+	cpy := make(map[string]any, len(ke.identity))
+	for k, v := range ke.identity {
+		cpy[k] = v
+	}
+	return cpy
+}
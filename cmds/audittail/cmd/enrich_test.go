@@ -0,0 +1,261 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+func writeKubeMetadataDir(t *testing.T) string {
+	t.Helper()
+
+	dir := t.TempDir()
+	for file, v := range map[string]string{
+		"pod_name":      "my-pod\n",
+		"pod_namespace": "my-namespace\n",
+		"node_name":     "my-node\n",
+	} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, file), []byte(v), 0o600))
+	}
+
+	return dir
+}
+
+func TestKubeEnricherReadsEnvironment(t *testing.T) {
+	// Can't be parallel as it sets environment variables
+	t.Setenv("POD_NAME", "env-pod")
+	t.Setenv("CONTAINER_NAME", "env-container")
+
+	ke, err := newKubeEnricher(enrichTargetMetadata, collisionKeep, writeKubeMetadataDir(t))
+	require.NoError(t, err)
+	require.Equal(t, map[string]any{
+		"pod":       "my-pod",
+		"namespace": "my-namespace",
+		"node":      "my-node",
+		"container": "env-container",
+	}, ke.identity, "files should take precedence over environment variables")
+}
+
+func TestKubeEnricherInvalidFlags(t *testing.T) {
+	t.Parallel()
+
+	_, err := newKubeEnricher("foo", collisionKeep, "")
+	require.ErrorIs(t, err, ErrInvalidEnrichTarget)
+
+	_, err = newKubeEnricher(enrichTargetSource, "foo", "")
+	require.ErrorIs(t, err, ErrInvalidCollisionPolicy)
+}
+
+func TestKubeEnricherEnrich(t *testing.T) {
+	t.Parallel()
+
+	identity := map[string]any{
+		"pod":       "my-pod",
+		"namespace": "my-namespace",
+		"node":      "my-node",
+	}
+
+	tests := []struct {
+		name        string
+		target      string
+		collision   string
+		event       *auditevent.AuditEvent
+		wantChanged bool
+		wantExtra   map[string]any
+	}{
+		{
+			name:        "source",
+			target:      enrichTargetSource,
+			collision:   collisionKeep,
+			event:       &auditevent.AuditEvent{},
+			wantChanged: true,
+			wantExtra:   map[string]any{KubeExtraKey: identity},
+		},
+		{
+			name:      "metadata",
+			target:    enrichTargetMetadata,
+			collision: collisionKeep,
+			event: &auditevent.AuditEvent{Metadata: auditevent.EventMetadata{
+				Extra: map[string]any{"foo": "bar"},
+			}},
+			wantChanged: true,
+			wantExtra:   map[string]any{"foo": "bar", KubeExtraKey: identity},
+		},
+		{
+			name:      "keep",
+			target:    enrichTargetMetadata,
+			collision: collisionKeep,
+			event: &auditevent.AuditEvent{Metadata: auditevent.EventMetadata{
+				Extra: map[string]any{KubeExtraKey: map[string]any{"pod": "app-pod"}},
+			}},
+			wantChanged: false,
+			wantExtra:   map[string]any{KubeExtraKey: map[string]any{"pod": "app-pod"}},
+		},
+		{
+			name:      "overwrite",
+			target:    enrichTargetMetadata,
+			collision: collisionOverwrite,
+			event: &auditevent.AuditEvent{Metadata: auditevent.EventMetadata{
+				Extra: map[string]any{KubeExtraKey: map[string]any{"pod": "app-pod"}},
+			}},
+			wantChanged: true,
+			wantExtra:   map[string]any{KubeExtraKey: identity},
+		},
+		{
+			name:      "merge",
+			target:    enrichTargetMetadata,
+			collision: collisionMerge,
+			event: &auditevent.AuditEvent{Metadata: auditevent.EventMetadata{
+				Extra: map[string]any{KubeExtraKey: map[string]any{"pod": "app-pod"}},
+			}},
+			wantChanged: true,
+			wantExtra: map[string]any{KubeExtraKey: map[string]any{
+				"pod":       "app-pod",
+				"namespace": "my-namespace",
+				"node":      "my-node",
+			}},
+		},
+		{
+			name:      "merge non-object",
+			target:    enrichTargetMetadata,
+			collision: collisionMerge,
+			event: &auditevent.AuditEvent{Metadata: auditevent.EventMetadata{
+				Extra: map[string]any{KubeExtraKey: "app-value"},
+			}},
+			wantChanged: false,
+			wantExtra:   map[string]any{KubeExtraKey: "app-value"},
+		},
+		{
+			name:      "signed",
+			target:    enrichTargetMetadata,
+			collision: collisionOverwrite,
+			event: &auditevent.AuditEvent{Metadata: auditevent.EventMetadata{
+				Signature: &auditevent.EventSignature{},
+			}},
+			wantChanged: false,
+		},
+		{
+			name:      "chained",
+			target:    enrichTargetMetadata,
+			collision: collisionOverwrite,
+			event: &auditevent.AuditEvent{Metadata: auditevent.EventMetadata{
+				Chain: &auditevent.EventChain{},
+			}},
+			wantChanged: false,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			ke := &kubeEnricher{
+				target:    tt.target,
+				collision: tt.collision,
+				identity:  identity,
+			}
+
+			require.Equal(t, tt.wantChanged, ke.enrich(tt.event))
+
+			extra := tt.event.Metadata.Extra
+			if tt.target == enrichTargetSource {
+				extra = tt.event.Source.Extra
+			}
+			if tt.wantExtra == nil {
+				require.Empty(t, extra)
+				return
+			}
+			require.Equal(t, tt.wantExtra, extra)
+		})
+	}
+}
+
+func TestKubeEnricherKeepsUnknownFields(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		target string
+		event  string
+		want   string
+	}{
+		{
+			target: enrichTargetMetadata,
+			event: `{"metadata":{"auditId":"1","tenant":"acme"},"type":"foo","loggedAt":"2026-01-01T00:00:00Z",` +
+				`"traceId":"abc"}`,
+			want: `{"loggedAt":"2026-01-01T00:00:00Z","metadata":{"auditId":"1",` +
+				`"extra":{"kubernetes":{"pod":"my-pod"}},"tenant":"acme"},"traceId":"abc","type":"foo"}`,
+		},
+		{
+			target: enrichTargetSource,
+			event: `{"metadata":{"auditId":"1"},"type":"foo","loggedAt":"2026-01-01T00:00:00Z",` +
+				`"traceId":"abc"}`,
+			want: `{"loggedAt":"2026-01-01T00:00:00Z","metadata":{"auditId":"1"},` +
+				`"source":{"extra":{"kubernetes":{"pod":"my-pod"}}},"traceId":"abc","type":"foo"}`,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.target, func(t *testing.T) {
+			t.Parallel()
+
+			var out bytes.Buffer
+			ft := &fileTailer{
+				w:          &out,
+				quarantine: io.Discard,
+				enricher: &kubeEnricher{
+					target:    tt.target,
+					collision: collisionKeep,
+					identity:  map[string]any{"pod": "my-pod"},
+				},
+			}
+
+			require.NoError(t, ft.forward([]byte(tt.event+"\n")))
+			require.JSONEq(t, tt.want, out.String(), "the fields of the event that aren't enriched should be kept")
+		})
+	}
+}
+
+func TestKubeEnricherKeepsNumberPrecision(t *testing.T) {
+	t.Parallel()
+
+	// Integers above 2^53 don't survive being decoded as float64
+	event := `{"metadata":{"auditId":"1","extra":{"seq":9007199254740993,` +
+		`"kubernetes":{"node":"n1","gen":9007199254740993}}},"type":"foo","loggedAt":"2026-01-01T00:00:00Z"}`
+	want := `{"loggedAt":"2026-01-01T00:00:00Z","metadata":{"auditId":"1","extra":{"kubernetes":` +
+		`{"gen":9007199254740993,"node":"n1","pod":"my-pod"},"seq":9007199254740993}},"type":"foo"}` + "\n"
+
+	var out bytes.Buffer
+	ft := &fileTailer{
+		w:          &out,
+		quarantine: io.Discard,
+		enricher: &kubeEnricher{
+			target:    enrichTargetMetadata,
+			collision: collisionMerge,
+			identity:  map[string]any{"pod": "my-pod"},
+		},
+	}
+
+	require.NoError(t, ft.forward([]byte(event+"\n")))
+	require.Equal(t, want, out.String())
+}
@@ -2,5 +2,109 @@ package cmd
 
 import "errors"
 
-// ErrFileRequired is returned when the --file flag is not provided.
+// ErrFileRequired is returned when neither the --file nor the --listen flag is provided.
 var ErrFileRequired = errors.New("--file is required")
+
+// ErrInvalidEnrichTarget is returned when the --kube-enrich flag has an unknown value.
+var ErrInvalidEnrichTarget = errors.New("--kube-enrich must be either 'source' or 'metadata'")
+
+// ErrInvalidCollisionPolicy is returned when the --kube-collision flag has an unknown value.
+var ErrInvalidCollisionPolicy = errors.New("--kube-collision must be one of 'keep', 'overwrite' or 'merge'")
+
+// ErrInvalidSyslogURL is returned when the --syslog flag isn't a valid syslog URL.
+var ErrInvalidSyslogURL = errors.New("--syslog must be a tcp://, tls:// or udp:// URL")
+
+// ErrInvalidCA is returned when a CA file has no PEM certificates.
+var ErrInvalidCA = errors.New("no certificates found in the CA")
+
+// ErrInvalidWebhookURL is returned when the --webhook flag isn't an http:// or https:// URL.
+var ErrInvalidWebhookURL = errors.New("--webhook must be an http:// or https:// URL")
+
+// ErrInvalidWebhookBatchSize is returned when the --webhook-batch-size flag isn't positive.
+var ErrInvalidWebhookBatchSize = errors.New("--webhook-batch-size must be positive")
+
+// ErrInvalidWebhookFlushInterval is returned when the --webhook-flush-interval flag isn't positive.
+var ErrInvalidWebhookFlushInterval = errors.New("--webhook-flush-interval must be positive")
+
+// ErrWebhookUnavailable is returned when the webhook collector can't take events right now.
+var ErrWebhookUnavailable = errors.New("webhook collector unavailable")
+
+// ErrWebhookRejected is returned when the webhook collector rejects events.
+var ErrWebhookRejected = errors.New("webhook collector rejected the events")
+
+// ErrInvalidSpoolFullPolicy is returned when the --spool-full-policy flag has an unknown value.
+var ErrInvalidSpoolFullPolicy = errors.New("--spool-full-policy must be one of 'block', 'drop-oldest' or 'drop-newest'")
+
+// ErrInvalidSpoolMaxSize is returned when the --spool-max-size-mib flag isn't positive.
+var ErrInvalidSpoolMaxSize = errors.New("--spool-max-size-mib must be positive")
+
+// ErrInvalidSpoolMaxAge is returned when the --spool-max-age flag is negative.
+var ErrInvalidSpoolMaxAge = errors.New("--spool-max-age can't be negative")
+
+// ErrInvalidDrainTimeout is returned when the --drain-timeout flag is negative.
+var ErrInvalidDrainTimeout = errors.New("--drain-timeout can't be negative")
+
+// ErrStateFileWithoutRegularFile is returned when the --state-file flag is set without --regular-file.
+var ErrStateFileWithoutRegularFile = errors.New("--state-file requires --regular-file")
+
+// ErrInvalidListenURL is returned when the --listen flag isn't a unix:// or unixgram:// URL.
+var ErrInvalidListenURL = errors.New("--listen must be a unix:// or unixgram:// URL")
+
+// ErrInvalidConfig is returned when the --config file isn't valid.
+var ErrInvalidConfig = errors.New("invalid config")
+
+// ErrInvalidVerifyOutput is returned when the --output flag of verify has an unknown value.
+var ErrInvalidVerifyOutput = errors.New("--output must be either 'text' or 'json'")
+
+// ErrInvalidVerifyKey is returned when a --key or --hmac-key flag isn't KEY_ID=PATH.
+var ErrInvalidVerifyKey = errors.New("--key and --hmac-key must be KEY_ID=PATH")
+
+// ErrVerificationFailed is returned when verify finds problems in the audit logs.
+var ErrVerificationFailed = errors.New("audit log verification failed")
+
+// ExitError is returned by commands that exit with a status of their own,
+// e.g. verify, which tells problems in the audit logs from failures to
+// read them.
+type ExitError struct {
+	Code int
+	Err  error
+}
+
+func (e *ExitError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ExitError) Unwrap() error {
+	return e.Err
+}
+
+// ErrInvalidFilter is returned when the --filter expression of query can't be parsed.
+var ErrInvalidFilter = errors.New("invalid filter")
+
+// ErrInvalidQueryOutput is returned when the --output flag of query has an unknown value.
+var ErrInvalidQueryOutput = errors.New("--output must be one of 'json', 'table' or 'csv'")
+
+// ErrInvalidQueryTime is returned when the --since or --until flag isn't a time or a duration.
+var ErrInvalidQueryTime = errors.New("--since and --until must be RFC 3339 times or durations")
+
+// ErrInvalidConvertFormat is returned when --from or --to isn't a known format.
+var ErrInvalidConvertFormat = errors.New("--from and --to must be one of 'native', 'cef', 'leef', 'ocsf', " +
+	"'cloudevents' or 'csv'")
+
+// ErrInvalidConvertInput is returned when an audit log can't be read in the format it's converted from.
+var ErrInvalidConvertInput = errors.New("invalid input")
+
+// ErrInvalidGenerateOutput is returned when the --output flag of the generate command is invalid.
+var ErrInvalidGenerateOutput = errors.New("--output must be one of 'text' or 'json'")
+
+// ErrInvalidGenerateOption is returned when the events to generate are misconfigured.
+var ErrInvalidGenerateOption = errors.New("invalid generate option")
+
+// ErrEventsLost is returned when generated events weren't received.
+var ErrEventsLost = errors.New("events were lost")
+
+// ErrInvalidPipeMode is returned when the --mode flag of the init command isn't an octal permission mode.
+var ErrInvalidPipeMode = errors.New("--mode must be an octal permission mode, like 0640")
+
+// ErrPipeNotWritable is returned when the application user can't open the named pipe for writing.
+var ErrPipeNotWritable = errors.New("the application can't write to the named pipe")
@@ -0,0 +1,421 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+// eventFilter picks the audit events a query prints.
+type eventFilter interface {
+	match(e *auditevent.AuditEvent) bool
+}
+
+type andFilter []eventFilter
+
+func (f andFilter) match(e *auditevent.AuditEvent) bool {
+	for _, sub := range f {
+		if !sub.match(e) {
+			return false
+		}
+	}
+
+	return true
+}
+
+type orFilter []eventFilter
+
+func (f orFilter) match(e *auditevent.AuditEvent) bool {
+	for _, sub := range f {
+		if sub.match(e) {
+			return true
+		}
+	}
+
+	return false
+}
+
+type notFilter struct {
+	eventFilter
+}
+
+func (f notFilter) match(e *auditevent.AuditEvent) bool {
+	return !f.eventFilter.match(e)
+}
+
+// fieldCondition compares a string field of the event to a value, or
+// matches it against a pattern where '*' matches any sequence of characters.
+type fieldCondition struct {
+	field   func(e *auditevent.AuditEvent) string
+	op      string
+	value   string
+	pattern *regexp.Regexp
+}
+
+func (c *fieldCondition) match(e *auditevent.AuditEvent) bool {
+	v := c.field(e)
+
+	switch c.op {
+	case "==":
+		return v == c.value
+	case "!=":
+		return v != c.value
+	case "~":
+		return c.pattern.MatchString(v)
+	default:
+		return !c.pattern.MatchString(v)
+	}
+}
+
+// timeCondition compares the time the event was logged at.
+type timeCondition struct {
+	op string
+	t  time.Time
+}
+
+func (c *timeCondition) match(e *auditevent.AuditEvent) bool {
+	switch c.op {
+	case "==":
+		return e.LoggedAt.Equal(c.t)
+	case "!=":
+		return !e.LoggedAt.Equal(c.t)
+	case "<":
+		return e.LoggedAt.Before(c.t)
+	case "<=":
+		return !e.LoggedAt.After(c.t)
+	case ">":
+		return e.LoggedAt.After(c.t)
+	default:
+		return !e.LoggedAt.Before(c.t)
+	}
+}
+
+// stringFields are the fields that hold a single string.
+var stringFields = map[string]func(e *auditevent.AuditEvent) string{
+	"metadata.auditId": func(e *auditevent.AuditEvent) string { return e.Metadata.AuditID },
+	"type":             func(e *auditevent.AuditEvent) string { return e.Type },
+	"outcome":          func(e *auditevent.AuditEvent) string { return e.Outcome },
+	"component":        func(e *auditevent.AuditEvent) string { return e.Component },
+	"source.type":      func(e *auditevent.AuditEvent) string { return e.Source.Type },
+	"source.value":     func(e *auditevent.AuditEvent) string { return e.Source.Value },
+}
+
+// filterField returns the getter of a field. Keys of subjects and target
+// are fields of their own, e.g. subjects.user, and are empty if missing.
+func filterField(name string) (func(e *auditevent.AuditEvent) string, bool) {
+	if get, ok := stringFields[name]; ok {
+		return get, true
+	}
+
+	if key, ok := strings.CutPrefix(name, "subjects."); ok && key != "" {
+		return func(e *auditevent.AuditEvent) string { return e.Subjects[key] }, true
+	}
+
+	if key, ok := strings.CutPrefix(name, "target."); ok && key != "" {
+		return func(e *auditevent.AuditEvent) string { return e.Target[key] }, true
+	}
+
+	return nil, false
+}
+
+// parseFilter parses a filter expression, e.g.
+//
+//	type == UserLogin and (outcome != succeeded or subjects.user ~ "*@example.com")
+//
+// An empty expression matches every event.
+func parseFilter(expr string) (eventFilter, error) {
+	tokens, err := tokenizeFilter(expr)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(tokens) == 0 {
+		return andFilter{}, nil
+	}
+
+	p := &filterParser{tokens: tokens}
+	f, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if t, ok := p.peek(); ok {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidFilter, t.text)
+	}
+
+	return f, nil
+}
+
+// filterToken is a token of a filter expression. Quoted strings are
+// never keywords or operators.
+type filterToken struct {
+	text   string
+	quoted bool
+}
+
+// comparisonOperators and filterOperators are sorted so that longer
+// operators are tried first.
+var (
+	comparisonOperators = []string{"==", "!=", "!~", "<=", ">=", "~", "<", ">"}
+	filterOperators     = []string{"==", "!=", "!~", "<=", ">=", "~", "<", ">", "(", ")"}
+)
+
+func tokenizeFilter(expr string) ([]filterToken, error) {
+	var tokens []filterToken
+
+	for i := 0; i < len(expr); {
+		c, size := utf8.DecodeRuneInString(expr[i:])
+		if unicode.IsSpace(c) {
+			i += size
+			continue
+		}
+
+		if c == '"' || c == '\'' {
+			text, n, err := unquoteFilterString(expr[i:])
+			if err != nil {
+				return nil, fmt.Errorf("%w: string at %d: %w", ErrInvalidFilter, i, err)
+			}
+
+			tokens = append(tokens, filterToken{text: text, quoted: true})
+			i += n
+			continue
+		}
+
+		if op, ok := filterOperatorAt(expr[i:]); ok {
+			tokens = append(tokens, filterToken{text: op})
+			i += len(op)
+			continue
+		}
+
+		// Values are read a rune at a time, so the bytes of multibyte
+		// runes aren't mistaken for spaces
+		start := i
+		for i < len(expr) {
+			r, size := utf8.DecodeRuneInString(expr[i:])
+			if unicode.IsSpace(r) || strings.ContainsRune(`"'()=!~<>`, r) {
+				break
+			}
+			i += size
+		}
+		if i == start {
+			return nil, fmt.Errorf("%w: unexpected %q at %d", ErrInvalidFilter, c, i)
+		}
+
+		tokens = append(tokens, filterToken{text: expr[start:i]})
+	}
+
+	return tokens, nil
+}
+
+// unquoteFilterString returns the string s starts with, and its length.
+// Double-quoted strings may have Go escape sequences, single-quoted
+// strings are taken as is.
+func unquoteFilterString(s string) (string, int, error) {
+	quote := s[0]
+	for i := 1; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && quote == '"':
+			i++
+		case s[i] == quote && quote == '\'':
+			return s[1:i], i + 1, nil
+		case s[i] == quote:
+			text, err := strconv.Unquote(s[:i+1])
+			return text, i + 1, err //nolint:wrapcheck // It's wrapped by the caller
+		}
+	}
+
+	return "", 0, errUnterminatedString
+}
+
+var errUnterminatedString = errors.New("unterminated string")
+
+func filterOperatorAt(s string) (string, bool) {
+	for _, op := range filterOperators {
+		if strings.HasPrefix(s, op) {
+			return op, true
+		}
+	}
+
+	return "", false
+}
+
+type filterParser struct {
+	tokens []filterToken
+	pos    int
+}
+
+func (p *filterParser) peek() (filterToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return filterToken{}, false
+	}
+
+	return p.tokens[p.pos], true
+}
+
+func (p *filterParser) next() (filterToken, error) {
+	t, ok := p.peek()
+	if !ok {
+		return t, fmt.Errorf("%w: unexpected end of the expression", ErrInvalidFilter)
+	}
+	p.pos++
+
+	return t, nil
+}
+
+// keyword consumes the next token if it's the given keyword.
+func (p *filterParser) keyword(kw string) bool {
+	t, ok := p.peek()
+	if !ok || t.quoted || !strings.EqualFold(t.text, kw) {
+		return false
+	}
+	p.pos++
+
+	return true
+}
+
+func (p *filterParser) parseOr() (eventFilter, error) {
+	f, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+
+	or := orFilter{f}
+	for p.keyword("or") {
+		f, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		or = append(or, f)
+	}
+
+	if len(or) == 1 {
+		return or[0], nil
+	}
+
+	return or, nil
+}
+
+func (p *filterParser) parseAnd() (eventFilter, error) {
+	f, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	and := andFilter{f}
+	for p.keyword("and") {
+		f, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		and = append(and, f)
+	}
+
+	if len(and) == 1 {
+		return and[0], nil
+	}
+
+	return and, nil
+}
+
+func (p *filterParser) parseUnary() (eventFilter, error) {
+	if p.keyword("not") {
+		f, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notFilter{f}, nil
+	}
+
+	if t, ok := p.peek(); ok && !t.quoted && t.text == "(" {
+		p.pos++
+
+		f, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if t, err := p.next(); err != nil || t.quoted || t.text != ")" {
+			return nil, fmt.Errorf("%w: missing ')'", ErrInvalidFilter)
+		}
+
+		return f, nil
+	}
+
+	return p.parseCondition()
+}
+
+func (p *filterParser) parseCondition() (eventFilter, error) {
+	field, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	op, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+	if op.quoted || !slices.Contains(comparisonOperators, op.text) {
+		return nil, fmt.Errorf("%w: expected an operator after %q, got %q", ErrInvalidFilter, field.text, op.text)
+	}
+
+	value, err := p.next()
+	if err != nil {
+		return nil, err
+	}
+
+	if field.text == "loggedAt" {
+		return newTimeCondition(op.text, value.text)
+	}
+
+	get, ok := filterField(field.text)
+	if !ok || field.quoted {
+		return nil, fmt.Errorf("%w: unknown field %q", ErrInvalidFilter, field.text)
+	}
+
+	c := &fieldCondition{field: get, op: op.text, value: value.text}
+	switch op.text {
+	case "==", "!=":
+	case "~", "!~":
+		c.pattern = compilePattern(value.text)
+	default:
+		return nil, fmt.Errorf("%w: %s only works on loggedAt", ErrInvalidFilter, op.text)
+	}
+
+	return c, nil
+}
+
+func newTimeCondition(op, value string) (eventFilter, error) {
+	if op == "~" || op == "!~" {
+		return nil, fmt.Errorf("%w: %s doesn't work on loggedAt", ErrInvalidFilter, op)
+	}
+
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: loggedAt must be compared to an RFC 3339 time: %w", ErrInvalidFilter, err)
+	}
+
+	return &timeCondition{op: op, t: t}, nil
+}
@@ -0,0 +1,101 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+func TestParseFilter(t *testing.T) {
+	t.Parallel()
+
+	e := auditevent.NewAuditEventWithID("1", "UserLogin",
+		auditevent.EventSource{Type: "IP", Value: "10.0.0.1"},
+		auditevent.OutcomeFailed, map[string]string{"user": "jane@example.com", "team": "voilà"}, "api").
+		WithTarget(map[string]string{"path": "/v1/login"})
+	e.LoggedAt = time.Date(2026, 1, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		expr  string
+		match bool
+	}{
+		{expr: "", match: true},
+		{expr: "type == UserLogin", match: true},
+		{expr: "type == userlogin", match: false},
+		{expr: `type != "UserLogin"`, match: false},
+		{expr: "outcome == failed and component == api", match: true},
+		{expr: "outcome == succeeded or component == api", match: true},
+		{expr: "outcome == succeeded or component == web", match: false},
+		{expr: "not outcome == succeeded", match: true},
+		{expr: "NOT (outcome == failed AND component == api)", match: false},
+		{expr: "outcome == succeeded and component == web or type == UserLogin", match: true},
+		{expr: "outcome == succeeded and (component == web or type == UserLogin)", match: false},
+		{expr: "metadata.auditId == 1 and source.type == IP and source.value ~ 10.*", match: true},
+		{expr: `subjects.user ~ "*@example.com"`, match: true},
+		{expr: `subjects.user !~ '*@example.com'`, match: false},
+		{expr: "target.path == /v1/login", match: true},
+		{expr: `subjects.group == ""`, match: true},
+		{expr: "loggedAt >= 2026-01-01T10:00:00Z and loggedAt < 2026-01-01T11:00:00Z", match: true},
+		{expr: "loggedAt > 2026-01-01T10:00:00Z", match: false},
+		{expr: "loggedAt <= 2026-01-01T11:00:00+01:00", match: true},
+		{expr: "loggedAt == 2026-01-01T10:00:00Z and loggedAt != 2026-01-01T10:00:01Z", match: true},
+		{expr: `type == "UserLogin"`, match: true},
+		// à is encoded as C3 A0, and A0 isn't a space on its own
+		{expr: "subjects.team == voilà and type == UserLogin", match: true},
+		{expr: "subjects.team ~ voil*", match: true},
+	}
+
+	for _, tt := range tests {
+		f, err := parseFilter(tt.expr)
+		require.NoError(t, err, tt.expr)
+		require.Equal(t, tt.match, f.match(e), tt.expr)
+	}
+}
+
+func TestParseFilterErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		expr   string
+		errMsg string
+	}{
+		{expr: "type", errMsg: "unexpected end of the expression"},
+		{expr: "type ==", errMsg: "unexpected end of the expression"},
+		{expr: "type UserLogin", errMsg: `expected an operator after "type", got "UserLogin"`},
+		{expr: "user == jane", errMsg: `unknown field "user"`},
+		{expr: "subjects. == jane", errMsg: `unknown field "subjects."`},
+		{expr: `"type" == UserLogin`, errMsg: `unknown field "type"`},
+		{expr: "type < UserLogin", errMsg: "< only works on loggedAt"},
+		{expr: "loggedAt ~ 2026*", errMsg: "~ doesn't work on loggedAt"},
+		{expr: "loggedAt > yesterday", errMsg: "loggedAt must be compared to an RFC 3339 time"},
+		{expr: "(type == UserLogin", errMsg: "missing ')'"},
+		{expr: "type == UserLogin)", errMsg: `unexpected ")"`},
+		{expr: "type == UserLogin outcome == failed", errMsg: `unexpected "outcome"`},
+		{expr: `type == "UserLogin`, errMsg: "unterminated string"},
+		{expr: "type = UserLogin", errMsg: "unexpected '='"},
+	}
+
+	for _, tt := range tests {
+		_, err := parseFilter(tt.expr)
+		require.ErrorIs(t, err, ErrInvalidFilter, tt.expr)
+		require.ErrorContains(t, err, tt.errMsg, tt.expr)
+	}
+}
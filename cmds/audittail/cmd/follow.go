@@ -0,0 +1,323 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"time"
+)
+
+const (
+	// followCheckpointInterval is how often the position in a followed
+	// file is saved to the state file.
+	followCheckpointInterval = time.Second
+	// followRotationGrace is how long a rotated file is still read once
+	// nothing is written to it, while the file that replaced it is empty.
+	followRotationGrace = 5 * time.Second
+)
+
+// followState is the position in the audit log that's saved to the
+// state file.
+type followState struct {
+	Inode  uint64 `json:"inode"`
+	Offset int64  `json:"offset"`
+}
+
+// followedFile maps the positions in the stream read from a fileFollower,
+// starting at start, to the positions in a file, starting at base.
+type followedFile struct {
+	inode uint64
+	start int64
+	base  int64
+}
+
+// fileFollower reads a regular file that's rotated or truncated by
+// tools like logrotate. Once it has read the file to its end, it moves
+// on to the file that replaced it, or starts over if it was truncated.
+// The application may write to a rotated file until it reopens its log,
+// so it's read until the new file has data, or until it's idle for the
+// rotation grace period. An unfinished line at the end of a file is
+// ended with a newline, so it isn't joined with the first line of the
+// next one.
+type fileFollower struct {
+	path      string
+	stateFile string
+	// log receives notices about rotations
+	log io.Writer
+
+	f      *os.File
+	info   os.FileInfo
+	offset int64
+	// unfinished is set if the last byte read wasn't a newline
+	unfinished bool
+	// rotated is when the file was found rotated, or last read since
+	rotated       time.Time
+	rotationGrace time.Duration
+
+	// pos is the position in the stream, and files map it to the
+	// positions in the files that were read
+	pos   int64
+	files []followedFile
+}
+
+// newFileFollower opens the file at path. If the state file has a
+// position, it resumes from it, starting with the rotated file it's in
+// if the file was rotated since.
+func newFileFollower(path, stateFile string, log io.Writer) (*fileFollower, error) {
+	ff := &fileFollower{
+		path:          path,
+		stateFile:     stateFile,
+		log:           log,
+		rotationGrace: followRotationGrace,
+	}
+
+	state, err := ff.loadState()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := ff.open(path); err != nil {
+		return nil, err
+	}
+
+	if state.Inode != 0 && fileInode(ff.info) != state.Inode {
+		rotated := ff.findRotated(state.Inode)
+		if rotated == "" {
+			fmt.Fprintf(log, "audittail: %s was rotated since the last checkpoint and the rotated file wasn't found, "+
+				"events may be missing\n", path)
+			state = followState{}
+		} else {
+			current := ff.f
+			err := ff.open(rotated)
+			current.Close()
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	if ff.info.Size() < state.Offset {
+		fmt.Fprintf(log, "audittail: %s was truncated since the last checkpoint, reading it from the start\n", path)
+		state.Offset = 0
+	}
+
+	if _, err := ff.f.Seek(state.Offset, io.SeekStart); err != nil {
+		ff.f.Close()
+		return nil, fmt.Errorf("resuming from the checkpoint: %w", err)
+	}
+	ff.offset = state.Offset
+	ff.files = []followedFile{{inode: fileInode(ff.info), base: state.Offset}}
+
+	return ff, nil
+}
+
+func (ff *fileFollower) Read(p []byte) (int, error) {
+	n, err := ff.f.Read(p)
+	if n > 0 {
+		ff.offset += int64(n)
+		ff.pos += int64(n)
+		ff.unfinished = p[n-1] != '\n'
+		if !ff.rotated.IsZero() {
+			ff.rotated = time.Now()
+		}
+		return n, nil
+	}
+
+	if !errors.Is(err, io.EOF) {
+		return 0, fmt.Errorf("reading audit log: %w", err)
+	}
+
+	moved, err := ff.follow()
+	if err != nil {
+		return 0, err
+	}
+	if !moved {
+		return 0, io.EOF
+	}
+
+	if ff.unfinished {
+		ff.unfinished = false
+		p[0] = '\n'
+		ff.pos++
+		ff.files[len(ff.files)-1].start++
+		return 1, nil
+	}
+
+	return ff.Read(p)
+}
+
+// Close closes the file that's read.
+func (ff *fileFollower) Close() error {
+	return ff.f.Close()
+}
+
+// follow moves on to the file at the path if the one that's read was
+// rotated, or starts over if it was truncated. It returns whether it did.
+func (ff *fileFollower) follow() (bool, error) {
+	info, err := os.Stat(ff.path)
+	if errors.Is(err, os.ErrNotExist) {
+		// The file was rotated, but the new one wasn't created yet
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("checking for rotation: %w", err)
+	}
+
+	switch {
+	case !os.SameFile(info, ff.info):
+		if !ff.rotationDone(info) {
+			return false, nil
+		}
+
+		old := ff.f
+		if err := ff.open(ff.path); err != nil {
+			return false, err
+		}
+		old.Close()
+		ff.rotated = time.Time{}
+	case info.Size() < ff.offset:
+		fmt.Fprintf(ff.log, "audittail: %s was truncated, reading it from the start\n", ff.path)
+		if _, err := ff.f.Seek(0, io.SeekStart); err != nil {
+			return false, fmt.Errorf("reading truncated audit log: %w", err)
+		}
+		ff.info = info
+	default:
+		return false, nil
+	}
+
+	ff.offset = 0
+	ff.files = append(ff.files, followedFile{inode: fileInode(ff.info), start: ff.pos})
+
+	return true, nil
+}
+
+// rotationDone returns whether the rotated file that's read may be left
+// for the file that replaced it, whose info is given.
+func (ff *fileFollower) rotationDone(info os.FileInfo) bool {
+	now := time.Now()
+	if ff.rotated.IsZero() {
+		ff.rotated = now
+	}
+
+	// Once the application writes to the new file, it won't write to
+	// the rotated one, but it may have done so since it was last read
+	if info.Size() > 0 {
+		rotated, err := ff.f.Stat()
+		return err != nil || rotated.Size() <= ff.offset
+	}
+
+	return now.Sub(ff.rotated) >= ff.rotationGrace
+}
+
+func (ff *fileFollower) open(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("opening file: %w", err)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("opening file: %w", err)
+	}
+
+	ff.f, ff.info = f, info
+
+	return nil
+}
+
+// findRotated returns the path of the rotated file with the given inode,
+// if it's still next to the audit log.
+func (ff *fileFollower) findRotated(inode uint64) string {
+	//nolint:errcheck // The pattern is always valid
+	matches, _ := filepath.Glob(ff.path + "*")
+	for _, m := range matches {
+		if info, err := os.Stat(m); err == nil && info.Mode().IsRegular() && fileInode(info) == inode {
+			return m
+		}
+	}
+
+	return ""
+}
+
+// save saves the position of pos in the stream to the state file.
+func (ff *fileFollower) save(pos int64) error {
+	if ff.stateFile == "" {
+		return nil
+	}
+
+	i := len(ff.files) - 1
+	for i > 0 && ff.files[i].start > pos {
+		i--
+	}
+	file := ff.files[i]
+	// The files before aren't needed anymore
+	ff.files = ff.files[i:]
+
+	b, err := json.Marshal(followState{Inode: file.inode, Offset: file.base + pos - file.start})
+	if err != nil {
+		return fmt.Errorf("encoding checkpoint: %w", err)
+	}
+
+	// The state file is replaced at once, so it's never left half-written
+	tmp := ff.stateFile + ".tmp"
+	if err := os.WriteFile(tmp, b, ownerGroupOwnership); err != nil {
+		return fmt.Errorf("saving checkpoint: %w", err)
+	}
+
+	if err := os.Rename(tmp, ff.stateFile); err != nil {
+		return fmt.Errorf("saving checkpoint: %w", err)
+	}
+
+	return nil
+}
+
+func (ff *fileFollower) loadState() (followState, error) {
+	var state followState
+	if ff.stateFile == "" {
+		return state, nil
+	}
+
+	b, err := os.ReadFile(ff.stateFile)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, fmt.Errorf("reading checkpoint: %w", err)
+	}
+
+	if err := json.Unmarshal(b, &state); err != nil {
+		return state, fmt.Errorf("decoding checkpoint: %w", err)
+	}
+
+	return state, nil
+}
+
+// fileInode returns the inode of a file, or 0 if it isn't known.
+func fileInode(info os.FileInfo) uint64 {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0
+	}
+
+	return st.Ino
+}
@@ -0,0 +1,249 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func appendToFile(t *testing.T, path, s string) {
+	t.Helper()
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, ownerGroupOwnership)
+	require.NoError(t, err)
+	defer f.Close()
+
+	_, err = f.WriteString(s)
+	require.NoError(t, err)
+}
+
+func appendEvents(t *testing.T, path string, from, to int) {
+	t.Helper()
+
+	appendToFile(t, path, followTestOutput(from, to))
+}
+
+func followTestOutput(from, to int) string {
+	var b strings.Builder
+	for _, e := range spoolTestEvents(from, to) {
+		b.WriteString(e + "\n")
+	}
+	return b.String()
+}
+
+// followingTailer runs a tailer that follows the file at path,
+// until its stop function is called.
+type followingTailer struct {
+	ft         *fileTailer
+	out        syncBuffer
+	quarantine syncBuffer
+	cancel     context.CancelFunc
+	errs       chan error
+}
+
+func startFollowingTailer(t *testing.T, path, stateFile string, log *bytes.Buffer) *followingTailer {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(t.Context())
+	tt := &followingTailer{cancel: cancel, errs: make(chan error)}
+
+	var err error
+	tt.ft, err = newFollowingTailer(path, stateFile, &tt.out, &tt.quarantine, log)
+	require.NoError(t, err)
+
+	go func() {
+		tt.errs <- tt.ft.tailFile(ctx)
+	}()
+
+	return tt
+}
+
+// stop stops the tailer and saves its checkpoint, as audittail does.
+func (tt *followingTailer) stop(t *testing.T) {
+	t.Helper()
+
+	tt.cancel()
+	require.NoError(t, <-tt.errs)
+	require.NoError(t, tt.ft.saveCheckpoint())
+	require.NoError(t, tt.ft.follower.Close())
+}
+
+func (tt *followingTailer) requireOutput(t *testing.T, want string) {
+	t.Helper()
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, want, tt.out.String())
+	}, time.Second, 5*time.Millisecond)
+}
+
+func TestFileFollowerFollowsRotation(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	appendEvents(t, path, 0, 2)
+
+	tt := startFollowingTailer(t, path, "", &bytes.Buffer{})
+	defer tt.stop(t)
+	tt.requireOutput(t, followTestOutput(0, 2))
+
+	// Events written to the old file after it's renamed are still read,
+	// and its unfinished line isn't joined with the new file's first one
+	require.NoError(t, os.Rename(path, path+".1"))
+	appendEvents(t, path+".1", 2, 3)
+	appendToFile(t, path+".1", `{"type":`)
+	appendEvents(t, path, 3, 5)
+
+	tt.requireOutput(t, followTestOutput(0, 5))
+	require.Equal(t, "{\"type\":\n", tt.quarantine.String())
+}
+
+func TestFileFollowerReadsRotatedFileUntilNewOneIsWritten(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	appendEvents(t, path, 0, 1)
+
+	tt := startFollowingTailer(t, path, "", &bytes.Buffer{})
+	defer tt.stop(t)
+	tt.requireOutput(t, followTestOutput(0, 1))
+
+	// logrotate's create replaces the file with an empty one, which the
+	// application only writes to once it reopens its log
+	require.NoError(t, os.Rename(path, path+".1"))
+	appendToFile(t, path, "")
+	time.Sleep(50 * time.Millisecond)
+
+	appendEvents(t, path+".1", 1, 3)
+	tt.requireOutput(t, followTestOutput(0, 3))
+
+	appendEvents(t, path, 3, 4)
+	tt.requireOutput(t, followTestOutput(0, 4))
+}
+
+func TestFileFollowerLeavesIdleRotatedFile(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	appendEvents(t, path, 0, 1)
+
+	ff, err := newFileFollower(path, "", &bytes.Buffer{})
+	require.NoError(t, err)
+	t.Cleanup(func() { ff.Close() })
+
+	readAll := func() string {
+		b, err := io.ReadAll(ff)
+		require.NoError(t, err)
+		return string(b)
+	}
+	require.Equal(t, followTestOutput(0, 1), readAll())
+
+	require.NoError(t, os.Rename(path, path+".1"))
+	appendToFile(t, path, "")
+	require.Empty(t, readAll())
+
+	appendEvents(t, path+".1", 1, 2)
+	require.Equal(t, followTestOutput(1, 2), readAll(), "the rotated file should be read within the grace period")
+
+	ff.rotationGrace = 0
+	require.Empty(t, readAll())
+
+	appendEvents(t, path+".1", 2, 3)
+	appendEvents(t, path, 3, 4)
+	require.Equal(t, followTestOutput(3, 4), readAll(), "the rotated file should be left once it's idle")
+}
+
+func TestFileFollowerFollowsTruncation(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	appendEvents(t, path, 0, 3)
+
+	log := &bytes.Buffer{}
+	tt := startFollowingTailer(t, path, "", log)
+	tt.requireOutput(t, followTestOutput(0, 3))
+
+	require.NoError(t, os.Truncate(path, 0))
+	appendEvents(t, path, 3, 4)
+
+	tt.requireOutput(t, followTestOutput(0, 4))
+	tt.stop(t)
+	require.Contains(t, log.String(), "was truncated")
+}
+
+func TestFileFollowerResumesFromCheckpoint(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	stateFile := filepath.Join(dir, "state")
+	appendEvents(t, path, 0, 2)
+	unfinished := spoolTestEvent(99)
+	appendToFile(t, path, unfinished[:20])
+
+	tt := startFollowingTailer(t, path, stateFile, &bytes.Buffer{})
+	tt.requireOutput(t, followTestOutput(0, 2))
+	tt.stop(t)
+	require.Empty(t, tt.quarantine.String(), "the unfinished line may still be finished")
+
+	// The line is finished while audittail is down
+	appendToFile(t, path, unfinished[20:]+"\n")
+	appendEvents(t, path, 2, 3)
+
+	tt = startFollowingTailer(t, path, stateFile, &bytes.Buffer{})
+	tt.requireOutput(t, unfinished+"\n"+followTestOutput(2, 3))
+	tt.stop(t)
+
+	// The file is rotated while audittail is down
+	appendEvents(t, path, 3, 4)
+	require.NoError(t, os.Rename(path, path+".1"))
+	appendEvents(t, path, 4, 5)
+
+	tt = startFollowingTailer(t, path, stateFile, &bytes.Buffer{})
+	tt.requireOutput(t, followTestOutput(3, 5))
+	tt.stop(t)
+
+	// The rotated file is gone by the time audittail starts
+	appendEvents(t, path, 5, 6)
+	require.NoError(t, os.Rename(path, path+".1"))
+	appendEvents(t, path, 6, 7)
+	require.NoError(t, os.Remove(path+".1"))
+
+	log := &bytes.Buffer{}
+	tt = startFollowingTailer(t, path, stateFile, log)
+	tt.requireOutput(t, followTestOutput(6, 7))
+	tt.stop(t)
+	require.Contains(t, log.String(), "events may be missing")
+}
+
+func TestRootStateFileRequiresRegularFile(t *testing.T) {
+	t.Parallel()
+
+	c := NewRootCmd()
+	c.SetOut(&bytes.Buffer{})
+	c.SetArgs([]string{"-f", filepath.Join(t.TempDir(), "audit.log"), "--state-file", "state"})
+
+	require.ErrorIs(t, c.Execute(), ErrStateFileWithoutRegularFile)
+}
@@ -0,0 +1,648 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"math/rand/v2"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/spf13/cobra"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+// These are the exit statuses of the generate command. Any other error
+// exits with generateExitError as well.
+const (
+	// generateExitLost is the exit status when events were lost.
+	generateExitLost = 1
+	// generateExitError is the exit status when events couldn't be generated.
+	generateExitError = 2
+)
+
+// These are the keys of the extra metadata that identify generated events,
+// so they're told apart from other events when they're received.
+const (
+	generateRunKey = "generatorRun"
+	generateSeqKey = "generatorSeq"
+)
+
+const (
+	defaultGenerateCount     = 10000
+	defaultGenerateComponent = "audittail-generate"
+	// generatePollInterval is how often the received events are read
+	// again once the end of the file is reached.
+	generatePollInterval = 50 * time.Millisecond
+	// generateUsers is the number of users that events are attributed to.
+	generateUsers = 1000
+	// generateResources is the number of resources events target.
+	generateResources = 10000
+	megabyte          = 1e6
+)
+
+var defaultGenerateTypes = []string{
+	"UserLogin", "UserLogout", "UserCreate", "UserDelete", "ResourceRead", "ResourceUpdate",
+}
+
+var defaultGenerateOutcomes = []string{
+	auditevent.OutcomeSucceeded, auditevent.OutcomeFailed, auditevent.OutcomeApproved, auditevent.OutcomeDenied,
+}
+
+// generateCmd represents the generate command.
+var generateCmd = NewGenerateCommand()
+
+func NewGenerateCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "generate",
+		Short: "Generate audit events to load test audittail",
+		Long: `Generate audit events to load test audittail.
+
+This writes audit events to the audit log file, which may be a named pipe
+that audittail tails, and reports the throughput and the latencies of the
+writes. Events are written by a number of writers at once, at a given rate
+or as fast as possible.
+
+With --receive, the events audittail outputs are read as well, e.g. from its
+stdout, to report the end to end latencies and the events that were lost:
+
+  audittail -f /app-audit/audit.log | audittail generate -f /app-audit/audit.log --receive -
+
+The exit status is 0 if no event was lost, 1 if events were lost, and 2 if
+events couldn't be generated.`,
+		Args: cobra.MatchAll(cobra.NoArgs, validateCommonArgs),
+		RunE: generateMain,
+	}
+
+	c.Flags().Int("count", defaultGenerateCount, "number of events to generate, or 0 to only stop after --duration")
+	c.Flags().Duration("duration", 0, "how long to generate events for, or 0 to only stop after --count")
+	c.Flags().Float64("rate", 0, "events to generate per second, or 0 to generate them as fast as possible")
+	c.Flags().Int("concurrency", 1, "number of writers generating events at once")
+	c.Flags().StringSlice("types", defaultGenerateTypes, "types of the events")
+	c.Flags().StringSlice("outcomes", defaultGenerateOutcomes, "outcomes of the events")
+	c.Flags().String("component", defaultGenerateComponent, "component of the events")
+	c.Flags().Int("payload-size", 0, "size of the data of every event, in bytes")
+	c.Flags().String("receive", "", "file to read the events audittail outputs from, or '-' for stdin")
+	c.Flags().Duration("receive-timeout", defaultDrainTimeout,
+		"how long to wait for the events to be received once they're all generated")
+	c.Flags().StringP("output", "o", outputText, "format of the report: 'text' or 'json'")
+	c.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return &ExitError{Code: generateExitError, Err: err}
+	})
+
+	return c
+}
+
+//nolint:gochecknoinits // this is a practice recommended by cobra
+func init() {
+	rootCmd.AddCommand(generateCmd)
+}
+
+// generateReport is the machine-readable report of the generate command.
+// Latencies are in seconds.
+type generateReport struct {
+	Events          int64          `json:"events"`
+	Bytes           int64          `json:"bytes"`
+	Seconds         float64        `json:"seconds"`
+	EventsPerSecond float64        `json:"eventsPerSecond"`
+	BytesPerSecond  float64        `json:"bytesPerSecond"`
+	WriteLatency    latencySummary `json:"writeLatency"`
+	// EndToEnd is only set if the events are received
+	EndToEnd *endToEndReport `json:"endToEnd,omitempty"`
+}
+
+type endToEndReport struct {
+	Received   int64          `json:"received"`
+	Lost       int64          `json:"lost"`
+	Duplicated int64          `json:"duplicated"`
+	Latency    latencySummary `json:"latency"`
+}
+
+type latencySummary struct {
+	P50 float64 `json:"p50"`
+	P90 float64 `json:"p90"`
+	P99 float64 `json:"p99"`
+	Max float64 `json:"max"`
+}
+
+// newLatencySummary returns the percentiles of the latencies, which it
+// sorts.
+func newLatencySummary(latencies []time.Duration) latencySummary {
+	if len(latencies) == 0 {
+		return latencySummary{}
+	}
+
+	slices.Sort(latencies)
+	percentile := func(p float64) float64 {
+		i := int(math.Ceil(p*float64(len(latencies)))) - 1
+		return latencies[max(i, 0)].Seconds()
+	}
+
+	//nolint:mnd // These are the percentiles
+	return latencySummary{
+		P50: percentile(0.5),
+		P90: percentile(0.9),
+		P99: percentile(0.99),
+		Max: latencies[len(latencies)-1].Seconds(),
+	}
+}
+
+// generator writes audit events with a number of writers at once.
+type generator struct {
+	run         string
+	count       int64
+	duration    time.Duration
+	rate        float64
+	concurrency int
+	types       []string
+	outcomes    []string
+	component   string
+	payloadSize int
+
+	// next is the sequence number of the last event that was generated
+	next  atomic.Int64
+	bytes atomic.Int64
+}
+
+func newGenerator(cmd *cobra.Command) (*generator, error) {
+	g := &generator{run: uuid.NewString()}
+
+	//nolint:errcheck // This is already verified by cobra
+	count, _ := cmd.Flags().GetInt("count")
+	//nolint:errcheck // This is already verified by cobra
+	g.duration, _ = cmd.Flags().GetDuration("duration")
+	//nolint:errcheck // This is already verified by cobra
+	g.rate, _ = cmd.Flags().GetFloat64("rate")
+	//nolint:errcheck // This is already verified by cobra
+	g.concurrency, _ = cmd.Flags().GetInt("concurrency")
+	//nolint:errcheck // This is already verified by cobra
+	g.types, _ = cmd.Flags().GetStringSlice("types")
+	//nolint:errcheck // This is already verified by cobra
+	g.outcomes, _ = cmd.Flags().GetStringSlice("outcomes")
+	//nolint:errcheck // This is already verified by cobra
+	g.component, _ = cmd.Flags().GetString("component")
+	//nolint:errcheck // This is already verified by cobra
+	g.payloadSize, _ = cmd.Flags().GetInt("payload-size")
+	g.count = int64(count)
+
+	switch {
+	case count < 0:
+		return nil, fmt.Errorf("%w: --count must not be negative", ErrInvalidGenerateOption)
+	case g.duration < 0:
+		return nil, fmt.Errorf("%w: --duration must not be negative", ErrInvalidGenerateOption)
+	case count == 0 && g.duration == 0:
+		return nil, fmt.Errorf("%w: --count or --duration must be set", ErrInvalidGenerateOption)
+	case g.rate < 0:
+		return nil, fmt.Errorf("%w: --rate must not be negative", ErrInvalidGenerateOption)
+	case g.concurrency < 1:
+		return nil, fmt.Errorf("%w: --concurrency must be at least 1", ErrInvalidGenerateOption)
+	case len(g.types) == 0 || len(g.outcomes) == 0:
+		return nil, fmt.Errorf("%w: --types and --outcomes must not be empty", ErrInvalidGenerateOption)
+	case g.payloadSize < 0:
+		return nil, fmt.Errorf("%w: --payload-size must not be negative", ErrInvalidGenerateOption)
+	}
+
+	return g, nil
+}
+
+// generate writes events to w until the count or the duration is
+// reached, or the context is done. It returns the latencies of the writes.
+func (g *generator) generate(ctx context.Context, w io.Writer) ([]time.Duration, error) {
+	if g.duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.duration)
+		defer cancel()
+	}
+
+	start := time.Now()
+	latencies := make([][]time.Duration, g.concurrency)
+	errs := make([]error, g.concurrency)
+
+	cw := &countingWriter{w: w, n: &g.bytes}
+
+	var wg sync.WaitGroup
+	for i := range g.concurrency {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			latencies[i], errs[i] = g.write(ctx, cw, start)
+		}()
+	}
+	wg.Wait()
+
+	return slices.Concat(latencies...), errors.Join(errs...)
+}
+
+// write is a writer, which generates events until there's none left.
+func (g *generator) write(ctx context.Context, w io.Writer, start time.Time) ([]time.Duration, error) {
+	aew := auditevent.NewDefaultAuditEventWriter(w)
+	payload := g.payload()
+
+	var latencies []time.Duration
+	for {
+		seq := g.next.Add(1)
+		if g.count > 0 && seq > g.count {
+			return latencies, nil
+		}
+
+		if g.rate > 0 {
+			due := start.Add(time.Duration(float64(seq-1) / g.rate * float64(time.Second)))
+			select {
+			case <-ctx.Done():
+			case <-time.After(time.Until(due)):
+			}
+		}
+
+		if ctx.Err() != nil {
+			return latencies, nil
+		}
+
+		e := g.event(seq, payload)
+		if err := aew.Write(e); err != nil {
+			return latencies, fmt.Errorf("writing event: %w", err)
+		}
+		latencies = append(latencies, time.Since(e.LoggedAt))
+	}
+}
+
+// event returns a random event of the given types and outcomes, stamped
+// with the run and its sequence number.
+func (g *generator) event(seq int64, payload *json.RawMessage) *auditevent.AuditEvent {
+	//nolint:gosec,mnd // The events only need to look realistic, in private addresses
+	source := auditevent.EventSource{
+		Type:  "IP",
+		Value: fmt.Sprintf("10.%d.%d.%d", rand.IntN(256), rand.IntN(256), rand.IntN(256)),
+	}
+
+	//nolint:gosec // The events only need to look realistic
+	e := auditevent.NewAuditEvent(
+		g.types[rand.IntN(len(g.types))],
+		source,
+		g.outcomes[rand.IntN(len(g.outcomes))],
+		map[string]string{"user": fmt.Sprintf("user-%d@example.com", rand.IntN(generateUsers))},
+		g.component,
+	).WithTarget(map[string]string{
+		"path": fmt.Sprintf("/v1/resources/%d", rand.IntN(generateResources)), //nolint:gosec // See above
+	})
+
+	e.Metadata.Extra = map[string]any{generateRunKey: g.run, generateSeqKey: seq}
+	if payload != nil {
+		e.WithData(payload)
+	}
+
+	return e
+}
+
+// payload returns the data of the events of a writer, which is a JSON
+// object of payloadSize bytes.
+func (g *generator) payload() *json.RawMessage {
+	const (
+		letters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+		prefix  = `{"payload":"`
+		suffix  = `"}`
+	)
+
+	if g.payloadSize == 0 {
+		return nil
+	}
+
+	var b strings.Builder
+	b.WriteString(prefix)
+	for range max(g.payloadSize-len(prefix)-len(suffix), 0) {
+		b.WriteByte(letters[rand.IntN(len(letters))]) //nolint:gosec // The payload only needs to be incompressible
+	}
+	b.WriteString(suffix)
+
+	data := json.RawMessage(b.String())
+	return &data
+}
+
+// countingWriter counts the bytes written to w. The writers share it,
+// and their writes are serialized: a pipe only writes up to PIPE_BUF
+// bytes at once, so larger events would be interleaved otherwise.
+type countingWriter struct {
+	mu sync.Mutex
+	w  io.Writer
+	n  *atomic.Int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	cw.mu.Lock()
+	defer cw.mu.Unlock()
+
+	n, err := cw.w.Write(p)
+	cw.n.Add(int64(n))
+	return n, err //nolint:wrapcheck // It's wrapped by the event writer's caller
+}
+
+// receivedEvent holds the fields of received events that identify the
+// generated ones.
+type receivedEvent struct {
+	LoggedAt time.Time `json:"loggedAt"`
+	Metadata struct {
+		Extra struct {
+			Run string `json:"generatorRun"`
+			Seq int64  `json:"generatorSeq"`
+		} `json:"extra"`
+	} `json:"metadata"`
+}
+
+// eventReceiver reads the events audittail outputs, and keeps track of
+// the events of a run.
+type eventReceiver struct {
+	run string
+
+	mu         sync.Mutex
+	seen       map[int64]bool
+	duplicated int64
+	latencies  []time.Duration
+}
+
+func newEventReceiver(run string) *eventReceiver {
+	return &eventReceiver{run: run, seen: map[int64]bool{}}
+}
+
+// receive reads events from r until the context is done. Once it reaches
+// the end of r, it reads it again after a while, as more may be written.
+func (er *eventReceiver) receive(ctx context.Context, r io.Reader) error {
+	br := bufio.NewReader(r)
+	var line []byte
+	for {
+		chunk, err := br.ReadBytes('\n')
+		line = append(line, chunk...)
+		if err == nil {
+			er.record(line, time.Now())
+			line = line[:0]
+			continue
+		}
+
+		if !errors.Is(err, io.EOF) {
+			return fmt.Errorf("reading received events: %w", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-time.After(generatePollInterval):
+		}
+	}
+}
+
+func (er *eventReceiver) record(line []byte, at time.Time) {
+	e := &receivedEvent{}
+	if err := json.Unmarshal(line, e); err != nil || e.Metadata.Extra.Run != er.run {
+		return
+	}
+
+	er.mu.Lock()
+	defer er.mu.Unlock()
+
+	if er.seen[e.Metadata.Extra.Seq] {
+		er.duplicated++
+		return
+	}
+
+	er.seen[e.Metadata.Extra.Seq] = true
+	er.latencies = append(er.latencies, at.Sub(e.LoggedAt))
+}
+
+// received returns the number of distinct events that were received.
+func (er *eventReceiver) received() int64 {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+
+	return int64(len(er.seen))
+}
+
+// wait waits until the given number of events was received, or the
+// context is done.
+func (er *eventReceiver) wait(ctx context.Context, n int64) {
+	t := time.NewTicker(generatePollInterval)
+	defer t.Stop()
+
+	for er.received() < n {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func (er *eventReceiver) report(generated int64) *endToEndReport {
+	er.mu.Lock()
+	defer er.mu.Unlock()
+
+	received := int64(len(er.seen))
+	return &endToEndReport{
+		Received:   received,
+		Lost:       max(generated-received, 0),
+		Duplicated: er.duplicated,
+		Latency:    newLatencySummary(er.latencies),
+	}
+}
+
+func generateMain(cmd *cobra.Command, _ []string) error {
+	// Lost events aren't usage errors
+	cmd.SilenceUsage = true
+
+	err := generateEvents(cmd)
+
+	var exitErr *ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return &ExitError{Code: generateExitError, Err: err}
+	}
+
+	return err
+}
+
+func generateEvents(cmd *cobra.Command) error {
+	//nolint:errcheck // This is already verified by cobra
+	output, _ := cmd.Flags().GetString("output")
+	if output != outputText && output != outputJSON {
+		return fmt.Errorf("%w: %q", ErrInvalidGenerateOutput, output)
+	}
+
+	g, err := newGenerator(cmd)
+	if err != nil {
+		return err
+	}
+
+	//nolint:errcheck // This is already verified by cobra
+	receiveTimeout, _ := cmd.Flags().GetDuration("receive-timeout")
+	if receiveTimeout < 0 {
+		return fmt.Errorf("%w: --receive-timeout must not be negative", ErrInvalidGenerateOption)
+	}
+
+	ctx := cmd.Context()
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	//nolint:errcheck // This is already verified by cobra
+	receive, _ := cmd.Flags().GetString("receive")
+	var er *eventReceiver
+	if receive != "" {
+		r, err := openReceivedEvents(cmd, receive)
+		if err != nil {
+			return err
+		}
+		defer r.Close()
+
+		er = newEventReceiver(g.run)
+		rctx, stop := context.WithCancel(ctx)
+		defer stop()
+
+		errc := make(chan error, 1)
+		go func() { errc <- er.receive(rctx, r) }()
+		defer func() {
+			stop()
+			// Reads from stdin or a pipe may block, in which case the
+			// receiver is left behind
+			select {
+			case <-errc:
+			case <-time.After(generatePollInterval):
+			}
+		}()
+	}
+
+	//nolint:errcheck // This is already verified by cobra
+	file, _ := cmd.Flags().GetString("file")
+	w, err := openGenerateTarget(cmd, file)
+	if err != nil {
+		return err
+	}
+
+	start := time.Now()
+	latencies, err := g.generate(ctx, w)
+	elapsed := time.Since(start)
+	if cerr := w.Close(); err == nil && cerr != nil {
+		err = fmt.Errorf("closing audit log: %w", cerr)
+	}
+	if err != nil {
+		return err
+	}
+
+	report := &generateReport{
+		Events:       int64(len(latencies)),
+		Bytes:        g.bytes.Load(),
+		Seconds:      elapsed.Seconds(),
+		WriteLatency: newLatencySummary(latencies),
+	}
+	if elapsed > 0 {
+		report.EventsPerSecond = float64(report.Events) / elapsed.Seconds()
+		report.BytesPerSecond = float64(report.Bytes) / elapsed.Seconds()
+	}
+
+	if er != nil {
+		wctx, cancel := context.WithTimeout(ctx, receiveTimeout)
+		er.wait(wctx, report.Events)
+		cancel()
+		report.EndToEnd = er.report(report.Events)
+	}
+
+	if output == outputJSON {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return fmt.Errorf("writing report: %w", err)
+		}
+	} else if err := report.print(cmd.OutOrStdout()); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+
+	if report.EndToEnd != nil && report.EndToEnd.Lost > 0 {
+		return &ExitError{
+			Code: generateExitLost,
+			Err:  fmt.Errorf("%w: %d of %d events", ErrEventsLost, report.EndToEnd.Lost, report.Events),
+		}
+	}
+
+	return nil
+}
+
+// openGenerateTarget opens the audit log events are generated to. If it's
+// a named pipe, this waits until audittail opens it too.
+func openGenerateTarget(cmd *cobra.Command, file string) (*os.File, error) {
+	if info, err := os.Stat(file); err == nil && info.Mode()&os.ModeNamedPipe != 0 {
+		fmt.Fprintf(cmd.ErrOrStderr(), "audittail: waiting for %s to be tailed\n", file)
+	}
+
+	f, err := os.OpenFile(file, os.O_WRONLY|os.O_APPEND|os.O_CREATE, ownerGroupOwnership)
+	if err != nil {
+		return nil, fmt.Errorf("opening audit log: %w", err)
+	}
+
+	return f, nil
+}
+
+// openReceivedEvents opens the file received events are read from. Named
+// pipes are opened without waiting for a writer, as audittail may only
+// open them once events are generated.
+func openReceivedEvents(cmd *cobra.Command, name string) (io.ReadCloser, error) {
+	if name == stdinLogName {
+		return io.NopCloser(cmd.InOrStdin()), nil
+	}
+
+	f, err := os.OpenFile(name, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		return nil, fmt.Errorf("opening received events: %w", err)
+	}
+
+	return f, nil
+}
+
+func (r *generateReport) print(w io.Writer) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "generated %d events (%.1f MB) in %s: %.1f events/s, %.1f MB/s\n",
+		r.Events, float64(r.Bytes)/megabyte, roundDuration(r.Seconds),
+		r.EventsPerSecond, r.BytesPerSecond/megabyte)
+	fmt.Fprintf(&b, "write latency: %s\n", r.WriteLatency)
+
+	if r.EndToEnd != nil {
+		fmt.Fprintf(&b, "received %d events end to end: %d lost, %d duplicated\n",
+			r.EndToEnd.Received, r.EndToEnd.Lost, r.EndToEnd.Duplicated)
+		fmt.Fprintf(&b, "end to end latency: %s\n", r.EndToEnd.Latency)
+	}
+
+	_, err := io.WriteString(w, b.String())
+
+	return err //nolint:wrapcheck // It's wrapped by the caller
+}
+
+func (l latencySummary) String() string {
+	return fmt.Sprintf("p50 %s, p90 %s, p99 %s, max %s",
+		roundDuration(l.P50), roundDuration(l.P90), roundDuration(l.P99), roundDuration(l.Max))
+}
+
+// roundDuration returns a duration in seconds as a duration to the
+// microsecond.
+func roundDuration(seconds float64) time.Duration {
+	return time.Duration(seconds * float64(time.Second)).Round(time.Microsecond)
+}
@@ -0,0 +1,181 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+func runGenerate(t *testing.T, args ...string) (stdout string, err error) {
+	t.Helper()
+
+	c := NewRootCmd()
+	c.AddCommand(NewGenerateCommand())
+	var out bytes.Buffer
+	c.SetOut(&out)
+	c.SetErr(&bytes.Buffer{})
+	c.SetArgs(append([]string{"generate"}, args...))
+
+	err = c.Execute()
+
+	return out.String(), err
+}
+
+func TestGenerateWritesEvents(t *testing.T) {
+	t.Parallel()
+
+	log := filepath.Join(t.TempDir(), "audit.log")
+
+	out, err := runGenerate(t, "-f", log, "--count", "50", "--concurrency", "3", "--payload-size", "200",
+		"--types", "UserLogin", "--outcomes", "denied", "--component", "api", "-o", "json")
+	require.NoError(t, err)
+
+	report := &generateReport{}
+	require.NoError(t, json.Unmarshal([]byte(out), report))
+	require.Equal(t, int64(50), report.Events)
+	require.Nil(t, report.EndToEnd, "events shouldn't be received unless asked to")
+
+	b, err := os.ReadFile(log)
+	require.NoError(t, err)
+	require.Equal(t, int64(len(b)), report.Bytes)
+
+	seqs := map[float64]bool{}
+	for _, line := range strings.Split(strings.TrimSuffix(string(b), "\n"), "\n") {
+		e := &auditevent.AuditEvent{}
+		require.NoError(t, json.Unmarshal([]byte(line), e))
+		require.NoError(t, e.Validate())
+		require.Equal(t, "UserLogin", e.Type)
+		require.Equal(t, auditevent.OutcomeDenied, e.Outcome)
+		require.Equal(t, "api", e.Component)
+		require.Len(t, *e.Data, 200)
+
+		seq, ok := e.Metadata.Extra[generateSeqKey].(float64)
+		require.True(t, ok, "events should have a sequence number")
+		seqs[seq] = true
+	}
+	require.Len(t, seqs, 50, "every event should have its own sequence number")
+}
+
+func TestGenerateDoesntInterleaveLargeEvents(t *testing.T) {
+	t.Parallel()
+
+	// Pipes only write up to PIPE_BUF (4096) bytes at once
+	pipe := filepath.Join(t.TempDir(), "audit.pipe")
+	require.NoError(t, syscall.Mkfifo(pipe, ownerGroupOwnership))
+
+	read := make(chan []byte, 1)
+	go func() {
+		f, err := os.Open(pipe)
+		if err != nil {
+			read <- nil
+			return
+		}
+		defer f.Close()
+
+		// The writers wait on the pipe once it's full
+		time.Sleep(50 * time.Millisecond)
+		b, _ := io.ReadAll(f) //nolint:errcheck // An error shows as missing events
+		read <- b
+	}()
+
+	_, err := runGenerate(t, "-f", pipe, "--count", "40", "--concurrency", "8", "--payload-size", "20000")
+	require.NoError(t, err)
+
+	lines := strings.Split(strings.TrimSuffix(string(<-read), "\n"), "\n")
+	require.Len(t, lines, 40)
+	for _, line := range lines {
+		require.True(t, json.Valid([]byte(line)), "events shouldn't be interleaved")
+	}
+}
+
+func TestGenerateReceivesEvents(t *testing.T) {
+	t.Parallel()
+
+	// Events written to a regular file are received from it as is
+	log := filepath.Join(t.TempDir(), "audit.log")
+	require.NoError(t, os.WriteFile(log, []byte("not an event\n"), ownerGroupOwnership))
+
+	out, err := runGenerate(t, "-f", log, "--count", "20", "--rate", "1000", "--receive", log)
+	require.NoError(t, err)
+	require.Contains(t, out, "generated 20 events")
+	require.Contains(t, out, "received 20 events end to end: 0 lost, 0 duplicated\n")
+
+	// Events of other runs are ignored
+	out, err = runGenerate(t, "-f", log, "--count", "20", "--receive", log, "-o", "json")
+	require.NoError(t, err)
+
+	report := &generateReport{}
+	require.NoError(t, json.Unmarshal([]byte(out), report))
+	require.Equal(t, &endToEndReport{Received: 20, Latency: report.EndToEnd.Latency}, report.EndToEnd)
+	require.Positive(t, report.EndToEnd.Latency.Max)
+}
+
+func TestGenerateReportsLostEvents(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	received := filepath.Join(dir, "received.log")
+	require.NoError(t, os.WriteFile(received, nil, ownerGroupOwnership))
+
+	out, err := runGenerate(t, "-f", filepath.Join(dir, "audit.log"), "--count", "10",
+		"--receive", received, "--receive-timeout", "100ms")
+	requireExitCode(t, err, generateExitLost)
+	require.ErrorIs(t, err, ErrEventsLost)
+	require.Contains(t, out, "received 0 events end to end: 10 lost, 0 duplicated\n")
+}
+
+func TestGenerateErrors(t *testing.T) {
+	t.Parallel()
+
+	log := filepath.Join(t.TempDir(), "audit.log")
+
+	_, err := runGenerate(t)
+	require.ErrorIs(t, err, ErrFileRequired)
+
+	for _, args := range [][]string{
+		{"--count", "0"},
+		{"--count", "-1"},
+		{"--concurrency", "0"},
+		{"--rate", "-5"},
+		{"--types", ""},
+		{"--payload-size", "-1"},
+	} {
+		_, err = runGenerate(t, append([]string{"-f", log}, args...)...)
+		requireExitCode(t, err, generateExitError)
+		require.ErrorIs(t, err, ErrInvalidGenerateOption, "args: %v", args)
+	}
+
+	_, err = runGenerate(t, "-f", log, "-o", "xml")
+	require.ErrorIs(t, err, ErrInvalidGenerateOutput)
+
+	_, err = runGenerate(t, "-f", log, "--count", "many")
+	requireExitCode(t, err, generateExitError)
+
+	_, err = runGenerate(t, "-f", log, "--receive", filepath.Join(t.TempDir(), "missing.log"))
+	requireExitCode(t, err, generateExitError)
+}
@@ -0,0 +1,163 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+const (
+	// readyStallTimeout is how long the tail loop may go without reading
+	// the audit log before audittail isn't ready anymore, e.g. because the
+	// sink blocks.
+	readyStallTimeout = 30 * time.Second
+
+	metricsReadHeaderTimeout = 5 * time.Second
+	metricsShutdownTimeout   = 5 * time.Second
+)
+
+// tailHealth tracks the tail loop for the health probes. Its methods
+// are no-ops on a nil instance.
+type tailHealth struct {
+	// lastRead is when the tail loop last read the audit log, in Unix nanoseconds
+	lastRead atomic.Int64
+	stopped  atomic.Bool
+	// failingSinks is the number of spools whose sink fails
+	failingSinks atomic.Int64
+}
+
+// read records that the tail loop read the audit log.
+func (h *tailHealth) read() {
+	if h == nil {
+		return
+	}
+
+	h.lastRead.Store(time.Now().UnixNano())
+}
+
+// stop records that the tail loop stopped.
+func (h *tailHealth) stop() {
+	if h == nil {
+		return
+	}
+
+	h.stopped.Store(true)
+}
+
+// sinkFailed records that a spool failed to send events to its sink.
+func (h *tailHealth) sinkFailed() {
+	if h == nil {
+		return
+	}
+
+	h.failingSinks.Add(1)
+}
+
+// sinkRecovered records that a spool sends events to its sink again.
+func (h *tailHealth) sinkRecovered() {
+	if h == nil {
+		return
+	}
+
+	h.failingSinks.Add(-1)
+}
+
+// alive tells whether the tail loop is running.
+func (h *tailHealth) alive() bool {
+	return !h.stopped.Load()
+}
+
+// ready tells whether the tail loop is running and read the audit log
+// recently, and whether the spooled events can be sent.
+func (h *tailHealth) ready() bool {
+	lastRead := h.lastRead.Load()
+	return h.alive() && lastRead != 0 && time.Since(time.Unix(0, lastRead)) < readyStallTimeout &&
+		h.failingSinks.Load() == 0
+}
+
+// newMetricsRegistry returns a registry with the Go runtime and process
+// metrics, besides audittail's.
+func newMetricsRegistry() (*prometheus.Registry, *tailMetrics) {
+	reg := prometheus.NewRegistry()
+	reg.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+
+	return reg, newTailMetrics(reg)
+}
+
+// startMetricsServer serves the metrics in reg on /metrics, and the
+// liveness and readiness probes on /healthz and /readyz.
+func startMetricsServer(ctx context.Context, addr string, reg *prometheus.Registry, h *tailHealth) (*http.Server, error) {
+	mux := http.NewServeMux()
+	mux.Handle("GET /metrics", promhttp.HandlerFor(reg, promhttp.HandlerOpts{}))
+	mux.HandleFunc("GET /healthz", probeHandler(h.alive))
+	mux.HandleFunc("GET /readyz", probeHandler(h.ready))
+
+	lc := &net.ListenConfig{}
+	l, err := lc.Listen(ctx, "tcp", addr)
+	if err != nil {
+		return nil, fmt.Errorf("listening for metrics: %w", err)
+	}
+
+	srv := &http.Server{
+		Addr:              l.Addr().String(),
+		Handler:           mux,
+		ReadHeaderTimeout: metricsReadHeaderTimeout,
+	}
+
+	go func() {
+		//nolint:errcheck // It only fails once it's shut down
+		srv.Serve(l)
+	}()
+
+	return srv, nil
+}
+
+// stopMetricsServer shuts the server down, waiting for the ongoing requests.
+func stopMetricsServer(srv *http.Server) error {
+	ctx, cancel := context.WithTimeout(context.Background(), metricsShutdownTimeout)
+	defer cancel()
+
+	if err := srv.Shutdown(ctx); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return fmt.Errorf("stopping metrics server: %w", err)
+	}
+
+	return nil
+}
+
+func probeHandler(ok func() bool) http.HandlerFunc {
+	return func(w http.ResponseWriter, _ *http.Request) {
+		if !ok() {
+			http.Error(w, http.StatusText(http.StatusServiceUnavailable), http.StatusServiceUnavailable)
+			return
+		}
+
+		//nolint:errcheck // The probe only needs the status
+		w.Write([]byte("ok\n"))
+	}
+}
@@ -17,6 +17,8 @@ package cmd
 
 import (
 	"fmt"
+	"os"
+	"strconv"
 
 	"github.com/spf13/cobra"
 )
@@ -25,16 +27,32 @@ import (
 var initCmd = NewInitCommand()
 
 func NewInitCommand() *cobra.Command {
-	return &cobra.Command{
+	c := &cobra.Command{
 		Use:   "init",
 		Short: "Initialize an audit log file to tail",
 		Long: `Initialize an audit log file to tail.
 
 This initializes an audit log file as a named pipe in order to tail it.
-This is useful to run in an init container to ensure the file is ready.`,
+This is useful to run in an init container to ensure the file is ready.
+
+The named pipe is created with --mode, and owned by --uid and --gid if they're
+given. If it already exists, they're only set if given explicitly.
+
+With --app-uid, this checks that the application, which runs as that user
+with --app-gid and --app-groups, can open the named pipe for writing, and
+fails with the reason if it can't.`,
 		Args: cobra.MatchAll(cobra.OnlyValidArgs, validateCommonArgs),
 		RunE: initTailFile,
 	}
+
+	c.Flags().String("mode", fmt.Sprintf("%04o", ownerGroupOwnership), "permission mode of the named pipe, in octal")
+	c.Flags().Int("uid", -1, "user ID to own the named pipe, or -1 for the user of audittail")
+	c.Flags().Int("gid", -1, "group ID to own the named pipe, or -1 for the group of audittail")
+	c.Flags().Int("app-uid", -1, "user ID the application writes audit events as, to check that it can")
+	c.Flags().Int("app-gid", -1, "primary group ID of the application")
+	c.Flags().IntSlice("app-groups", nil, "supplementary group IDs of the application, e.g. the fsGroup of the pod")
+
+	return c
 }
 
 //nolint:gochecknoinits // this is a practice recommended by cobra
@@ -46,14 +64,73 @@ func initTailFile(cmd *cobra.Command, _ []string) error {
 	//nolint:errcheck // This is already verified by cobra
 	f, _ := cmd.Flags().GetString("file")
 
-	if err := createNamedPipe(f); err != nil {
+	own, err := pipeOwnershipFromFlags(cmd)
+	if err != nil {
+		return err
+	}
+
+	// Failing to create or check the named pipe isn't a usage error
+	cmd.SilenceUsage = true
+
+	_, statErr := os.Stat(f)
+	existed := statErr == nil
+
+	if err := createNamedPipe(f, own); err != nil {
 		return err
 	}
 
+	changed := cmd.Flags().Changed("mode") || cmd.Flags().Changed("uid") || cmd.Flags().Changed("gid")
+	if existed && changed {
+		if err := setPipeOwnership(f, own); err != nil {
+			return err
+		}
+	}
+
 	_, werr := fmt.Fprintf(cmd.OutOrStdout(), "Created named pipe %s\n", f)
 	if werr != nil {
 		return fmt.Errorf("writing to stdout: %w", werr)
 	}
 
+	//nolint:errcheck // This is already verified by cobra
+	appUID, _ := cmd.Flags().GetInt("app-uid")
+	if appUID == -1 {
+		return nil
+	}
+
+	u := &appUser{uid: appUID}
+	//nolint:errcheck // This is already verified by cobra
+	u.gid, _ = cmd.Flags().GetInt("app-gid")
+	//nolint:errcheck // This is already verified by cobra
+	u.groups, _ = cmd.Flags().GetIntSlice("app-groups")
+
+	if err := checkPipeWritable(f, u); err != nil {
+		return err
+	}
+
+	_, werr = fmt.Fprintf(cmd.OutOrStdout(), "Checked that %s can write to %s\n", u, f)
+	if werr != nil {
+		return fmt.Errorf("writing to stdout: %w", werr)
+	}
+
 	return nil
 }
+
+// pipeOwnershipFromFlags returns the mode and the owner of the named pipe.
+func pipeOwnershipFromFlags(cmd *cobra.Command) (pipeOwnership, error) {
+	own := pipeOwnership{}
+
+	//nolint:errcheck // This is already verified by cobra
+	mode, _ := cmd.Flags().GetString("mode")
+	perm, err := strconv.ParseUint(mode, 8, 32)
+	if err != nil || perm > uint64(os.ModePerm) {
+		return own, fmt.Errorf("%w: %q", ErrInvalidPipeMode, mode)
+	}
+	own.mode = os.FileMode(perm)
+
+	//nolint:errcheck // This is already verified by cobra
+	own.uid, _ = cmd.Flags().GetInt("uid")
+	//nolint:errcheck // This is already verified by cobra
+	own.gid, _ = cmd.Flags().GetInt("gid")
+
+	return own, nil
+}
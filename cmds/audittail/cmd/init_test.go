@@ -19,6 +19,7 @@ import (
 	"bytes"
 	"os"
 	"path/filepath"
+	"strconv"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -166,3 +167,75 @@ func TestInitSucceedsEvenIfFileAlreadyExists(t *testing.T) {
 	err = c.Execute()
 	require.NoError(t, err, "unexpected error in second call")
 }
+
+func runInit(t *testing.T, args ...string) (string, error) {
+	t.Helper()
+
+	c := NewRootCmd()
+	buf := bytes.NewBufferString("")
+	c.SetOut(buf)
+	c.SetErr(bytes.NewBufferString(""))
+	c.AddCommand(NewInitCommand())
+	c.SetArgs(append([]string{"init"}, args...))
+
+	err := c.Execute()
+
+	return buf.String(), err
+}
+
+func TestInitSetsModeAndOwner(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+
+	// Only root may give files away, so the pipe is given to the user
+	// and group of the test
+	uid, gid := strconv.Itoa(os.Getuid()), strconv.Itoa(os.Getgid())
+	_, err := runInit(t, "-f", path, "--mode", "0662", "--uid", uid, "--gid", gid)
+	require.NoError(t, err)
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	require.NotZero(t, info.Mode()&os.ModeNamedPipe, "a named pipe should be created")
+	require.Equal(t, os.FileMode(0o662), info.Mode().Perm(), "the mode shouldn't be masked by the umask")
+
+	// The mode of an existing pipe is only changed if it's given
+	_, err = runInit(t, "-f", path)
+	require.NoError(t, err)
+	info, err = os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o662), info.Mode().Perm())
+
+	_, err = runInit(t, "-f", path, "--mode", "600")
+	require.NoError(t, err)
+	info, err = os.Stat(path)
+	require.NoError(t, err)
+	require.Equal(t, os.FileMode(0o600), info.Mode().Perm())
+
+	for _, mode := range []string{"rw-r-----", "0o640", "1777", "0999"} {
+		_, err = runInit(t, "-f", path, "--mode", mode)
+		require.ErrorIs(t, err, ErrInvalidPipeMode, "mode: %s", mode)
+	}
+}
+
+func TestInitChecksTheAppCanWrite(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	// The directory of the temporary directories of the test isn't
+	// searchable by others
+	require.NoError(t, os.Chmod(filepath.Dir(dir), 0o755))
+
+	out, err := runInit(t, "-f", path, "--app-uid", strconv.Itoa(os.Getuid()))
+	require.NoError(t, err)
+	require.Contains(t, out, "Checked that uid "+strconv.Itoa(os.Getuid())+" can write to "+path)
+
+	// Nobody else may write with the default mode
+	const otherUID = "65533"
+	_, err = runInit(t, "-f", path, "--app-uid", otherUID, "--app-gid", otherUID)
+	require.ErrorIs(t, err, ErrPipeNotWritable)
+
+	_, err = runInit(t, "-f", path, "--mode", "0622", "--app-uid", otherUID, "--app-gid", otherUID)
+	require.NoError(t, err)
+}
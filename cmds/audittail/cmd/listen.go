@@ -0,0 +1,348 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+const (
+	// socketMode lets the group of audittail connect to its socket.
+	socketMode = 0o660
+	// socketMaxDatagramSize is the largest datagram that's read whole.
+	// Longer ones are cut short, so they're quarantined.
+	socketMaxDatagramSize = 4 << 20
+	// socketDrainIdle is how long new connections and datagrams are
+	// waited for once shutdown is requested, as the socket itself is
+	// never closed by its writers.
+	socketDrainIdle = 100 * time.Millisecond
+	// socketHealthInterval is how often the tail loop reports that
+	// it's alive while no events are received.
+	socketHealthInterval = time.Second
+)
+
+// socketLine is a line received on the socket. unfinished is set for
+// the trailing line of a connection that was closed before finishing it.
+type socketLine struct {
+	b          []byte
+	unfinished bool
+}
+
+// socketListener receives events on a Unix stream or datagram socket.
+// Every connection of a stream socket is read on its own, so events of
+// several writers are never interleaved.
+type socketListener struct {
+	path string
+	// ln is set for stream sockets, and pc for datagram sockets
+	ln *net.UnixListener
+	pc *net.UnixConn
+
+	lines chan socketLine
+	// stop is closed once the listener is closed, so readers stop
+	stop      chan struct{}
+	closeOnce sync.Once
+	wg        sync.WaitGroup
+	// abandoned is set if the drain deadline passed while reading
+	abandoned atomic.Bool
+
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{}
+	draining bool
+	deadline time.Time
+}
+
+// newSocketListener listens on the socket of a unix:// or unixgram:// URL,
+// replacing the socket left over from a previous run.
+func newSocketListener(rawURL string) (*socketListener, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Path == "" ||
+		(u.Scheme != auditevent.UnixSocketStream && u.Scheme != auditevent.UnixSocketDatagram) {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidListenURL, rawURL)
+	}
+
+	if info, err := os.Lstat(u.Path); err == nil && info.Mode()&os.ModeSocket != 0 {
+		if err := os.Remove(u.Path); err != nil {
+			return nil, fmt.Errorf("removing stale socket: %w", err)
+		}
+	}
+
+	sl := &socketListener{
+		path:  u.Path,
+		lines: make(chan socketLine),
+		stop:  make(chan struct{}),
+		conns: map[net.Conn]struct{}{},
+	}
+
+	addr := &net.UnixAddr{Name: u.Path, Net: u.Scheme}
+	if u.Scheme == auditevent.UnixSocketStream {
+		sl.ln, err = net.ListenUnix(u.Scheme, addr)
+	} else {
+		sl.pc, err = net.ListenUnixgram(u.Scheme, addr)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("listening on socket: %w", err)
+	}
+
+	//nolint:gosec // The group of audittail is meant to connect to the socket
+	if err := os.Chmod(u.Path, socketMode); err != nil {
+		sl.close()
+		return nil, fmt.Errorf("listening on socket: %w", err)
+	}
+
+	return sl, nil
+}
+
+// serve reads events until ctx is cancelled. It then drains the socket
+// until the writers close their connections and no connection or
+// datagram arrives for a while, or the drain timeout passes. The lines
+// channel is closed once it's done.
+func (sl *socketListener) serve(ctx context.Context, drainTimeout time.Duration) {
+	sl.wg.Add(1)
+	if sl.ln != nil {
+		go sl.accept()
+	} else {
+		go sl.readDatagrams()
+	}
+
+	context.AfterFunc(ctx, func() {
+		sl.drain(drainTimeout)
+	})
+
+	go func() {
+		sl.wg.Wait()
+		close(sl.lines)
+	}()
+}
+
+func (sl *socketListener) accept() {
+	defer sl.wg.Done()
+
+	for {
+		conn, err := sl.ln.Accept()
+		if errors.Is(err, net.ErrClosed) || errors.Is(err, os.ErrDeadlineExceeded) {
+			return
+		}
+		if err != nil {
+			// e.g. too many open files, which may not last
+			time.Sleep(defaultConstantBackoff)
+			continue
+		}
+
+		sl.mu.Lock()
+		if sl.draining {
+			//nolint:errcheck // Without a deadline, the drain only stops once the writer is gone
+			conn.SetReadDeadline(sl.deadline)
+			//nolint:errcheck // The drain is bounded by the drain deadline anyway
+			sl.ln.SetDeadline(sl.drainReadDeadline())
+		}
+		sl.conns[conn] = struct{}{}
+		sl.mu.Unlock()
+
+		sl.wg.Add(1)
+		go sl.readStream(conn)
+	}
+}
+
+func (sl *socketListener) readStream(conn net.Conn) {
+	defer sl.wg.Done()
+	defer func() {
+		sl.mu.Lock()
+		delete(sl.conns, conn)
+		sl.mu.Unlock()
+		conn.Close()
+	}()
+
+	br := bufio.NewReader(conn)
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == nil {
+			if !sl.send(socketLine{b: line}) {
+				return
+			}
+			continue
+		}
+
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			sl.abandoned.Store(true)
+		}
+
+		// A line that was never finished can't be an event
+		if len(line) > 0 {
+			sl.send(socketLine{b: line, unfinished: true})
+		}
+
+		return
+	}
+}
+
+// readDatagrams reads datagrams, which hold one or more whole events.
+func (sl *socketListener) readDatagrams() {
+	defer sl.wg.Done()
+
+	buf := make([]byte, socketMaxDatagramSize)
+	for {
+		n, err := sl.pc.Read(buf)
+		if err != nil {
+			sl.mu.Lock()
+			if errors.Is(err, os.ErrDeadlineExceeded) && !time.Now().Before(sl.deadline) {
+				sl.abandoned.Store(true)
+			}
+			sl.mu.Unlock()
+			return
+		}
+
+		for _, line := range bytes.SplitAfter(buf[:n], []byte("\n")) {
+			if len(line) > 0 && !sl.send(socketLine{b: bytes.Clone(line)}) {
+				return
+			}
+		}
+
+		sl.mu.Lock()
+		if sl.draining {
+			//nolint:errcheck // The drain is bounded by the drain deadline anyway
+			sl.pc.SetReadDeadline(sl.drainReadDeadline())
+		}
+		sl.mu.Unlock()
+	}
+}
+
+// drain sets the deadline of the reads that are left. Connections that
+// are waiting to be accepted, and datagrams, are taken until none
+// arrives for a while.
+func (sl *socketListener) drain(timeout time.Duration) {
+	sl.mu.Lock()
+	defer sl.mu.Unlock()
+
+	sl.draining = true
+	sl.deadline = time.Now().Add(timeout)
+
+	if sl.pc != nil {
+		//nolint:errcheck // The drain is bounded by the drain deadline anyway
+		sl.pc.SetReadDeadline(sl.drainReadDeadline())
+		return
+	}
+
+	//nolint:errcheck // The drain is bounded by the drain deadline anyway
+	sl.ln.SetDeadline(sl.drainReadDeadline())
+	for conn := range sl.conns {
+		//nolint:errcheck // Without a deadline, the drain only stops once the writer is gone
+		conn.SetReadDeadline(sl.deadline)
+	}
+}
+
+// drainReadDeadline returns the deadline of the next accept or datagram
+// read while draining. sl.mu must be held.
+func (sl *socketListener) drainReadDeadline() time.Time {
+	idle := time.Now().Add(socketDrainIdle)
+	if idle.Before(sl.deadline) {
+		return idle
+	}
+
+	return sl.deadline
+}
+
+// send hands a line to the tail loop, unless the listener is closed.
+func (sl *socketListener) send(l socketLine) bool {
+	select {
+	case sl.lines <- l:
+		return true
+	case <-sl.stop:
+		return false
+	}
+}
+
+// close stops reading and removes the socket. It's safe to call more than once.
+func (sl *socketListener) close() {
+	sl.closeOnce.Do(func() {
+		close(sl.stop)
+
+		sl.mu.Lock()
+		defer sl.mu.Unlock()
+
+		if sl.ln != nil {
+			// Closing the listener removes the socket
+			sl.ln.Close()
+		} else {
+			sl.pc.Close()
+			os.Remove(sl.path)
+		}
+
+		for conn := range sl.conns {
+			conn.Close()
+		}
+	})
+}
+
+// tailSocket forwards the events received on the socket until ctx is
+// cancelled and the socket is drained.
+func (ft *fileTailer) tailSocket(ctx context.Context, sl *socketListener) error {
+	defer ft.health.stop()
+	defer sl.close()
+
+	sl.serve(ctx, ft.drainTimeout)
+
+	ticker := time.NewTicker(socketHealthInterval)
+	defer ticker.Stop()
+
+	ft.health.read()
+	for {
+		select {
+		case l, ok := <-sl.lines:
+			if !ok {
+				ft.report.abandoned = sl.abandoned.Load()
+				return nil
+			}
+
+			if err := ft.forwardSocketLine(ctx, l); err != nil {
+				return fmt.Errorf("tail socket: %w", err)
+			}
+			ft.health.read()
+		case <-ticker.C:
+			ft.health.read()
+		}
+	}
+}
+
+func (ft *fileTailer) forwardSocketLine(ctx context.Context, l socketLine) error {
+	if l.unfinished {
+		if ctx.Err() != nil {
+			ft.report.unfinished += len(l.b)
+		}
+		return writeLine(ft.quarantine, l.b)
+	}
+
+	if err := ft.forward(l.b); err != nil {
+		return err
+	}
+
+	if ctx.Err() != nil {
+		ft.report.drainedLines++
+	}
+
+	return nil
+}
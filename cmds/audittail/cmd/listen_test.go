@@ -0,0 +1,196 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+// socketTailer runs a tailer on a socket until its context is cancelled.
+type socketTailer struct {
+	ft         *fileTailer
+	out        syncBuffer
+	quarantine syncBuffer
+	cancel     context.CancelFunc
+	errs       chan error
+}
+
+func startSocketTailer(t *testing.T, rawURL string, drainTimeout time.Duration) *socketTailer {
+	t.Helper()
+
+	sl, err := newSocketListener(rawURL)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(t.Context())
+	st := &socketTailer{cancel: cancel, errs: make(chan error, 1)}
+	st.ft = &fileTailer{w: &st.out, quarantine: &st.quarantine, drainTimeout: drainTimeout}
+
+	go func() {
+		st.errs <- st.ft.tailSocket(ctx, sl)
+	}()
+	t.Cleanup(cancel)
+
+	return st
+}
+
+func (st *socketTailer) requireEvents(t *testing.T, want []string) {
+	t.Helper()
+
+	slices.Sort(want)
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		got := strings.Split(strings.TrimSuffix(st.out.String(), "\n"), "\n")
+		slices.Sort(got)
+		assert.Equal(c, want, got)
+	}, time.Second, 5*time.Millisecond)
+}
+
+func newTestSocketWriter(t *testing.T, network, path string) *auditevent.UnixSocketWriter {
+	t.Helper()
+
+	w, err := auditevent.NewUnixSocketWriter(network, path)
+	require.NoError(t, err)
+	t.Cleanup(func() { w.Close() })
+
+	return w
+}
+
+func TestSocketListenerStream(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit.sock")
+	st := startSocketTailer(t, "unix://"+path, 10*time.Second)
+
+	// Events of several writers aren't interleaved, whatever their size
+	big := `{"metadata":{"auditId":"big"},"type":"big","loggedAt":"2026-01-01T00:00:00Z","data":"` +
+		strings.Repeat("a", 1<<20) + `"}`
+	w1 := newTestSocketWriter(t, auditevent.UnixSocketStream, path)
+	w2 := newTestSocketWriter(t, auditevent.UnixSocketStream, path)
+	done := make(chan error)
+	go func() {
+		_, err := w1.Write([]byte(big + "\n"))
+		done <- err
+	}()
+	_, err := w2.Write([]byte(spoolTestEvent(0) + "\n"))
+	require.NoError(t, err)
+	require.NoError(t, <-done)
+
+	st.requireEvents(t, []string{big, spoolTestEvent(0)})
+
+	// A writer that's still connected once shutdown is requested is
+	// read until it closes the connection
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	_, err = conn.Write([]byte(spoolTestEvent(1)[:10]))
+	require.NoError(t, err)
+
+	st.cancel()
+	_, err = conn.Write([]byte(spoolTestEvent(1)[10:] + "\n" + `{"type":`))
+	require.NoError(t, err)
+	require.NoError(t, w1.Close())
+	require.NoError(t, w2.Close())
+	require.NoError(t, conn.Close())
+
+	require.NoError(t, <-st.errs)
+	st.requireEvents(t, []string{big, spoolTestEvent(0), spoolTestEvent(1)})
+	require.Equal(t, "{\"type\":\n", st.quarantine.String())
+	require.Equal(t, drainReport{drainedLines: 1, unfinished: len(`{"type":`)}, st.ft.report)
+
+	_, err = os.Stat(path)
+	require.ErrorIs(t, err, os.ErrNotExist, "the socket should be removed")
+}
+
+func TestSocketListenerDatagram(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit.sock")
+	st := startSocketTailer(t, "unixgram://"+path, 10*time.Second)
+
+	w := newTestSocketWriter(t, auditevent.UnixSocketDatagram, path)
+	aew := auditevent.NewDefaultAuditEventWriter(w)
+	for _, typ := range []string{"first", "second"} {
+		require.NoError(t, aew.Write(auditevent.NewAuditEvent(typ, auditevent.EventSource{}, "succeeded", nil, "test")))
+	}
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, 2, strings.Count(st.out.String(), "\n"))
+	}, time.Second, 5*time.Millisecond)
+
+	// The drain stops once no datagram arrives for a while
+	start := time.Now()
+	st.cancel()
+	require.NoError(t, <-st.errs)
+	require.Less(t, time.Since(start), time.Second)
+	require.False(t, st.ft.report.abandoned)
+
+	_, err := os.Stat(path)
+	require.ErrorIs(t, err, os.ErrNotExist, "the socket should be removed")
+}
+
+func TestSocketListenerAbandonsAfterDrainTimeout(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit.sock")
+	st := startSocketTailer(t, "unix://"+path, 50*time.Millisecond)
+
+	conn, err := net.Dial("unix", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	_, err = conn.Write([]byte(spoolTestEvent(0) + "\n"))
+	require.NoError(t, err)
+	st.requireEvents(t, []string{spoolTestEvent(0)})
+
+	st.cancel()
+	require.NoError(t, <-st.errs)
+	require.True(t, st.ft.report.abandoned)
+}
+
+func TestNewSocketListener(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	for _, rawURL := range []string{"tcp://localhost:514", "unix://", "unixgram:relative.sock"} {
+		_, err := newSocketListener(rawURL)
+		require.ErrorIs(t, err, ErrInvalidListenURL, rawURL)
+	}
+
+	// A socket left over by a previous run is replaced
+	path := filepath.Join(dir, "audit.sock")
+	pc, err := net.ListenUnixgram("unixgram", &net.UnixAddr{Name: path, Net: "unixgram"})
+	require.NoError(t, err)
+	require.NoError(t, pc.Close())
+
+	sl, err := newSocketListener("unixgram://" + path)
+	require.NoError(t, err)
+	sl.close()
+
+	// Other files aren't
+	require.NoError(t, os.WriteFile(path, nil, ownerGroupOwnership))
+	_, err = newSocketListener("unix://" + path)
+	require.ErrorContains(t, err, "listening on socket")
+}
@@ -0,0 +1,93 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/spf13/cobra"
+)
+
+// stdinLogName is the name of the audit log read from stdin.
+const stdinLogName = "-"
+
+// gzipMagic starts every gzip stream.
+var gzipMagic = []byte{0x1f, 0x8b}
+
+// auditLog is an audit log opened by openAuditLog.
+type auditLog struct {
+	io.Reader
+	f *os.File
+}
+
+// openAuditLog opens the audit log with the given name, or stdin if it's
+// "-". Logs compressed with gzip, e.g. by logrotate, are decompressed.
+func openAuditLog(cmd *cobra.Command, name string) (*auditLog, error) {
+	l := &auditLog{}
+
+	var r io.Reader
+	if name == stdinLogName {
+		r = cmd.InOrStdin()
+	} else {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, fmt.Errorf("opening audit log: %w", err)
+		}
+		l.f = f
+		r = f
+	}
+
+	br := bufio.NewReader(r)
+	//nolint:errcheck // Short logs can't be compressed, and errors are returned by Read
+	magic, _ := br.Peek(len(gzipMagic))
+	if !bytes.Equal(magic, gzipMagic) {
+		l.Reader = br
+		return l, nil
+	}
+
+	zr, err := gzip.NewReader(br)
+	if err != nil {
+		l.Close()
+		return nil, fmt.Errorf("decompressing audit log %s: %w", name, err)
+	}
+	l.Reader = zr
+
+	return l, nil
+}
+
+// Close closes the file of the audit log. Stdin is left open.
+func (l *auditLog) Close() error {
+	if l.f == nil {
+		return nil
+	}
+
+	return l.f.Close()
+}
+
+// auditLogNames returns the audit logs named by the arguments of a
+// command, or stdin if there's none.
+func auditLogNames(args []string) []string {
+	if len(args) == 0 {
+		return []string{stdinLogName}
+	}
+
+	return args
+}
@@ -0,0 +1,216 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"io"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	// EventsReadTotalMetricsName is the name of the metric that tracks the
+	// number of audit events read from the audit log.
+	EventsReadTotalMetricsName = "audittail_events_read_total"
+	// ReadBytesTotalMetricsName is the name of the metric that tracks the
+	// number of bytes read from the audit log.
+	ReadBytesTotalMetricsName = "audittail_read_bytes_total"
+	// ParseErrorsTotalMetricsName is the name of the metric that tracks the
+	// number of audit log lines that weren't audit events.
+	ParseErrorsTotalMetricsName = "audittail_parse_errors_total"
+	// SinkWriteDurationMetricsName is the name of the metric that tracks how
+	// long the sink takes to take an audit event, retries included.
+	SinkWriteDurationMetricsName = "audittail_sink_write_duration_seconds"
+	// SinkFailuresTotalMetricsName is the name of the metric that tracks the
+	// number of audit events the sink failed to take.
+	SinkFailuresTotalMetricsName = "audittail_sink_failures_total"
+	// SinkRetriesTotalMetricsName is the name of the metric that tracks the
+	// number of times the sink retried sending audit events.
+	SinkRetriesTotalMetricsName = "audittail_sink_retries_total"
+	// SinkRejectedTotalMetricsName is the name of the metric that tracks the
+	// number of audit events the sink's collector rejected, which were quarantined.
+	SinkRejectedTotalMetricsName = "audittail_sink_rejected_total"
+	// SpoolBytesMetricsName is the name of the metric that tracks the size
+	// of the spool on disk.
+	SpoolBytesMetricsName = "audittail_spool_bytes"
+	// SpoolSegmentsMetricsName is the name of the metric that tracks the
+	// number of segments in the spool.
+	SpoolSegmentsMetricsName = "audittail_spool_segments"
+	// SpoolDroppedBytesTotalMetricsName is the name of the metric that tracks
+	// the number of bytes of audit events dropped from the spool.
+	SpoolDroppedBytesTotalMetricsName = "audittail_spool_dropped_bytes_total"
+	// ReasonLabelName is the name of the label that tells why audit events
+	// were dropped from the spool: "full", "expired" or "unfinished".
+	ReasonLabelName = "reason"
+)
+
+// These are the reasons audit events are dropped from the spool.
+const (
+	dropReasonFull       = "full"
+	dropReasonExpired    = "expired"
+	dropReasonUnfinished = "unfinished"
+)
+
+// tailMetrics holds the metrics of audittail. Its methods are no-ops
+// on a nil instance, so the metrics are optional.
+type tailMetrics struct {
+	eventsRead        prometheus.Counter
+	readBytes         prometheus.Counter
+	parseErrors       prometheus.Counter
+	sinkWriteDuration prometheus.Histogram
+	sinkFailures      prometheus.Counter
+	sinkRetries       prometheus.Counter
+	sinkRejections    prometheus.Counter
+	spoolBytes        prometheus.Gauge
+	spoolSegments     prometheus.Gauge
+	spoolDroppedBytes *prometheus.CounterVec
+}
+
+func newTailMetrics(r prometheus.Registerer) *tailMetrics {
+	m := &tailMetrics{
+		eventsRead: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: EventsReadTotalMetricsName,
+			Help: "Number of audit events read from the audit log.",
+		}),
+		readBytes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: ReadBytesTotalMetricsName,
+			Help: "Number of bytes read from the audit log.",
+		}),
+		parseErrors: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: ParseErrorsTotalMetricsName,
+			Help: "Number of audit log lines that weren't audit events.",
+		}),
+		sinkWriteDuration: prometheus.NewHistogram(prometheus.HistogramOpts{
+			Name:    SinkWriteDurationMetricsName,
+			Help:    "Time the sink took to take an audit event, retries included.",
+			Buckets: prometheus.ExponentialBuckets(0.0001, 4, 10), //nolint:mnd // 100µs to ~26s
+		}),
+		sinkFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: SinkFailuresTotalMetricsName,
+			Help: "Number of audit events the sink failed to take.",
+		}),
+		sinkRetries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: SinkRetriesTotalMetricsName,
+			Help: "Number of times the sink retried sending audit events.",
+		}),
+		sinkRejections: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: SinkRejectedTotalMetricsName,
+			Help: "Number of audit events the sink's collector rejected, which were quarantined.",
+		}),
+		spoolBytes: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: SpoolBytesMetricsName,
+			Help: "Size of the spool on disk, in bytes.",
+		}),
+		spoolSegments: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: SpoolSegmentsMetricsName,
+			Help: "Number of segments in the spool.",
+		}),
+		spoolDroppedBytes: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: SpoolDroppedBytesTotalMetricsName,
+			Help: "Number of bytes of audit events dropped from the spool.",
+		}, []string{ReasonLabelName}),
+	}
+
+	for _, c := range []prometheus.Collector{
+		m.eventsRead, m.readBytes, m.parseErrors,
+		m.sinkWriteDuration, m.sinkFailures, m.sinkRetries, m.sinkRejections,
+		m.spoolBytes, m.spoolSegments, m.spoolDroppedBytes,
+	} {
+		r.MustRegister(c)
+	}
+
+	return m
+}
+
+// read records a line read from the audit log, and whether it was an audit event.
+func (m *tailMetrics) read(n int, isEvent bool) {
+	if m == nil {
+		return
+	}
+
+	m.readBytes.Add(float64(n))
+	if isEvent {
+		m.eventsRead.Inc()
+	} else {
+		m.parseErrors.Inc()
+	}
+}
+
+// sinkRetried records a failed attempt of the sink that's retried.
+func (m *tailMetrics) sinkRetried() {
+	if m == nil {
+		return
+	}
+
+	m.sinkRetries.Inc()
+}
+
+// sinkRejected records audit events the sink's collector rejected.
+func (m *tailMetrics) sinkRejected(n int) {
+	if m == nil {
+		return
+	}
+
+	m.sinkRejections.Add(float64(n))
+}
+
+// spoolChanged records a change in the size of a spool.
+func (m *tailMetrics) spoolChanged(size int64, segments int) {
+	if m == nil {
+		return
+	}
+
+	m.spoolBytes.Add(float64(size))
+	m.spoolSegments.Add(float64(segments))
+}
+
+// spoolDropped records bytes of audit events dropped from the spool.
+func (m *tailMetrics) spoolDropped(reason string, n int64) {
+	if m == nil {
+		return
+	}
+
+	m.spoolDroppedBytes.WithLabelValues(reason).Add(float64(n))
+}
+
+// instrumentedSink records how long a sink takes to take audit events,
+// and how many it fails to take.
+type instrumentedSink struct {
+	io.WriteCloser
+	metrics *tailMetrics
+}
+
+func (s *instrumentedSink) Write(p []byte) (int, error) {
+	start := time.Now()
+	n, err := s.WriteCloser.Write(p)
+
+	s.metrics.sinkWriteDuration.Observe(time.Since(start).Seconds())
+	if err != nil {
+		s.metrics.sinkFailures.Inc()
+	}
+
+	return n, err
+}
+
+// Flush flushes the sink, if it buffers audit events.
+func (s *instrumentedSink) Flush() error {
+	if f, ok := s.WriteCloser.(flusher); ok {
+		return f.Flush()
+	}
+
+	return nil
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+var errFailingWriter = errors.New("failing writer")
+
+type failingWriter struct{}
+
+func (failingWriter) Write([]byte) (int, error) {
+	return 0, errFailingWriter
+}
+
+func TestTailMetrics(t *testing.T) {
+	t.Parallel()
+
+	event := `{"metadata":{"auditId":"1"},"type":"foo","loggedAt":"2026-01-01T00:00:00Z","outcome":"succeeded"}`
+	input := strings.Join([]string{event, "not an event", "", event, ""}, "\n")
+
+	m := newTailMetrics(prometheus.NewRegistry())
+	ft := &fileTailer{
+		r:          strings.NewReader(input),
+		w:          &instrumentedSink{WriteCloser: nopCloser{failingWriter{}}, metrics: m},
+		quarantine: io.Discard,
+		metrics:    m,
+	}
+
+	err := ft.tailFile(t.Context())
+	require.ErrorIs(t, err, errFailingWriter)
+
+	require.InDelta(t, 1, testutil.ToFloat64(m.eventsRead), 0, "the tailer stops on the first failure")
+	require.InDelta(t, len(event)+1, testutil.ToFloat64(m.readBytes), 0)
+	require.InDelta(t, 1, testutil.ToFloat64(m.sinkFailures), 0)
+	require.Equal(t, 1, testutil.CollectAndCount(m.sinkWriteDuration))
+
+	ft = &fileTailer{
+		r:          strings.NewReader(input),
+		w:          &instrumentedSink{WriteCloser: nopCloser{io.Discard}, metrics: m},
+		quarantine: io.Discard,
+		metrics:    m,
+	}
+
+	ctx, cancel := context.WithCancel(t.Context())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	require.NoError(t, ft.tailFile(ctx))
+	require.InDelta(t, 3, testutil.ToFloat64(m.eventsRead), 0)
+	require.InDelta(t, 1, testutil.ToFloat64(m.parseErrors), 0)
+	require.InDelta(t, 1, testutil.ToFloat64(m.sinkFailures), 0)
+}
+
+func TestSpoolMetrics(t *testing.T) {
+	t.Parallel()
+
+	eventSize := int64(len(spoolTestEvent(0)) + 1)
+	m := newTailMetrics(prometheus.NewRegistry())
+
+	sink := newSpoolTestSink()
+	sink.hold()
+	s, _ := newTestSpool(t, spoolConfig{
+		maxSize:     2 * eventSize,
+		segmentSize: 1,
+		fullPolicy:  spoolFullDropNewest,
+		metrics:     m,
+	}, sink)
+
+	writeSpoolEvents(t, s, 0, 3)
+	require.InDelta(t, 2*eventSize, testutil.ToFloat64(m.spoolBytes), 0)
+	require.InDelta(t, 2, testutil.ToFloat64(m.spoolSegments), 0)
+	require.InDelta(t, eventSize, testutil.ToFloat64(m.spoolDroppedBytes.WithLabelValues(dropReasonFull)), 0)
+
+	sink.release()
+	requireReceived(t, sink, spoolTestEvents(0, 2))
+	// Only the segment that's written to is left
+	require.Eventually(t, func() bool {
+		return testutil.ToFloat64(m.spoolSegments) == 1
+	}, time.Second, 5*time.Millisecond, "the segments that were sent should be removed")
+	require.InDelta(t, eventSize, testutil.ToFloat64(m.spoolBytes), 0)
+}
+
+func TestMetricsServer(t *testing.T) {
+	t.Parallel()
+
+	reg, m := newMetricsRegistry()
+	h := &tailHealth{}
+
+	srv, err := startMetricsServer(t.Context(), "127.0.0.1:0", reg, h)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		require.NoError(t, stopMetricsServer(srv))
+	})
+
+	get := func(path string) (int, string) {
+		t.Helper()
+
+		req, err := http.NewRequestWithContext(t.Context(), http.MethodGet, "http://"+srv.Addr+path, http.NoBody)
+		require.NoError(t, err)
+
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+
+		var b bytes.Buffer
+		_, err = b.ReadFrom(resp.Body)
+		require.NoError(t, err)
+
+		return resp.StatusCode, b.String()
+	}
+
+	status, _ := get("/healthz")
+	require.Equal(t, http.StatusOK, status)
+
+	status, _ = get("/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, status, "it shouldn't be ready before reading the audit log")
+
+	h.read()
+	status, _ = get("/readyz")
+	require.Equal(t, http.StatusOK, status)
+
+	h.lastRead.Store(time.Now().Add(-readyStallTimeout).UnixNano())
+	status, _ = get("/readyz")
+	require.Equal(t, http.StatusServiceUnavailable, status, "it shouldn't be ready once the tail loop stalls")
+
+	h.stop()
+	status, _ = get("/healthz")
+	require.Equal(t, http.StatusServiceUnavailable, status, "it shouldn't be alive once the tail loop stops")
+
+	m.read(10, true)
+	status, body := get("/metrics")
+	require.Equal(t, http.StatusOK, status)
+	require.Contains(t, body, EventsReadTotalMetricsName+" 1")
+	require.Contains(t, body, "go_goroutines")
+}
+
+func TestMetricsServerInvalidAddress(t *testing.T) {
+	t.Parallel()
+
+	reg, _ := newMetricsRegistry()
+	_, err := startMetricsServer(t.Context(), "not an address", reg, &tailHealth{})
+	require.ErrorContains(t, err, "listening for metrics")
+}
@@ -0,0 +1,243 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+// These identify the API Activity class of OCSF 1.1.0, which audit events
+// are converted to.
+const (
+	ocsfVersion        = "1.1.0"
+	ocsfCategoryUID    = 6
+	ocsfCategoryName   = "Application Activity"
+	ocsfClassUID       = 6003
+	ocsfClassName      = "API Activity"
+	ocsfActivityOther  = 99
+	ocsfActivityName   = "Other"
+	ocsfTypeUID        = ocsfClassUID*100 + ocsfActivityOther
+	ocsfSeverityInfo   = 1
+	ocsfSeverityMedium = 3
+	ocsfStatusUnknown  = 0
+	ocsfStatusSuccess  = 1
+	ocsfStatusFailure  = 2
+	ocsfStatusOther    = 99
+)
+
+// ocsfEvent is an OCSF API Activity event. Its fields that aren't in the
+// schema are kept in Unmapped, so it converts back to the same event.
+//
+//nolint:tagliatelle // These are the names of the OCSF schema
+type ocsfEvent struct {
+	ActivityID   int              `json:"activity_id"`
+	ActivityName string           `json:"activity_name"`
+	CategoryUID  int              `json:"category_uid"`
+	CategoryName string           `json:"category_name"`
+	ClassUID     int              `json:"class_uid"`
+	ClassName    string           `json:"class_name"`
+	TypeUID      int              `json:"type_uid"`
+	Time         int64            `json:"time"`
+	TimeDT       string           `json:"time_dt"`
+	SeverityID   int              `json:"severity_id"`
+	Severity     string           `json:"severity"`
+	StatusID     int              `json:"status_id"`
+	StatusDetail string           `json:"status_detail,omitempty"`
+	Metadata     ocsfMetadata     `json:"metadata"`
+	API          ocsfAPI          `json:"api"`
+	Actor        ocsfActor        `json:"actor"`
+	SrcEndpoint  ocsfEndpoint     `json:"src_endpoint"`
+	HTTPRequest  *ocsfHTTPRequest `json:"http_request,omitempty"`
+	Unmapped     ocsfUnmapped     `json:"unmapped"`
+}
+
+type ocsfMetadata struct {
+	UID     string      `json:"uid"`
+	Version string      `json:"version"`
+	Product ocsfProduct `json:"product"`
+}
+
+//nolint:tagliatelle // These are the names of the OCSF schema
+type ocsfProduct struct {
+	Name       string `json:"name"`
+	VendorName string `json:"vendor_name"`
+}
+
+type ocsfAPI struct {
+	Operation string `json:"operation"`
+}
+
+type ocsfActor struct {
+	User *ocsfUser `json:"user,omitempty"`
+}
+
+type ocsfUser struct {
+	Name string `json:"name"`
+}
+
+type ocsfEndpoint struct {
+	IP string `json:"ip,omitempty"`
+}
+
+type ocsfHTTPRequest struct {
+	URL ocsfURL `json:"url"`
+}
+
+type ocsfURL struct {
+	Path string `json:"path"`
+}
+
+// ocsfUnmapped holds the fields of audit events that have no place in the
+// OCSF schema, as they're in the native format.
+type ocsfUnmapped struct {
+	Source   auditevent.EventSource `json:"source"`
+	Subjects map[string]string      `json:"subjects"`
+	Target   map[string]string      `json:"target,omitempty"`
+	Data     *json.RawMessage       `json:"data,omitempty"`
+	Metadata ocsfUnmappedMetadata   `json:"metadata"`
+}
+
+type ocsfUnmappedMetadata struct {
+	Extra     map[string]any             `json:"extra,omitempty"`
+	Chain     *auditevent.EventChain     `json:"chain,omitempty"`
+	Signature *auditevent.EventSignature `json:"signature,omitempty"`
+}
+
+// ocsfStatus returns the OCSF status of an outcome.
+func ocsfStatus(outcome string) int {
+	switch {
+	case outcome == "":
+		return ocsfStatusUnknown
+	case strings.EqualFold(outcome, auditevent.OutcomeSucceeded),
+		strings.EqualFold(outcome, auditevent.OutcomeApproved):
+		return ocsfStatusSuccess
+	case failedOutcome(outcome):
+		return ocsfStatusFailure
+	default:
+		return ocsfStatusOther
+	}
+}
+
+// encodeOCSF formats an event as an OCSF API Activity event.
+func encodeOCSF(e *auditevent.AuditEvent) ([]byte, error) {
+	o := &ocsfEvent{
+		ActivityID:   ocsfActivityOther,
+		ActivityName: ocsfActivityName,
+		CategoryUID:  ocsfCategoryUID,
+		CategoryName: ocsfCategoryName,
+		ClassUID:     ocsfClassUID,
+		ClassName:    ocsfClassName,
+		TypeUID:      ocsfTypeUID,
+		Time:         e.LoggedAt.UnixMilli(),
+		TimeDT:       formatTime(e.LoggedAt),
+		SeverityID:   ocsfSeverityInfo,
+		Severity:     "Informational",
+		StatusID:     ocsfStatus(e.Outcome),
+		StatusDetail: e.Outcome,
+		Metadata: ocsfMetadata{
+			UID:     e.Metadata.AuditID,
+			Version: ocsfVersion,
+			Product: ocsfProduct{Name: e.Component, VendorName: convertVendor},
+		},
+		API:         ocsfAPI{Operation: e.Type},
+		SrcEndpoint: ocsfEndpoint{IP: sourceIP(e)},
+		Unmapped: ocsfUnmapped{
+			Source:   e.Source,
+			Subjects: e.Subjects,
+			Target:   e.Target,
+			Data:     e.Data,
+			Metadata: ocsfUnmappedMetadata{
+				Extra:     e.Metadata.Extra,
+				Chain:     e.Metadata.Chain,
+				Signature: e.Metadata.Signature,
+			},
+		},
+	}
+
+	if failedOutcome(e.Outcome) {
+		o.SeverityID = ocsfSeverityMedium
+		o.Severity = "Medium"
+	}
+
+	if user := e.Subjects["user"]; user != "" {
+		o.Actor.User = &ocsfUser{Name: user}
+	}
+
+	if path := e.Target["path"]; path != "" {
+		o.HTTPRequest = &ocsfHTTPRequest{URL: ocsfURL{Path: path}}
+	}
+
+	return json.Marshal(o) //nolint:wrapcheck // It's wrapped by the caller
+}
+
+// decodeOCSF parses an OCSF API Activity event.
+func decodeOCSF(line []byte) (*auditevent.AuditEvent, error) {
+	o := &ocsfEvent{}
+	if err := json.Unmarshal(line, o); err != nil {
+		return nil, err //nolint:wrapcheck // It's wrapped by the decoder
+	}
+
+	if o.ClassUID != ocsfClassUID {
+		return nil, fmt.Errorf("%w: OCSF class %d isn't API Activity", ErrInvalidConvertInput, o.ClassUID)
+	}
+
+	e := &auditevent.AuditEvent{
+		Metadata: auditevent.EventMetadata{
+			AuditID:   o.Metadata.UID,
+			Extra:     o.Unmapped.Metadata.Extra,
+			Chain:     o.Unmapped.Metadata.Chain,
+			Signature: o.Unmapped.Metadata.Signature,
+		},
+		Type:      o.API.Operation,
+		Outcome:   o.StatusDetail,
+		Component: o.Metadata.Product.Name,
+		Source:    o.Unmapped.Source,
+		Subjects:  o.Unmapped.Subjects,
+		Target:    o.Unmapped.Target,
+		Data:      o.Unmapped.Data,
+	}
+
+	// time_dt keeps the nanoseconds of the native format, time only has
+	// milliseconds
+	if o.TimeDT != "" {
+		loggedAt, err := time.Parse(time.RFC3339Nano, o.TimeDT)
+		if err != nil {
+			return nil, fmt.Errorf("%w: time_dt: %w", ErrInvalidConvertInput, err)
+		}
+		e.LoggedAt = loggedAt
+	} else {
+		e.LoggedAt = time.UnixMilli(o.Time).UTC()
+	}
+
+	// Events that weren't written by audittail don't have the unmapped
+	// fields
+	if e.Source.Type == "" && e.Source.Value == "" && o.SrcEndpoint.IP != "" {
+		e.Source = auditevent.EventSource{Type: "IP", Value: o.SrcEndpoint.IP}
+	}
+	if e.Subjects == nil && o.Actor.User != nil {
+		e.Subjects = map[string]string{"user": o.Actor.User.Name}
+	}
+	if e.Target == nil && o.HTTPRequest != nil {
+		e.Target = map[string]string{"path": o.HTTPRequest.URL.Path}
+	}
+
+	return e, nil
+}
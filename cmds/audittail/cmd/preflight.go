@@ -0,0 +1,160 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"slices"
+	"syscall"
+)
+
+// These are the permission bits of the owner class. Those of the group
+// and others are shifted right by 3 and 6 bits.
+const (
+	permWrite  = 0o200
+	permSearch = 0o100
+)
+
+// appUser is the user the application writes audit events as.
+type appUser struct {
+	uid int
+	// gid is -1 if the primary group isn't known
+	gid    int
+	groups []int
+}
+
+func (u *appUser) inGroup(gid int) bool {
+	return u.gid == gid || slices.Contains(u.groups, gid)
+}
+
+func (u *appUser) String() string {
+	if u.gid == -1 {
+		return fmt.Sprintf("uid %d", u.uid)
+	}
+
+	return fmt.Sprintf("uid %d (gid %d)", u.uid, u.gid)
+}
+
+// checkPipeWritable checks that the user can open the named pipe for
+// writing. It only checks the permission bits, the way the kernel does
+// without ACLs or security modules like SELinux, which aren't used on
+// the volumes audit logs are shared on.
+func checkPipeWritable(file string, u *appUser) error {
+	path, err := filepath.Abs(file)
+	if err != nil {
+		return fmt.Errorf("checking the named pipe: %w", err)
+	}
+
+	// Every directory on the way must be searchable
+	var dirs []string
+	for dir := filepath.Dir(path); ; dir = filepath.Dir(dir) {
+		dirs = append(dirs, dir)
+		if dir == filepath.Dir(dir) {
+			break
+		}
+	}
+	slices.Reverse(dirs)
+
+	for _, dir := range dirs {
+		info, err := os.Stat(dir)
+		if err != nil {
+			return fmt.Errorf("checking the named pipe: %w", err)
+		}
+
+		if reason := deniedReason(info, u, permSearch); reason != "" {
+			return fmt.Errorf("%w: %s can't reach %s, as it can't search the directory %s: %s; "+
+				"the volume must let it in, e.g. with the fsGroup of the pod",
+				ErrPipeNotWritable, u, file, dir, reason)
+		}
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("checking the named pipe: %w", err)
+	}
+
+	if info.Mode()&os.ModeNamedPipe == 0 {
+		return fmt.Errorf("%w: %s isn't a named pipe, but a %s", ErrPipeNotWritable, file, fileKind(info))
+	}
+
+	if reason := deniedReason(info, u, permWrite); reason != "" {
+		return fmt.Errorf("%w: %s can't open %s for writing: %s; "+
+			"run init with --uid %d, with the --gid of one of its groups and a --mode that lets the group write, "+
+			"or with a --mode that lets others write",
+			ErrPipeNotWritable, u, file, reason, u.uid)
+	}
+
+	return nil
+}
+
+// deniedReason returns why the user doesn't have the permission on the
+// file, or an empty string if it does. Like the kernel, it only checks
+// the bits of the first class the user is in.
+func deniedReason(info os.FileInfo, u *appUser, perm os.FileMode) string {
+	// root bypasses the permission bits
+	if u.uid == 0 {
+		return ""
+	}
+
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return ""
+	}
+
+	mode := info.Mode().Perm()
+	owner, group := int(st.Uid), int(st.Gid)
+	action := "write to it"
+	if perm == permSearch {
+		action = "search it"
+	}
+
+	switch {
+	case u.uid == owner:
+		if mode&perm != 0 {
+			return ""
+		}
+		return fmt.Sprintf("it's owned by it, with mode %04o, which doesn't let the owner %s", mode, action)
+	case u.inGroup(group):
+		if mode&(perm>>3) != 0 {
+			return ""
+		}
+		return fmt.Sprintf("it's in its group %d, and mode %04o doesn't let the group %s", group, mode, action)
+	default:
+		if mode&(perm>>6) != 0 {
+			return ""
+		}
+		return fmt.Sprintf("it's owned by uid %d and gid %d, with mode %04o, which doesn't let others %s",
+			owner, group, mode, action)
+	}
+}
+
+// fileKind describes the type of a file.
+func fileKind(info os.FileInfo) string {
+	switch mode := info.Mode(); {
+	case mode.IsRegular():
+		return "regular file"
+	case mode.IsDir():
+		return "directory"
+	case mode&os.ModeSocket != 0:
+		return "socket"
+	case mode&os.ModeSymlink != 0:
+		return "symbolic link"
+	default:
+		return "special file"
+	}
+}
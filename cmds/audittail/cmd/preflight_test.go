@@ -0,0 +1,149 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckPipeWritable(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audit.log")
+	require.NoError(t, syscall.Mkfifo(path, ownerGroupOwnership))
+	// The directory of the temporary directories of the test isn't
+	// searchable by others
+	require.NoError(t, os.Chmod(filepath.Dir(dir), 0o755))
+
+	info, err := os.Stat(path)
+	require.NoError(t, err)
+	st, ok := info.Sys().(*syscall.Stat_t)
+	require.True(t, ok)
+	owner, group := int(st.Uid), int(st.Gid)
+
+	// These don't own the pipe, nor are in its group, unless the tests
+	// run as them
+	const other, otherGroup, nobody = 65533, 65533, 65534
+
+	// root bypasses the permission bits, so its pipe is given away
+	if owner == 0 {
+		require.NoError(t, os.Chown(path, nobody, -1))
+		owner = nobody
+	}
+	require.NotEqual(t, other, owner)
+	require.NotEqual(t, otherGroup, group)
+
+	tests := []struct {
+		name    string
+		mode    os.FileMode
+		dirMode os.FileMode
+		user    appUser
+		want    string
+	}{
+		{
+			name: "owner",
+			mode: 0o600,
+			user: appUser{uid: owner, gid: -1},
+		},
+		{
+			name: "owner without write permission",
+			mode: 0o460,
+			// The bits of the group don't apply to the owner
+			user: appUser{uid: owner, gid: group},
+			want: "with mode 0460, which doesn't let the owner write to it",
+		},
+		{
+			name: "group",
+			mode: 0o620,
+			user: appUser{uid: other, gid: group},
+		},
+		{
+			name: "supplementary group",
+			mode: 0o620,
+			user: appUser{uid: other, gid: otherGroup, groups: []int{group}},
+		},
+		{
+			name: "group without write permission",
+			mode: 0o640,
+			user: appUser{uid: other, gid: -1, groups: []int{group}},
+			want: "and mode 0640 doesn't let the group write to it",
+		},
+		{
+			name: "others",
+			mode: 0o602,
+			user: appUser{uid: other, gid: otherGroup},
+		},
+		{
+			name: "others without write permission",
+			mode: 0o664,
+			user: appUser{uid: other, gid: otherGroup},
+			want: "with mode 0664, which doesn't let others write to it",
+		},
+		{
+			name: "root",
+			mode: 0o000,
+			user: appUser{uid: 0, gid: 0},
+		},
+		{
+			name:    "directory that can't be searched",
+			mode:    0o666,
+			dirMode: 0o750,
+			user:    appUser{uid: other, gid: otherGroup},
+			want:    "as it can't search the directory " + dir,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			// The tests share the pipe
+			require.NoError(t, os.Chmod(path, tc.mode))
+			dirMode := tc.dirMode
+			if dirMode == 0 {
+				dirMode = 0o755
+			}
+			require.NoError(t, os.Chmod(dir, dirMode))
+
+			err := checkPipeWritable(path, &tc.user)
+			if tc.want == "" {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorIs(t, err, ErrPipeNotWritable)
+			require.ErrorContains(t, err, tc.want)
+		})
+	}
+}
+
+func TestCheckPipeWritableNeedsANamedPipe(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit.log")
+	require.NoError(t, os.WriteFile(path, nil, 0o666))
+
+	err := checkPipeWritable(path, &appUser{uid: 0, gid: -1})
+	require.ErrorIs(t, err, ErrPipeNotWritable)
+	require.ErrorContains(t, err, "isn't a named pipe, but a regular file")
+
+	err = checkPipeWritable(filepath.Join(t.TempDir(), "missing.log"), &appUser{uid: 0, gid: -1})
+	require.ErrorIs(t, err, os.ErrNotExist)
+}
@@ -0,0 +1,338 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"slices"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+// These are the formats query prints events in. outputJSON prints them
+// as they were read.
+const (
+	outputTable = "table"
+	outputCSV   = "csv"
+)
+
+// queryColumns are the columns of the table and CSV formats.
+var queryColumns = []string{"loggedAt", "auditId", "type", "outcome", "component", "source", "subjects", "target"}
+
+// queryCmd represents the query command.
+var queryCmd = NewQueryCommand()
+
+func NewQueryCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "query [file...]",
+		Short: "Search audit logs",
+		Long: `Search audit logs.
+
+This reads JSON-lines audit logs, from the given files or stdin, and prints
+the events that match the filter expression, as they're read. Logs
+compressed with gzip are read as is.
+
+Filter expressions compare the fields of events to values, e.g.
+
+  type == UserLogin and (outcome != succeeded or subjects.user ~ "*@example.com")
+
+The fields are metadata.auditId, type, outcome, component, source.type,
+source.value, loggedAt, and the keys of subjects and target, e.g.
+subjects.user or target.path. Missing keys are empty. The operators are
+== and !=, ~ and !~ to match patterns where '*' matches any sequence of
+characters, and <, <=, > and >= to compare loggedAt to RFC 3339 times.
+Conditions are combined with 'and', 'or', 'not' and parentheses.`,
+		Args: cobra.ArbitraryArgs,
+		RunE: queryMain,
+	}
+
+	c.Flags().String("filter", "", "expression the events to print must match (defaults to every event)")
+	c.Flags().String("since", "", "only print the events logged at or after this RFC 3339 time, or this long ago, e.g. 1h")
+	c.Flags().String("until", "", "only print the events logged before this RFC 3339 time, or this long ago")
+	c.Flags().StringP("output", "o", outputJSON, "format to print events in: 'json', 'table' or 'csv'")
+	c.Flags().Int("limit", 0, "stop after printing this many events (0 prints all of them)")
+
+	return c
+}
+
+//nolint:gochecknoinits // this is a practice recommended by cobra
+func init() {
+	rootCmd.AddCommand(queryCmd)
+}
+
+func queryMain(cmd *cobra.Command, args []string) error {
+	//nolint:errcheck // This is already verified by cobra
+	expr, _ := cmd.Flags().GetString("filter")
+	//nolint:errcheck // This is already verified by cobra
+	output, _ := cmd.Flags().GetString("output")
+	//nolint:errcheck // This is already verified by cobra
+	limit, _ := cmd.Flags().GetInt("limit")
+
+	filter, err := parseFilter(expr)
+	if err != nil {
+		return err
+	}
+
+	filter, err = withTimeRange(cmd, filter, time.Now())
+	if err != nil {
+		return err
+	}
+
+	printer, err := newEventPrinter(cmd.OutOrStdout(), output)
+	if err != nil {
+		return err
+	}
+
+	// Failing to read the audit logs isn't a usage error
+	cmd.SilenceUsage = true
+
+	q := &eventQuery{filter: filter, printer: printer, limit: limit}
+	for _, name := range auditLogNames(args) {
+		l, err := openAuditLog(cmd, name)
+		if err != nil {
+			return err
+		}
+
+		done, err := q.run(name, l)
+		l.Close()
+		if err != nil {
+			return err
+		}
+
+		if done {
+			break
+		}
+	}
+
+	if err := printer.flush(); err != nil {
+		return fmt.Errorf("printing events: %w", err)
+	}
+
+	if q.malformed > 0 {
+		fmt.Fprintf(cmd.ErrOrStderr(), "audittail: skipped %d lines that aren't audit events\n", q.malformed)
+	}
+
+	return nil
+}
+
+// withTimeRange adds the time range of the --since and --until flags to the filter.
+func withTimeRange(cmd *cobra.Command, filter eventFilter, now time.Time) (eventFilter, error) {
+	f := andFilter{filter}
+
+	for _, bound := range []struct {
+		flag string
+		op   string
+	}{{"since", ">="}, {"until", "<"}} {
+		//nolint:errcheck // This is already verified by cobra
+		v, _ := cmd.Flags().GetString(bound.flag)
+		if v == "" {
+			continue
+		}
+
+		t, err := parseQueryTime(v, now)
+		if err != nil {
+			return nil, err
+		}
+
+		f = append(f, &timeCondition{op: bound.op, t: t})
+	}
+
+	if len(f) == 1 {
+		return filter, nil
+	}
+
+	return f, nil
+}
+
+// parseQueryTime parses an RFC 3339 time, or a duration before now.
+func parseQueryTime(v string, now time.Time) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339Nano, v); err == nil {
+		return t, nil
+	}
+
+	d, err := time.ParseDuration(v)
+	if err != nil || d < 0 {
+		return time.Time{}, fmt.Errorf("%w: %q", ErrInvalidQueryTime, v)
+	}
+
+	return now.Add(-d), nil
+}
+
+// eventQuery prints the events of audit logs that match its filter.
+type eventQuery struct {
+	filter  eventFilter
+	printer eventPrinter
+	// limit is the number of events to print, if positive
+	limit   int
+	printed int
+	// malformed is the number of lines that aren't audit events
+	malformed int
+}
+
+// run prints the events of the audit log that match. It returns whether
+// the limit was reached.
+func (q *eventQuery) run(name string, r io.Reader) (bool, error) {
+	br := bufio.NewReader(r)
+	for {
+		raw, err := br.ReadBytes('\n')
+		if line := bytes.TrimSpace(raw); len(line) > 0 {
+			e := &auditevent.AuditEvent{}
+			if jerr := json.Unmarshal(line, e); jerr != nil {
+				q.malformed++
+			} else if q.filter.match(e) {
+				if perr := q.printer.print(line, e); perr != nil {
+					return false, fmt.Errorf("printing events: %w", perr)
+				}
+
+				q.printed++
+				if q.limit > 0 && q.printed >= q.limit {
+					return true, nil
+				}
+			}
+		}
+
+		if errors.Is(err, io.EOF) {
+			return false, nil
+		}
+
+		if err != nil {
+			return false, fmt.Errorf("reading audit log %s: %w", name, err)
+		}
+	}
+}
+
+// eventPrinter prints the events that match a query.
+type eventPrinter interface {
+	// print prints the event, given along with the line it was read from
+	print(line []byte, e *auditevent.AuditEvent) error
+	flush() error
+}
+
+func newEventPrinter(w io.Writer, output string) (eventPrinter, error) {
+	switch output {
+	case outputJSON:
+		return &jsonPrinter{w: w}, nil
+	case outputTable:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0) //nolint:mnd // The padding between columns
+		p := &tablePrinter{tw: tw}
+		return p, p.printRow(queryColumns)
+	case outputCSV:
+		p := &csvPrinter{w: csv.NewWriter(w)}
+		return p, p.w.Write(queryColumns)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidQueryOutput, output)
+	}
+}
+
+// jsonPrinter prints events as JSON lines, as they were read. They're
+// not buffered, so events are printed as soon as they're matched, even
+// when a log that's still written to is piped to the query.
+type jsonPrinter struct {
+	w io.Writer
+}
+
+func (p *jsonPrinter) print(line []byte, _ *auditevent.AuditEvent) error {
+	return writeLine(p.w, line)
+}
+
+func (*jsonPrinter) flush() error {
+	return nil
+}
+
+// tablePrinter prints events as a table, which is aligned once every
+// event is printed.
+type tablePrinter struct {
+	tw *tabwriter.Writer
+}
+
+func (p *tablePrinter) print(_ []byte, e *auditevent.AuditEvent) error {
+	row := queryRow(e)
+	// Tabs and newlines would break the table
+	for i, v := range row {
+		row[i] = strings.Map(func(r rune) rune {
+			if r == '\t' || r == '\n' || r == '\r' {
+				return ' '
+			}
+			return r
+		}, v)
+	}
+
+	return p.printRow(row)
+}
+
+func (p *tablePrinter) printRow(row []string) error {
+	_, err := fmt.Fprintln(p.tw, strings.Join(row, "\t"))
+	return err //nolint:wrapcheck // It's wrapped by the caller
+}
+
+func (p *tablePrinter) flush() error {
+	return p.tw.Flush() //nolint:wrapcheck // It's wrapped by the caller
+}
+
+// csvPrinter prints events as CSV, with a header.
+type csvPrinter struct {
+	w *csv.Writer
+}
+
+func (p *csvPrinter) print(_ []byte, e *auditevent.AuditEvent) error {
+	return p.w.Write(queryRow(e)) //nolint:wrapcheck // It's wrapped by the caller
+}
+
+func (p *csvPrinter) flush() error {
+	p.w.Flush()
+	return p.w.Error() //nolint:wrapcheck // It's wrapped by the caller
+}
+
+// queryRow returns the values of the queryColumns of the event.
+func queryRow(e *auditevent.AuditEvent) []string {
+	source := e.Source.Type
+	if e.Source.Value != "" {
+		source += ":" + e.Source.Value
+	}
+
+	return []string{
+		e.LoggedAt.Format(time.RFC3339Nano),
+		e.Metadata.AuditID,
+		e.Type,
+		e.Outcome,
+		e.Component,
+		source,
+		formatKeys(e.Subjects),
+		formatKeys(e.Target),
+	}
+}
+
+// formatKeys formats a map as key=value pairs, sorted by key.
+func formatKeys(m map[string]string) string {
+	pairs := make([]string, 0, len(m))
+	for _, k := range slices.Sorted(maps.Keys(m)) {
+		pairs = append(pairs, k+"="+m[k])
+	}
+
+	return strings.Join(pairs, " ")
+}
@@ -0,0 +1,140 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+const (
+	queryTestLogin = `{"metadata":{"auditId":"1"},"type":"UserLogin","loggedAt":"2026-01-01T10:00:00Z",` +
+		`"source":{"type":"IP","value":"10.0.0.1"},"outcome":"failed","subjects":{"user":"jane@example.com"},` +
+		`"component":"api","target":{"path":"/v1/login","method":"POST"}}`
+	queryTestLogout = `{"metadata":{"auditId":"2"},"type":"UserLogout","loggedAt":"2026-01-01T11:00:00Z",` +
+		`"source":{"type":"IP","value":"10.0.0.2"},"outcome":"succeeded","subjects":{"user":"joe, \"jr\""},` +
+		`"component":"api"}`
+)
+
+func runQuery(t *testing.T, stdin string, args ...string) (stdout, stderr string, err error) {
+	t.Helper()
+
+	c := NewQueryCommand()
+	var out, errOut bytes.Buffer
+	c.SetOut(&out)
+	c.SetErr(&errOut)
+	c.SetIn(strings.NewReader(stdin))
+	c.SetArgs(args)
+
+	err = c.Execute()
+
+	return out.String(), errOut.String(), err
+}
+
+func TestQueryFiltersEvents(t *testing.T) {
+	t.Parallel()
+
+	// Archived logs are compressed
+	dir := t.TempDir()
+	archive := filepath.Join(dir, "audit.log.1.gz")
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, err := zw.Write([]byte(queryTestLogin + "\nnot an event\n"))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	require.NoError(t, os.WriteFile(archive, gz.Bytes(), ownerGroupOwnership))
+
+	out, errOut, err := runQuery(t, queryTestLogout+"\n", "--filter", "component == api", archive, "-")
+	require.NoError(t, err)
+	require.Equal(t, queryTestLogin+"\n"+queryTestLogout+"\n", out, "events should be printed as they were read")
+	require.Equal(t, "audittail: skipped 1 lines that aren't audit events\n", errOut)
+
+	out, _, err = runQuery(t, queryTestLogin+"\n"+queryTestLogout, "--filter", `subjects.user ~ "*@example.com"`)
+	require.NoError(t, err)
+	require.Equal(t, queryTestLogin+"\n", out)
+
+	out, _, err = runQuery(t, queryTestLogin+"\n"+queryTestLogout, "--limit", "1")
+	require.NoError(t, err)
+	require.Equal(t, queryTestLogin+"\n", out)
+
+	out, _, err = runQuery(t, queryTestLogin+"\n"+queryTestLogout,
+		"--since", "2026-01-01T10:30:00Z", "--until", "2026-01-01T11:00:01Z")
+	require.NoError(t, err)
+	require.Equal(t, queryTestLogout+"\n", out)
+}
+
+func TestQueryOutputs(t *testing.T) {
+	t.Parallel()
+
+	log := queryTestLogin + "\n" + queryTestLogout + "\n"
+
+	out, _, err := runQuery(t, log, "-o", "table")
+	require.NoError(t, err)
+	require.Equal(t, ""+
+		"loggedAt              auditId  type        outcome    component  source       subjects               target\n"+
+		"2026-01-01T10:00:00Z  1        UserLogin   failed     api        IP:10.0.0.1  user=jane@example.com  method=POST path=/v1/login\n"+
+		"2026-01-01T11:00:00Z  2        UserLogout  succeeded  api        IP:10.0.0.2  user=joe, \"jr\"         \n",
+		out)
+
+	out, _, err = runQuery(t, log, "-o", "csv")
+	require.NoError(t, err)
+	require.Equal(t, ""+
+		"loggedAt,auditId,type,outcome,component,source,subjects,target\n"+
+		"2026-01-01T10:00:00Z,1,UserLogin,failed,api,IP:10.0.0.1,user=jane@example.com,method=POST path=/v1/login\n"+
+		"2026-01-01T11:00:00Z,2,UserLogout,succeeded,api,IP:10.0.0.2,\"user=joe, \"\"jr\"\"\",\n",
+		out)
+}
+
+func TestQueryErrors(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		args []string
+		err  error
+	}{
+		{args: []string{"--filter", "type =="}, err: ErrInvalidFilter},
+		{args: []string{"-o", "yaml"}, err: ErrInvalidQueryOutput},
+		{args: []string{"--since", "yesterday"}, err: ErrInvalidQueryTime},
+		{args: []string{"--until", "-1h"}, err: ErrInvalidQueryTime},
+		{args: []string{filepath.Join(t.TempDir(), "missing.log")}, err: os.ErrNotExist},
+	}
+
+	for _, tt := range tests {
+		_, _, err := runQuery(t, "", tt.args...)
+		require.ErrorIs(t, err, tt.err, tt.args)
+	}
+}
+
+func TestParseQueryTime(t *testing.T) {
+	t.Parallel()
+
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	got, err := parseQueryTime("90m", now)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2026, 1, 1, 10, 30, 0, 0, time.UTC), got)
+
+	got, err = parseQueryTime("2025-12-31T23:00:00-02:00", now)
+	require.NoError(t, err)
+	require.True(t, got.Equal(time.Date(2026, 1, 1, 1, 0, 0, 0, time.UTC)))
+}
@@ -16,15 +16,22 @@ limitations under the License.
 package cmd
 
 import (
+	"bufio"
+	"bytes"
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"os"
+	"path/filepath"
 	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/spf13/cobra"
 	"golang.org/x/sync/errgroup"
+
+	"github.com/metal-toolbox/auditevent"
 )
 
 const (
@@ -45,12 +52,65 @@ func NewRootCmd() *cobra.Command {
 		Short: "A utility to reliably tail audit an audit log file",
 		Long: `A utility to reliably tail audit an audit log file.
 	
-This utility will create a named pipe in order to tail the audit log file.`,
+This utility will create a named pipe in order to tail the audit log file,
+unless --regular-file is set. Regular files are followed when they're
+rotated or truncated, and the position in them is saved to --state-file.
+With --listen, events are received on a Unix socket instead.
+Each line of the file is forwarded as a whole only if it's an audit event.
+Malformed lines are written to the quarantine file, or to stderr if it
+isn't set.
+
+Events are written to stdout, or sent to a syslog server if --syslog is set,
+or to an HTTP collector if --webhook is set. With --config, they're routed
+to the sinks of a configuration file instead, by rules that match their
+type, outcome, component, subjects or target. If --spool-dir is set, events
+are spooled to disk first, so the audit log keeps being read while they
+can't be sent.
+Events may be enriched with the Kubernetes identity of the pod that wrote
+them, read from downward API environment variables or files.
+Once shutdown is requested, the audit log is drained and the events are
+sent until --drain-timeout passes.`,
 		Args: cobra.MatchAll(cobra.OnlyValidArgs, validateCommonArgs),
 		RunE: tailMain,
 	}
 
 	c.PersistentFlags().StringP("file", "f", "", "audit log file to tail")
+	c.Flags().StringP("quarantine", "q", "", "file to write malformed audit log lines to (defaults to stderr)")
+	c.Flags().String("kube-enrich", "", "add the Kubernetes identity to the event's 'source' or 'metadata' extra fields")
+	c.Flags().String("kube-collision", collisionKeep,
+		"what to do if the event already has a Kubernetes identity: 'keep', 'overwrite' or 'merge'")
+	c.Flags().String("kube-metadata-dir", "", "downward API volume to read the Kubernetes identity from")
+	c.Flags().String("syslog", "", "syslog server to send events to, e.g. tls://siem.example.com:6514")
+	c.Flags().String("syslog-sd-id", defaultSyslogSDID, "ID of the syslog structured data element of events")
+	c.Flags().String("syslog-ca", "", "CA to verify the syslog server with (defaults to the system's)")
+	c.Flags().String("syslog-cert", "", "client certificate to authenticate to the syslog server with")
+	c.Flags().String("syslog-key", "", "key of the syslog client certificate")
+	c.Flags().String("webhook", "", "HTTP collector to POST batches of events to")
+	c.Flags().Int("webhook-batch-size", defaultWebhookBatchSize, "maximum number of events in a webhook batch")
+	c.Flags().Duration("webhook-flush-interval", defaultWebhookFlushInterval,
+		"maximum time an event waits for its webhook batch to fill up")
+	c.Flags().Bool("webhook-gzip", false, "compress webhook batches with gzip")
+	c.Flags().String("webhook-token-file", "", "file with the bearer token to authenticate to the webhook collector with")
+	c.Flags().String("webhook-ca", "", "CA to verify the webhook collector with (defaults to the system's)")
+	c.Flags().String("webhook-cert", "", "client certificate to authenticate to the webhook collector with")
+	c.Flags().String("webhook-key", "", "key of the webhook client certificate")
+	c.MarkFlagsMutuallyExclusive("syslog", "webhook")
+	c.Flags().String("config", "", "file with the sinks to send events to, and the rules that route events to them")
+	c.MarkFlagsMutuallyExclusive("config", "syslog")
+	c.MarkFlagsMutuallyExclusive("config", "webhook")
+	c.Flags().String("spool-dir", "", "directory to spool events to while they can't be sent")
+	c.Flags().Int64("spool-max-size-mib", defaultSpoolMaxSizeMiB, "maximum size of the spool, in MiB")
+	c.Flags().Duration("spool-max-age", 0, "maximum time events are kept in the spool (0 keeps them until they're sent)")
+	c.Flags().String("metrics-address", "", "address to serve metrics and health probes on, e.g. ':9090'")
+	c.Flags().String("spool-full-policy", spoolFullDropNewest,
+		"what to do with events when the spool is full: 'block', 'drop-oldest' or 'drop-newest'")
+	c.Flags().Bool("regular-file", false, "tail a regular file, following it when it's rotated, instead of a named pipe")
+	c.Flags().String("state-file", "", "file to save the position in the regular file to, so a restart resumes from it")
+	c.Flags().String("listen", "",
+		"receive events on a Unix socket instead of a file, e.g. unix:///app-audit/audit.sock or unixgram://...")
+	c.MarkFlagsMutuallyExclusive("listen", "regular-file")
+	c.Flags().Duration("drain-timeout", defaultDrainTimeout,
+		"how long to keep reading and sending events once shutdown is requested")
 	return c
 }
 
@@ -58,52 +118,473 @@ func tailMain(cmd *cobra.Command, _ []string) error {
 	//nolint:errcheck // This is already verified by cobra
 	f, _ := cmd.Flags().GetString("file")
 
-	if err := createNamedPipe(f); err != nil {
-		// If the file already exists this is not an issue.
-		if !errors.Is(err, os.ErrExist) {
-			return fmt.Errorf("creating named pipe: %w", err)
+	//nolint:errcheck // This is already verified by cobra
+	regularFile, _ := cmd.Flags().GetBool("regular-file")
+	//nolint:errcheck // This is already verified by cobra
+	stateFile, _ := cmd.Flags().GetString("state-file")
+	if stateFile != "" && !regularFile {
+		return ErrStateFileWithoutRegularFile
+	}
+
+	//nolint:errcheck // This is already verified by cobra
+	listenURL, _ := cmd.Flags().GetString("listen")
+
+	if !regularFile && listenURL == "" {
+		if err := createNamedPipe(f, defaultPipeOwnership); err != nil {
+			// If the file already exists this is not an issue.
+			if !errors.Is(err, os.ErrExist) {
+				return fmt.Errorf("creating named pipe: %w", err)
+			}
+		}
+	}
+
+	quarantine := cmd.ErrOrStderr()
+
+	//nolint:errcheck // This is already verified by cobra
+	qf, _ := cmd.Flags().GetString("quarantine")
+	if qf != "" {
+		qfd, err := os.OpenFile(qf, os.O_APPEND|os.O_CREATE|os.O_WRONLY, ownerGroupOwnership)
+		if err != nil {
+			return fmt.Errorf("opening quarantine file: %w", err)
 		}
+		defer qfd.Close()
+
+		quarantine = qfd
+	}
+
+	//nolint:errcheck // This is already verified by cobra
+	drainTimeout, _ := cmd.Flags().GetDuration("drain-timeout")
+	if drainTimeout < 0 {
+		return fmt.Errorf("%w: %s", ErrInvalidDrainTimeout, drainTimeout)
 	}
 
-	ft, err := newFileTailer(f, cmd.OutOrStdout())
+	// The context is cancelled once shutdown is requested. Sinks keep
+	// theirs until the drain timeout passes, to send the last events.
+	shutdown := cmd.Context()
+	if shutdown == nil {
+		shutdown = context.Background()
+	}
+	ctx, startDeadline, cancel := newDrainContext(shutdown, drainTimeout)
+	defer cancel()
+
+	var (
+		metrics *tailMetrics
+		health  *tailHealth
+	)
+
+	//nolint:errcheck // This is already verified by cobra
+	metricsAddr, _ := cmd.Flags().GetString("metrics-address")
+	if metricsAddr != "" {
+		var reg *prometheus.Registry
+		reg, metrics = newMetricsRegistry()
+		health = &tailHealth{}
+
+		srv, err := startMetricsServer(shutdown, metricsAddr, reg, health)
+		if err != nil {
+			return err
+		}
+		//nolint:errcheck // The server is only shut down along with audittail
+		defer stopMetricsServer(srv)
+	}
+
+	out, err := newOutput(ctx, cmd, quarantine, metrics, health)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	var (
+		ft *fileTailer
+		sl *socketListener
+	)
+	switch {
+	case listenURL != "":
+		sl, err = newSocketListener(listenURL)
+		if err != nil {
+			return err
+		}
+		defer sl.close()
+
+		ft = &fileTailer{w: out, quarantine: quarantine}
+	case regularFile:
+		ft, err = newFollowingTailer(f, stateFile, out, quarantine, cmd.ErrOrStderr())
+	default:
+		ft, err = newFileTailer(f, out, quarantine)
+	}
 	if err != nil {
 		return fmt.Errorf("creating file tailer: %w", err)
 	}
+	ft.metrics = metrics
+	ft.health = health
+	ft.drainTimeout = drainTimeout
+
+	//nolint:errcheck // This is already verified by cobra
+	target, _ := cmd.Flags().GetString("kube-enrich")
+	if target != "" {
+		//nolint:errcheck // This is already verified by cobra
+		collision, _ := cmd.Flags().GetString("kube-collision")
+		//nolint:errcheck // This is already verified by cobra
+		dir, _ := cmd.Flags().GetString("kube-metadata-dir")
+
+		ft.enricher, err = newKubeEnricher(target, collision, dir)
+		if err != nil {
+			return fmt.Errorf("creating kubernetes enricher: %w", err)
+		}
+	}
+
+	var tailErr error
+	if sl != nil {
+		tailErr = ft.tailSocket(shutdown, sl)
+	} else {
+		tailErr = ft.tailFile(shutdown)
+	}
+
+	// Sinks that buffer events send them before closing,
+	// until the drain timeout passes
+	startDeadline()
+	closeErr := out.Close()
+
+	if shutdown.Err() != nil {
+		ft.report.print(cmd.ErrOrStderr(), closeErr, spoolOf(out))
+	}
+
+	if tailErr != nil {
+		return tailErr
+	}
+
+	if closeErr != nil {
+		return fmt.Errorf("closing output: %w", closeErr)
+	}
+
+	// The output flushed every event once closed
+	return ft.saveCheckpoint()
+}
+
+// newOutput returns the sinks of the --config file, behind a router that
+// picks the ones every event is sent to. Otherwise, it returns the syslog
+// sink if --syslog is set, the webhook sink if --webhook is set, or stdout.
+// The events sinks reject for good are written to quarantine.
+func newOutput(
+	ctx context.Context,
+	cmd *cobra.Command,
+	quarantine io.Writer,
+	metrics *tailMetrics,
+	health *tailHealth,
+) (io.WriteCloser, error) {
+	//nolint:errcheck // This is already verified by cobra
+	configFile, _ := cmd.Flags().GetString("config")
+	if configFile == "" {
+		return newSinkOutput(ctx, cmd, "", sinkConfigFromFlags(cmd), quarantine, metrics, health)
+	}
+
+	cfg, err := loadRoutingConfig(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := newRouter(cfg, func(name string, sink sinkConfig) (io.WriteCloser, error) {
+		return newSinkOutput(ctx, cmd, name, sink, quarantine, metrics, health)
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// sinkConfigFromFlags returns the configuration of the sink picked by the flags.
+func sinkConfigFromFlags(cmd *cobra.Command) sinkConfig {
+	//nolint:errcheck // This is already verified by cobra
+	webhookURL, _ := cmd.Flags().GetString("webhook")
+	if webhookURL != "" {
+		cfg := &webhookSinkConfig{URL: webhookURL}
+		//nolint:errcheck // This is already verified by cobra
+		cfg.BatchSize, _ = cmd.Flags().GetInt("webhook-batch-size")
+		//nolint:errcheck // This is already verified by cobra
+		cfg.FlushInterval, _ = cmd.Flags().GetDuration("webhook-flush-interval")
+		//nolint:errcheck // This is already verified by cobra
+		cfg.Gzip, _ = cmd.Flags().GetBool("webhook-gzip")
+		//nolint:errcheck // This is already verified by cobra
+		cfg.TokenFile, _ = cmd.Flags().GetString("webhook-token-file")
+		//nolint:errcheck // This is already verified by cobra
+		cfg.CA, _ = cmd.Flags().GetString("webhook-ca")
+		//nolint:errcheck // This is already verified by cobra
+		cfg.Cert, _ = cmd.Flags().GetString("webhook-cert")
+		//nolint:errcheck // This is already verified by cobra
+		cfg.Key, _ = cmd.Flags().GetString("webhook-key")
+
+		return sinkConfig{Webhook: cfg}
+	}
+
+	//nolint:errcheck // This is already verified by cobra
+	syslogURL, _ := cmd.Flags().GetString("syslog")
+	if syslogURL == "" {
+		return sinkConfig{Stdout: &stdoutSinkConfig{}}
+	}
+
+	cfg := &syslogSinkConfig{URL: syslogURL}
+	//nolint:errcheck // This is already verified by cobra
+	cfg.StructuredDataID, _ = cmd.Flags().GetString("syslog-sd-id")
+	//nolint:errcheck // This is already verified by cobra
+	cfg.CA, _ = cmd.Flags().GetString("syslog-ca")
+	//nolint:errcheck // This is already verified by cobra
+	cfg.Cert, _ = cmd.Flags().GetString("syslog-cert")
+	//nolint:errcheck // This is already verified by cobra
+	cfg.Key, _ = cmd.Flags().GetString("syslog-key")
+
+	return sinkConfig{Syslog: cfg}
+}
+
+// newSinkOutput returns the sink of cfg. If metrics are enabled, the sink
+// is instrumented, and if --spool-dir is set, it's spooled.
+func newSinkOutput(
+	ctx context.Context,
+	cmd *cobra.Command,
+	name string,
+	cfg sinkConfig,
+	quarantine io.Writer,
+	metrics *tailMetrics,
+	health *tailHealth,
+) (io.WriteCloser, error) {
+	out, err := newSink(ctx, cmd.OutOrStdout(), cfg, quarantine, metrics)
+	if err != nil {
+		return nil, err
+	}
+
+	if metrics != nil {
+		out = &instrumentedSink{WriteCloser: out, metrics: metrics}
+	}
+
+	// The spool flushes webhooks no more often than they flush themselves,
+	// so their batches are kept whole
+	checkpointInterval := defaultSpoolCheckpointInterval
+	if cfg.Webhook != nil {
+		checkpointInterval = max(checkpointInterval, cfg.Webhook.FlushInterval)
+	}
+
+	return newSpoolOutput(ctx, cmd, name, out, spoolConfig{
+		checkpointInterval: checkpointInterval,
+		metrics:            metrics,
+		health:             health,
+	})
+}
+
+func newSink(
+	ctx context.Context,
+	stdout io.Writer,
+	cfg sinkConfig,
+	quarantine io.Writer,
+	metrics *tailMetrics,
+) (io.WriteCloser, error) {
+	switch {
+	case cfg.Webhook != nil:
+		return newWebhookOutput(ctx, cfg.Webhook, quarantine, metrics)
+	case cfg.Syslog != nil:
+		return newSyslogOutput(ctx, cfg.Syslog, metrics)
+	default:
+		return nopCloser{stdout}, nil
+	}
+}
+
+func newSyslogOutput(ctx context.Context, cfg *syslogSinkConfig, metrics *tailMetrics) (io.WriteCloser, error) {
+	tlsConfig, err := newClientTLSConfig(cfg.CA, cfg.Cert, cfg.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	sink, err := newSyslogSink(ctx, cfg.URL, cfg.StructuredDataID, tlsConfig)
+	if err != nil {
+		return nil, fmt.Errorf("creating syslog sink: %w", err)
+	}
+	sink.metrics = metrics
 
-	return ft.tailFile(cmd.Context())
+	return sink, nil
+}
+
+func newWebhookOutput(
+	ctx context.Context,
+	cfg *webhookSinkConfig,
+	quarantine io.Writer,
+	metrics *tailMetrics,
+) (io.WriteCloser, error) {
+	var token string
+	if cfg.TokenFile != "" {
+		b, err := os.ReadFile(cfg.TokenFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading webhook token: %w", err)
+		}
+		token = string(bytes.TrimSpace(b))
+	}
+
+	tlsConfig, err := newClientTLSConfig(cfg.CA, cfg.Cert, cfg.Key)
+	if err != nil {
+		return nil, err
+	}
+
+	sink, err := newWebhookSink(ctx, webhookConfig{
+		url:           cfg.URL,
+		token:         token,
+		gzip:          cfg.Gzip,
+		batchSize:     cfg.BatchSize,
+		flushInterval: cfg.FlushInterval,
+		tlsConfig:     tlsConfig,
+		quarantine:    quarantine,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating webhook sink: %w", err)
+	}
+	sink.metrics = metrics
+
+	return sink, nil
+}
+
+// newSpoolOutput returns a spool in front of out if --spool-dir is set,
+// or out otherwise. Named sinks are spooled in a directory of their own.
+// The rest of cfg is set from the flags.
+func newSpoolOutput(
+	ctx context.Context,
+	cmd *cobra.Command,
+	name string,
+	out io.WriteCloser,
+	cfg spoolConfig,
+) (io.WriteCloser, error) {
+	//nolint:errcheck // This is already verified by cobra
+	dir, _ := cmd.Flags().GetString("spool-dir")
+	if dir == "" {
+		return out, nil
+	}
+
+	//nolint:errcheck // This is already verified by cobra
+	maxSizeMiB, _ := cmd.Flags().GetInt64("spool-max-size-mib")
+	//nolint:errcheck // This is already verified by cobra
+	maxAge, _ := cmd.Flags().GetDuration("spool-max-age")
+	//nolint:errcheck // This is already verified by cobra
+	fullPolicy, _ := cmd.Flags().GetString("spool-full-policy")
+
+	cfg.dir = filepath.Join(dir, name)
+	cfg.maxSize = maxSizeMiB << 20
+	cfg.segmentSize = min(defaultSpoolSegmentSize, cfg.maxSize/spoolMinSegments)
+	cfg.maxAge = maxAge
+	cfg.fullPolicy = fullPolicy
+
+	sp, err := newSpool(ctx, cfg, out, cmd.ErrOrStderr())
+	if err != nil {
+		out.Close()
+		return nil, fmt.Errorf("creating spool: %w", err)
+	}
+
+	return sp, nil
+}
+
+// nopCloser keeps stdout open once tailing is done.
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error {
+	return nil
 }
 
 type fileTailer struct {
 	r io.Reader
 	w io.Writer
+	// quarantine receives the lines that aren't audit events
+	quarantine io.Writer
+	// enricher adds the Kubernetes identity to events, if set
+	enricher *kubeEnricher
+	metrics  *tailMetrics
+	health   *tailHealth
+	// drainTimeout bounds how long the audit log is drained for
+	// once shutdown is requested
+	drainTimeout time.Duration
+	report       drainReport
+	// follower is set if a regular file is followed. consumed is the
+	// position after the last whole line, which is checkpointed.
+	follower     *fileFollower
+	consumed     int64
+	checkpointed int64
+}
+
+// newFollowingTailer returns a tailer that follows the regular file at
+// path when it's rotated, resuming from the position in the state file.
+func newFollowingTailer(file, stateFile string, w, quarantine, log io.Writer) (*fileTailer, error) {
+	ff, err := newFileFollower(file, stateFile, log)
+	if err != nil {
+		return nil, err
+	}
+
+	return &fileTailer{
+		r:          ff,
+		w:          w,
+		quarantine: quarantine,
+		follower:   ff,
+	}, nil
 }
 
-func newFileTailer(file string, w io.Writer) (*fileTailer, error) {
+func newFileTailer(file string, w, quarantine io.Writer) (*fileTailer, error) {
 	f, err := os.Open(file)
 	if err != nil {
 		return nil, fmt.Errorf("opening file: %w", err)
 	}
 
 	return &fileTailer{
-		r: f,
-		w: w,
+		r:          f,
+		w:          w,
+		quarantine: quarantine,
 	}, nil
 }
 
+// tailFile forwards events until ctx is cancelled. It then drains the
+// audit log until its writers close it or the drain timeout passes.
 func (ft *fileTailer) tailFile(ctx context.Context) error {
+	if d, ok := ft.r.(readDeadliner); ok {
+		stop := context.AfterFunc(ctx, func() {
+			//nolint:errcheck // Without a deadline, the drain only stops once the writers are gone
+			d.SetReadDeadline(time.Now().Add(ft.drainTimeout))
+		})
+		defer stop()
+	}
+
 	ticker := time.NewTicker(defaultConstantBackoff)
+
+	var checkpoints <-chan time.Time
+	if ft.follower != nil {
+		checkpointTicker := time.NewTicker(followCheckpointInterval)
+		defer checkpointTicker.Stop()
+		checkpoints = checkpointTicker.C
+	}
+
 	eg := &errgroup.Group{}
 	eg.Go(func() error {
+		defer ft.health.stop()
+
+		br := bufio.NewReader(ft.r)
+		// holds a line until the writer finishes it
+		var pending []byte
 		for {
 			select {
 			case <-ticker.C:
-				if _, err := io.Copy(ft.w, ft.r); err != nil {
-					if !errors.Is(err, io.EOF) {
-						return err
+				var err error
+				if pending, err = ft.forwardEvents(ctx, br, pending); err != nil {
+					if ctx.Err() != nil && errors.Is(err, os.ErrDeadlineExceeded) {
+						ft.report.abandoned = true
+						return ft.finishDrain(ctx, pending)
 					}
+					return err
+				}
+				ft.health.read()
+			case <-checkpoints:
+				if err := ft.checkpoint(); err != nil {
+					return err
 				}
 			case <-ctx.Done():
-				return ctx.Err()
+				pending, err := ft.forwardEvents(ctx, br, pending)
+				if errors.Is(err, os.ErrDeadlineExceeded) {
+					ft.report.abandoned = true
+				} else if err != nil {
+					return err
+				}
+				return ft.finishDrain(ctx, pending)
 			}
 		}
 	})
@@ -115,3 +596,128 @@ func (ft *fileTailer) tailFile(ctx context.Context) error {
 
 	return fmt.Errorf("tail file: %w", err)
 }
+
+// finishDrain quarantines the pending line, as a line that was never
+// finished can't be an event. A followed file is read again from the
+// pending line after a restart instead, as it may still be finished.
+func (ft *fileTailer) finishDrain(ctx context.Context, pending []byte) error {
+	if len(pending) > 0 && ft.follower == nil {
+		ft.report.unfinished = len(pending)
+		if err := writeLine(ft.quarantine, pending); err != nil {
+			return err
+		}
+	}
+
+	return ctx.Err()
+}
+
+// forwardEvents forwards every complete line that can be read right
+// away, starting with the pending one. It returns the trailing line
+// if it isn't complete yet.
+func (ft *fileTailer) forwardEvents(ctx context.Context, br *bufio.Reader, pending []byte) ([]byte, error) {
+	for {
+		line, err := br.ReadBytes('\n')
+		pending = append(pending, line...)
+		if errors.Is(err, io.EOF) {
+			return pending, nil
+		}
+		if err != nil {
+			return pending, err
+		}
+
+		if err := ft.forward(pending); err != nil {
+			return nil, err
+		}
+		ft.consumed += int64(len(pending))
+		pending = pending[:0]
+
+		if ctx.Err() != nil {
+			ft.report.drainedLines++
+		}
+	}
+}
+
+// checkpoint saves the position after the last whole line of a followed
+// file, once the output has flushed the events before it.
+func (ft *fileTailer) checkpoint() error {
+	if ft.follower == nil || ft.consumed == ft.checkpointed {
+		return nil
+	}
+
+	if f, ok := ft.w.(flusher); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return ft.saveCheckpoint()
+}
+
+// saveCheckpoint saves the position after the last whole line of a
+// followed file, without flushing the output.
+func (ft *fileTailer) saveCheckpoint() error {
+	if ft.follower == nil {
+		return nil
+	}
+
+	if err := ft.follower.save(ft.consumed); err != nil {
+		return err
+	}
+	ft.checkpointed = ft.consumed
+
+	return nil
+}
+
+// forward writes a line to the output if it's an audit event (see
+// isAuditEvent), or to the quarantine otherwise. Blank lines are dropped.
+// Events are re-encoded only if the enrichment changes them, and then
+// only the field it changes is.
+func (ft *fileTailer) forward(line []byte) error {
+	trimmed := bytes.TrimSpace(line)
+	if len(trimmed) == 0 {
+		return nil
+	}
+
+	event := &auditevent.AuditEvent{}
+	if err := json.Unmarshal(trimmed, event); err != nil || !isAuditEvent(event) {
+		ft.metrics.read(len(line), false)
+		return writeLine(ft.quarantine, line)
+	}
+	ft.metrics.read(len(line), true)
+
+	if ft.enricher != nil && ft.enricher.enrich(event) {
+		enriched, err := ft.enricher.patch(trimmed)
+		if err != nil {
+			return fmt.Errorf("encoding enriched event: %w", err)
+		}
+		line = enriched
+	}
+
+	return writeLine(ft.w, line)
+}
+
+// isAuditEvent tells whether a decoded line has what identifies an audit
+// event: its audit ID, type and logging time. Other JSON values, like null,
+// {} or unrelated objects, decode without them.
+func isAuditEvent(e *auditevent.AuditEvent) bool {
+	return e.Metadata.AuditID != "" && e.Type != "" && !e.LoggedAt.IsZero()
+}
+
+// writeLine writes a newline-terminated line in a single call,
+// so it's never interleaved with other writes. A short write
+// is an error, as the line can't be completed atomically.
+func writeLine(w io.Writer, line []byte) error {
+	if line[len(line)-1] != '\n' {
+		line = append(line, '\n')
+	}
+
+	n, err := w.Write(line)
+	if err == nil && n < len(line) {
+		err = io.ErrShortWrite
+	}
+	if err != nil {
+		return fmt.Errorf("writing line: %w", err)
+	}
+
+	return nil
+}
@@ -22,8 +22,10 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"strings"
 	"sync"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -191,6 +193,63 @@ func TestFileTrailerUnknownErrorWhenTailing(t *testing.T) {
 	require.Error(t, err, "unexpected success")
 }
 
+func TestFileTailerForwardsWholeEvents(t *testing.T) {
+	t.Parallel()
+
+	event := `{"metadata":{"auditId":"1"},"type":"foo","loggedAt":"2026-01-01T00:00:00Z","outcome":"succeeded"}`
+	input := strings.Join([]string{
+		event,
+		"not an event",
+		"",
+		"null",
+		"{}",
+		`{"kind":"Event","type":"Normal"}`,
+		`{"type": "half`,
+		event,
+		`{"type":"unterminated"}`,
+	}, "\n")
+
+	// The reader is split in two to check lines spanning reads
+	r := io.MultiReader(strings.NewReader(input[:len(event)/2]), strings.NewReader(input[len(event)/2:]))
+
+	var out, quarantine bytes.Buffer
+	ft := &fileTailer{
+		r:          r,
+		w:          &out,
+		quarantine: &quarantine,
+	}
+
+	// Give the tailer some time to read everything
+	ctx, cancel := context.WithCancel(t.Context())
+	time.AfterFunc(50*time.Millisecond, cancel)
+
+	err := ft.tailFile(ctx)
+	require.NoError(t, err, "unexpected error")
+	require.Equal(t, event+"\n"+event+"\n", out.String(), "only whole events should be forwarded")
+	require.Equal(t, "not an event\nnull\n{}\n{\"kind\":\"Event\",\"type\":\"Normal\"}\n"+
+		"{\"type\": \"half\n{\"type\":\"unterminated\"}\n", quarantine.String(),
+		"malformed and unfinished lines, and JSON that isn't an event, should be quarantined")
+}
+
+type shortWriter struct{}
+
+func (s *shortWriter) Write(p []byte) (int, error) {
+	return len(p) - 1, nil
+}
+
+func TestFileTailerFailsOnShortWrites(t *testing.T) {
+	t.Parallel()
+
+	ft := &fileTailer{
+		r:          strings.NewReader(spoolTestEvent(0) + "\n"),
+		w:          &shortWriter{},
+		quarantine: io.Discard,
+	}
+
+	err := ft.tailFile(t.Context())
+	require.ErrorIs(t, err, io.ErrShortWrite)
+}
+
 func TestRootCmdSingletonGet(t *testing.T) {
 	t.Parallel()
 
@@ -0,0 +1,215 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"slices"
+)
+
+// routedEvent holds the fields of an audit event that routes match on.
+type routedEvent struct {
+	Type      string            `json:"type"`
+	Outcome   string            `json:"outcome"`
+	Component string            `json:"component"`
+	Subjects  map[string]string `json:"subjects"`
+	Target    map[string]string `json:"target"`
+}
+
+// route is a compiled routeConfig.
+type route struct {
+	types      []*regexp.Regexp
+	outcomes   []*regexp.Regexp
+	components []*regexp.Regexp
+	subjects   map[string]*regexp.Regexp
+	target     map[string]*regexp.Regexp
+	sinks      []string
+}
+
+func newRoute(cfg routeConfig) route {
+	return route{
+		types:      compilePatterns(cfg.Match.Type),
+		outcomes:   compilePatterns(cfg.Match.Outcome),
+		components: compilePatterns(cfg.Match.Component),
+		subjects:   compileKeyPatterns(cfg.Match.Subjects),
+		target:     compileKeyPatterns(cfg.Match.Target),
+		sinks:      cfg.Sinks,
+	}
+}
+
+func (r *route) matches(e *routedEvent) bool {
+	return matchesAny(r.types, e.Type) &&
+		matchesAny(r.outcomes, e.Outcome) &&
+		matchesAny(r.components, e.Component) &&
+		matchesKeys(r.subjects, e.Subjects) &&
+		matchesKeys(r.target, e.Target)
+}
+
+// router sends every event to the sinks of the first route that matches
+// it, or to the default sinks if none does. It receives whole events, one
+// per Write.
+type router struct {
+	routes   []route
+	defaults []string
+	// names are the names of the sinks, in a stable order
+	names []string
+	sinks map[string]io.WriteCloser
+}
+
+// newRouter returns a router over the sinks of the configuration, which
+// are created by newSink. If it fails, the sinks that were created are closed.
+func newRouter(cfg *routingConfig, newSink func(name string, cfg sinkConfig) (io.WriteCloser, error)) (*router, error) {
+	r := &router{
+		defaults: cfg.Default,
+		sinks:    map[string]io.WriteCloser{},
+	}
+
+	for name := range cfg.Sinks {
+		r.names = append(r.names, name)
+	}
+	slices.Sort(r.names)
+
+	for _, name := range r.names {
+		sink, err := newSink(name, cfg.Sinks[name])
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("creating sink %q: %w", name, err)
+		}
+		r.sinks[name] = sink
+	}
+
+	for _, rc := range cfg.Routes {
+		r.routes = append(r.routes, newRoute(rc))
+	}
+
+	return r, nil
+}
+
+func (r *router) Write(p []byte) (int, error) {
+	e := &routedEvent{}
+	if err := json.Unmarshal(p, e); err != nil {
+		return 0, fmt.Errorf("routing event: %w", err)
+	}
+
+	for _, name := range r.match(e) {
+		if err := writeLine(r.sinks[name], p); err != nil {
+			return 0, fmt.Errorf("sending event to sink %q: %w", name, err)
+		}
+	}
+
+	return len(p), nil
+}
+
+// match returns the sinks an event is sent to.
+func (r *router) match(e *routedEvent) []string {
+	for i := range r.routes {
+		if r.routes[i].matches(e) {
+			return r.routes[i].sinks
+		}
+	}
+
+	return r.defaults
+}
+
+// Flush flushes the sinks that buffer events.
+func (r *router) Flush() error {
+	for _, name := range r.names {
+		if f, ok := r.sinks[name].(flusher); ok {
+			if err := f.Flush(); err != nil {
+				return fmt.Errorf("flushing sink %q: %w", name, err)
+			}
+		}
+	}
+
+	return nil
+}
+
+// Close closes every sink, even if some fail to.
+func (r *router) Close() error {
+	var errs []error
+	for _, name := range r.names {
+		if sink, ok := r.sinks[name]; ok {
+			if err := sink.Close(); err != nil {
+				errs = append(errs, fmt.Errorf("closing sink %q: %w", name, err))
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// unsent returns the size of the events left in the spools of the sinks.
+func (r *router) unsent() int64 {
+	var n int64
+	for _, sink := range r.sinks {
+		if sp, ok := sink.(*spool); ok {
+			n += sp.unsent()
+		}
+	}
+
+	return n
+}
+
+func compilePatterns(patterns []string) []*regexp.Regexp {
+	res := make([]*regexp.Regexp, 0, len(patterns))
+	for _, p := range patterns {
+		res = append(res, compilePattern(p))
+	}
+
+	return res
+}
+
+func compileKeyPatterns(patterns map[string]string) map[string]*regexp.Regexp {
+	res := make(map[string]*regexp.Regexp, len(patterns))
+	for k, p := range patterns {
+		res[k] = compilePattern(p)
+	}
+
+	return res
+}
+
+// matchesAny returns whether v matches any of the patterns, or true if
+// there's none.
+func matchesAny(patterns []*regexp.Regexp, v string) bool {
+	if len(patterns) == 0 {
+		return true
+	}
+
+	for _, p := range patterns {
+		if p.MatchString(v) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// matchesKeys returns whether every key of the patterns is in m, with a
+// value that matches its pattern.
+func matchesKeys(patterns map[string]*regexp.Regexp, m map[string]string) bool {
+	for k, p := range patterns {
+		v, ok := m[k]
+		if !ok || !p.MatchString(v) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func routeTestEvent(typ, outcome, component, user string) string {
+	return fmt.Sprintf(`{"type":%q,"outcome":%q,"component":%q,"subjects":{"user":%q},"target":{"path":"/v1/%s"}}`,
+		typ, outcome, component, user, typ)
+}
+
+func newTestRouter(t *testing.T, config string) (*router, map[string]*spoolTestSink) {
+	t.Helper()
+
+	cfg, err := decodeRoutingConfig(strings.NewReader(config))
+	require.NoError(t, err)
+
+	sinks := map[string]*spoolTestSink{}
+	r, err := newRouter(cfg, func(name string, _ sinkConfig) (io.WriteCloser, error) {
+		sinks[name] = newSpoolTestSink()
+		return sinks[name], nil
+	})
+	require.NoError(t, err)
+
+	return r, sinks
+}
+
+func TestRouterRoutesEvents(t *testing.T) {
+	t.Parallel()
+
+	r, sinks := newTestRouter(t, `
+sinks:
+  siem: {stdout: {}}
+  billing: {stdout: {}}
+  archive: {stdout: {}}
+routes:
+  - match:
+      outcome: [failed, denied]
+    sinks: [siem, archive]
+  - match:
+      component: [billing-*]
+      subjects: {user: "*@example.com"}
+    sinks: [billing]
+  - match:
+      target: {path: /v1/delete*}
+    sinks: [siem]
+default: [archive]
+`)
+
+	failed := routeTestEvent("login", "failed", "billing-api", "jane@example.com")
+	billed := routeTestEvent("charge", "succeeded", "billing-api", "jane@example.com")
+	external := routeTestEvent("charge", "succeeded", "billing-api", "joe@example.org")
+	deleted := routeTestEvent("delete-account", "succeeded", "accounts", "jane@example.com")
+	other := routeTestEvent("login", "succeeded", "accounts", "jane@example.com")
+
+	for _, e := range []string{failed, billed, external, deleted, other} {
+		n, err := r.Write([]byte(e + "\n"))
+		require.NoError(t, err)
+		require.Equal(t, len(e)+1, n, "the whole event should be written")
+	}
+
+	// Only the first route that matches is used
+	require.Equal(t, []string{failed, deleted}, sinks["siem"].received())
+	require.Equal(t, []string{billed}, sinks["billing"].received())
+	require.Equal(t, []string{failed, external, other}, sinks["archive"].received())
+
+	require.NoError(t, r.Flush())
+	require.NoError(t, r.Close())
+	for name, sink := range sinks {
+		require.True(t, sink.closed, "sink %q should be closed", name)
+	}
+}
+
+func TestRouterErrors(t *testing.T) {
+	t.Parallel()
+
+	r, sinks := newTestRouter(t, "sinks: {out: {stdout: {}}}\ndefault: [out]")
+
+	_, err := r.Write([]byte("{\"type\":\n"))
+	require.ErrorContains(t, err, "routing event")
+
+	sinks["out"].breakDown()
+	_, err = r.Write([]byte(spoolTestEvent(0) + "\n"))
+	require.ErrorIs(t, err, errSpoolTestSinkBroken)
+	require.ErrorContains(t, err, `sink "out"`)
+
+	// The sinks that were created are closed if one can't be
+	cfg, err := decodeRoutingConfig(strings.NewReader("sinks: {a: {stdout: {}}, b: {stdout: {}}}\ndefault: [a]"))
+	require.NoError(t, err)
+
+	created := newSpoolTestSink()
+	_, err = newRouter(cfg, func(name string, _ sinkConfig) (io.WriteCloser, error) {
+		if name == "b" {
+			return nil, errSpoolTestSinkBroken
+		}
+		return created, nil
+	})
+	require.ErrorIs(t, err, errSpoolTestSinkBroken)
+	require.ErrorContains(t, err, `creating sink "b"`)
+	require.True(t, created.closed)
+}
+
+func TestNewOutputWithConfig(t *testing.T) {
+	t.Parallel()
+
+	c := &webhookCollector{}
+	srv := httptest.NewServer(c)
+	t.Cleanup(srv.Close)
+
+	dir := t.TempDir()
+	path := filepath.Join(dir, "audittail.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+sinks:
+  collector:
+    webhook: {url: `+srv.URL+`, batchSize: 1}
+  stdout:
+    stdout: {}
+routes:
+  - match: {outcome: [failed]}
+    sinks: [collector]
+default: [stdout]
+`), ownerGroupOwnership))
+
+	cmd := NewRootCmd()
+	var stdout syncBuffer
+	cmd.SetOut(&stdout)
+	spoolDir := filepath.Join(dir, "spool")
+	require.NoError(t, cmd.ParseFlags([]string{"--config", path, "--spool-dir", spoolDir}))
+
+	out, err := newOutput(t.Context(), cmd, io.Discard, nil, nil)
+	require.NoError(t, err)
+
+	failed := routeTestEvent("login", "failed", "accounts", "jane@example.com")
+	other := routeTestEvent("login", "succeeded", "accounts", "jane@example.com")
+	for _, e := range []string{failed, other} {
+		require.NoError(t, writeLine(out, []byte(e+"\n")))
+	}
+	require.NoError(t, out.Close())
+
+	batches, _ := c.received()
+	require.Equal(t, []string{failed + "\n"}, batches)
+	require.Equal(t, other+"\n", stdout.String())
+
+	// Every sink has a spool of its own
+	require.NotNil(t, spoolOf(out))
+	for _, name := range []string{"collector", "stdout"} {
+		require.DirExists(t, filepath.Join(spoolDir, name))
+	}
+
+	require.NoError(t, cmd.ParseFlags([]string{"--webhook", srv.URL}))
+	err = cmd.ValidateFlagGroups()
+	require.ErrorContains(t, err, "[config webhook] were all set")
+}
@@ -0,0 +1,781 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// These are the policies that determine what happens to an event
+// when the spool is full.
+const (
+	// spoolFullBlock stops reading the audit log until there's room.
+	spoolFullBlock = "block"
+	// spoolFullDropOldest drops the oldest segment to make room.
+	spoolFullDropOldest = "drop-oldest"
+	// spoolFullDropNewest drops the event.
+	spoolFullDropNewest = "drop-newest"
+)
+
+const (
+	defaultSpoolMaxSizeMiB = 256
+	// defaultSpoolSegmentSize is the size a segment is rotated at, unless
+	// the spool can't fit spoolMinSegments of them.
+	defaultSpoolSegmentSize = 8 << 20
+	spoolMinSegments        = 4
+
+	// defaultSpoolCheckpointInterval is how often the sink is flushed, so
+	// the events sent to it are forgotten.
+	defaultSpoolCheckpointInterval = time.Second
+	// spoolSyncInterval is how often the segment that's written to is
+	// synced to disk, while events are written.
+	spoolSyncInterval = time.Second
+
+	spoolMinRetryBackoff = 100 * time.Millisecond
+	spoolMaxRetryBackoff = 30 * time.Second
+
+	spoolSegmentExt   = ".seg"
+	spoolCursorFile   = "cursor"
+	spoolCursorFormat = "%020d %020d\n"
+	spoolDirMode      = 0o750
+)
+
+// flusher is implemented by sinks that buffer events. The spool
+// only forgets events once they're flushed.
+type flusher interface {
+	Flush() error
+}
+
+// spoolConfig holds the settings of a spool.
+type spoolConfig struct {
+	dir         string
+	maxSize     int64
+	segmentSize int64
+	maxAge      time.Duration
+	fullPolicy  string
+	// checkpointInterval is how often the sink is flushed while events
+	// are sent. If it's 0, it's flushed once there's nothing left to send.
+	checkpointInterval time.Duration
+	metrics            *tailMetrics
+	health             *tailHealth
+}
+
+// spoolSegment is a file of the spool, which holds whole events.
+type spoolSegment struct {
+	seq      uint64
+	size     int64
+	modified time.Time
+}
+
+// spool is a disk-backed buffer between the audit log and a sink, so that
+// the audit log keeps being read while the sink is slow or unavailable.
+//
+// Events are appended to segment files in a directory, which are synced
+// to disk every sync interval and once they're finished. A drainer sends
+// them to the sink in order, and removes the segments it's done with.
+// The position of the drainer is saved in a cursor file every checkpoint
+// interval, once the sink is flushed, so the events that weren't sent are
+// replayed after a restart. Delivery is at-least-once. If the sink fails,
+// i.e. it's unavailable, the drainer retries with exponential backoff
+// while events are spooled. Sinks take the events they can never send,
+// like the batches the webhook collector rejects, and quarantine them,
+// so the drainer moves past them.
+type spool struct {
+	//nolint:containedctx // Write has no context of its own to stop waiting
+	ctx  context.Context
+	cfg  spoolConfig
+	sink io.WriteCloser
+	// log receives notices about dropped events
+	log io.Writer
+
+	mu sync.Mutex
+	// segments are sorted from oldest to newest. The newest one is written to.
+	segments []*spoolSegment
+	// size is the size of all the segments
+	size int64
+	w    *os.File
+	// synced is when w was last synced to disk, and unsynced is set if
+	// events were written since. syncTimer syncs them once the sync
+	// interval has passed.
+	synced    time.Time
+	unsynced  bool
+	syncTimer *time.Timer
+	// dropped is the number of events dropped since the spool was last full
+	dropped int
+	// recordedSize and recordedSegments are the size of the spool last
+	// added to the metrics, which are shared with the spools of other sinks
+	recordedSize     int64
+	recordedSegments int
+	// err is the error that stopped the spool
+	err error
+
+	// These are only used by the drainer, or once it's done.
+	cursor           *os.File
+	readFile         *os.File
+	readSeq          uint64
+	readOffset       int64
+	checkpointSeq    uint64
+	checkpointOffset int64
+	checkpointed     time.Time
+	// retrying is set while the sink fails
+	retrying bool
+
+	// written wakes up the drainer when events are written
+	written chan struct{}
+	// freed wakes up blocked writers when segments are removed
+	freed     chan struct{}
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+	closeErr  error
+}
+
+// newSpool opens the spool in cfg.dir, creating it if needed, and
+// starts sending its events to the sink, starting with the ones left
+// over from previous runs.
+func newSpool(ctx context.Context, cfg spoolConfig, sink io.WriteCloser, log io.Writer) (*spool, error) {
+	switch cfg.fullPolicy {
+	case spoolFullBlock, spoolFullDropOldest, spoolFullDropNewest:
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrInvalidSpoolFullPolicy, cfg.fullPolicy)
+	}
+
+	if cfg.maxSize <= 0 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidSpoolMaxSize, cfg.maxSize)
+	}
+
+	if cfg.maxAge < 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidSpoolMaxAge, cfg.maxAge)
+	}
+
+	if err := os.MkdirAll(cfg.dir, spoolDirMode); err != nil {
+		return nil, fmt.Errorf("creating spool directory: %w", err)
+	}
+
+	s := &spool{
+		ctx:     ctx,
+		cfg:     cfg,
+		sink:    sink,
+		log:     log,
+		written: make(chan struct{}, 1),
+		freed:   make(chan struct{}, 1),
+		stop:    make(chan struct{}),
+		done:    make(chan struct{}),
+	}
+
+	if err := s.load(); err != nil {
+		s.closeFiles()
+		return nil, err
+	}
+
+	go s.run()
+
+	return s, nil
+}
+
+// load finds the segments and the cursor left over from previous runs,
+// and creates a new segment to write to.
+func (s *spool) load() error {
+	entries, err := os.ReadDir(s.cfg.dir)
+	if err != nil {
+		return fmt.Errorf("reading spool directory: %w", err)
+	}
+
+	for _, e := range entries {
+		seq, err := strconv.ParseUint(strings.TrimSuffix(e.Name(), spoolSegmentExt), 10, 64)
+		if err != nil || !strings.HasSuffix(e.Name(), spoolSegmentExt) {
+			continue
+		}
+
+		info, err := e.Info()
+		if err != nil {
+			return fmt.Errorf("reading spool segment: %w", err)
+		}
+
+		s.segments = append(s.segments, &spoolSegment{seq: seq, size: info.Size(), modified: info.ModTime()})
+		s.size += info.Size()
+	}
+
+	slices.SortFunc(s.segments, func(a, b *spoolSegment) int {
+		return cmp.Compare(a.seq, b.seq)
+	})
+
+	s.cursor, err = os.OpenFile(filepath.Join(s.cfg.dir, spoolCursorFile), os.O_RDWR|os.O_CREATE, ownerGroupOwnership)
+	if err != nil {
+		return fmt.Errorf("opening spool cursor: %w", err)
+	}
+
+	// A missing or corrupt cursor replays all the segments
+	b, err := io.ReadAll(s.cursor)
+	if err != nil {
+		return fmt.Errorf("reading spool cursor: %w", err)
+	}
+	//nolint:errcheck // See above
+	fmt.Sscanf(string(b), spoolCursorFormat, &s.readSeq, &s.readOffset)
+
+	// Segments before the cursor were sent already
+	for len(s.segments) > 0 && s.segments[0].seq < s.readSeq {
+		s.removeOldest()
+	}
+
+	if len(s.segments) == 0 || s.segments[0].seq != s.readSeq {
+		s.readOffset = 0
+	}
+	s.checkpointSeq, s.checkpointOffset = s.readSeq, s.readOffset
+
+	return s.rotate()
+}
+
+// Write appends the audit event in p to the spool. p is expected to
+// hold a single, whole event.
+func (s *spool) Write(p []byte) (int, error) {
+	line := p
+	if line[len(line)-1] != '\n' {
+		line = append(line, '\n')
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.expire()
+
+	for s.err == nil && s.size+int64(len(line)) > s.cfg.maxSize {
+		switch {
+		case s.cfg.fullPolicy == spoolFullDropOldest && s.size > 0:
+			if err := s.dropOldest(); err != nil {
+				return 0, err
+			}
+		case s.cfg.fullPolicy == spoolFullBlock && s.size > 0:
+			// The drainer only removes the segments that aren't written to
+			if s.segments[len(s.segments)-1].size > 0 {
+				if err := s.rotate(); err != nil {
+					return 0, err
+				}
+			}
+			if err := s.waitForRoom(); err != nil {
+				return 0, err
+			}
+		default:
+			// Either the policy says so, or the event doesn't fit even
+			// in an empty spool
+			if s.dropped == 0 {
+				fmt.Fprintf(s.log, "audittail: spool is full, dropping events\n")
+			}
+			s.dropped++
+			s.cfg.metrics.spoolDropped(dropReasonFull, int64(len(line)))
+			return len(p), nil
+		}
+	}
+
+	if s.err != nil {
+		return 0, s.err
+	}
+
+	if s.dropped > 0 {
+		fmt.Fprintf(s.log, "audittail: spool has room again, %d events were dropped\n", s.dropped)
+		s.dropped = 0
+	}
+
+	seg := s.segments[len(s.segments)-1]
+	if seg.size >= s.cfg.segmentSize {
+		if err := s.rotate(); err != nil {
+			return 0, err
+		}
+		seg = s.segments[len(s.segments)-1]
+	}
+
+	n, err := s.w.Write(line)
+	seg.size += int64(n)
+	seg.modified = time.Now()
+	s.size += int64(n)
+	s.recordSize()
+	if err != nil {
+		s.err = fmt.Errorf("writing to spool: %w", err)
+		return 0, s.err
+	}
+
+	s.unsynced = true
+	if time.Since(s.synced) >= spoolSyncInterval {
+		if err := s.sync(); err != nil {
+			s.err = err
+			return 0, s.err
+		}
+	} else if s.syncTimer == nil {
+		s.syncTimer = time.AfterFunc(time.Until(s.synced.Add(spoolSyncInterval)), s.syncLater)
+	}
+
+	select {
+	case s.written <- struct{}{}:
+	default:
+	}
+
+	return len(p), nil
+}
+
+// Close stops the drainer once it has sent the events it can right away,
+// closes the sink and saves the position of the drainer.
+func (s *spool) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+		<-s.done
+
+		s.mu.Lock()
+		defer s.mu.Unlock()
+
+		// Closing the sink flushes it
+		s.closeErr = s.sink.Close()
+		if s.closeErr == nil {
+			s.closeErr = s.saveCursor()
+		}
+		if err := s.sync(); s.closeErr == nil {
+			s.closeErr = err
+		}
+		if s.syncTimer != nil {
+			s.syncTimer.Stop()
+		}
+
+		s.closeFiles()
+	})
+
+	return s.closeErr
+}
+
+// unsent returns the size of the events that will be replayed after a
+// restart. It's nil-safe, and only meant to be called once the spool is closed.
+func (s *spool) unsent() int64 {
+	if s == nil {
+		return 0
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for _, seg := range s.segments {
+		switch {
+		case seg.seq == s.checkpointSeq:
+			n += seg.size - s.checkpointOffset
+		case seg.seq > s.checkpointSeq:
+			n += seg.size
+		}
+	}
+
+	return n
+}
+
+func (s *spool) closeFiles() {
+	for _, f := range []*os.File{s.w, s.cursor, s.readFile} {
+		if f != nil {
+			f.Close()
+		}
+	}
+}
+
+// waitForRoom waits until the drainer removes a segment. s.mu must be held.
+func (s *spool) waitForRoom() error {
+	s.mu.Unlock()
+	defer s.mu.Lock()
+
+	select {
+	case <-s.freed:
+		return nil
+	case <-s.done:
+		// The drainer stopped, s.err tells why
+		return nil
+	case <-s.ctx.Done():
+		return fmt.Errorf("waiting for room in the spool: %w", s.ctx.Err())
+	}
+}
+
+// rotate starts writing to a new segment. s.mu must be held.
+func (s *spool) rotate() error {
+	seq := s.readSeq
+	if len(s.segments) > 0 {
+		seq = s.segments[len(s.segments)-1].seq + 1
+	}
+
+	if err := s.sync(); err != nil {
+		return err
+	}
+
+	w, err := os.OpenFile(s.segmentPath(seq), os.O_APPEND|os.O_CREATE|os.O_WRONLY, ownerGroupOwnership)
+	if err != nil {
+		return fmt.Errorf("creating spool segment: %w", err)
+	}
+
+	// The new segment is only found after a crash once its directory
+	// entry is synced too
+	if err := syncDir(s.cfg.dir); err != nil {
+		w.Close()
+		return err
+	}
+
+	if s.w != nil {
+		s.w.Close()
+	}
+
+	s.w = w
+	s.segments = append(s.segments, &spoolSegment{seq: seq, modified: time.Now()})
+	s.recordSize()
+
+	// The drainer may be done with the previous segment now
+	select {
+	case s.written <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// sync syncs the segment that's written to, if any, to disk.
+// s.mu must be held.
+func (s *spool) sync() error {
+	if s.w == nil {
+		return nil
+	}
+
+	if err := s.w.Sync(); err != nil {
+		return fmt.Errorf("syncing spool segment: %w", err)
+	}
+	s.synced = time.Now()
+	s.unsynced = false
+
+	return nil
+}
+
+// syncLater syncs the events that were written since the last sync.
+func (s *spool) syncLater() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.syncTimer = nil
+	if s.err == nil && s.unsynced {
+		s.err = s.sync()
+	}
+}
+
+// syncDir syncs the entries of a directory to disk.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("syncing spool directory: %w", err)
+	}
+	defer d.Close()
+
+	if err := d.Sync(); err != nil {
+		return fmt.Errorf("syncing spool directory: %w", err)
+	}
+
+	return nil
+}
+
+// dropOldest drops the oldest segment, even if it's being written to.
+// s.mu must be held.
+func (s *spool) dropOldest() error {
+	if len(s.segments) == 1 {
+		if err := s.rotate(); err != nil {
+			return err
+		}
+	}
+
+	fmt.Fprintf(s.log, "audittail: spool is full, dropping %d bytes of the oldest events\n", s.segments[0].size)
+	s.cfg.metrics.spoolDropped(dropReasonFull, s.segments[0].size)
+	s.removeOldest()
+
+	return nil
+}
+
+// expire drops the segments whose newest event is older than the
+// maximum age. s.mu must be held.
+func (s *spool) expire() {
+	if s.cfg.maxAge == 0 {
+		return
+	}
+
+	cutoff := time.Now().Add(-s.cfg.maxAge)
+	for len(s.segments) > 1 && s.segments[0].modified.Before(cutoff) {
+		fmt.Fprintf(s.log, "audittail: dropping %d bytes of expired events from the spool\n", s.segments[0].size)
+		s.cfg.metrics.spoolDropped(dropReasonExpired, s.segments[0].size)
+		s.removeOldest()
+	}
+}
+
+// recordSize adds the change in the size of the spool to the metrics.
+// s.mu must be held.
+func (s *spool) recordSize() {
+	s.cfg.metrics.spoolChanged(s.size-s.recordedSize, len(s.segments)-s.recordedSegments)
+	s.recordedSize = s.size
+	s.recordedSegments = len(s.segments)
+}
+
+// removeOldest removes the oldest segment, which mustn't be written to.
+// s.mu must be held.
+func (s *spool) removeOldest() {
+	seg := s.segments[0]
+	s.segments = s.segments[1:]
+	s.size -= seg.size
+	s.recordSize()
+
+	//nolint:errcheck // A segment that can't be removed is only replayed
+	os.Remove(s.segmentPath(seg.seq))
+
+	select {
+	case s.freed <- struct{}{}:
+	default:
+	}
+}
+
+func (s *spool) segmentPath(seq uint64) string {
+	return filepath.Join(s.cfg.dir, fmt.Sprintf("%020d%s", seq, spoolSegmentExt))
+}
+
+// run sends the events in the spool to the sink until the spool is
+// closed, and sends the events it can right away once it is.
+func (s *spool) run() {
+	defer close(s.done)
+
+	backoff := spoolMinRetryBackoff
+	for {
+		progress, err := s.drain()
+		if err != nil {
+			s.failed(err)
+
+			select {
+			case <-time.After(backoff):
+			case <-s.stop:
+				return
+			case <-s.ctx.Done():
+				s.stopped()
+				return
+			}
+
+			s.cfg.metrics.sinkRetried()
+			backoff = min(2*backoff, spoolMaxRetryBackoff)
+			continue
+		}
+
+		if s.retrying {
+			s.recovered()
+			backoff = spoolMinRetryBackoff
+		}
+
+		if progress {
+			continue
+		}
+
+		select {
+		case <-s.written:
+		case <-s.checkpointDue():
+		case <-s.stop:
+			return
+		case <-s.ctx.Done():
+			s.stopped()
+			return
+		}
+	}
+}
+
+// failed records that the drainer failed to send events, which makes
+// audittail not ready until it succeeds again.
+func (s *spool) failed(err error) {
+	if s.retrying {
+		return
+	}
+
+	fmt.Fprintf(s.log, "audittail: failed to send spooled events, retrying: %v\n", err)
+	s.cfg.health.sinkFailed()
+	s.retrying = true
+}
+
+// recovered records that the drainer sends events again.
+func (s *spool) recovered() {
+	fmt.Fprintf(s.log, "audittail: sending spooled events again\n")
+	s.cfg.health.sinkRecovered()
+	s.retrying = false
+}
+
+// stopped records that the drainer stopped because the context is done.
+func (s *spool) stopped() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = fmt.Errorf("sending spooled events: %w", s.ctx.Err())
+}
+
+// drain sends the events that were written to the oldest segment,
+// removing the segment if it's done with it. It returns whether it
+// made progress.
+func (s *spool) drain() (bool, error) {
+	// The sink may still hold the events of the attempt that failed,
+	// and only takes more once they're sent
+	if s.retrying {
+		if f, ok := s.sink.(flusher); ok {
+			if err := f.Flush(); err != nil {
+				return false, err
+			}
+		}
+	}
+
+	s.mu.Lock()
+	s.expire()
+	seg := s.segments[0]
+	size := seg.size
+	writing := len(s.segments) == 1
+	s.mu.Unlock()
+
+	if seg.seq != s.readSeq {
+		// The previous segment was done with or dropped
+		s.closeReadFile()
+		s.readSeq, s.readOffset = seg.seq, 0
+	}
+
+	if s.readOffset < size {
+		n, err := s.send(size)
+		if err != nil || n > 0 {
+			return true, err
+		}
+
+		// Only an interrupted write leaves an unfinished event behind,
+		// and the segment isn't written to after that
+		if !writing {
+			fmt.Fprintf(s.log, "audittail: dropping %d bytes of an unfinished event from the spool\n", size-s.readOffset)
+			s.cfg.metrics.spoolDropped(dropReasonUnfinished, size-s.readOffset)
+			s.readOffset = size
+		}
+	}
+
+	// The events are only forgotten once the sink flushes them, which
+	// has to be done before the segment is removed
+	if err := s.checkpoint(!writing); err != nil {
+		return false, err
+	}
+
+	if writing {
+		return false, nil
+	}
+
+	s.closeReadFile()
+
+	s.mu.Lock()
+	if len(s.segments) > 1 && s.segments[0] == seg {
+		s.removeOldest()
+	}
+	s.mu.Unlock()
+
+	return true, nil
+}
+
+// send sends the whole events between the read offset and end to the sink,
+// and returns how many bytes it sent.
+func (s *spool) send(end int64) (int64, error) {
+	if s.readFile == nil {
+		f, err := os.Open(s.segmentPath(s.readSeq))
+		if err != nil {
+			return 0, fmt.Errorf("opening spool segment: %w", err)
+		}
+		s.readFile = f
+	}
+
+	var sent int64
+	br := bufio.NewReader(io.NewSectionReader(s.readFile, s.readOffset, end-s.readOffset))
+	for {
+		line, err := br.ReadBytes('\n')
+		if errors.Is(err, io.EOF) {
+			return sent, nil
+		}
+		if err != nil {
+			return sent, fmt.Errorf("reading spool segment: %w", err)
+		}
+
+		if err := writeLine(s.sink, bytes.Clone(line)); err != nil {
+			return sent, err
+		}
+
+		sent += int64(len(line))
+		s.readOffset += int64(len(line))
+	}
+}
+
+// checkpoint flushes the sink and saves the position of the drainer.
+// Unless it's forced, it's only done once per checkpoint interval, so
+// sinks that batch events aren't flushed on every send.
+func (s *spool) checkpoint(force bool) error {
+	if !s.uncheckpointed() {
+		return nil
+	}
+
+	if !force && time.Since(s.checkpointed) < s.cfg.checkpointInterval {
+		return nil
+	}
+
+	if f, ok := s.sink.(flusher); ok {
+		if err := f.Flush(); err != nil {
+			return err
+		}
+	}
+
+	return s.saveCursor()
+}
+
+func (s *spool) saveCursor() error {
+	if _, err := s.cursor.WriteAt([]byte(fmt.Sprintf(spoolCursorFormat, s.readSeq, s.readOffset)), 0); err != nil {
+		return fmt.Errorf("saving spool cursor: %w", err)
+	}
+
+	if err := s.cursor.Sync(); err != nil {
+		return fmt.Errorf("saving spool cursor: %w", err)
+	}
+
+	s.checkpointSeq, s.checkpointOffset = s.readSeq, s.readOffset
+	s.checkpointed = time.Now()
+
+	return nil
+}
+
+// uncheckpointed tells whether the drainer moved since the last checkpoint.
+func (s *spool) uncheckpointed() bool {
+	return s.readSeq != s.checkpointSeq || s.readOffset != s.checkpointOffset
+}
+
+// checkpointDue returns a channel that's sent to once the next checkpoint
+// is due, or nil if there's nothing to checkpoint.
+func (s *spool) checkpointDue() <-chan time.Time {
+	if !s.uncheckpointed() {
+		return nil
+	}
+
+	return time.After(time.Until(s.checkpointed.Add(s.cfg.checkpointInterval)))
+}
+
+func (s *spool) closeReadFile() {
+	if s.readFile != nil {
+		s.readFile.Close()
+		s.readFile = nil
+	}
+}
@@ -0,0 +1,488 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// spoolTestSink records the events it's sent. Sends block while
+// it's held, and fail once it's broken.
+type spoolTestSink struct {
+	mu     sync.Mutex
+	events []string
+	held   chan struct{}
+	broken bool
+	closed bool
+	// sending is the number of sends in flight
+	sending int
+}
+
+func newSpoolTestSink() *spoolTestSink {
+	s := &spoolTestSink{held: make(chan struct{})}
+	close(s.held)
+	return s
+}
+
+func (s *spoolTestSink) hold() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.held = make(chan struct{})
+}
+
+func (s *spoolTestSink) release() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	select {
+	case <-s.held:
+	default:
+		close(s.held)
+	}
+}
+
+func (s *spoolTestSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	held := s.held
+	s.sending++
+	s.mu.Unlock()
+	<-held
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sending--
+
+	if s.broken {
+		return 0, errSpoolTestSinkBroken
+	}
+
+	s.events = append(s.events, strings.TrimSpace(string(p)))
+	return len(p), nil
+}
+
+func (s *spoolTestSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	return nil
+}
+
+func (s *spoolTestSink) breakDown() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.broken = true
+}
+
+func (s *spoolTestSink) repair() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.broken = false
+}
+
+// flushingTestSink is a spoolTestSink that counts how often it's flushed.
+type flushingTestSink struct {
+	*spoolTestSink
+	flushes atomic.Int64
+}
+
+func (s *flushingTestSink) Flush() error {
+	s.flushes.Add(1)
+	return nil
+}
+
+// waitForSend waits until an event is being sent.
+func (s *spoolTestSink) waitForSend(t *testing.T) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return s.sending > 0
+	}, time.Second, 5*time.Millisecond)
+}
+
+func (s *spoolTestSink) received() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]string{}, s.events...)
+}
+
+var errSpoolTestSinkBroken = errors.New("broken")
+
+func spoolTestEvent(i int) string {
+	return fmt.Sprintf(`{"metadata":{"auditId":"%03d"},"type":"foo","loggedAt":"2026-01-01T00:00:00Z","outcome":"succeeded"}`, i)
+}
+
+func spoolTestEvents(from, to int) []string {
+	events := []string{}
+	for i := from; i < to; i++ {
+		events = append(events, spoolTestEvent(i))
+	}
+	return events
+}
+
+func newTestSpool(t *testing.T, cfg spoolConfig, sink io.WriteCloser) (*spool, *bytes.Buffer) {
+	t.Helper()
+
+	if cfg.dir == "" {
+		cfg.dir = t.TempDir()
+	}
+	if cfg.maxSize == 0 {
+		cfg.maxSize = 1 << 20
+	}
+	if cfg.segmentSize == 0 {
+		cfg.segmentSize = 1 << 10
+	}
+	if cfg.fullPolicy == "" {
+		cfg.fullPolicy = spoolFullBlock
+	}
+
+	var log bytes.Buffer
+	s, err := newSpool(t.Context(), cfg, sink, &log)
+	require.NoError(t, err, "unexpected error creating spool")
+	t.Cleanup(func() {
+		// A held sink would never let the spool close
+		if ts, ok := sink.(*spoolTestSink); ok {
+			ts.release()
+		}
+		s.Close()
+	})
+
+	return s, &log
+}
+
+func writeSpoolEvents(t *testing.T, s *spool, from, to int) {
+	t.Helper()
+
+	for _, e := range spoolTestEvents(from, to) {
+		n, err := s.Write([]byte(e + "\n"))
+		require.NoError(t, err)
+		require.Equal(t, len(e)+1, n, "the whole event should be written")
+	}
+}
+
+func requireReceived(t *testing.T, sink *spoolTestSink, want []string) {
+	t.Helper()
+
+	require.EventuallyWithT(t, func(c *assert.CollectT) {
+		assert.Equal(c, want, sink.received())
+	}, time.Second, 5*time.Millisecond)
+}
+
+func segmentFiles(t *testing.T, dir string) []string {
+	t.Helper()
+
+	files, err := filepath.Glob(filepath.Join(dir, "*"+spoolSegmentExt))
+	require.NoError(t, err)
+	return files
+}
+
+func TestSpoolForwardsEvents(t *testing.T) {
+	t.Parallel()
+
+	sink := newSpoolTestSink()
+	// Each segment holds a couple of events
+	s, _ := newTestSpool(t, spoolConfig{segmentSize: 100}, sink)
+
+	writeSpoolEvents(t, s, 0, 10)
+	requireReceived(t, sink, spoolTestEvents(0, 10))
+
+	require.NoError(t, s.Close())
+	require.True(t, sink.closed, "the sink should be closed")
+	require.Len(t, segmentFiles(t, s.cfg.dir), 1, "the segments that were sent should be removed")
+}
+
+func TestSpoolKeepsReadingWhileSinkBlocks(t *testing.T) {
+	t.Parallel()
+
+	sink := newSpoolTestSink()
+	sink.hold()
+	s, _ := newTestSpool(t, spoolConfig{}, sink)
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		writeSpoolEvents(t, s, 0, 100)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		require.Fail(t, "writes shouldn't block while there's room in the spool")
+	}
+
+	sink.release()
+	requireReceived(t, sink, spoolTestEvents(0, 100))
+}
+
+func TestSpoolReplaysAfterRestart(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	sink := newSpoolTestSink()
+	s, _ := newTestSpool(t, spoolConfig{dir: dir, segmentSize: 100}, sink)
+	writeSpoolEvents(t, s, 0, 3)
+	requireReceived(t, sink, spoolTestEvents(0, 3))
+
+	// The sink breaks, so the rest of the events stay in the spool
+	sink.hold()
+	writeSpoolEvents(t, s, 3, 6)
+	sink.waitForSend(t)
+	sink.breakDown()
+	sink.release()
+
+	writeSpoolEvents(t, s, 6, 7)
+	require.NoError(t, s.Close())
+	require.Equal(t, int64(4*(len(spoolTestEvent(0))+1)), s.unsent())
+
+	sink = newSpoolTestSink()
+	s, _ = newTestSpool(t, spoolConfig{dir: dir, segmentSize: 100}, sink)
+	requireReceived(t, sink, spoolTestEvents(3, 7))
+
+	writeSpoolEvents(t, s, 7, 8)
+	requireReceived(t, sink, spoolTestEvents(3, 8))
+}
+
+func TestSpoolRetriesFailingSink(t *testing.T) {
+	t.Parallel()
+
+	health := &tailHealth{}
+	health.read()
+
+	sink := newSpoolTestSink()
+	sink.breakDown()
+	s, log := newTestSpool(t, spoolConfig{health: health}, sink)
+
+	writeSpoolEvents(t, s, 0, 3)
+	require.Eventually(t, func() bool {
+		return !health.ready()
+	}, time.Second, 5*time.Millisecond, "audittail shouldn't be ready while the sink fails")
+	require.Contains(t, log.String(), "failed to send spooled events, retrying")
+
+	// Events are still spooled while the sink fails
+	writeSpoolEvents(t, s, 3, 5)
+
+	sink.repair()
+	requireReceived(t, sink, spoolTestEvents(0, 5))
+	require.Eventually(t, health.ready, time.Second, 5*time.Millisecond,
+		"audittail should be ready again once the sink recovers")
+	require.Contains(t, log.String(), "sending spooled events again")
+}
+
+func TestSpoolSkipsRejectedBatches(t *testing.T) {
+	t.Parallel()
+
+	health := &tailHealth{}
+	health.read()
+
+	c := &webhookCollector{reject: spoolTestEvent(1)}
+	srv := httptest.NewServer(c)
+	t.Cleanup(srv.Close)
+
+	var quarantine syncBuffer
+	sink := newTestWebhookSink(t, webhookConfig{url: srv.URL, batchSize: 1, quarantine: &quarantine})
+	s, log := newTestSpool(t, spoolConfig{health: health}, sink)
+
+	writeSpoolEvents(t, s, 0, 4)
+	require.Eventually(t, func() bool {
+		batches, _ := c.received()
+		return len(batches) == 3
+	}, time.Second, 5*time.Millisecond, "the events after a rejected batch should be sent")
+
+	batches, _ := c.received()
+	require.Equal(t, []string{spoolTestEvent(0) + "\n", spoolTestEvent(2) + "\n", spoolTestEvent(3) + "\n"}, batches)
+	require.Equal(t, spoolTestEvent(1)+"\n", quarantine.String(), "the rejected batch should be quarantined")
+	require.True(t, health.ready(), "a rejected batch shouldn't make audittail unready")
+	require.NotContains(t, log.String(), "retrying")
+
+	require.NoError(t, s.Close())
+	require.Zero(t, s.unsent(), "the rejected batch shouldn't be sent again")
+}
+
+func TestSpoolCheckpointInterval(t *testing.T) {
+	t.Parallel()
+
+	sink := &flushingTestSink{spoolTestSink: newSpoolTestSink()}
+	s, _ := newTestSpool(t, spoolConfig{checkpointInterval: time.Hour}, sink)
+
+	// Every event is sent on its own, but the sink is only flushed once
+	// per checkpoint interval
+	for i := range 5 {
+		writeSpoolEvents(t, s, i, i+1)
+		requireReceived(t, sink.spoolTestSink, spoolTestEvents(0, i+1))
+	}
+	require.Equal(t, int64(1), sink.flushes.Load(), "the sink should be flushed once per interval")
+
+	require.NoError(t, s.Close())
+	require.Zero(t, s.unsent(), "closing should checkpoint the events that were sent")
+}
+
+func TestSpoolSyncsWrittenEvents(t *testing.T) {
+	t.Parallel()
+
+	sink := newSpoolTestSink()
+	sink.hold()
+	s, _ := newTestSpool(t, spoolConfig{}, sink)
+
+	synced := func() bool {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		return !s.unsynced
+	}
+
+	// The first event is synced right away, and the next ones once the
+	// sync interval has passed, even if no more events are written
+	writeSpoolEvents(t, s, 0, 3)
+	require.False(t, synced())
+	require.Eventually(t, synced, 2*spoolSyncInterval, 10*time.Millisecond)
+}
+
+func TestSpoolFullPolicies(t *testing.T) {
+	t.Parallel()
+
+	eventSize := int64(len(spoolTestEvent(0)) + 1)
+
+	tests := []struct {
+		policy string
+		want   []string
+		log    string
+	}{
+		{
+			policy: spoolFullDropNewest,
+			want:   spoolTestEvents(0, 4),
+			log:    "spool has room again, 6 events were dropped",
+		},
+		{
+			// The first event was being sent already
+			policy: spoolFullDropOldest,
+			want:   append(spoolTestEvents(0, 1), spoolTestEvents(6, 10)...),
+			log:    fmt.Sprintf("dropping %d bytes of the oldest events", eventSize),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.policy, func(t *testing.T) {
+			t.Parallel()
+
+			sink := newSpoolTestSink()
+			sink.hold()
+			// Each segment holds an event, and the spool holds 4 of them
+			s, log := newTestSpool(t, spoolConfig{
+				maxSize:     4 * eventSize,
+				segmentSize: 1,
+				fullPolicy:  tt.policy,
+			}, sink)
+
+			writeSpoolEvents(t, s, 0, 1)
+			sink.waitForSend(t)
+			writeSpoolEvents(t, s, 1, 10)
+
+			sink.release()
+			requireReceived(t, sink, tt.want)
+
+			// Once there's room again, events are written
+			writeSpoolEvents(t, s, 10, 11)
+			requireReceived(t, sink, append(tt.want, spoolTestEvent(10)))
+			require.Contains(t, log.String(), tt.log)
+		})
+	}
+}
+
+func TestSpoolBlocksWhenFull(t *testing.T) {
+	t.Parallel()
+
+	eventSize := int64(len(spoolTestEvent(0)) + 1)
+
+	sink := newSpoolTestSink()
+	sink.hold()
+	s, _ := newTestSpool(t, spoolConfig{maxSize: 2 * eventSize, segmentSize: 1, fullPolicy: spoolFullBlock}, sink)
+
+	writeSpoolEvents(t, s, 0, 2)
+
+	written := make(chan struct{})
+	go func() {
+		defer close(written)
+		writeSpoolEvents(t, s, 2, 3)
+	}()
+
+	select {
+	case <-written:
+		require.Fail(t, "writes should block while the spool is full")
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	sink.release()
+	<-written
+	requireReceived(t, sink, spoolTestEvents(0, 3))
+}
+
+func TestSpoolExpiresEvents(t *testing.T) {
+	t.Parallel()
+
+	sink := newSpoolTestSink()
+	sink.hold()
+	s, log := newTestSpool(t, spoolConfig{segmentSize: 1, maxAge: 50 * time.Millisecond}, sink)
+
+	writeSpoolEvents(t, s, 0, 1)
+	sink.waitForSend(t)
+	writeSpoolEvents(t, s, 1, 3)
+	time.Sleep(100 * time.Millisecond)
+	writeSpoolEvents(t, s, 3, 4)
+
+	sink.release()
+	// The first event was being sent already
+	requireReceived(t, sink, []string{spoolTestEvent(0), spoolTestEvent(3)})
+	require.Contains(t, log.String(), "expired events")
+}
+
+func TestSpoolInvalidConfig(t *testing.T) {
+	t.Parallel()
+
+	_, err := newSpool(t.Context(), spoolConfig{dir: t.TempDir(), maxSize: 1, fullPolicy: "foo"}, nopCloser{io.Discard}, io.Discard)
+	require.ErrorIs(t, err, ErrInvalidSpoolFullPolicy)
+
+	_, err = newSpool(t.Context(), spoolConfig{dir: t.TempDir(), fullPolicy: spoolFullBlock}, nopCloser{io.Discard}, io.Discard)
+	require.ErrorIs(t, err, ErrInvalidSpoolMaxSize)
+
+	_, err = newSpool(t.Context(), spoolConfig{
+		dir:        t.TempDir(),
+		maxSize:    1,
+		maxAge:     -time.Second,
+		fullPolicy: spoolFullBlock,
+	}, nopCloser{io.Discard}, io.Discard)
+	require.ErrorIs(t, err, ErrInvalidSpoolMaxAge)
+
+	dir := filepath.Join(t.TempDir(), "file")
+	require.NoError(t, os.WriteFile(dir, nil, 0o600))
+	_, err = newSpool(t.Context(), spoolConfig{dir: dir, maxSize: 1, fullPolicy: spoolFullBlock}, nopCloser{io.Discard}, io.Discard)
+	require.ErrorContains(t, err, "creating spool directory")
+}
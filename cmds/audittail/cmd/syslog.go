@@ -0,0 +1,263 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"strconv"
+	"syscall"
+	"time"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+// These are the supported syslog URL schemes.
+const (
+	syslogSchemeTCP = "tcp"
+	syslogSchemeTLS = "tls"
+	syslogSchemeUDP = "udp"
+)
+
+const (
+	// syslogFacilityAudit is the "log audit" facility.
+	syslogFacilityAudit = 13
+	// syslogSeverityInfo is the "informational" severity.
+	syslogSeverityInfo = 6
+	// syslogFacilityShift is how far the facility is shifted in the priority.
+	syslogFacilityShift = 3
+	// defaultSyslogSDID identifies the structured data element of the events.
+	// 32473 is the private enterprise number reserved for documentation.
+	defaultSyslogSDID = "audit@32473"
+
+	// These are the maximum lengths of the header fields.
+	syslogMaxHostname = 255
+	syslogMaxAppName  = 48
+	syslogMaxMsgID    = 32
+
+	syslogTimestampFormat = "2006-01-02T15:04:05.000000Z07:00"
+	syslogNilValue        = "-"
+
+	syslogDialTimeout  = 10 * time.Second
+	syslogWriteTimeout = 30 * time.Second
+	syslogMinBackoff   = 100 * time.Millisecond
+	syslogMaxBackoff   = 30 * time.Second
+)
+
+// syslogSink forwards audit events as RFC 5424 syslog messages. Over TCP
+// and TLS, messages are framed with RFC 6587 octet counting. Over UDP,
+// each message is sent in its own datagram.
+// If sending fails, it reconnects with exponential backoff until the
+// message is sent or its context is done.
+type syslogSink struct {
+	//nolint:containedctx // Write has no context of its own to stop retrying
+	ctx       context.Context
+	scheme    string
+	addr      string
+	tlsConfig *tls.Config
+	hostname  string
+	sdID      string
+	conn      net.Conn
+	metrics   *tailMetrics
+}
+
+// newSyslogSink returns a sink for the given syslog URL. e.g.
+// tls://siem.example.com:6514. It connects lazily, on the first event.
+func newSyslogSink(ctx context.Context, rawURL, sdID string, tlsConfig *tls.Config) (*syslogSink, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidSyslogURL, err)
+	}
+
+	switch u.Scheme {
+	case syslogSchemeTCP, syslogSchemeTLS, syslogSchemeUDP:
+	default:
+		return nil, fmt.Errorf("%w: unknown scheme %q", ErrInvalidSyslogURL, u.Scheme)
+	}
+
+	if u.Host == "" {
+		return nil, fmt.Errorf("%w: missing host", ErrInvalidSyslogURL)
+	}
+
+	//nolint:errcheck // The nil value is used if the hostname is unknown
+	hostname, _ := os.Hostname()
+
+	return &syslogSink{
+		ctx:       ctx,
+		scheme:    u.Scheme,
+		addr:      u.Host,
+		tlsConfig: tlsConfig,
+		hostname:  headerField(hostname, syslogMaxHostname),
+		sdID:      sdID,
+	}, nil
+}
+
+// Write sends the audit event in p as a syslog message.
+// p is expected to hold a single, whole event.
+func (s *syslogSink) Write(p []byte) (int, error) {
+	event := &auditevent.AuditEvent{}
+	if err := json.Unmarshal(p, event); err != nil {
+		return 0, fmt.Errorf("decoding audit event: %w", err)
+	}
+
+	if err := s.send(s.format(event, bytes.TrimSpace(p))); err != nil {
+		return 0, err
+	}
+
+	return len(p), nil
+}
+
+// Close closes the connection to the syslog server, if any.
+func (s *syslogSink) Close() error {
+	if s.conn == nil {
+		return nil
+	}
+
+	err := s.conn.Close()
+	s.conn = nil
+	return err
+}
+
+func (s *syslogSink) send(msg []byte) error {
+	backoff := syslogMinBackoff
+	for {
+		err := s.trySend(msg)
+		if err == nil {
+			return nil
+		}
+
+		// The message won't fit in a datagram, no matter how many times it's sent
+		if errors.Is(err, syscall.EMSGSIZE) {
+			return fmt.Errorf("sending syslog message: %w", err)
+		}
+
+		//nolint:errcheck // The connection is broken already
+		s.Close()
+
+		select {
+		case <-s.ctx.Done():
+			return fmt.Errorf("sending syslog message: %w", errors.Join(s.ctx.Err(), err))
+		case <-time.After(backoff):
+		}
+
+		s.metrics.sinkRetried()
+		backoff = min(2*backoff, syslogMaxBackoff)
+	}
+}
+
+func (s *syslogSink) trySend(msg []byte) error {
+	if s.conn == nil {
+		conn, err := s.dial()
+		if err != nil {
+			return err
+		}
+		s.conn = conn
+	}
+
+	frame := msg
+	if s.scheme != syslogSchemeUDP {
+		frame = strconv.AppendInt(nil, int64(len(msg)), 10)
+		frame = append(frame, ' ')
+		frame = append(frame, msg...)
+	}
+
+	if err := s.conn.SetWriteDeadline(time.Now().Add(syslogWriteTimeout)); err != nil {
+		return err
+	}
+
+	_, err := s.conn.Write(frame)
+	return err
+}
+
+func (s *syslogSink) dial() (net.Conn, error) {
+	ctx, cancel := context.WithTimeout(s.ctx, syslogDialTimeout)
+	defer cancel()
+
+	d := &net.Dialer{}
+	if s.scheme == syslogSchemeTLS {
+		td := &tls.Dialer{NetDialer: d, Config: s.tlsConfig}
+		return td.DialContext(ctx, "tcp", s.addr)
+	}
+
+	return d.DialContext(ctx, s.scheme, s.addr)
+}
+
+// format returns the RFC 5424 message for the event, whose JSON
+// encoding is the message's content.
+func (s *syslogSink) format(e *auditevent.AuditEvent, line []byte) []byte {
+	timestamp := syslogNilValue
+	if !e.LoggedAt.IsZero() {
+		timestamp = e.LoggedAt.Format(syslogTimestampFormat)
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "<%d>1 %s %s %s %s %s [%s",
+		syslogFacilityAudit<<syslogFacilityShift|syslogSeverityInfo,
+		timestamp,
+		s.hostname,
+		headerField(e.Component, syslogMaxAppName),
+		syslogNilValue,
+		headerField(e.Type, syslogMaxMsgID),
+		s.sdID,
+	)
+	writeSDParam(&b, "auditId", e.Metadata.AuditID)
+	writeSDParam(&b, "type", e.Type)
+	writeSDParam(&b, "outcome", e.Outcome)
+	b.WriteString("] ")
+	b.Write(line)
+
+	return b.Bytes()
+}
+
+// headerField returns v as a syslog header field: printable US-ASCII
+// only, up to maxLen characters, or the nil value if it's empty.
+func headerField(v string, maxLen int) string {
+	if v == "" {
+		return syslogNilValue
+	}
+
+	b := []byte(v)
+	if len(b) > maxLen {
+		b = b[:maxLen]
+	}
+
+	for i, c := range b {
+		if c < '!' || c > '~' {
+			b[i] = '_'
+		}
+	}
+
+	return string(b)
+}
+
+// writeSDParam writes a structured data parameter, escaping its value.
+func writeSDParam(b *bytes.Buffer, name, value string) {
+	b.WriteString(" " + name + `="`)
+	for _, c := range value {
+		if c == '"' || c == '\\' || c == ']' {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	b.WriteByte('"')
+}
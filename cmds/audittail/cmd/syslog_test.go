@@ -0,0 +1,246 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"io"
+	"net"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+const (
+	syslogTestEvent = `{"metadata":{"auditId":"1"},"type":"GetFoo","loggedAt":"2022-01-02T03:04:05.123456Z",` +
+		`"component":"my component","outcome":"succeeded"}`
+	syslogTestMessage = `<110>1 2022-01-02T03:04:05.123456Z host my_component - GetFoo ` +
+		`[audit@32473 auditId="1" type="GetFoo" outcome="succeeded"] ` + syslogTestEvent
+)
+
+// readOctetCounted reads an RFC 6587 octet counted frame.
+func readOctetCounted(r *bufio.Reader) (string, error) {
+	l, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+
+	n, err := strconv.Atoi(l[:len(l)-1])
+	if err != nil {
+		return "", err
+	}
+
+	msg := make([]byte, n)
+	if _, err := io.ReadFull(r, msg); err != nil {
+		return "", err
+	}
+
+	return string(msg), nil
+}
+
+// acceptOne returns the messages sent on the first connection to l.
+func acceptOne(t *testing.T, l net.Listener) <-chan string {
+	t.Helper()
+
+	msgs := make(chan string)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			return
+		}
+		defer conn.Close()
+
+		r := bufio.NewReader(conn)
+		for {
+			msg, err := readOctetCounted(r)
+			if err != nil {
+				return
+			}
+			msgs <- msg
+		}
+	}()
+
+	return msgs
+}
+
+func newTestSyslogSink(t *testing.T, ctx context.Context, rawURL string, tlsConfig *tls.Config) *syslogSink {
+	t.Helper()
+
+	s, err := newSyslogSink(ctx, rawURL, defaultSyslogSDID, tlsConfig)
+	require.NoError(t, err, "unexpected error creating syslog sink")
+	t.Cleanup(func() {
+		s.Close()
+	})
+
+	s.hostname = "host"
+	return s
+}
+
+func TestSyslogFormat(t *testing.T) {
+	t.Parallel()
+
+	s := &syslogSink{hostname: "host", sdID: defaultSyslogSDID}
+	require.Equal(t, syslogTestMessage, string(s.format(mustParseEvent(t, syslogTestEvent), []byte(syslogTestEvent))))
+
+	// Header fields are sanitized, and structured data values escaped
+	event := `{"metadata":{"auditId":"a\"b\\c]d"},"type":"Foo Bar","outcome":"failed"}`
+	require.Equal(t,
+		`<110>1 - host - - Foo_Bar [audit@32473 auditId="a\"b\\c\]d" type="Foo Bar" outcome="failed"] `+event,
+		string(s.format(mustParseEvent(t, event), []byte(event))))
+}
+
+func TestSyslogDropsMalformedEvents(t *testing.T) {
+	t.Parallel()
+
+	s := newTestSyslogSink(t, t.Context(), "udp://127.0.0.1:514", nil)
+
+	n, err := s.Write([]byte("not an event\n"))
+	require.ErrorContains(t, err, "decoding audit event")
+	require.Zero(t, n)
+}
+
+func mustParseEvent(t *testing.T, event string) *auditevent.AuditEvent {
+	t.Helper()
+
+	e := &auditevent.AuditEvent{}
+	require.NoError(t, json.Unmarshal([]byte(event), e))
+	return e
+}
+
+func TestSyslogTCP(t *testing.T) {
+	t.Parallel()
+
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	msgs := acceptOne(t, l)
+	s := newTestSyslogSink(t, t.Context(), "tcp://"+l.Addr().String(), nil)
+
+	for range 2 {
+		n, err := s.Write([]byte(syslogTestEvent + "\n"))
+		require.NoError(t, err)
+		require.Equal(t, len(syslogTestEvent)+1, n, "the whole event should be written")
+		require.Equal(t, syslogTestMessage, <-msgs)
+	}
+}
+
+func TestSyslogTLS(t *testing.T) {
+	t.Parallel()
+
+	cert, caFile, _ := newTestCertificate(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	tlsConfig, err := newClientTLSConfig(caFile, "", "")
+	require.NoError(t, err)
+
+	msgs := acceptOne(t, l)
+	s := newTestSyslogSink(t, t.Context(), "tls://"+l.Addr().String(), tlsConfig)
+
+	_, err = s.Write([]byte(syslogTestEvent))
+	require.NoError(t, err)
+	require.Equal(t, syslogTestMessage, <-msgs)
+}
+
+func TestSyslogTLSUnknownAuthority(t *testing.T) {
+	t.Parallel()
+
+	cert, _, _ := newTestCertificate(t)
+	l, err := tls.Listen("tcp", "127.0.0.1:0", &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		MinVersion:   tls.VersionTLS12,
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	acceptOne(t, l)
+
+	ctx, cancel := context.WithTimeout(t.Context(), 500*time.Millisecond)
+	defer cancel()
+
+	s := newTestSyslogSink(t, ctx, "tls://"+l.Addr().String(), &tls.Config{MinVersion: tls.VersionTLS12})
+
+	_, err = s.Write([]byte(syslogTestEvent))
+	require.ErrorIs(t, err, context.DeadlineExceeded, "it should retry until the context is done")
+}
+
+func TestSyslogUDP(t *testing.T) {
+	t.Parallel()
+
+	pc, err := net.ListenPacket("udp", "127.0.0.1:0")
+	require.NoError(t, err)
+	t.Cleanup(func() { pc.Close() })
+
+	s := newTestSyslogSink(t, t.Context(), "udp://"+pc.LocalAddr().String(), nil)
+
+	_, err = s.Write([]byte(syslogTestEvent + "\n"))
+	require.NoError(t, err)
+
+	buf := make([]byte, 4096)
+	n, _, err := pc.ReadFrom(buf)
+	require.NoError(t, err)
+	require.Equal(t, syslogTestMessage, string(buf[:n]), "datagrams shouldn't be framed")
+}
+
+func TestSyslogReconnects(t *testing.T) {
+	t.Parallel()
+
+	// Reserve an address, with nothing listening on it yet
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := l.Addr().String()
+	require.NoError(t, l.Close())
+
+	s := newTestSyslogSink(t, t.Context(), "tcp://"+addr, nil)
+
+	errs := make(chan error)
+	go func() {
+		_, err := s.Write([]byte(syslogTestEvent))
+		errs <- err
+	}()
+
+	// Give the sink time to fail connecting
+	time.Sleep(2 * syslogMinBackoff)
+
+	l, err = net.Listen("tcp", addr)
+	require.NoError(t, err)
+	t.Cleanup(func() { l.Close() })
+
+	msgs := acceptOne(t, l)
+	require.Equal(t, syslogTestMessage, <-msgs)
+	require.NoError(t, <-errs)
+}
+
+func TestSyslogInvalidURL(t *testing.T) {
+	t.Parallel()
+
+	for _, u := range []string{"http://localhost:514", "tcp://", "tcp://%zz"} {
+		_, err := newSyslogSink(t.Context(), u, defaultSyslogSDID, nil)
+		require.ErrorIs(t, err, ErrInvalidSyslogURL, u)
+	}
+}
@@ -0,0 +1,424 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+// These are the exit statuses of the verify command. Any other error
+// exits with verifyExitError as well.
+const (
+	// verifyExitProblems is the exit status when problems were found.
+	verifyExitProblems = 1
+	// verifyExitError is the exit status when the audit logs couldn't be verified.
+	verifyExitError = 2
+)
+
+// These are the checks that report problems.
+const (
+	checkMalformedJSON    = "malformed-json"
+	checkInvalidField     = "invalid-field"
+	checkDuplicateAuditID = "duplicate-audit-id"
+	checkLoggedAtOrder    = "non-monotonic-logged-at"
+	checkHashChain        = "broken-hash-chain"
+	checkSignature        = "bad-signature"
+)
+
+// These are the formats of the verification report.
+const (
+	outputText = "text"
+	outputJSON = "json"
+)
+
+// verifyCmd represents the verify command.
+var verifyCmd = NewVerifyCommand()
+
+func NewVerifyCommand() *cobra.Command {
+	c := &cobra.Command{
+		Use:   "verify [file...]",
+		Short: "Check the integrity of audit logs",
+		Long: `Check the integrity of audit logs.
+
+This reads JSON-lines audit logs, from the given files or stdin, and reports
+malformed JSON, events missing required fields, duplicate audit IDs, events
+logged before the ones preceding them, and broken hash chains. If keys are
+given, signatures are verified too. Logs compressed with gzip are read as is.
+The files are checked as a single log, in the given order, so rotated logs
+should be given from oldest to newest.
+
+The exit status is 0 if no problem was found, 1 if problems were found, and
+2 if the audit logs couldn't be verified.`,
+		Args: cobra.ArbitraryArgs,
+		RunE: verifyMain,
+	}
+
+	c.Flags().StringP("output", "o", outputText, "format of the report: 'text' or 'json'")
+	c.Flags().StringArray("key", nil,
+		"public key to verify signatures with, as KEY_ID=PATH to a PEM public key or certificate")
+	c.Flags().StringArray("hmac-key", nil, "shared secret to verify HMAC signatures with, as KEY_ID=PATH")
+	c.Flags().Bool("require-signatures", false, "report events that aren't signed")
+	c.Flags().Duration("max-clock-skew", 0, "how far back loggedAt may go from one event to the next")
+	c.SetFlagErrorFunc(func(_ *cobra.Command, err error) error {
+		return &ExitError{Code: verifyExitError, Err: err}
+	})
+
+	return c
+}
+
+//nolint:gochecknoinits // this is a practice recommended by cobra
+func init() {
+	rootCmd.AddCommand(verifyCmd)
+}
+
+// verifyReport is the machine-readable report of the verify command.
+type verifyReport struct {
+	Logs   []string `json:"logs"`
+	Events int      `json:"events"`
+	// Chained is the number of events whose hash chain verified, in
+	// Chains chains
+	Chained int `json:"chained"`
+	Chains  int `json:"chains"`
+	// Signed is the number of events with a signature. They're only
+	// verified if keys are given.
+	Signed             int             `json:"signed"`
+	SignaturesVerified bool            `json:"signaturesVerified"`
+	Problems           []verifyProblem `json:"problems"`
+}
+
+// verifyProblem is a problem found in an audit log.
+type verifyProblem struct {
+	Log     string `json:"log"`
+	Line    int    `json:"line"`
+	AuditID string `json:"auditId,omitempty"`
+	Check   string `json:"check"`
+	// Field is set for the problems of a single field
+	Field   string `json:"field,omitempty"`
+	Message string `json:"message"`
+}
+
+func verifyMain(cmd *cobra.Command, args []string) error {
+	// Problems in the audit logs aren't usage errors
+	cmd.SilenceUsage = true
+
+	err := verifyLogs(cmd, args)
+
+	var exitErr *ExitError
+	if err != nil && !errors.As(err, &exitErr) {
+		return &ExitError{Code: verifyExitError, Err: err}
+	}
+
+	return err
+}
+
+func verifyLogs(cmd *cobra.Command, args []string) error {
+	//nolint:errcheck // This is already verified by cobra
+	output, _ := cmd.Flags().GetString("output")
+	if output != outputText && output != outputJSON {
+		return fmt.Errorf("%w: %q", ErrInvalidVerifyOutput, output)
+	}
+
+	keys, err := loadVerifyKeys(cmd)
+	if err != nil {
+		return err
+	}
+
+	v := newLogVerifier(keys)
+	//nolint:errcheck // This is already verified by cobra
+	v.requireSignatures, _ = cmd.Flags().GetBool("require-signatures")
+	//nolint:errcheck // This is already verified by cobra
+	v.maxClockSkew, _ = cmd.Flags().GetDuration("max-clock-skew")
+
+	for _, name := range auditLogNames(args) {
+		l, err := openAuditLog(cmd, name)
+		if err != nil {
+			return err
+		}
+
+		err = v.verify(name, l)
+		l.Close()
+		if err != nil {
+			return err
+		}
+	}
+
+	report := v.finish()
+	if output == outputJSON {
+		enc := json.NewEncoder(cmd.OutOrStdout())
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(report); err != nil {
+			return fmt.Errorf("writing report: %w", err)
+		}
+	} else if err := report.print(cmd.OutOrStdout()); err != nil {
+		return fmt.Errorf("writing report: %w", err)
+	}
+
+	if len(report.Problems) > 0 {
+		return &ExitError{
+			Code: verifyExitProblems,
+			Err:  fmt.Errorf("%w: %d problems found", ErrVerificationFailed, len(report.Problems)),
+		}
+	}
+
+	return nil
+}
+
+func (r *verifyReport) print(w io.Writer) error {
+	var b strings.Builder
+	for _, p := range r.Problems {
+		fmt.Fprintf(&b, "%s:%d: %s: %s\n", p.Log, p.Line, p.Check, p.Message)
+	}
+
+	fmt.Fprintf(&b, "%d events in %d audit logs, %d chained in %d chains, %d signed",
+		r.Events, len(r.Logs), r.Chained, r.Chains, r.Signed)
+	if r.Signed > 0 && !r.SignaturesVerified {
+		b.WriteString(" (not verified, no keys were given)")
+	}
+	fmt.Fprintf(&b, ": %d problems found\n", len(r.Problems))
+
+	_, err := io.WriteString(w, b.String())
+
+	return err //nolint:wrapcheck // It's wrapped by the caller
+}
+
+// logVerifier checks the events of audit logs, which are checked as a
+// single log.
+type logVerifier struct {
+	keys              auditevent.PublicKeySet
+	requireSignatures bool
+	maxClockSkew      time.Duration
+
+	chains *auditevent.ChainVerifier
+	// seen holds where every audit ID was first seen
+	seen map[string]string
+	// lastLoggedAt is the time the previous event was logged at, and
+	// lastEvent where it is
+	lastLoggedAt time.Time
+	lastEvent    string
+	report       verifyReport
+}
+
+func newLogVerifier(keys auditevent.PublicKeySet) *logVerifier {
+	return &logVerifier{
+		keys:   keys,
+		chains: auditevent.NewChainVerifier(),
+		seen:   map[string]string{},
+		report: verifyReport{
+			Logs:               []string{},
+			Problems:           []verifyProblem{},
+			SignaturesVerified: len(keys) > 0,
+		},
+	}
+}
+
+// verify checks the events of the audit log. Problems are added to the
+// report, and only failures to read the log are returned.
+func (v *logVerifier) verify(name string, r io.Reader) error {
+	v.report.Logs = append(v.report.Logs, name)
+
+	br := bufio.NewReader(r)
+	for line := 1; ; line++ {
+		raw, err := br.ReadBytes('\n')
+		if len(bytes.TrimSpace(raw)) > 0 {
+			v.check(name, line, raw)
+		}
+
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+
+		if err != nil {
+			return fmt.Errorf("reading audit log %s: %w", name, err)
+		}
+	}
+}
+
+func (v *logVerifier) check(name string, line int, raw []byte) {
+	v.report.Events++
+	loc := fmt.Sprintf("%s:%d", name, line)
+
+	e := &auditevent.AuditEvent{}
+	if err := json.Unmarshal(raw, e); err != nil {
+		v.add(verifyProblem{Log: name, Line: line, Check: checkMalformedJSON, Message: err.Error()})
+		return
+	}
+
+	problem := func(check, msg string) verifyProblem {
+		return verifyProblem{Log: name, Line: line, AuditID: e.Metadata.AuditID, Check: check, Message: msg}
+	}
+
+	var verr *auditevent.ValidationError
+	if err := e.Validate(); errors.As(err, &verr) {
+		for _, fe := range verr.Errors {
+			p := problem(checkInvalidField, fe.Error())
+			p.Field = fe.Field
+			v.add(p)
+		}
+	}
+
+	if id := e.Metadata.AuditID; id != "" {
+		if first, ok := v.seen[id]; ok {
+			v.add(problem(checkDuplicateAuditID, "audit ID already used at "+first))
+		} else {
+			v.seen[id] = loc
+		}
+	}
+
+	if !e.LoggedAt.IsZero() {
+		if e.LoggedAt.Before(v.lastLoggedAt.Add(-v.maxClockSkew)) {
+			v.add(problem(checkLoggedAtOrder, fmt.Sprintf("logged at %s, before %s at %s",
+				e.LoggedAt.Format(time.RFC3339Nano), v.lastLoggedAt.Format(time.RFC3339Nano), v.lastEvent)))
+		}
+
+		v.lastLoggedAt = e.LoggedAt
+		v.lastEvent = loc
+	}
+
+	if err := v.chains.Check(e); err != nil {
+		var cerr *auditevent.ChainError
+		if errors.As(err, &cerr) {
+			v.add(problem(checkHashChain, fmt.Sprintf("chain %s: %s", cerr.ChainID, cerr.Reason)))
+		} else {
+			v.add(problem(checkHashChain, err.Error()))
+		}
+	}
+
+	v.checkSignature(e, problem)
+}
+
+func (v *logVerifier) checkSignature(e *auditevent.AuditEvent, problem func(check, msg string) verifyProblem) {
+	if e.Metadata.Signature == nil {
+		if v.requireSignatures {
+			v.add(problem(checkSignature, auditevent.ErrUnsigned.Error()))
+		}
+		return
+	}
+
+	v.report.Signed++
+	if len(v.keys) == 0 {
+		return
+	}
+
+	if err := auditevent.Verify(e, v.keys); err != nil {
+		v.add(problem(checkSignature, err.Error()))
+	}
+}
+
+func (v *logVerifier) add(p verifyProblem) {
+	v.report.Problems = append(v.report.Problems, p)
+}
+
+// finish returns the report, once every audit log is checked.
+func (v *logVerifier) finish() *verifyReport {
+	v.report.Chained = v.chains.Chained
+	v.report.Chains = v.chains.Chains()
+
+	return &v.report
+}
+
+// loadVerifyKeys reads the keys of the --key and --hmac-key flags.
+func loadVerifyKeys(cmd *cobra.Command) (auditevent.PublicKeySet, error) {
+	keys := auditevent.PublicKeySet{}
+
+	//nolint:errcheck // This is already verified by cobra
+	pubKeys, _ := cmd.Flags().GetStringArray("key")
+	for _, arg := range pubKeys {
+		id, path, err := splitVerifyKey(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		keys[id], err = loadPublicKey(path)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	//nolint:errcheck // This is already verified by cobra
+	hmacKeys, _ := cmd.Flags().GetStringArray("hmac-key")
+	for _, arg := range hmacKeys {
+		id, path, err := splitVerifyKey(arg)
+		if err != nil {
+			return nil, err
+		}
+
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("reading HMAC key: %w", err)
+		}
+
+		secret := bytes.TrimSpace(raw)
+		if len(secret) == 0 {
+			return nil, fmt.Errorf("%w: empty HMAC secret in %s", auditevent.ErrUnsupportedKey, path)
+		}
+		keys[id] = secret
+	}
+
+	return keys, nil
+}
+
+func splitVerifyKey(arg string) (id, path string, err error) {
+	id, path, ok := strings.Cut(arg, "=")
+	if !ok || id == "" || path == "" {
+		return "", "", fmt.Errorf("%w: %q", ErrInvalidVerifyKey, arg)
+	}
+
+	return id, path, nil
+}
+
+// loadPublicKey reads a PEM-encoded public key, or the key of a certificate.
+func loadPublicKey(path string) (any, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading public key: %w", err)
+	}
+
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM data found in %s", auditevent.ErrUnsupportedKey, path)
+	}
+
+	switch block.Type {
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parsing public key: %w", err)
+		}
+		return key, nil
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parsing certificate: %w", err)
+		}
+		return cert.PublicKey, nil
+	default:
+		return nil, fmt.Errorf("%w: PEM block type %q", auditevent.ErrUnsupportedKey, block.Type)
+	}
+}
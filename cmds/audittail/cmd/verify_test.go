@@ -0,0 +1,243 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+var verifyTestTime = time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func verifyTestEvent(id string, loggedAt time.Time) *auditevent.AuditEvent {
+	e := auditevent.NewAuditEventWithID(id, "UserLogin",
+		auditevent.EventSource{Type: "IP", Value: "10.0.0.1"},
+		auditevent.OutcomeSucceeded, map[string]string{"user": "jane"}, "api")
+	e.LoggedAt = loggedAt
+
+	return e
+}
+
+// writeVerifyTestLog returns the lines the writer writes the events as.
+func writeVerifyTestLog(t *testing.T, configure func(*auditevent.EventWriter), events ...*auditevent.AuditEvent) []string {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := auditevent.NewDefaultAuditEventWriter(&buf)
+	configure(w)
+	for _, e := range events {
+		require.NoError(t, w.Write(e))
+	}
+
+	lines := strings.SplitAfter(buf.String(), "\n")
+
+	return lines[:len(lines)-1]
+}
+
+func runVerify(t *testing.T, stdin string, args ...string) (string, error) {
+	t.Helper()
+
+	c := NewVerifyCommand()
+	var out bytes.Buffer
+	c.SetOut(&out)
+	c.SetErr(&bytes.Buffer{})
+	c.SetIn(strings.NewReader(stdin))
+	c.SetArgs(args)
+
+	err := c.Execute()
+
+	return out.String(), err
+}
+
+func requireExitCode(t *testing.T, err error, code int) {
+	t.Helper()
+
+	var exitErr *ExitError
+	require.ErrorAs(t, err, &exitErr)
+	require.Equal(t, code, exitErr.Code)
+}
+
+func TestVerifyValidLogs(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	pub, priv, err := ed25519.GenerateKey(nil)
+	require.NoError(t, err)
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	require.NoError(t, err)
+	keyPath := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}),
+		ownerGroupOwnership))
+
+	// Checkpoints are logged when they're written, after the events
+	// before them were created
+	now := time.Now().UTC()
+	lines := writeVerifyTestLog(t, func(w *auditevent.EventWriter) {
+		w.WithHashChain(2).WithSigner(auditevent.NewEd25519Signer("k1", priv))
+	}, verifyTestEvent("1", now), verifyTestEvent("2", now), verifyTestEvent("3", now))
+	// 3 events and a checkpoint
+	require.Len(t, lines, 4)
+
+	// The log was rotated and compressed after its first events
+	rotated := filepath.Join(dir, "audit.log.1.gz")
+	var gz bytes.Buffer
+	zw := gzip.NewWriter(&gz)
+	_, err = zw.Write([]byte(strings.Join(lines[:2], "")))
+	require.NoError(t, err)
+	require.NoError(t, zw.Close())
+	require.NoError(t, os.WriteFile(rotated, gz.Bytes(), ownerGroupOwnership))
+
+	out, err := runVerify(t, strings.Join(lines[2:], ""),
+		"--key", "k1="+keyPath, "--require-signatures", "--max-clock-skew", "1m",
+		"-o", "json", rotated, "-")
+	require.NoError(t, err, out)
+
+	report := &verifyReport{}
+	require.NoError(t, json.Unmarshal([]byte(out), report))
+	require.Equal(t, &verifyReport{
+		Logs:               []string{rotated, "-"},
+		Events:             4,
+		Chained:            4,
+		Chains:             1,
+		Signed:             4,
+		SignaturesVerified: true,
+		Problems:           []verifyProblem{},
+	}, report)
+
+	out, err = runVerify(t, strings.Join(lines, ""), "--max-clock-skew", "1m")
+	require.NoError(t, err)
+	require.Equal(t, "4 events in 1 audit logs, 4 chained in 1 chains, 4 signed "+
+		"(not verified, no keys were given): 0 problems found\n", out)
+}
+
+func TestVerifyReportsProblems(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	keyPath := filepath.Join(dir, "hmac.key")
+	require.NoError(t, os.WriteFile(keyPath, []byte("secret\n"), ownerGroupOwnership))
+
+	incomplete := verifyTestEvent("3", verifyTestTime.Add(2*time.Second))
+	incomplete.Subjects = nil
+	incomplete.Component = ""
+
+	signed := writeVerifyTestLog(t, func(w *auditevent.EventWriter) {
+		w.WithSigner(auditevent.NewHMACSigner("k1", []byte("secret")))
+	},
+		verifyTestEvent("1", verifyTestTime),
+		incomplete,
+		verifyTestEvent("1", verifyTestTime.Add(3*time.Second)),
+		verifyTestEvent("5", verifyTestTime.Add(time.Second)),
+		verifyTestEvent("6", verifyTestTime.Add(4*time.Second)),
+	)
+	signed[4] = strings.Replace(signed[4], auditevent.OutcomeSucceeded, auditevent.OutcomeFailed, 1)
+
+	unsigned := writeVerifyTestLog(t, func(*auditevent.EventWriter) {},
+		verifyTestEvent("7", verifyTestTime.Add(5*time.Second)))
+
+	chained := writeVerifyTestLog(t, func(w *auditevent.EventWriter) {
+		w.WithHashChain(0).WithSigner(auditevent.NewHMACSigner("k1", []byte("secret")))
+	},
+		verifyTestEvent("8", verifyTestTime.Add(6*time.Second)),
+		verifyTestEvent("9", verifyTestTime.Add(7*time.Second)),
+		verifyTestEvent("10", verifyTestTime.Add(8*time.Second)),
+	)
+
+	log := signed[0] + "{not json\n" + strings.Join(signed[1:], "") + unsigned[0] + chained[0] + chained[2]
+	path := filepath.Join(dir, "audit.log")
+	require.NoError(t, os.WriteFile(path, []byte(log), ownerGroupOwnership))
+
+	out, err := runVerify(t, "", "--hmac-key", "k1="+keyPath, "--require-signatures", path)
+	requireExitCode(t, err, verifyExitProblems)
+	require.ErrorIs(t, err, ErrVerificationFailed)
+
+	lines := strings.Split(strings.TrimSuffix(out, "\n"), "\n")
+	require.Len(t, lines, 9)
+	for i, want := range []string{
+		path + ":2: " + checkMalformedJSON + ": ",
+		path + ":3: " + checkInvalidField + ": component (AU-3(c)): must not be empty",
+		path + ":3: " + checkInvalidField + ": subjects (AU-3(f)): must contain at least one subject",
+		path + ":4: " + checkDuplicateAuditID + ": audit ID already used at " + path + ":1",
+		path + ":5: " + checkLoggedAtOrder + ": logged at 2026-01-02T03:04:06Z, before 2026-01-02T03:04:08Z at " +
+			path + ":4",
+		path + ":6: " + checkSignature + ": invalid audit event signature",
+		path + ":7: " + checkSignature + ": audit event is not signed",
+		path + ":9: " + checkHashChain + ": chain ",
+	} {
+		require.True(t, strings.HasPrefix(lines[i], want), "got %q, want %q", lines[i], want)
+	}
+
+	// The report is only printed, CI tells the problems apart by their exit status
+	out, err = runVerify(t, "", "-o", "json", path)
+	requireExitCode(t, err, verifyExitProblems)
+
+	report := &verifyReport{}
+	require.NoError(t, json.Unmarshal([]byte(out), report))
+	require.Equal(t, 9, report.Events)
+	require.False(t, report.SignaturesVerified)
+	require.Equal(t, verifyProblem{
+		Log:     path,
+		Line:    3,
+		AuditID: "3",
+		Check:   checkInvalidField,
+		Field:   "component",
+		Message: "component (AU-3(c)): must not be empty",
+	}, report.Problems[1])
+}
+
+func TestVerifyErrors(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+	notKey := filepath.Join(dir, "key.pem")
+	require.NoError(t, os.WriteFile(notKey, []byte("not a key"), ownerGroupOwnership))
+
+	tests := []struct {
+		args   []string
+		errMsg string
+	}{
+		{args: []string{filepath.Join(dir, "missing.log")}, errMsg: "opening audit log"},
+		{args: []string{"-o", "yaml"}, errMsg: ErrInvalidVerifyOutput.Error()},
+		{args: []string{"--key", "k1"}, errMsg: ErrInvalidVerifyKey.Error()},
+		{args: []string{"--key", "k1=" + notKey}, errMsg: "no PEM data found"},
+		{args: []string{"--hmac-key", "k1=" + filepath.Join(dir, "missing.key")}, errMsg: "reading HMAC key"},
+		{args: []string{"--unknown"}, errMsg: "unknown flag"},
+	}
+
+	for _, tt := range tests {
+		t.Run(fmt.Sprint(tt.args), func(t *testing.T) {
+			t.Parallel()
+
+			_, err := runVerify(t, "", tt.args...)
+			requireExitCode(t, err, verifyExitError)
+			require.ErrorContains(t, err, tt.errMsg)
+		})
+	}
+}
@@ -0,0 +1,317 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultWebhookBatchSize     = 100
+	defaultWebhookFlushInterval = time.Second
+
+	webhookContentType = "application/x-ndjson"
+	webhookTimeout     = 30 * time.Second
+	webhookMinBackoff  = 100 * time.Millisecond
+	webhookMaxBackoff  = 30 * time.Second
+)
+
+// webhookSink POSTs batches of audit events to an HTTP collector, as
+// newline-delimited JSON. A batch is sent once it's full or the flush
+// interval elapses, and stays buffered until the collector acknowledges
+// it with a 2xx status. Network errors, 5xx and 429 statuses are retried
+// with exponential backoff. Any other status rejects the batch for good,
+// so it's quarantined, and the events after it are still sent.
+type webhookSink struct {
+	//nolint:containedctx // Write has no context of its own to stop retrying
+	ctx       context.Context
+	client    *http.Client
+	url       string
+	token     string
+	gzip      bool
+	batchSize int
+	metrics   *tailMetrics
+	// quarantine receives the batches the collector rejects
+	quarantine io.Writer
+
+	mu sync.Mutex
+	// batch holds the events that weren't acknowledged yet
+	batch bytes.Buffer
+	// events is the number of events in batch
+	events int
+	// err is the error of the last flush, which stops the sink
+	err error
+
+	stop      chan struct{}
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// webhookConfig holds the settings of a webhookSink.
+type webhookConfig struct {
+	url           string
+	token         string
+	gzip          bool
+	batchSize     int
+	flushInterval time.Duration
+	tlsConfig     *tls.Config
+	// quarantine receives the batches the collector rejects,
+	// which are discarded if it's nil
+	quarantine io.Writer
+}
+
+// newWebhookSink returns a sink for the given collector URL. It flushes
+// the batch every flush interval until it's closed or ctx is done.
+func newWebhookSink(ctx context.Context, cfg webhookConfig) (*webhookSink, error) {
+	u, err := url.Parse(cfg.url)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidWebhookURL, cfg.url)
+	}
+
+	if cfg.batchSize < 1 {
+		return nil, fmt.Errorf("%w: %d", ErrInvalidWebhookBatchSize, cfg.batchSize)
+	}
+
+	if cfg.flushInterval <= 0 {
+		return nil, fmt.Errorf("%w: %s", ErrInvalidWebhookFlushInterval, cfg.flushInterval)
+	}
+
+	//nolint:forcetypeassert // The default transport is always an *http.Transport
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.TLSClientConfig = cfg.tlsConfig
+
+	quarantine := cfg.quarantine
+	if quarantine == nil {
+		quarantine = io.Discard
+	}
+
+	s := &webhookSink{
+		ctx: ctx,
+		client: &http.Client{
+			Transport: transport,
+			Timeout:   webhookTimeout,
+		},
+		url:        cfg.url,
+		token:      cfg.token,
+		gzip:       cfg.gzip,
+		batchSize:  cfg.batchSize,
+		quarantine: quarantine,
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	go s.run(cfg.flushInterval)
+
+	return s, nil
+}
+
+// Write adds the audit event in p to the batch, and sends the batch
+// if it's full. p is expected to hold a single, whole event.
+func (s *webhookSink) Write(p []byte) (int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.err != nil {
+		return 0, s.err
+	}
+
+	s.batch.Write(bytes.TrimSpace(p))
+	s.batch.WriteByte('\n')
+	s.events++
+
+	if s.events >= s.batchSize {
+		if s.err = s.flush(s.ctx); s.err != nil {
+			return 0, s.err
+		}
+	}
+
+	return len(p), nil
+}
+
+// Flush sends the batch until the collector acknowledges or rejects it.
+// Unlike Write, it sends a batch that failed before again, and the sink
+// takes events again once it succeeds.
+func (s *webhookSink) Flush() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.err = s.flush(s.ctx)
+	return s.err
+}
+
+// Close stops the periodic flushes and sends the remaining events,
+// retrying until ctx is done.
+func (s *webhookSink) Close() error {
+	s.closeOnce.Do(func() {
+		close(s.stop)
+	})
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	// The events are still sent if only the retries were cut short
+	s.err = s.flush(s.ctx)
+	return s.err
+}
+
+func (s *webhookSink) run(interval time.Duration) {
+	defer close(s.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			s.mu.Lock()
+			if s.err == nil {
+				s.err = s.flush(s.ctx)
+			}
+			s.mu.Unlock()
+		case <-s.stop:
+			return
+		case <-s.ctx.Done():
+			return
+		}
+	}
+}
+
+// flush sends the batch until the collector acknowledges or rejects it.
+// s.mu must be held.
+func (s *webhookSink) flush(ctx context.Context) error {
+	if s.events == 0 {
+		return nil
+	}
+
+	body, err := s.encode()
+	if err != nil {
+		return err
+	}
+
+	backoff := webhookMinBackoff
+	for {
+		retryAfter, err := s.post(ctx, body)
+		if err == nil {
+			s.batch.Reset()
+			s.events = 0
+			return nil
+		}
+
+		if errors.Is(err, ErrWebhookRejected) {
+			return s.reject(err)
+		}
+
+		wait := max(backoff, retryAfter)
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("sending events to webhook: %w", errors.Join(ctx.Err(), err))
+		case <-time.After(wait):
+		}
+
+		s.metrics.sinkRetried()
+		backoff = min(2*backoff, webhookMaxBackoff)
+	}
+}
+
+// reject quarantines the batch the collector rejected, and drops it from
+// the sink. If it can't be quarantined, it's kept, and err is returned.
+// s.mu must be held.
+func (s *webhookSink) reject(err error) error {
+	if qerr := writeLine(s.quarantine, s.batch.Bytes()); qerr != nil {
+		return fmt.Errorf("quarantining events: %w", errors.Join(qerr, err))
+	}
+
+	s.metrics.sinkRejected(s.events)
+	s.batch.Reset()
+	s.events = 0
+	return nil
+}
+
+func (s *webhookSink) encode() ([]byte, error) {
+	if !s.gzip {
+		return s.batch.Bytes(), nil
+	}
+
+	var b bytes.Buffer
+	zw := gzip.NewWriter(&b)
+	if _, err := zw.Write(s.batch.Bytes()); err != nil {
+		return nil, fmt.Errorf("compressing events: %w", err)
+	}
+
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("compressing events: %w", err)
+	}
+
+	return b.Bytes(), nil
+}
+
+// post sends the body once. If it may be retried, it returns how long
+// the collector asked to wait before that, if it did.
+func (s *webhookSink) post(ctx context.Context, body []byte) (time.Duration, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.url, bytes.NewReader(body))
+	if err != nil {
+		return 0, fmt.Errorf("creating webhook request: %w", err)
+	}
+
+	req.Header.Set("Content-Type", webhookContentType)
+	if s.gzip {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+	if s.token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.token)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	//nolint:errcheck // The body is drained only to reuse the connection
+	io.Copy(io.Discard, resp.Body)
+
+	switch {
+	case resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices:
+		return 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests, resp.StatusCode >= http.StatusInternalServerError:
+		return retryAfter(resp), fmt.Errorf("%w: %s", ErrWebhookUnavailable, resp.Status)
+	default:
+		return 0, fmt.Errorf("%w: %s", ErrWebhookRejected, resp.Status)
+	}
+}
+
+// retryAfter returns the delay in the response's Retry-After header,
+// if it's in seconds, capped to the maximum backoff.
+func retryAfter(resp *http.Response) time.Duration {
+	secs, err := strconv.Atoi(resp.Header.Get("Retry-After"))
+	if err != nil || secs < 0 {
+		return 0
+	}
+
+	return min(time.Duration(secs)*time.Second, webhookMaxBackoff)
+}
@@ -0,0 +1,318 @@
+/*
+Copyright 2022 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package cmd
+
+import (
+	"compress/gzip"
+	"crypto/tls"
+	"crypto/x509"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+)
+
+const webhookTestEvent = `{"metadata":{"auditId":"1"},"type":"foo","outcome":"succeeded"}`
+
+// webhookCollector records the batches it acknowledges, replying
+// with the given statuses first. It always rejects the batches
+// that contain reject, if it's set.
+type webhookCollector struct {
+	mu       sync.Mutex
+	statuses []int
+	reject   string
+	requests int
+	batches  []string
+	headers  []http.Header
+}
+
+func (c *webhookCollector) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.requests++
+	if len(c.statuses) > 0 {
+		status := c.statuses[0]
+		c.statuses = c.statuses[1:]
+		if status == http.StatusTooManyRequests {
+			w.Header().Set("Retry-After", "0")
+		}
+		w.WriteHeader(status)
+		return
+	}
+
+	body := r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+
+	b, err := io.ReadAll(body)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	if c.reject != "" && strings.Contains(string(b), c.reject) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+
+	c.batches = append(c.batches, string(b))
+	c.headers = append(c.headers, r.Header.Clone())
+}
+
+func (c *webhookCollector) received() ([]string, int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]string{}, c.batches...), c.requests
+}
+
+func newTestWebhookSink(t *testing.T, cfg webhookConfig) *webhookSink {
+	t.Helper()
+
+	if cfg.flushInterval == 0 {
+		cfg.flushInterval = time.Hour
+	}
+
+	s, err := newWebhookSink(t.Context(), cfg)
+	require.NoError(t, err, "unexpected error creating webhook sink")
+	return s
+}
+
+func writeWebhookEvents(t *testing.T, s *webhookSink, n int) {
+	t.Helper()
+
+	for range n {
+		written, err := s.Write([]byte(webhookTestEvent + "\n"))
+		require.NoError(t, err)
+		require.Equal(t, len(webhookTestEvent)+1, written, "the whole event should be written")
+	}
+}
+
+func TestWebhookBatchSize(t *testing.T) {
+	t.Parallel()
+
+	c := &webhookCollector{}
+	srv := httptest.NewServer(c)
+	t.Cleanup(srv.Close)
+
+	s := newTestWebhookSink(t, webhookConfig{url: srv.URL, batchSize: 2})
+
+	writeWebhookEvents(t, s, 5)
+
+	batch := strings.Repeat(webhookTestEvent+"\n", 2)
+	batches, _ := c.received()
+	require.Equal(t, []string{batch, batch}, batches, "only full batches should be sent")
+
+	require.NoError(t, s.Close())
+
+	batches, _ = c.received()
+	require.Equal(t, []string{batch, batch, webhookTestEvent + "\n"}, batches, "closing should send the rest")
+	require.Equal(t, webhookContentType, c.headers[0].Get("Content-Type"))
+	require.Empty(t, c.headers[0].Get("Authorization"))
+}
+
+func TestWebhookFlushInterval(t *testing.T) {
+	t.Parallel()
+
+	c := &webhookCollector{}
+	srv := httptest.NewServer(c)
+	t.Cleanup(srv.Close)
+
+	s := newTestWebhookSink(t, webhookConfig{url: srv.URL, batchSize: 100, flushInterval: 10 * time.Millisecond})
+	t.Cleanup(func() { s.Close() })
+
+	writeWebhookEvents(t, s, 1)
+
+	require.Eventually(t, func() bool {
+		batches, _ := c.received()
+		return len(batches) == 1
+	}, time.Second, 10*time.Millisecond, "the batch should be sent once the interval elapses")
+}
+
+func TestWebhookGzipAndToken(t *testing.T) {
+	t.Parallel()
+
+	c := &webhookCollector{}
+	srv := httptest.NewServer(c)
+	t.Cleanup(srv.Close)
+
+	s := newTestWebhookSink(t, webhookConfig{url: srv.URL, batchSize: 1, gzip: true, token: "my-token"})
+	t.Cleanup(func() { s.Close() })
+
+	writeWebhookEvents(t, s, 1)
+
+	batches, _ := c.received()
+	require.Equal(t, []string{webhookTestEvent + "\n"}, batches)
+	require.Equal(t, "gzip", c.headers[0].Get("Content-Encoding"))
+	require.Equal(t, "Bearer my-token", c.headers[0].Get("Authorization"))
+}
+
+func TestWebhookMutualTLS(t *testing.T) {
+	t.Parallel()
+
+	cert, certFile, keyFile := newTestCertificate(t)
+	pool := x509.NewCertPool()
+	pool.AddCert(mustParseCertificate(t, cert))
+
+	c := &webhookCollector{}
+	srv := httptest.NewUnstartedServer(c)
+	srv.TLS = &tls.Config{
+		Certificates: []tls.Certificate{cert},
+		ClientAuth:   tls.RequireAndVerifyClientCert,
+		ClientCAs:    pool,
+		MinVersion:   tls.VersionTLS12,
+	}
+	srv.StartTLS()
+	t.Cleanup(srv.Close)
+
+	tlsConfig, err := newClientTLSConfig(certFile, certFile, keyFile)
+	require.NoError(t, err)
+
+	s := newTestWebhookSink(t, webhookConfig{url: srv.URL, batchSize: 1, tlsConfig: tlsConfig})
+	t.Cleanup(func() { s.Close() })
+
+	writeWebhookEvents(t, s, 1)
+
+	batches, _ := c.received()
+	require.Equal(t, []string{webhookTestEvent + "\n"}, batches)
+}
+
+func TestWebhookRetries(t *testing.T) {
+	t.Parallel()
+
+	c := &webhookCollector{
+		statuses: []int{http.StatusServiceUnavailable, http.StatusTooManyRequests, http.StatusBadGateway},
+	}
+	srv := httptest.NewServer(c)
+	t.Cleanup(srv.Close)
+
+	s := newTestWebhookSink(t, webhookConfig{url: srv.URL, batchSize: 2})
+	t.Cleanup(func() { s.Close() })
+
+	writeWebhookEvents(t, s, 2)
+
+	batches, requests := c.received()
+	require.Equal(t, []string{strings.Repeat(webhookTestEvent+"\n", 2)}, batches,
+		"the batch should be kept until it's acknowledged")
+	require.Equal(t, 4, requests)
+}
+
+func TestWebhookRejected(t *testing.T) {
+	t.Parallel()
+
+	c := &webhookCollector{statuses: []int{http.StatusBadRequest}}
+	srv := httptest.NewServer(c)
+	t.Cleanup(srv.Close)
+
+	var quarantine syncBuffer
+	s := newTestWebhookSink(t, webhookConfig{url: srv.URL, batchSize: 1, quarantine: &quarantine})
+	s.metrics = newTailMetrics(prometheus.NewRegistry())
+
+	rejected := `{"metadata":{"auditId":"2"},"type":"bar","outcome":"failed"}`
+	_, err := s.Write([]byte(rejected + "\n"))
+	require.NoError(t, err, "a rejected batch shouldn't fail the sink")
+
+	writeWebhookEvents(t, s, 1)
+	require.NoError(t, s.Close())
+
+	batches, requests := c.received()
+	require.Equal(t, []string{webhookTestEvent + "\n"}, batches, "the events after a rejected batch should be sent")
+	require.Equal(t, 2, requests, "rejected batches shouldn't be retried")
+	require.Equal(t, rejected+"\n", quarantine.String(), "rejected batches should be quarantined")
+	require.InDelta(t, 1, testutil.ToFloat64(s.metrics.sinkRejections), 0)
+}
+
+func TestWebhookKeepsBatchItCantQuarantine(t *testing.T) {
+	t.Parallel()
+
+	c := &webhookCollector{statuses: []int{http.StatusBadRequest}}
+	srv := httptest.NewServer(c)
+	t.Cleanup(srv.Close)
+
+	s := newTestWebhookSink(t, webhookConfig{url: srv.URL, batchSize: 1, quarantine: failingWriter{}})
+
+	_, err := s.Write([]byte(webhookTestEvent))
+	require.ErrorIs(t, err, ErrWebhookRejected)
+
+	require.NoError(t, s.Flush(), "flushing should send the batch again")
+	require.NoError(t, s.Close())
+
+	batches, requests := c.received()
+	require.Equal(t, []string{webhookTestEvent + "\n"}, batches)
+	require.Equal(t, 2, requests)
+}
+
+func TestWebhookInvalidConfig(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name string
+		cfg  webhookConfig
+		want error
+	}{
+		{
+			name: "scheme",
+			cfg:  webhookConfig{url: "ftp://localhost", batchSize: 1, flushInterval: time.Second},
+			want: ErrInvalidWebhookURL,
+		},
+		{
+			name: "host",
+			cfg:  webhookConfig{url: "http://", batchSize: 1, flushInterval: time.Second},
+			want: ErrInvalidWebhookURL,
+		},
+		{
+			name: "batch size",
+			cfg:  webhookConfig{url: "http://localhost", flushInterval: time.Second},
+			want: ErrInvalidWebhookBatchSize,
+		},
+		{
+			name: "flush interval",
+			cfg:  webhookConfig{url: "http://localhost", batchSize: 1},
+			want: ErrInvalidWebhookFlushInterval,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			_, err := newWebhookSink(t.Context(), tt.cfg)
+			require.ErrorIs(t, err, tt.want)
+		})
+	}
+}
+
+func mustParseCertificate(t *testing.T, cert tls.Certificate) *x509.Certificate {
+	t.Helper()
+
+	c, err := x509.ParseCertificate(cert.Certificate[0])
+	require.NoError(t, err)
+	return c
+}
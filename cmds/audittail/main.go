@@ -17,8 +17,10 @@ package main
 
 import (
 	"context"
+	"errors"
 	"os"
 	"os/signal"
+	"syscall"
 
 	"github.com/metal-toolbox/auditevent/cmds/audittail/cmd"
 )
@@ -26,11 +28,12 @@ import (
 func runCommand() int {
 	ctx := context.Background()
 
-	// trap Ctrl+C and call cancel on the context
+	// trap Ctrl+C and termination signals and call cancel on the context,
+	// which drains the audit log before exiting
 	ctx, cancel := context.WithCancel(ctx)
 
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 
 	defer func() {
 		signal.Stop(c)
@@ -46,6 +49,12 @@ func runCommand() int {
 	}()
 
 	if err := cmd.GetCmd().ExecuteContext(ctx); err != nil {
+		// Some commands tell their failures apart by their exit status
+		var exitErr *cmd.ExitError
+		if errors.As(err, &exitErr) {
+			return exitErr.Code
+		}
+
 		return 1
 	}
 
@@ -0,0 +1,80 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package ginaudit
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/metal-toolbox/auditevent/middleware/auditcore"
+)
+
+// adapter exposes a gin context to the audit core.
+type adapter struct {
+	c *gin.Context
+	m *Middleware
+}
+
+var _ auditcore.Adapter = (*adapter)(nil)
+
+func (a *adapter) Request() *http.Request {
+	return a.c.Request
+}
+
+// Route returns the matched route's full path, which is empty
+// if no route matched.
+func (a *adapter) Route() string {
+	return a.c.FullPath()
+}
+
+func (a *adapter) PathParams() map[string]string {
+	params := make(map[string]string, len(a.c.Params))
+	for _, p := range a.c.Params {
+		params[p.Key] = p.Value
+	}
+	return params
+}
+
+func (a *adapter) Status() int {
+	return a.c.Writer.Status()
+}
+
+// ClientIP already takes into account X-Forwarded-For and alike
+// headers sent by the engine's trusted proxies.
+func (a *adapter) ClientIP() string {
+	return a.c.ClientIP()
+}
+
+func (a *adapter) Get(key string) (any, bool) {
+	return a.c.Get(key)
+}
+
+func (a *adapter) Set(key string, value any) {
+	a.c.Set(key, value)
+}
+
+func (a *adapter) HoldResponse() auditcore.ResponseHolder {
+	return holdResponse(a.c)
+}
+
+func (a *adapter) Outcome() string {
+	return a.m.outcomeHandler(a.c)
+}
+
+func (a *adapter) Subjects() map[string]string {
+	return a.m.subjectHandler(a.c)
+}
@@ -0,0 +1,139 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package ginaudit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/metal-toolbox/auditevent/middleware/auditcore"
+)
+
+// noWritten mirrors the size gin reports for responses without a body.
+const noWritten = -1
+
+// heldWriter is a gin.ResponseWriter that holds the response back
+// until its audit event is written. See auditcore.FailClosed.
+type heldWriter struct {
+	gin.ResponseWriter
+	c      *gin.Context
+	status int
+	size   int
+	body   bytes.Buffer
+}
+
+var _ auditcore.ResponseHolder = (*heldWriter)(nil)
+
+func holdResponse(c *gin.Context) *heldWriter {
+	w := &heldWriter{
+		ResponseWriter: c.Writer,
+		c:              c,
+		status:         c.Writer.Status(),
+		size:           noWritten,
+	}
+	c.Writer = w
+
+	return w
+}
+
+func (w *heldWriter) WriteHeader(code int) {
+	if code > 0 && w.status != code && !w.Written() {
+		w.status = code
+	}
+}
+
+func (w *heldWriter) WriteHeaderNow() {
+	if !w.Written() {
+		w.size = 0
+	}
+}
+
+func (w *heldWriter) Write(data []byte) (int, error) {
+	w.WriteHeaderNow()
+	n, err := w.body.Write(data)
+	w.size += n
+	return n, err
+}
+
+func (w *heldWriter) WriteString(s string) (int, error) {
+	w.WriteHeaderNow()
+	n, err := w.body.WriteString(s)
+	w.size += n
+	return n, err
+}
+
+func (w *heldWriter) Status() int {
+	return w.status
+}
+
+func (w *heldWriter) Size() int {
+	return w.size
+}
+
+func (w *heldWriter) Written() bool {
+	return w.size != noWritten
+}
+
+// Flush is a no-op, as the response is held back.
+func (w *heldWriter) Flush() {
+	w.WriteHeaderNow()
+}
+
+// Hijack isn't supported, as the response is held back.
+func (w *heldWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, fmt.Errorf("hijacking a held back response: %w", http.ErrNotSupported)
+}
+
+// Pusher returns nil, as the response is held back.
+func (w *heldWriter) Pusher() http.Pusher {
+	return nil
+}
+
+func (w *heldWriter) Release() {
+	w.c.Writer = w.ResponseWriter
+	w.ResponseWriter.WriteHeader(w.status)
+
+	if !w.Written() {
+		return
+	}
+
+	if w.body.Len() == 0 {
+		w.ResponseWriter.WriteHeaderNow()
+		return
+	}
+
+	//nolint:errcheck // the client is gone, there's nothing left to do
+	w.ResponseWriter.Write(w.body.Bytes())
+}
+
+func (w *heldWriter) Reject(status int) {
+	w.c.Writer = w.ResponseWriter
+
+	h := w.ResponseWriter.Header()
+	for k := range h {
+		delete(h, k)
+	}
+
+	h.Set("Content-Type", "text/plain; charset=utf-8")
+	w.ResponseWriter.WriteHeader(status)
+	//nolint:errcheck // the client is gone, there's nothing left to do
+	w.ResponseWriter.WriteString(http.StatusText(status))
+}
@@ -16,29 +16,25 @@ limitations under the License.
 package ginaudit
 
 import (
-	"encoding/json"
-	"fmt"
 	"io"
-	"sync"
 
 	"github.com/gin-gonic/gin"
-	"github.com/google/uuid"
+	"github.com/go-logr/logr"
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/metal-toolbox/auditevent"
+	"github.com/metal-toolbox/auditevent/middleware/auditcore"
 )
 
 const (
 	// AuditDataContextKey is the gin context key for additional audit data.
-	AuditDataContextKey = "audit.data"
+	AuditDataContextKey = auditcore.AuditDataContextKey
 	// AuditIDContextKey is the gin context key for the audit ID.
-	AuditIDContextKey = "audit.id"
+	AuditIDContextKey = auditcore.AuditIDContextKey
 )
 
 type Middleware struct {
-	component      string
-	aew            *auditevent.EventWriter
-	eventTypeMap   sync.Map
+	core           *auditcore.Core
 	outcomeHandler OutcomeHandler
 	subjectHandler SubjectHandler
 }
@@ -46,8 +42,7 @@ type Middleware struct {
 // NewMiddleware returns a new instance of audit Middleware.
 func NewMiddleware(component string, aew *auditevent.EventWriter) *Middleware {
 	return &Middleware{
-		component:      component,
-		aew:            aew,
+		core:           auditcore.New(component, aew),
 		outcomeHandler: GetOutcomeDefault,
 		subjectHandler: GetSubjectDefault,
 	}
@@ -64,14 +59,14 @@ func NewJSONMiddleware(component string, w io.Writer) *Middleware {
 // WithPrometheusMetrics enables prometheus metrics for this middleware instance
 // using the default prometheus registerer (prometheus.DefaultRegisterer).
 func (m *Middleware) WithPrometheusMetrics() *Middleware {
-	m.aew.WithPrometheusMetrics(m.component)
+	m.core.WithPrometheusMetrics()
 	return m
 }
 
 // WithPrometheusMetricsForRegisterer enables prometheus metrics for this middleware instance
 // using the default prometheus registerer (prometheus.DefaultRegisterer).
 func (m *Middleware) WithPrometheusMetricsForRegisterer(pr prometheus.Registerer) *Middleware {
-	m.aew.WithPrometheusMetricsForRegisterer(m.component, pr)
+	m.core.WithPrometheusMetricsForRegisterer(pr)
 	return m
 }
 
@@ -85,9 +80,38 @@ func (m *Middleware) WithSubjectHandler(handler SubjectHandler) *Middleware {
 	return m
 }
 
+// WithLogger sets the logger used to report the errors writing events.
+// See WithFailurePolicy.
+func (m *Middleware) WithLogger(l logr.Logger) *Middleware {
+	m.core.WithLogger(l)
+	return m
+}
+
+// WithFailurePolicy sets what happens to requests whose audit event can't
+// be written, unless a policy is set for their method or route. By default,
+// errors are ignored (auditcore.IgnoreFailures). See auditcore.FailurePolicy.
+func (m *Middleware) WithFailurePolicy(p auditcore.FailurePolicy) *Middleware {
+	m.core.SetFailurePolicy(p)
+	return m
+}
+
+// SetFailurePolicyForMethod sets the failure policy for the requests with the
+// given HTTP method, e.g. auditcore.FailClosed for the methods that change state.
+func (m *Middleware) SetFailurePolicyForMethod(httpMethod string, p auditcore.FailurePolicy) {
+	m.core.SetFailurePolicyForMethod(httpMethod, p)
+}
+
+// SetFailurePolicyForRoute sets the failure policy for the requests to the given
+// HTTP method and path. The path is a route template, as in RegisterEventType.
+// It takes precedence over the policy of the method.
+func (m *Middleware) SetFailurePolicyForRoute(httpMethod, path string, p auditcore.FailurePolicy) {
+	m.core.SetFailurePolicyForRoute(httpMethod, path, p)
+}
+
 // RegisterEventType registers an audit event type for a given HTTP method and path.
+// The path is the template of the route, e.g. `/servers/:id`, as in gin's route definition.
 func (m *Middleware) RegisterEventType(eventType, httpMethod, path string) {
-	m.eventTypeMap.Store(keyFromHTTPMethodAndPath(httpMethod, path), eventType)
+	m.core.RegisterEventType(eventType, httpMethod, path)
 }
 
 // Audit returns a gin middleware that will audit the request.
@@ -104,66 +128,7 @@ func (m *Middleware) Audit() gin.HandlerFunc {
 // it'll use the HTTP method and path.
 func (m *Middleware) AuditWithType(t string) gin.HandlerFunc {
 	return func(c *gin.Context) {
-		method := c.Request.Method
-		path := c.Request.URL.Path
-
-		auditID := uuid.New().String()
-		c.Set(AuditIDContextKey, auditID)
-
-		// We audit after the request has been processed
-		c.Next()
-
-		event := auditevent.NewAuditEventWithID(
-			auditID,
-			m.getEventType(t, method, path),
-			auditevent.EventSource{
-				Type: "IP",
-				// This already takes into account X-Forwarded-For and alike headers
-				Value: c.ClientIP(),
-			},
-			m.outcomeHandler(c),
-			m.subjectHandler(c),
-			m.component,
-		).WithTarget(map[string]string{
-			"path": path,
-		})
-
-		data, ok := c.Get(AuditDataContextKey)
-		if ok {
-			ed, ok := data.(*json.RawMessage)
-			if ok {
-				event.WithData(ed)
-			}
-		}
-
-		// persist event
-		m.write(event)
+		//nolint:errcheck // errors are handled by the failure policy
+		m.core.Audit(&adapter{c: c, m: m}, t, c.Next)
 	}
 }
-
-func (m *Middleware) getEventType(preferredType, httpMethod, path string) string {
-	if preferredType != "" {
-		return preferredType
-	}
-
-	key := keyFromHTTPMethodAndPath(httpMethod, path)
-	rawEventType, ok := m.eventTypeMap.Load(key)
-	if ok {
-		etype, castok := rawEventType.(string)
-		if castok {
-			return etype
-		}
-	}
-	return key
-}
-
-// This function is wrapped to allow for easy testing and
-// easy replacement in case we run into concurrency issues.
-func (m *Middleware) write(event *auditevent.AuditEvent) {
-	//nolint:errcheck // TODO: We should come back to this and log the error
-	m.aew.Write(event)
-}
-
-func keyFromHTTPMethodAndPath(method, path string) string {
-	return fmt.Sprintf("%s:%s", method, path)
-}
@@ -15,29 +15,19 @@ limitations under the License.
 */
 package ginaudit
 
-import "github.com/gin-gonic/gin"
+import (
+	"github.com/gin-gonic/gin"
+
+	"github.com/metal-toolbox/auditevent/middleware/auditcore"
+)
 
 // SubjectHandler is a function that returns the AuditEvent subject map
 // for a given request. This will be called after other middleware; e.g.
 // the given gin context should already contain the subject information.
 type SubjectHandler func(c *gin.Context) map[string]string
 
+// GetSubjectDefault is the default subject handler that's set in the
+// middleware constructor. See auditcore.DefaultSubjects.
 func GetSubjectDefault(c *gin.Context) map[string]string {
-	// These context keys come from github.com/metal-toolbox/hollow-toolbox/ginjwt
-	sub := c.GetString("jwt.subject")
-	if sub == "" {
-		sub = "Unknown"
-	}
-
-	user := c.GetString("jwt.user")
-	if user == "" {
-		user = c.Request.Header.Get("X-User-Id")
-		if user == "" {
-			user = "Unknown"
-		}
-	}
-	return map[string]string{
-		"user": user,
-		"sub":  sub,
-	}
+	return auditcore.DefaultSubjects(&adapter{c: c})
 }
@@ -19,6 +19,7 @@ limitations under the License.
 package testtools
 
 import (
+	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
@@ -30,13 +31,14 @@ import (
 
 	"github.com/stretchr/testify/require"
 
+	"github.com/metal-toolbox/auditevent"
 	"github.com/metal-toolbox/auditevent/helpers"
 )
 
 const (
 	ownerAccessOnly   = 0o600
 	ownerWriteAllRead = 0o644
-	oneWord           = 4
+	readChunkSize     = 512
 )
 
 // GetNamedPipe creates a randomly named pipe in a temporary directory.
@@ -73,7 +75,14 @@ func SetPipeReader(t *testing.T, namedPipe string) <-chan io.WriteCloser {
 // WriteAuditEvent writes a test audit event to a file.
 func WriteAuditEvent(t *testing.T, f *os.File, i int) {
 	t.Helper()
-	_, err := fmt.Fprintf(f, "audit-%d\n", i)
+	event := auditevent.NewAuditEvent(
+		fmt.Sprintf("audit-%d", i),
+		auditevent.EventSource{Type: "IP", Value: "127.0.0.1"},
+		auditevent.OutcomeSucceeded,
+		map[string]string{"user": "test"},
+		"test",
+	)
+	err := json.NewEncoder(f).Encode(event)
 	require.NoError(t, err, "Unexpected error writing audit event")
 }
 
@@ -90,7 +99,7 @@ func GenerateAuditEvents(t *testing.T, path string, count int) {
 }
 
 // ReadAllAuditEvents reads all the events from the reader and fails if it times out
-// it will read 4 bytes at a time and count newlines to determine the amount of
+// it will read 512 bytes at a time and count newlines to determine the amount of
 // audit events.
 func ReadAllAuditEvents(t *testing.T, reader io.Reader, expectedEvents int) {
 	t.Helper()
@@ -100,7 +109,7 @@ func ReadAllAuditEvents(t *testing.T, reader io.Reader, expectedEvents int) {
 	for {
 		select {
 		case <-ticket.C:
-			data := make([]byte, oneWord)
+			data := make([]byte, readChunkSize)
 			_, err := reader.Read(data)
 			// ignore EOF as the tail writer might not be ready with events
 			if len(data) == 0 || errors.Is(err, io.EOF) {
@@ -25,6 +25,18 @@ const (
 	// writing audit events.
 	ErrorsTotalMetricsName = "audit_errors_total"
 
+	// DroppedTotalMetricsName is the name of the metric that tracks the number of
+	// audit events that were dropped because a writer's queue was full.
+	DroppedTotalMetricsName = "audit_events_dropped_total"
+
+	// InvalidTotalMetricsName is the name of the metric that tracks the number of
+	// audit events that were rejected because they failed validation.
+	InvalidTotalMetricsName = "audit_events_invalid_total"
+
+	// QueuedMetricsName is the name of the metric that tracks the number of audit
+	// events currently waiting in a writer's queue.
+	QueuedMetricsName = "audit_events_queued"
+
 	// ComponentLabelName is the name of the label that identifies the component
 	// This is a label used in both the "audit_events_total" and "audit_errors_total" metrics.
 	ComponentLabelName = "component"
@@ -35,6 +47,9 @@ type PrometheusMetricsProvider struct {
 	component string
 	nEvents   *prometheus.CounterVec
 	nErrors   *prometheus.CounterVec
+	nDropped  *prometheus.CounterVec
+	nInvalid  *prometheus.CounterVec
+	nQueued   *prometheus.GaugeVec
 }
 
 // NewPrometheusMetricsProviderForRegisterer returns a new instance of a metrics provider that
@@ -68,9 +83,30 @@ func NewPrometheusMetricsProviderForRegisterer(
 			},
 			[]string{ComponentLabelName},
 		),
+		nDropped: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: DroppedTotalMetricsName,
+				Help: "Number of audit events dropped due to a full queue.",
+			},
+			[]string{ComponentLabelName},
+		),
+		nInvalid: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: InvalidTotalMetricsName,
+				Help: "Number of invalid audit events that were rejected.",
+			},
+			[]string{ComponentLabelName},
+		),
+		nQueued: prometheus.NewGaugeVec(
+			prometheus.GaugeOpts{
+				Name: QueuedMetricsName,
+				Help: "Number of audit events waiting to be written.",
+			},
+			[]string{ComponentLabelName},
+		),
 	}
 
-	for _, m := range []prometheus.Collector{p.nEvents, p.nErrors} {
+	for _, m := range []prometheus.Collector{p.nEvents, p.nErrors, p.nDropped, p.nInvalid, p.nQueued} {
 		r.MustRegister(m)
 	}
 
@@ -86,3 +122,18 @@ func (p *PrometheusMetricsProvider) IncEvents() {
 func (p *PrometheusMetricsProvider) IncErrors() {
 	p.nErrors.WithLabelValues(p.component).Inc()
 }
+
+// Increase the number of audit events that have been dropped.
+func (p *PrometheusMetricsProvider) IncDropped() {
+	p.nDropped.WithLabelValues(p.component).Inc()
+}
+
+// Increase the number of audit events that have been rejected as invalid.
+func (p *PrometheusMetricsProvider) IncInvalid() {
+	p.nInvalid.WithLabelValues(p.component).Inc()
+}
+
+// Set the number of audit events that are waiting to be written.
+func (p *PrometheusMetricsProvider) SetQueued(n int) {
+	p.nQueued.WithLabelValues(p.component).Set(float64(n))
+}
@@ -0,0 +1,483 @@
+//go:build testtools
+// +build testtools
+
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package auditcoretest holds the conformance test suite that every HTTP
+audit middleware built on auditcore must pass. This package was tagged
+with testtools to ensure we don't pollute the library/binary with
+constants and functions.
+
+A middleware's tests provide a Harness that serves the following routes,
+auditing every one of them:
+
+  - POST /fails-with-user-header: audited with the "AlwaysBreaks" event
+    type; the handler fails with a 500 status.
+  - GET /ok: registered with the "MyEventType" event type; sets the
+    `jwt.user` and `jwt.subject` context keys to "user-ozz" and "sub-ozz"
+    and responds with a 200 status.
+  - GET /denied: responds with a 403 status.
+  - GET /denied-user: sets the JWT context keys and responds with a 403 status.
+  - GET /changes: sets the JWT context keys, sets the audit data context
+    key to &TestData and responds with a 200 status.
+  - GET /changes/denied: sets the audit data context key to &TestData
+    and responds with a 403 status.
+  - GET /nodata: sets the JWT context keys, sets the audit data context
+    key to a string and responds with a 200 status.
+  - GET /servers/{id}: written in the framework's route syntax and
+    registered with the "GetServer" event type; sets the JWT context keys
+    and responds with a 200 status.
+*/
+package auditcoretest
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-toolbox/auditevent"
+	"github.com/metal-toolbox/auditevent/internal/testtools"
+	"github.com/metal-toolbox/auditevent/metrics"
+	"github.com/metal-toolbox/auditevent/middleware/auditcore"
+)
+
+// Component is the component the harness' middleware must be created for.
+const Component = "test"
+
+// TestData is the audit data set by the routes that enrich their events.
+var TestData = json.RawMessage(`{"foo":"bar"}`)
+
+// Config configures the middleware set up by a Harness.
+type Config struct {
+	// Registerer, if not nil, is used to enable prometheus metrics.
+	Registerer prometheus.Registerer
+	// Outcome, if not empty, is returned by a custom outcome handler.
+	Outcome string
+	// Subjects, if not nil, are returned by a custom subject handler.
+	Subjects map[string]string
+	// FailurePolicy is the middleware's failure policy.
+	FailurePolicy auditcore.FailurePolicy
+}
+
+// Harness sets up a middleware under test.
+type Harness struct {
+	// Setup returns a handler that serves the conformance routes (see the
+	// package documentation) through a middleware writing events to w.
+	Setup func(t *testing.T, w io.Writer, cfg Config) http.Handler
+	// EnableDefaultPrometheusMetrics creates a middleware writing events to w
+	// and enables prometheus metrics with the default registerer.
+	EnableDefaultPrometheusMetrics func(w io.Writer)
+}
+
+// TestCase is a request to a conformance route and the event it generates.
+type TestCase struct {
+	Name          string
+	ExpectedEvent *auditevent.AuditEvent
+	Method        string
+	Headers       map[string]string
+}
+
+// TestCases returns the requests made by the conformance suite.
+func TestCases() []TestCase {
+	return []TestCase{
+		{
+			"user request succeeds",
+			expectedEvent("MyEventType", auditevent.OutcomeSucceeded, "user-ozz", "sub-ozz", "/ok", nil),
+			http.MethodGet,
+			nil,
+		},
+		{
+			"user request denied with unregistered event type and unknown user",
+			expectedEvent("GET:/denied", auditevent.OutcomeDenied, "Unknown", "Unknown", "/denied", nil),
+			http.MethodGet,
+			nil,
+		},
+		{
+			"user request denied with unregistered event type and known user",
+			expectedEvent("GET:/denied-user", auditevent.OutcomeDenied, "user-ozz", "sub-ozz", "/denied-user", nil),
+			http.MethodGet,
+			nil,
+		},
+		{
+			"user request fails with unregistered event type and known user from header",
+			expectedEvent("AlwaysBreaks", auditevent.OutcomeFailed, "user-ozz-from-header", "Unknown",
+				"/fails-with-user-header", nil),
+			http.MethodPost,
+			map[string]string{
+				"X-User-Id": "user-ozz-from-header",
+			},
+		},
+		{
+			"user request succeeds, enriched by context data",
+			expectedEvent("GET:/changes", auditevent.OutcomeSucceeded, "user-ozz", "sub-ozz", "/changes", &TestData),
+			http.MethodGet,
+			nil,
+		},
+		{
+			"user request denied, encriched by context data",
+			expectedEvent("GET:/changes/denied", auditevent.OutcomeDenied, "Unknown", "Unknown",
+				"/changes/denied", &TestData),
+			http.MethodGet,
+			nil,
+		},
+		{
+			"user request succeeds, context data added as wrong type",
+			expectedEvent("GET:/nodata", auditevent.OutcomeSucceeded, "user-ozz", "sub-ozz", "/nodata", nil),
+			http.MethodGet,
+			nil,
+		},
+		{
+			"user request to parameterized route matches the route's event type",
+			expectedEvent("GetServer", auditevent.OutcomeSucceeded, "user-ozz", "sub-ozz", "/servers/123", nil).
+				WithTarget(map[string]string{
+					"path": "/servers/123",
+					"id":   "123",
+				}),
+			http.MethodGet,
+			nil,
+		},
+	}
+}
+
+func expectedEvent(eventType, outcome, user, sub, path string, data *json.RawMessage) *auditevent.AuditEvent {
+	event := auditevent.NewAuditEvent(
+		eventType,
+		auditevent.EventSource{
+			Type:  "IP",
+			Value: "127.0.0.1",
+		},
+		outcome,
+		map[string]string{
+			"user": user,
+			"sub":  sub,
+		},
+		Component,
+	).WithTarget(map[string]string{
+		"path": path,
+	})
+
+	if data != nil {
+		event.WithData(data)
+	}
+
+	return event
+}
+
+// Run runs the conformance suite against the given harness.
+func Run(t *testing.T, h Harness) {
+	t.Helper()
+
+	t.Run("middleware", func(t *testing.T) {
+		t.Parallel()
+		testMiddleware(t, h)
+	})
+	t.Run("parallel calls to middleware", func(t *testing.T) {
+		t.Parallel()
+		testParallelCallsToMiddleware(t, h)
+	})
+	t.Run("can't register multiple times to same prometheus", func(t *testing.T) {
+		t.Parallel()
+		testCantRegisterMultipleTimesToSamePrometheus(t, h)
+	})
+	t.Run("custom outcome handler", func(t *testing.T) {
+		t.Parallel()
+		testMiddlewareWithCustomOutcomeHandler(t, h)
+	})
+	t.Run("custom subject handler", func(t *testing.T) {
+		t.Parallel()
+		testMiddlewareWithCustomSubjectHandler(t, h)
+	})
+	t.Run("fail closed", func(t *testing.T) {
+		t.Parallel()
+		testMiddlewareFailClosed(t, h)
+	})
+	t.Run("fail closed releases audited responses", func(t *testing.T) {
+		t.Parallel()
+		testMiddlewareFailClosedReleases(t, h)
+	})
+}
+
+// expectedStatus returns the status the conformance routes
+// respond with for the given outcome.
+func expectedStatus(outcome string) int {
+	switch outcome {
+	case auditevent.OutcomeDenied:
+		return http.StatusForbidden
+	case auditevent.OutcomeFailed:
+		return http.StatusInternalServerError
+	default:
+		return http.StatusOK
+	}
+}
+
+// serveAndDecode serves the test case's request and returns the event
+// it generated.
+func serveAndDecode(t *testing.T, h Harness, cfg Config, tc TestCase) *auditevent.AuditEvent {
+	t.Helper()
+
+	p := testtools.GetNamedPipe(t)
+
+	fdchan := testtools.SetPipeReader(t, p)
+
+	f, err := os.Open(p)
+	require.NoError(t, err)
+
+	// receive pipe reader file descriptor
+	pfd := <-fdchan
+	defer pfd.Close()
+
+	r := h.Setup(t, pfd, cfg)
+	w := httptest.NewRecorder()
+	req := httptest.NewRequest(tc.Method, tc.ExpectedEvent.Target["path"], http.NoBody)
+	for k, v := range tc.Headers {
+		req.Header.Set(k, v)
+	}
+	r.ServeHTTP(w, req)
+
+	// wait for the event to be written
+	gotEvent := &auditevent.AuditEvent{}
+	dec := json.NewDecoder(f)
+	decErr := dec.Decode(gotEvent)
+	require.NoError(t, decErr)
+
+	require.Equal(t, tc.ExpectedEvent.Type, gotEvent.Type, "type should match")
+	require.True(t, gotEvent.LoggedAt.Before(time.Now()), "logging time should be before now")
+	require.Equal(t, tc.ExpectedEvent.Source.Type, gotEvent.Source.Type, "source type should match")
+	require.Equal(t, tc.ExpectedEvent.Component, gotEvent.Component, "component should match")
+	require.Equal(t, tc.ExpectedEvent.Target, gotEvent.Target, "target should match")
+	require.Equal(t, tc.ExpectedEvent.Data, gotEvent.Data, "data should match")
+
+	return gotEvent
+}
+
+func testMiddleware(t *testing.T, h Harness) {
+	t.Helper()
+
+	for _, tc := range TestCases() {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			gotEvent := serveAndDecode(t, h, Config{}, tc)
+
+			require.Equal(t, tc.ExpectedEvent.Outcome, gotEvent.Outcome, "outcome should match")
+			require.Equal(t, tc.ExpectedEvent.Subjects, gotEvent.Subjects, "subjects should match")
+			require.NotEmpty(t, gotEvent.Metadata.AuditID, "audit id is not empty")
+		})
+	}
+}
+
+func testParallelCallsToMiddleware(t *testing.T, h Harness) {
+	t.Helper()
+
+	// Set up server with middleware
+	p := testtools.GetNamedPipe(t)
+	c := testtools.SetPipeReader(t, p)
+
+	// set up other end of pipe
+	f, err := os.OpenFile(p, os.O_RDONLY|os.O_APPEND, 0o600)
+	require.NoError(t, err)
+	defer f.Close()
+
+	// receive pipe reader file descriptor
+	pfd := <-c
+
+	pr := prometheus.NewRegistry()
+
+	r := h.Setup(t, pfd, Config{Registerer: pr})
+
+	tcs := TestCases()
+
+	// make a bunch of requests
+	// This is set to 8000 since for race testing there's a goroutine limit
+	// of 8128
+	nreqs := 8000
+	var wg sync.WaitGroup
+	for i := 0; i < nreqs; i++ {
+		wg.Add(1)
+		tc := tcs[i%len(tcs)]
+
+		go func(wg *sync.WaitGroup, method, path string, headers map[string]string) {
+			defer wg.Done()
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(method, path, http.NoBody)
+			for k, v := range headers {
+				req.Header.Set(k, v)
+			}
+			r.ServeHTTP(w, req)
+		}(&wg, tc.Method, tc.ExpectedEvent.Target["path"], tc.Headers)
+	}
+
+	// close pipe when all events are received
+	go func() {
+		wg.Wait()
+		pfd.Close()
+	}()
+
+	reader := bufio.NewReader(f)
+
+	var numlines int
+	// Read events from the pipe
+	for {
+		_, _, readErr := reader.ReadLine()
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+		numlines++
+	}
+
+	// verify we didn't loose audit logs
+	require.Equal(t, nreqs, numlines, "number of events should match")
+
+	gatheredmetrics, err := pr.Gather()
+	require.NoError(t, err)
+	require.Greater(t, len(gatheredmetrics), 0, "should have gathered metrics")
+
+	for _, m := range gatheredmetrics {
+		var buf strings.Builder
+		_, fmterr := expfmt.MetricFamilyToText(&buf, m)
+		require.NoError(t, fmterr)
+		str := buf.String()
+		var metricToCompare string
+
+		switch m.GetName() {
+		case metrics.EventsTotalMetricsName:
+			metricToCompare = fmt.Sprintf(`%s{component=%q} %d\n`, metrics.EventsTotalMetricsName, Component, numlines)
+		case metrics.ErrorsTotalMetricsName:
+			t.Errorf("unexpected error metric name: %s", m.GetName())
+		default:
+			t.Errorf("unexpected metric name: %s", m.GetName())
+		}
+
+		require.Regexp(t, regexp.MustCompile(metricToCompare), str)
+	}
+}
+
+func testCantRegisterMultipleTimesToSamePrometheus(t *testing.T, h Harness) {
+	t.Helper()
+
+	var buf strings.Builder
+	h.EnableDefaultPrometheusMetrics(&buf)
+
+	require.Panics(t, func() {
+		h.EnableDefaultPrometheusMetrics(&buf)
+	})
+}
+
+// Tests that the middleware generates events with a custom outcome handler.
+func testMiddlewareWithCustomOutcomeHandler(t *testing.T, h Harness) {
+	t.Helper()
+
+	for _, tc := range TestCases() {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			gotEvent := serveAndDecode(t, h, Config{Outcome: "custom"}, tc)
+
+			require.Equal(t, tc.ExpectedEvent.Subjects, gotEvent.Subjects, "subjects should match")
+
+			// This is the custom outcome we set above
+			require.Equal(t, "custom", gotEvent.Outcome, "outcome should match")
+		})
+	}
+}
+
+// Tests that the middleware generates events with a custom subject handler.
+func testMiddlewareWithCustomSubjectHandler(t *testing.T, h Harness) {
+	t.Helper()
+
+	customSubjects := map[string]string{"custom": "customvalue"}
+
+	for _, tc := range TestCases() {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			gotEvent := serveAndDecode(t, h, Config{Subjects: customSubjects}, tc)
+
+			require.Equal(t, tc.ExpectedEvent.Outcome, gotEvent.Outcome, "outcome should match")
+
+			// This is the custom subjects we set above
+			require.Equal(t, customSubjects, gotEvent.Subjects, "subjects should match")
+		})
+	}
+}
+
+// Tests that requests are rejected when their event can't be written.
+func testMiddlewareFailClosed(t *testing.T, h Harness) {
+	t.Helper()
+
+	for _, tc := range TestCases() {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			r := h.Setup(t, testtools.NewErrorWriter(), Config{FailurePolicy: auditcore.FailClosed})
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.Method, tc.ExpectedEvent.Target["path"], http.NoBody)
+			for k, v := range tc.Headers {
+				req.Header.Set(k, v)
+			}
+			r.ServeHTTP(w, req)
+
+			require.Equal(t, auditcore.RejectedStatus, w.Code, "request should be rejected")
+			require.Equal(t, http.StatusText(auditcore.RejectedStatus), w.Body.String(),
+				"handler's response should be discarded")
+		})
+	}
+}
+
+// Tests that responses are sent unchanged when their event is written.
+func testMiddlewareFailClosedReleases(t *testing.T, h Harness) {
+	t.Helper()
+
+	for _, tc := range TestCases() {
+		t.Run(tc.Name, func(t *testing.T) {
+			t.Parallel()
+
+			var buf strings.Builder
+			r := h.Setup(t, &buf, Config{FailurePolicy: auditcore.FailClosed})
+			w := httptest.NewRecorder()
+			req := httptest.NewRequest(tc.Method, tc.ExpectedEvent.Target["path"], http.NoBody)
+			for k, v := range tc.Headers {
+				req.Header.Set(k, v)
+			}
+			r.ServeHTTP(w, req)
+
+			require.Equal(t, expectedStatus(tc.ExpectedEvent.Outcome), w.Code, "status should match")
+			if w.Code == http.StatusOK {
+				require.Contains(t, w.Body.String(), `"ok"`, "body should match")
+			}
+
+			gotEvent := &auditevent.AuditEvent{}
+			require.NoError(t, json.Unmarshal([]byte(buf.String()), gotEvent))
+			require.Equal(t, tc.ExpectedEvent.Type, gotEvent.Type, "type should match")
+		})
+	}
+}
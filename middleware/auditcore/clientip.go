@@ -0,0 +1,136 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package auditcore
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// ErrInvalidTrustedProxy is returned when a trusted proxy is neither
+// a valid IP address nor a valid CIDR.
+var ErrInvalidTrustedProxy = errors.New("invalid trusted proxy")
+
+// These are the headers that trusted proxies use to report
+// the client's IP address, in order of preference.
+const (
+	ForwardedForHeader = "X-Forwarded-For"
+	RealIPHeader       = "X-Real-IP"
+)
+
+// TrustedProxies is a set of networks whose proxies are trusted to report
+// the client's IP address. This follows the logic used by gin. See
+// https://github.com/gin-gonic/gin/blob/457fabd7e14f36ca1b5f302f7247efeb4690e49c/context.go#L771
+type TrustedProxies struct {
+	nets []*net.IPNet
+}
+
+// ParseTrustedProxies parses the given IP addresses and CIDRs.
+func ParseTrustedProxies(proxies []string) (*TrustedProxies, error) {
+	tp := &TrustedProxies{nets: make([]*net.IPNet, 0, len(proxies))}
+
+	for _, p := range proxies {
+		if !strings.Contains(p, "/") {
+			ip := net.ParseIP(p)
+			if ip == nil {
+				return nil, fmt.Errorf("%w: %q", ErrInvalidTrustedProxy, p)
+			}
+
+			bits := net.IPv4len * 8
+			if ip.To4() == nil {
+				bits = net.IPv6len * 8
+			}
+
+			p = fmt.Sprintf("%s/%d", p, bits)
+		}
+
+		_, ipnet, err := net.ParseCIDR(p)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidTrustedProxy, err)
+		}
+
+		tp.nets = append(tp.nets, ipnet)
+	}
+
+	return tp, nil
+}
+
+// ClientIP returns the IP address of the client that made the request.
+// If the request comes from a trusted proxy, the X-Forwarded-For header is
+// walked from right to left, skipping trusted proxies, and the first
+// untrusted address is returned. X-Real-IP is used if there is no
+// X-Forwarded-For header. Otherwise, the remote address is returned.
+// A nil set doesn't trust any proxy.
+func (tp *TrustedProxies) ClientIP(r *http.Request) string {
+	remoteIP, _, err := net.SplitHostPort(strings.TrimSpace(r.RemoteAddr))
+	if err != nil {
+		remoteIP = strings.TrimSpace(r.RemoteAddr)
+	}
+
+	if !tp.trusts(net.ParseIP(remoteIP)) {
+		return remoteIP
+	}
+
+	if xff := r.Header.Get(ForwardedForHeader); xff != "" {
+		if ip, ok := tp.fromForwardedFor(xff); ok {
+			return ip
+		}
+
+		return remoteIP
+	}
+
+	if xri := strings.TrimSpace(r.Header.Get(RealIPHeader)); net.ParseIP(xri) != nil {
+		return xri
+	}
+
+	return remoteIP
+}
+
+func (tp *TrustedProxies) fromForwardedFor(header string) (string, bool) {
+	items := strings.Split(header, ",")
+	for i := len(items) - 1; i >= 0; i-- {
+		ipStr := strings.TrimSpace(items[i])
+
+		ip := net.ParseIP(ipStr)
+		if ip == nil {
+			return "", false
+		}
+
+		// The leftmost address is the client, even if it's trusted
+		if i == 0 || !tp.trusts(ip) {
+			return ipStr, true
+		}
+	}
+
+	return "", false
+}
+
+func (tp *TrustedProxies) trusts(ip net.IP) bool {
+	if tp == nil || ip == nil {
+		return false
+	}
+
+	for _, n := range tp.nets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,76 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package auditcore_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-toolbox/auditevent/middleware/auditcore"
+)
+
+func TestClientIP(t *testing.T) {
+	t.Parallel()
+
+	tp, err := auditcore.ParseTrustedProxies([]string{"10.0.0.0/8", "2001:db8::1"})
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		tp       *auditcore.TrustedProxies
+		remote   string
+		headers  map[string]string
+		expected string
+	}{
+		{"no trusted proxies", nil, "10.0.0.1:1234", map[string]string{auditcore.ForwardedForHeader: "192.0.2.1"}, "10.0.0.1"},
+		{"untrusted remote", tp, "192.0.2.9:1234", map[string]string{auditcore.ForwardedForHeader: "192.0.2.1"}, "192.0.2.9"},
+		{"forwarded for", tp, "10.0.0.1:1234", map[string]string{auditcore.ForwardedForHeader: "192.0.2.1"}, "192.0.2.1"},
+		{"forwarded for through trusted hops", tp, "10.0.0.1:1234",
+			map[string]string{auditcore.ForwardedForHeader: "192.0.2.1, 192.0.2.2, 10.0.0.2"}, "192.0.2.2"},
+		{"forwarded for only trusted hops", tp, "10.0.0.1:1234",
+			map[string]string{auditcore.ForwardedForHeader: "10.0.0.3, 10.0.0.2"}, "10.0.0.3"},
+		{"invalid forwarded for", tp, "10.0.0.1:1234", map[string]string{auditcore.ForwardedForHeader: "garbage"}, "10.0.0.1"},
+		{"real ip", tp, "10.0.0.1:1234", map[string]string{auditcore.RealIPHeader: "192.0.2.1"}, "192.0.2.1"},
+		{"ipv6 proxy", tp, "[2001:db8::1]:1234", map[string]string{auditcore.ForwardedForHeader: "192.0.2.1"}, "192.0.2.1"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+			req.RemoteAddr = tc.remote
+			for k, v := range tc.headers {
+				req.Header.Set(k, v)
+			}
+
+			require.Equal(t, tc.expected, tc.tp.ClientIP(req))
+		})
+	}
+}
+
+func TestParseTrustedProxiesInvalid(t *testing.T) {
+	t.Parallel()
+
+	_, err := auditcore.ParseTrustedProxies([]string{"10.0.0.0/8", "not-an-ip"})
+	require.ErrorIs(t, err, auditcore.ErrInvalidTrustedProxy)
+
+	_, err = auditcore.ParseTrustedProxies([]string{"10.0.0.0/99"})
+	require.ErrorIs(t, err, auditcore.ErrInvalidTrustedProxy)
+}
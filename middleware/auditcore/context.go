@@ -0,0 +1,95 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package auditcore
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+)
+
+type auditContextKey struct{}
+
+// auditValues holds the values handlers share with the middlewares that
+// keep them in a context.Context, e.g. net/http's and gRPC's. Unlike
+// context values, these are visible to the middleware after the handlers
+// return, which is what gin's and echo's contexts give us.
+type auditValues struct {
+	mu     sync.RWMutex
+	values map[string]any
+}
+
+// NewContext returns a context that audit values can be set in.
+// Nested middlewares share the values of the outermost one, so if ctx
+// already holds audit values, it's returned as is.
+func NewContext(ctx context.Context) context.Context {
+	if _, ok := ctx.Value(auditContextKey{}).(*auditValues); ok {
+		return ctx
+	}
+
+	return context.WithValue(ctx, auditContextKey{}, &auditValues{values: map[string]any{}})
+}
+
+// Set stores a value under the given key in the audit context.
+// It's a no-op if ctx wasn't returned by NewContext.
+func Set(ctx context.Context, key string, value any) {
+	av, ok := ctx.Value(auditContextKey{}).(*auditValues)
+	if !ok {
+		return
+	}
+
+	av.mu.Lock()
+	defer av.mu.Unlock()
+	av.values[key] = value
+}
+
+// Get returns the value stored under the given key in the audit context.
+func Get(ctx context.Context, key string) (any, bool) {
+	av, ok := ctx.Value(auditContextKey{}).(*auditValues)
+	if !ok {
+		return nil, false
+	}
+
+	av.mu.RLock()
+	defer av.mu.RUnlock()
+	v, ok := av.values[key]
+	return v, ok
+}
+
+// GetString returns the value stored under the given key in the audit
+// context as a string. If the value is missing or not a string, it
+// returns an empty string ("").
+func GetString(ctx context.Context, key string) string {
+	v, ok := Get(ctx, key)
+	if !ok {
+		return ""
+	}
+
+	s, _ := v.(string)
+	return s
+}
+
+// AuditDataFromContext returns the audit data stored in the audit context,
+// or nil if there is none or it isn't a *json.RawMessage.
+func AuditDataFromContext(ctx context.Context) *json.RawMessage {
+	v, ok := Get(ctx, AuditDataContextKey)
+	if !ok {
+		return nil
+	}
+
+	data, _ := v.(*json.RawMessage)
+	return data
+}
@@ -0,0 +1,71 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package auditcore_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-toolbox/auditevent/middleware/auditcore"
+)
+
+func TestContextValues(t *testing.T) {
+	t.Parallel()
+
+	ctx := auditcore.NewContext(context.Background())
+	auditcore.Set(ctx, "string", "value")
+	auditcore.Set(ctx, "int", 1)
+
+	v, ok := auditcore.Get(ctx, "int")
+	require.True(t, ok)
+	require.Equal(t, 1, v)
+	require.Equal(t, "value", auditcore.GetString(ctx, "string"))
+	require.Empty(t, auditcore.GetString(ctx, "int"), "values that aren't strings should be empty")
+	require.Empty(t, auditcore.GetString(ctx, "missing"))
+
+	// Nested middlewares share the values of the outermost one
+	nested := auditcore.NewContext(context.WithValue(ctx, struct{}{}, "other"))
+	auditcore.Set(nested, "nested", "value")
+	require.Equal(t, "value", auditcore.GetString(ctx, "nested"))
+}
+
+func TestContextValuesWithoutAuditContext(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+	auditcore.Set(ctx, "key", "value")
+
+	_, ok := auditcore.Get(ctx, "key")
+	require.False(t, ok, "values can't be set outside of an audit context")
+	require.Nil(t, auditcore.AuditDataFromContext(ctx))
+}
+
+func TestAuditDataFromContext(t *testing.T) {
+	t.Parallel()
+
+	ctx := auditcore.NewContext(context.Background())
+	require.Nil(t, auditcore.AuditDataFromContext(ctx))
+
+	auditcore.Set(ctx, auditcore.AuditDataContextKey, "not raw JSON")
+	require.Nil(t, auditcore.AuditDataFromContext(ctx), "data of the wrong type should be ignored")
+
+	data := json.RawMessage(`{"foo":"bar"}`)
+	auditcore.Set(ctx, auditcore.AuditDataContextKey, &data)
+	require.Equal(t, &data, auditcore.AuditDataFromContext(ctx))
+}
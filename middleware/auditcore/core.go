@@ -0,0 +1,355 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package auditcore holds the framework-agnostic logic shared by the audit
+middlewares: event type registration, event construction, audit data
+extraction and writing. Each HTTP middleware implements the small Adapter
+interface for its web framework and delegates the rest to a Core. The gRPC
+interceptors share the registry, the audit context and the writing.
+*/
+package auditcore
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+const (
+	// AuditDataContextKey is the request context key for additional audit data.
+	AuditDataContextKey = "audit.data"
+	// AuditIDContextKey is the request context key for the audit ID.
+	AuditIDContextKey = "audit.id"
+
+	// These context keys come from github.com/metal-toolbox/hollow-toolbox/ginjwt
+
+	// JWTUserContextKey is the request context key for the authenticated user.
+	JWTUserContextKey = "jwt.user"
+	// JWTSubjectContextKey is the request context key for the token's subject.
+	JWTSubjectContextKey = "jwt.subject"
+
+	// UserIDHeader is the header used as the user when there is none in the context.
+	UserIDHeader = "X-User-Id"
+	// UnknownSubject is used for subjects that couldn't be determined.
+	UnknownSubject = "Unknown"
+
+	// SourceTypeIP is the source type of events coming from HTTP requests.
+	SourceTypeIP = "IP"
+)
+
+// Adapter gives the core access to a single request and its response,
+// regardless of the web framework handling them.
+type Adapter interface {
+	// Request returns the HTTP request being audited.
+	Request() *http.Request
+	// Route returns the template of the route that matched the request,
+	// e.g. `/servers/:id`, or an empty string if no route matched.
+	Route() string
+	// PathParams returns the path parameters of the matched route.
+	PathParams() map[string]string
+	// Status returns the HTTP status of the response.
+	Status() int
+	// ClientIP returns the IP address of the client that made the request.
+	ClientIP() string
+	// Get returns the value stored in the request context under the given key.
+	Get(key string) (any, bool)
+	// Set stores a value in the request context under the given key.
+	Set(key string, value any)
+	// Outcome returns the outcome of the request, as determined by the
+	// middleware's outcome handler.
+	Outcome() string
+	// Subjects returns the subjects of the request, as determined by the
+	// middleware's subject handler.
+	Subjects() map[string]string
+	// HoldResponse holds back the response written from now on, until
+	// the returned holder releases or rejects it. See FailClosed.
+	HoldResponse() ResponseHolder
+}
+
+// Core builds and writes audit events for HTTP requests.
+type Core struct {
+	component      string
+	aew            *auditevent.EventWriter
+	eventTypes     EventTypes
+	trustedProxies *TrustedProxies
+	logger         logr.Logger
+
+	failurePolicy          FailurePolicy
+	methodPolicies         sync.Map
+	routePolicies          sync.Map
+	failClosedRouteMethods sync.Map
+}
+
+// New returns a new Core that writes events for the given
+// component to the given writer.
+func New(component string, aew *auditevent.EventWriter) *Core {
+	return &Core{
+		component: component,
+		aew:       aew,
+		logger:    logr.Discard(),
+	}
+}
+
+// WithLogger sets the logger used to report the errors writing events.
+// See FailurePolicy.
+func (c *Core) WithLogger(l logr.Logger) *Core {
+	c.logger = l
+	return c
+}
+
+// Component returns the component events are written for.
+func (c *Core) Component() string {
+	return c.component
+}
+
+// WithPrometheusMetrics enables prometheus metrics for the event writer
+// using the default prometheus registerer (prometheus.DefaultRegisterer).
+func (c *Core) WithPrometheusMetrics() *Core {
+	c.aew.WithPrometheusMetrics(c.component)
+	return c
+}
+
+// WithPrometheusMetricsForRegisterer enables prometheus metrics for the
+// event writer using the given prometheus registerer.
+func (c *Core) WithPrometheusMetricsForRegisterer(pr prometheus.Registerer) *Core {
+	c.aew.WithPrometheusMetricsForRegisterer(c.component, pr)
+	return c
+}
+
+// SetTrustedProxies sets the network addresses (in CIDR notation or single
+// IPs) of the proxies that are trusted to report the client's IP address
+// through the X-Forwarded-For and X-Real-IP headers. See ClientIP.
+func (c *Core) SetTrustedProxies(proxies []string) error {
+	tp, err := ParseTrustedProxies(proxies)
+	if err != nil {
+		return err
+	}
+
+	c.trustedProxies = tp
+
+	return nil
+}
+
+// HasTrustedProxies returns whether trusted proxies were set.
+func (c *Core) HasTrustedProxies() bool {
+	return c.trustedProxies != nil
+}
+
+// ClientIP returns the IP address of the client that made the request,
+// taking the trusted proxies into account.
+func (c *Core) ClientIP(r *http.Request) string {
+	return c.trustedProxies.ClientIP(r)
+}
+
+// RegisterEventType registers an audit event type for a given HTTP method and path.
+// The path is the template of a route, e.g. `/servers/:id`, so all the requests
+// matching the route share the event type.
+func (c *Core) RegisterEventType(eventType, httpMethod, path string) {
+	c.eventTypes.Register(eventType, keyFromHTTPMethodAndPath(httpMethod, path))
+}
+
+// EventType returns the event type for a request. If the preferred type
+// isn't empty, it is used. Otherwise, the pre-registered type for the
+// method and path is used (see RegisterEventType). If there is none,
+// the event type is the HTTP method and path.
+func (c *Core) EventType(preferredType, httpMethod, path string) string {
+	if preferredType != "" {
+		return preferredType
+	}
+
+	return c.eventTypes.Lookup(keyFromHTTPMethodAndPath(httpMethod, path))
+}
+
+// EventTypes is a registry of audit event types, keyed by what identifies
+// a kind of request, e.g. its HTTP method and route, or its gRPC method.
+// The zero value is ready to use.
+type EventTypes struct {
+	m sync.Map
+}
+
+// Register registers an audit event type for the given key.
+func (t *EventTypes) Register(eventType, key string) {
+	t.m.Store(key, eventType)
+}
+
+// Lookup returns the event type registered for the given key,
+// or the key itself if there is none.
+func (t *EventTypes) Lookup(key string) string {
+	rawEventType, ok := t.m.Load(key)
+	if ok {
+		etype, castok := rawEventType.(string)
+		if castok {
+			return etype
+		}
+	}
+	return key
+}
+
+// Audit audits a single request. It sets a new audit ID in the request
+// context, calls next to process the request and then writes an event
+// describing it. The event type is determined as in EventType, using the
+// template of the matched route as the path. If no route matched, the
+// request's path is used. Errors writing the event are handled according
+// to the request's failure policy, and returned.
+func (c *Core) Audit(a Adapter, preferredType string, next func()) error {
+	r := a.Request()
+	method := r.Method
+	path := r.URL.Path
+
+	auditID := uuid.New().String()
+	a.Set(AuditIDContextKey, auditID)
+
+	var holder ResponseHolder
+	if c.mayFailClosed(method) {
+		holder = a.HoldResponse()
+	}
+
+	// We audit after the request has been processed
+	next()
+
+	route := a.Route()
+	if route == "" {
+		route = path
+	}
+
+	event := c.NewEvent(a, auditID, c.EventType(preferredType, method, route), path)
+
+	// persist event
+	err := c.Write(event)
+	c.handleWriteError(c.FailurePolicy(method, route), holder, event, err)
+
+	return err
+}
+
+// NewEvent returns an event for a processed request. Its target is the
+// request's path along with the path parameters of the matched route,
+// each under its own key. It's enriched with the audit data that was set
+// in the request context, if any.
+func (c *Core) NewEvent(a Adapter, auditID, eventType, path string) *auditevent.AuditEvent {
+	target := map[string]string{}
+	for k, v := range a.PathParams() {
+		target[k] = v
+	}
+	// The path can't be overridden by a parameter
+	target["path"] = path
+
+	event := auditevent.NewAuditEventWithID(
+		auditID,
+		eventType,
+		auditevent.EventSource{
+			Type:  SourceTypeIP,
+			Value: a.ClientIP(),
+		},
+		a.Outcome(),
+		a.Subjects(),
+		c.component,
+	).WithTarget(target)
+
+	if data := AuditData(a); data != nil {
+		event.WithData(data)
+	}
+
+	return event
+}
+
+// Write persists the given event.
+func (c *Core) Write(event *auditevent.AuditEvent) error {
+	return c.aew.Write(event)
+}
+
+// AuditData returns the audit data stored in the request context, or nil
+// if there is none or it isn't a *json.RawMessage.
+func AuditData(a Adapter) *json.RawMessage {
+	data, ok := a.Get(AuditDataContextKey)
+	if !ok {
+		return nil
+	}
+
+	ed, ok := data.(*json.RawMessage)
+	if !ok {
+		return nil
+	}
+
+	return ed
+}
+
+// DefaultOutcome returns `failed` for HTTP response statuses 500 and
+// above, `denied` for statuses 400 and above and `succeeded` otherwise.
+func DefaultOutcome(a Adapter) string {
+	return OutcomeFromStatus(a.Status())
+}
+
+// OutcomeFromStatus maps an HTTP response status to an outcome.
+// See DefaultOutcome.
+func OutcomeFromStatus(status int) string {
+	if status >= http.StatusBadRequest && status < http.StatusInternalServerError {
+		return auditevent.OutcomeDenied
+	}
+	if status >= http.StatusInternalServerError {
+		return auditevent.OutcomeFailed
+	}
+	return auditevent.OutcomeSucceeded
+}
+
+// DefaultSubjects returns the user and subject of the request. These are
+// taken from the JWT context keys; the user falls back to the X-User-Id
+// header. Subjects that can't be determined are "Unknown".
+func DefaultSubjects(a Adapter) map[string]string {
+	sub := getString(a, JWTSubjectContextKey)
+	if sub == "" {
+		sub = UnknownSubject
+	}
+
+	user := getString(a, JWTUserContextKey)
+	if user == "" {
+		user = a.Request().Header.Get(UserIDHeader)
+		if user == "" {
+			user = UnknownSubject
+		}
+	}
+
+	return map[string]string{
+		"user": user,
+		"sub":  sub,
+	}
+}
+
+// getString returns a context value as a string. If the value is
+// missing or not a string, it returns an empty string ("").
+func getString(a Adapter, key string) string {
+	v, ok := a.Get(key)
+	if !ok {
+		return ""
+	}
+
+	if s, ok := v.(string); ok {
+		return s
+	}
+
+	return ""
+}
+
+func keyFromHTTPMethodAndPath(method, path string) string {
+	return fmt.Sprintf("%s:%s", method, path)
+}
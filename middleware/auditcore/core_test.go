@@ -0,0 +1,388 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package auditcore_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-toolbox/auditevent"
+	"github.com/metal-toolbox/auditevent/middleware/auditcore"
+)
+
+// fakeAdapter is a framework-less Adapter backed by a map.
+type fakeAdapter struct {
+	req    *http.Request
+	route  string
+	params map[string]string
+	status int
+	values map[string]any
+	holder *fakeHolder
+}
+
+// fakeHolder records what happened to the held back response.
+type fakeHolder struct {
+	released       bool
+	rejectedStatus int
+}
+
+func (h *fakeHolder) Release()          { h.released = true }
+func (h *fakeHolder) Reject(status int) { h.rejectedStatus = status }
+
+func newFakeAdapter(req *http.Request) *fakeAdapter {
+	return &fakeAdapter{req: req, status: http.StatusOK, values: map[string]any{}}
+}
+
+func (a *fakeAdapter) Request() *http.Request { return a.req }
+func (a *fakeAdapter) Route() string          { return a.route }
+func (a *fakeAdapter) Status() int            { return a.status }
+
+func (a *fakeAdapter) PathParams() map[string]string { return a.params }
+func (a *fakeAdapter) ClientIP() string              { return "127.0.0.1" }
+
+func (a *fakeAdapter) Get(key string) (any, bool) {
+	v, ok := a.values[key]
+	return v, ok
+}
+
+func (a *fakeAdapter) Set(key string, value any) { a.values[key] = value }
+func (a *fakeAdapter) HoldResponse() auditcore.ResponseHolder {
+	a.holder = &fakeHolder{}
+	return a.holder
+}
+
+func (a *fakeAdapter) Outcome() string { return auditcore.DefaultOutcome(a) }
+
+func (a *fakeAdapter) Subjects() map[string]string { return auditcore.DefaultSubjects(a) }
+
+func TestEventType(t *testing.T) {
+	t.Parallel()
+
+	c := auditcore.New("test", auditevent.NewDefaultAuditEventWriter(&bytes.Buffer{}))
+	c.RegisterEventType("Registered", http.MethodGet, "/registered")
+
+	require.Equal(t, "Preferred", c.EventType("Preferred", http.MethodGet, "/registered"))
+	require.Equal(t, "Registered", c.EventType("", http.MethodGet, "/registered"))
+	require.Equal(t, "POST:/registered", c.EventType("", http.MethodPost, "/registered"))
+}
+
+func TestEventTypes(t *testing.T) {
+	t.Parallel()
+
+	var types auditcore.EventTypes
+	types.Register("Registered", "/pkg.Service/Registered")
+
+	require.Equal(t, "Registered", types.Lookup("/pkg.Service/Registered"))
+	require.Equal(t, "/pkg.Service/Other", types.Lookup("/pkg.Service/Other"))
+}
+
+func TestOutcomeFromStatus(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, auditevent.OutcomeSucceeded, auditcore.OutcomeFromStatus(http.StatusOK))
+	require.Equal(t, auditevent.OutcomeSucceeded, auditcore.OutcomeFromStatus(http.StatusFound))
+	require.Equal(t, auditevent.OutcomeDenied, auditcore.OutcomeFromStatus(http.StatusUnauthorized))
+	require.Equal(t, auditevent.OutcomeFailed, auditcore.OutcomeFromStatus(http.StatusBadGateway))
+}
+
+func TestAudit(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	c := auditcore.New("test", auditevent.NewDefaultAuditEventWriter(&buf))
+
+	req := httptest.NewRequest(http.MethodPut, "/things", http.NoBody)
+	req.Header.Set(auditcore.UserIDHeader, "user-from-header")
+	a := newFakeAdapter(req)
+
+	data := json.RawMessage(`{"foo":"bar"}`)
+	err := c.Audit(a, "", func() {
+		a.Set(auditcore.JWTSubjectContextKey, "sub-ozz")
+		a.Set(auditcore.AuditDataContextKey, &data)
+		a.status = http.StatusForbidden
+	})
+	require.NoError(t, err)
+
+	auditID, ok := a.Get(auditcore.AuditIDContextKey)
+	require.True(t, ok, "audit id should be set in the context")
+
+	gotEvent := &auditevent.AuditEvent{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), gotEvent))
+
+	require.Equal(t, auditID, gotEvent.Metadata.AuditID, "audit id should match")
+	require.Equal(t, "PUT:/things", gotEvent.Type, "type should match")
+	require.Equal(t, auditevent.EventSource{Type: "IP", Value: "127.0.0.1"}, gotEvent.Source, "source should match")
+	require.Equal(t, auditevent.OutcomeDenied, gotEvent.Outcome, "outcome should match")
+	require.Equal(t, map[string]string{"user": "user-from-header", "sub": "sub-ozz"}, gotEvent.Subjects,
+		"subjects should match")
+	require.Equal(t, "test", gotEvent.Component, "component should match")
+	require.Equal(t, map[string]string{"path": "/things"}, gotEvent.Target, "target should match")
+	require.Equal(t, &data, gotEvent.Data, "data should match")
+}
+
+func TestAuditWithRoute(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	c := auditcore.New("test", auditevent.NewDefaultAuditEventWriter(&buf))
+
+	a := newFakeAdapter(httptest.NewRequest(http.MethodGet, "/servers/123/power", http.NoBody))
+	a.route = "/servers/:id/power"
+	a.params = map[string]string{"id": "123", "path": "not-the-path"}
+
+	require.NoError(t, c.Audit(a, "", func() {}))
+
+	gotEvent := &auditevent.AuditEvent{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), gotEvent))
+
+	require.Equal(t, "GET:/servers/:id/power", gotEvent.Type, "type should use the route")
+	require.Equal(t, map[string]string{"path": "/servers/123/power", "id": "123"}, gotEvent.Target,
+		"target should have the path and parameters")
+}
+
+func TestAuditDataOfWrongType(t *testing.T) {
+	t.Parallel()
+
+	a := newFakeAdapter(httptest.NewRequest(http.MethodGet, "/", http.NoBody))
+	require.Nil(t, auditcore.AuditData(a))
+
+	a.Set(auditcore.AuditDataContextKey, "some random string")
+	require.Nil(t, auditcore.AuditData(a))
+}
+
+// errorWriter is a writer that always fails.
+type errorWriter struct{}
+
+func (errorWriter) Write([]byte) (int, error) {
+	return 0, errors.New("boom") //nolint:err113 // test
+}
+
+func TestFailurePolicy(t *testing.T) {
+	t.Parallel()
+
+	c := auditcore.New("test", auditevent.NewDefaultAuditEventWriter(&bytes.Buffer{}))
+	require.Equal(t, auditcore.IgnoreFailures, c.FailurePolicy(http.MethodGet, "/foo"), "default should ignore")
+
+	c.SetFailurePolicy(auditcore.LogFailures)
+	c.SetFailurePolicyForMethod(http.MethodPost, auditcore.FailClosed)
+	c.SetFailurePolicyForRoute(http.MethodPost, "/foo/:id", auditcore.IgnoreFailures)
+	c.SetFailurePolicyForRoute(http.MethodGet, "/bar", auditcore.FailClosed)
+
+	require.Equal(t, auditcore.LogFailures, c.FailurePolicy(http.MethodGet, "/foo"))
+	require.Equal(t, auditcore.FailClosed, c.FailurePolicy(http.MethodPost, "/foo"))
+	require.Equal(t, auditcore.IgnoreFailures, c.FailurePolicy(http.MethodPost, "/foo/:id"))
+	require.Equal(t, auditcore.FailClosed, c.FailurePolicy(http.MethodGet, "/bar"))
+}
+
+func TestAuditFailurePolicies(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name           string
+		setup          func(c *auditcore.Core)
+		method         string
+		expectHeld     bool
+		expectRejected bool
+		expectLogged   bool
+	}{
+		{
+			"ignored",
+			func(*auditcore.Core) {},
+			http.MethodPost, false, false, false,
+		},
+		{
+			"logged",
+			func(c *auditcore.Core) { c.SetFailurePolicy(auditcore.LogFailures) },
+			http.MethodPost, false, false, true,
+		},
+		{
+			"fail closed",
+			func(c *auditcore.Core) { c.SetFailurePolicy(auditcore.FailClosed) },
+			http.MethodPost, true, true, true,
+		},
+		{
+			"fail closed for the method",
+			func(c *auditcore.Core) { c.SetFailurePolicyForMethod(http.MethodPost, auditcore.FailClosed) },
+			http.MethodPost, true, true, true,
+		},
+		{
+			"fail closed for another method",
+			func(c *auditcore.Core) { c.SetFailurePolicyForMethod(http.MethodPost, auditcore.FailClosed) },
+			http.MethodGet, false, false, false,
+		},
+		{
+			"fail closed for the route",
+			func(c *auditcore.Core) {
+				c.SetFailurePolicyForRoute(http.MethodPost, "/servers/:id", auditcore.FailClosed)
+			},
+			http.MethodPost, true, true, true,
+		},
+		{
+			"fail closed for another route",
+			func(c *auditcore.Core) {
+				c.SetFailurePolicyForRoute(http.MethodPost, "/servers", auditcore.FailClosed)
+			},
+			http.MethodPost, true, false, false,
+		},
+		{
+			"route overrides fail closed method",
+			func(c *auditcore.Core) {
+				c.SetFailurePolicyForMethod(http.MethodPost, auditcore.FailClosed)
+				c.SetFailurePolicyForRoute(http.MethodPost, "/servers/:id", auditcore.IgnoreFailures)
+			},
+			http.MethodPost, true, false, false,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var logged bool
+			logger := funcr.New(func(_, _ string) { logged = true }, funcr.Options{})
+
+			c := auditcore.New("test", auditevent.NewDefaultAuditEventWriter(errorWriter{})).WithLogger(logger)
+			tc.setup(c)
+
+			a := newFakeAdapter(httptest.NewRequest(tc.method, "/servers/123", http.NoBody))
+			a.route = "/servers/:id"
+
+			err := c.Audit(a, "", func() {})
+			require.Error(t, err)
+			require.Equal(t, tc.expectLogged, logged, "logging should match")
+
+			if !tc.expectHeld {
+				require.Nil(t, a.holder, "response shouldn't be held")
+				return
+			}
+
+			require.NotNil(t, a.holder, "response should be held")
+			if tc.expectRejected {
+				require.Equal(t, auditcore.RejectedStatus, a.holder.rejectedStatus, "response should be rejected")
+				require.False(t, a.holder.released, "response shouldn't be released")
+			} else {
+				require.True(t, a.holder.released, "response should be released")
+			}
+		})
+	}
+}
+
+func TestAuditFailClosedReleasesWrittenEvents(t *testing.T) {
+	t.Parallel()
+
+	c := auditcore.New("test", auditevent.NewDefaultAuditEventWriter(&bytes.Buffer{}))
+	c.SetFailurePolicy(auditcore.FailClosed)
+
+	a := newFakeAdapter(httptest.NewRequest(http.MethodPost, "/servers", http.NoBody))
+	require.NoError(t, c.Audit(a, "", func() {}))
+	require.True(t, a.holder.released, "response should be released")
+}
+
+func TestWriteWithPolicy(t *testing.T) {
+	t.Parallel()
+
+	for _, policy := range []auditcore.FailurePolicy{
+		auditcore.IgnoreFailures,
+		auditcore.LogFailures,
+		auditcore.FailClosed,
+	} {
+		var logged bool
+		logger := funcr.New(func(_, _ string) { logged = true }, funcr.Options{})
+
+		c := auditcore.New("test", auditevent.NewDefaultAuditEventWriter(errorWriter{})).WithLogger(logger)
+		err := c.WriteWithPolicy(policy, auditevent.NewAuditEvent("", auditevent.EventSource{}, "", nil, "test"))
+
+		require.Equal(t, policy != auditcore.IgnoreFailures, logged, policy.String())
+		if policy == auditcore.FailClosed {
+			require.Error(t, err, "the error should be returned to reject the request")
+		} else {
+			require.NoError(t, err, policy.String())
+		}
+	}
+}
+
+func TestFailClosedWithAsyncWriter(t *testing.T) {
+	t.Parallel()
+
+	newCore := func(policy auditevent.OverflowPolicy) *auditcore.Core {
+		w := auditevent.NewDefaultAuditEventWriter(&bytes.Buffer{}).WithAsync(1, policy)
+		t.Cleanup(func() { w.Close(context.Background()) })
+		return auditcore.New("test", w)
+	}
+
+	// Writes to these return once the event is queued
+	for _, policy := range []auditevent.OverflowPolicy{
+		auditevent.OverflowBlock,
+		auditevent.OverflowDropNewest,
+		auditevent.OverflowDropOldest,
+	} {
+		c := newCore(policy)
+		require.PanicsWithValue(t, auditcore.ErrFailClosedWithAsyncWriter, func() {
+			c.SetFailurePolicy(auditcore.FailClosed)
+		}, policy.String())
+		require.PanicsWithValue(t, auditcore.ErrFailClosedWithAsyncWriter, func() {
+			c.SetFailurePolicyForMethod(http.MethodPost, auditcore.FailClosed)
+		}, policy.String())
+		require.PanicsWithValue(t, auditcore.ErrFailClosedWithAsyncWriter, func() {
+			c.SetFailurePolicyForRoute(http.MethodPost, "/servers", auditcore.FailClosed)
+		}, policy.String())
+		require.NotPanics(t, func() { c.SetFailurePolicy(auditcore.LogFailures) }, policy.String())
+	}
+
+	require.NotPanics(t, func() {
+		newCore(auditevent.OverflowFailClosed).SetFailurePolicy(auditcore.FailClosed)
+	})
+}
+
+func TestFailClosedRejectsRequestsWhenTheQueueIsFull(t *testing.T) {
+	t.Parallel()
+
+	// The worker blocks on the first event until the reader is closed
+	pr, pw := io.Pipe()
+	w := auditevent.NewDefaultAuditEventWriter(pw).WithAsync(1, auditevent.OverflowFailClosed)
+	t.Cleanup(func() {
+		pr.Close()
+		w.Close(context.Background())
+	})
+
+	c := auditcore.New("test", w)
+	c.SetFailurePolicy(auditcore.FailClosed)
+
+	// One event is being written and another is queued, so the third
+	// doesn't fit
+	var rejected *fakeAdapter
+	for range 3 {
+		a := newFakeAdapter(httptest.NewRequest(http.MethodPost, "/servers", http.NoBody))
+		if err := c.Audit(a, "", func() {}); err != nil {
+			require.ErrorIs(t, err, auditevent.ErrQueueFull)
+			rejected = a
+			break
+		}
+		require.True(t, a.holder.released, "queued events should release the response")
+	}
+
+	require.NotNil(t, rejected, "a request should be rejected once the queue is full")
+	require.Equal(t, auditcore.RejectedStatus, rejected.holder.rejectedStatus)
+}
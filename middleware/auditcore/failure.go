@@ -0,0 +1,192 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package auditcore
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+// FailurePolicy determines what happens to a request whose audit
+// event can't be written.
+type FailurePolicy int
+
+const (
+	// IgnoreFailures drops the error. This is the default policy.
+	IgnoreFailures FailurePolicy = iota
+	// LogFailures logs the error through the core's logger.
+	LogFailures
+	// FailClosed holds the response back until the audit event is
+	// written. If writing fails, the response is discarded and the
+	// client gets a 503 (Service Unavailable) instead, or the
+	// Unavailable code for gRPC calls. The error is also logged. While
+	// the response is held back, flushing it is a no-op and hijacking
+	// the connection isn't supported.
+	//
+	// An asynchronous writer returns as soon as the event is queued, so
+	// it's only allowed with the auditevent.OverflowFailClosed policy,
+	// which rejects the requests whose event doesn't fit in the queue.
+	// Errors encoding queued events are only returned by its Flush.
+	FailClosed
+)
+
+// ErrFailClosedWithAsyncWriter is the panic value of setting the FailClosed
+// policy on a core whose writer is asynchronous and doesn't use the
+// auditevent.OverflowFailClosed policy. Its writes never fail, so the
+// requests would proceed without an audit trail.
+var ErrFailClosedWithAsyncWriter = errors.New(
+	"auditcore: FailClosed needs a synchronous writer or the OverflowFailClosed overflow policy")
+
+// RejectedStatus is the HTTP status of the requests rejected by
+// the FailClosed policy.
+const RejectedStatus = http.StatusServiceUnavailable
+
+func (p FailurePolicy) String() string {
+	switch p {
+	case IgnoreFailures:
+		return "ignore"
+	case LogFailures:
+		return "log"
+	case FailClosed:
+		return "fail-closed"
+	default:
+		return fmt.Sprintf("FailurePolicy(%d)", int(p))
+	}
+}
+
+// ResponseHolder holds a response back until the audit event of its
+// request is written.
+type ResponseHolder interface {
+	// Release sends the held back response.
+	Release()
+	// Reject discards the held back response, including its headers,
+	// and responds with the given status instead.
+	Reject(status int)
+}
+
+// SetFailurePolicy sets the failure policy of the requests
+// without a more specific one. See FailClosed for the writers
+// it may be used with; this panics with any other.
+func (c *Core) SetFailurePolicy(p FailurePolicy) {
+	c.checkFailurePolicy(p)
+	c.failurePolicy = p
+}
+
+// SetFailurePolicyForMethod sets the failure policy of the requests with the
+// given HTTP method. It takes precedence over the policy set by SetFailurePolicy.
+// It panics as SetFailurePolicy does.
+func (c *Core) SetFailurePolicyForMethod(httpMethod string, p FailurePolicy) {
+	c.checkFailurePolicy(p)
+	c.methodPolicies.Store(httpMethod, p)
+}
+
+// SetFailurePolicyForRoute sets the failure policy of the requests to the given
+// HTTP method and route template (see RegisterEventType). It takes precedence
+// over the policies set by SetFailurePolicy and SetFailurePolicyForMethod.
+// It panics as SetFailurePolicy does.
+func (c *Core) SetFailurePolicyForRoute(httpMethod, path string, p FailurePolicy) {
+	c.checkFailurePolicy(p)
+	c.routePolicies.Store(keyFromHTTPMethodAndPath(httpMethod, path), p)
+	if p == FailClosed {
+		c.failClosedRouteMethods.Store(httpMethod, true)
+	}
+}
+
+// checkFailurePolicy panics if the policy can't be enforced with the
+// core's writer. See ErrFailClosedWithAsyncWriter.
+func (c *Core) checkFailurePolicy(p FailurePolicy) {
+	if p != FailClosed {
+		return
+	}
+
+	if policy, async := c.aew.AsyncPolicy(); async && policy != auditevent.OverflowFailClosed {
+		panic(ErrFailClosedWithAsyncWriter)
+	}
+}
+
+// FailurePolicy returns the failure policy of a request to the given HTTP
+// method and route template.
+func (c *Core) FailurePolicy(httpMethod, route string) FailurePolicy {
+	if p, ok := c.routePolicies.Load(keyFromHTTPMethodAndPath(httpMethod, route)); ok {
+		if policy, castok := p.(FailurePolicy); castok {
+			return policy
+		}
+	}
+
+	if p, ok := c.methodPolicies.Load(httpMethod); ok {
+		if policy, castok := p.(FailurePolicy); castok {
+			return policy
+		}
+	}
+
+	return c.failurePolicy
+}
+
+// mayFailClosed returns whether requests with the given HTTP method may be
+// subject to the FailClosed policy. The route of a request isn't known until
+// it's processed, so this errs on the side of holding its response back.
+func (c *Core) mayFailClosed(httpMethod string) bool {
+	if _, ok := c.failClosedRouteMethods.Load(httpMethod); ok {
+		return true
+	}
+
+	if p, ok := c.methodPolicies.Load(httpMethod); ok {
+		return p == FailClosed
+	}
+
+	return c.failurePolicy == FailClosed
+}
+
+// handleWriteError applies the failure policy of a request
+// to the result of writing its audit event.
+func (c *Core) handleWriteError(policy FailurePolicy, holder ResponseHolder, event *auditevent.AuditEvent, err error) {
+	if err != nil && policy != IgnoreFailures {
+		c.logger.Error(err, "failed to write audit event",
+			"audit_id", event.Metadata.AuditID,
+			"type", event.Type,
+			"policy", policy.String(),
+		)
+	}
+
+	if holder == nil {
+		return
+	}
+
+	if err != nil && policy == FailClosed {
+		holder.Reject(RejectedStatus)
+		return
+	}
+
+	holder.Release()
+}
+
+// WriteWithPolicy writes the audit event of a request that isn't audited
+// through Audit, e.g. a gRPC call, and handles the error according to the
+// given failure policy. The error is only returned under FailClosed, for
+// the caller to reject the request.
+func (c *Core) WriteWithPolicy(policy FailurePolicy, event *auditevent.AuditEvent) error {
+	err := c.Write(event)
+	c.handleWriteError(policy, nil, event, err)
+
+	if policy != FailClosed {
+		return nil
+	}
+
+	return err
+}
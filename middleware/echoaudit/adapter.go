@@ -0,0 +1,86 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package echoaudit
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/metal-toolbox/auditevent/middleware/auditcore"
+)
+
+// adapter exposes an echo context to the audit core.
+type adapter struct {
+	c echo.Context
+	m *Middleware
+}
+
+var _ auditcore.Adapter = (*adapter)(nil)
+
+func (a *adapter) Request() *http.Request {
+	return a.c.Request()
+}
+
+func (a *adapter) Route() string {
+	return a.c.Path()
+}
+
+func (a *adapter) PathParams() map[string]string {
+	names := a.c.ParamNames()
+	values := a.c.ParamValues()
+
+	params := make(map[string]string, len(names))
+	for i, name := range names {
+		if i < len(values) {
+			params[name] = values[i]
+		}
+	}
+	return params
+}
+
+func (a *adapter) Status() int {
+	return a.c.Response().Status
+}
+
+func (a *adapter) ClientIP() string {
+	if a.m.core.HasTrustedProxies() {
+		return a.m.core.ClientIP(a.c.Request())
+	}
+
+	return a.c.RealIP()
+}
+
+func (a *adapter) Get(key string) (any, bool) {
+	v := a.c.Get(key)
+	return v, v != nil
+}
+
+func (a *adapter) Set(key string, value any) {
+	a.c.Set(key, value)
+}
+
+func (a *adapter) HoldResponse() auditcore.ResponseHolder {
+	return holdResponse(a.c)
+}
+
+func (a *adapter) Outcome() string {
+	return a.m.outcomeHandler(a.c)
+}
+
+func (a *adapter) Subjects() map[string]string {
+	return a.m.subjectHandler(a.c)
+}
@@ -0,0 +1,107 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package echoaudit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+
+	"github.com/metal-toolbox/auditevent/middleware/auditcore"
+)
+
+// heldWriter is an http.ResponseWriter that holds the response back
+// until its audit event is written. See auditcore.FailClosed.
+// It replaces the writer of the echo response, which keeps track
+// of the status on its own.
+type heldWriter struct {
+	resp   *echo.Response
+	orig   http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+var _ auditcore.ResponseHolder = (*heldWriter)(nil)
+
+func holdResponse(c echo.Context) *heldWriter {
+	resp := c.Response()
+	w := &heldWriter{
+		resp: resp,
+		orig: resp.Writer,
+	}
+	resp.Writer = w
+
+	return w
+}
+
+func (w *heldWriter) Header() http.Header {
+	return w.orig.Header()
+}
+
+func (w *heldWriter) WriteHeader(code int) {
+	if w.status == 0 {
+		w.status = code
+	}
+}
+
+func (w *heldWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	return w.body.Write(b)
+}
+
+// Flush is a no-op, as the response is held back.
+func (w *heldWriter) Flush() {}
+
+// Hijack isn't supported, as the response is held back.
+func (w *heldWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return nil, nil, fmt.Errorf("hijacking a held back response: %w", http.ErrNotSupported)
+}
+
+func (w *heldWriter) Release() {
+	w.resp.Writer = w.orig
+
+	if w.status != 0 {
+		w.orig.WriteHeader(w.status)
+	}
+
+	if w.body.Len() > 0 {
+		//nolint:errcheck // the client is gone, there's nothing left to do
+		w.orig.Write(w.body.Bytes())
+	}
+}
+
+func (w *heldWriter) Reject(status int) {
+	w.resp.Writer = w.orig
+
+	h := w.orig.Header()
+	for k := range h {
+		delete(h, k)
+	}
+
+	h.Set(echo.HeaderContentType, echo.MIMETextPlainCharsetUTF8)
+	w.resp.Status = status
+	w.resp.Committed = true
+	w.orig.WriteHeader(status)
+	//nolint:errcheck // the client is gone, there's nothing left to do
+	w.orig.Write([]byte(http.StatusText(status)))
+}
@@ -16,30 +16,26 @@ limitations under the License.
 package echoaudit
 
 import (
-	"encoding/json"
-	"fmt"
 	"io"
-	"sync"
 
-	"github.com/google/uuid"
+	"github.com/go-logr/logr"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/prometheus/client_golang/prometheus"
 
 	"github.com/metal-toolbox/auditevent"
+	"github.com/metal-toolbox/auditevent/middleware/auditcore"
 )
 
 const (
 	// AuditDataContextKey is the context key for additional audit data.
-	AuditDataContextKey = "audit.data"
+	AuditDataContextKey = auditcore.AuditDataContextKey
 	// AuditIDContextKey is the context key for the audit ID.
-	AuditIDContextKey = "audit.id"
+	AuditIDContextKey = auditcore.AuditIDContextKey
 )
 
 type Middleware struct {
-	component      string
-	aew            *auditevent.EventWriter
-	eventTypeMap   sync.Map
+	core           *auditcore.Core
 	outcomeHandler OutcomeHandler
 	subjectHandler SubjectHandler
 }
@@ -47,8 +43,7 @@ type Middleware struct {
 // NewMiddleware returns a new instance of audit Middleware.
 func NewMiddleware(component string, aew *auditevent.EventWriter) *Middleware {
 	return &Middleware{
-		component:      component,
-		aew:            aew,
+		core:           auditcore.New(component, aew),
 		outcomeHandler: GetOutcomeDefault,
 		subjectHandler: GetSubjectDefault,
 	}
@@ -65,14 +60,14 @@ func NewJSONMiddleware(component string, w io.Writer) *Middleware {
 // WithPrometheusMetrics enables prometheus metrics for this middleware instance
 // using the default prometheus registerer (prometheus.DefaultRegisterer).
 func (m *Middleware) WithPrometheusMetrics() *Middleware {
-	m.aew.WithPrometheusMetrics(m.component)
+	m.core.WithPrometheusMetrics()
 	return m
 }
 
 // WithPrometheusMetricsForRegisterer enables prometheus metrics for this middleware instance
 // using the default prometheus registerer (prometheus.DefaultRegisterer).
 func (m *Middleware) WithPrometheusMetricsForRegisterer(pr prometheus.Registerer) *Middleware {
-	m.aew.WithPrometheusMetricsForRegisterer(m.component, pr)
+	m.core.WithPrometheusMetricsForRegisterer(pr)
 	return m
 }
 
@@ -86,9 +81,46 @@ func (m *Middleware) WithSubjectHandler(handler SubjectHandler) *Middleware {
 	return m
 }
 
+// SetTrustedProxies sets the IP addresses or CIDRs of the proxies that
+// are trusted to report the client's IP address through the
+// X-Forwarded-For and X-Real-IP headers, like gin's engine does.
+// When no trusted proxies are set, echo's `RealIP` is used.
+func (m *Middleware) SetTrustedProxies(proxies []string) error {
+	return m.core.SetTrustedProxies(proxies)
+}
+
+// WithLogger sets the logger used to report the errors writing events.
+// See WithFailurePolicy.
+func (m *Middleware) WithLogger(l logr.Logger) *Middleware {
+	m.core.WithLogger(l)
+	return m
+}
+
+// WithFailurePolicy sets what happens to requests whose audit event can't
+// be written, unless a policy is set for their method or route. By default,
+// errors are ignored (auditcore.IgnoreFailures). See auditcore.FailurePolicy.
+func (m *Middleware) WithFailurePolicy(p auditcore.FailurePolicy) *Middleware {
+	m.core.SetFailurePolicy(p)
+	return m
+}
+
+// SetFailurePolicyForMethod sets the failure policy for the requests with the
+// given HTTP method, e.g. auditcore.FailClosed for the methods that change state.
+func (m *Middleware) SetFailurePolicyForMethod(httpMethod string, p auditcore.FailurePolicy) {
+	m.core.SetFailurePolicyForMethod(httpMethod, p)
+}
+
+// SetFailurePolicyForRoute sets the failure policy for the requests to the given
+// HTTP method and path. The path is a route template, as in RegisterEventType.
+// It takes precedence over the policy of the method.
+func (m *Middleware) SetFailurePolicyForRoute(httpMethod, path string, p auditcore.FailurePolicy) {
+	m.core.SetFailurePolicyForRoute(httpMethod, path, p)
+}
+
 // RegisterEventType registers an audit event type for a given HTTP method and path.
+// The path is the template of the route, e.g. `/servers/:id`, as in echo's route definition.
 func (m *Middleware) RegisterEventType(eventType, httpMethod, path string) {
-	m.eventTypeMap.Store(keyFromHTTPMethodAndPath(httpMethod, path), eventType)
+	m.core.RegisterEventType(eventType, httpMethod, path)
 }
 
 // Audit returns a echo middleware that will audit the request.
@@ -122,71 +154,14 @@ func (m *Middleware) AuditWithTypeAndSkipper(t string, skipper middleware.Skippe
 				return next(c)
 			}
 
-			method := c.Request().Method
-			path := c.Request().URL.Path
-
-			auditID := uuid.New().String()
-			c.Set(AuditIDContextKey, auditID)
-
-			// We audit after the request has been processed
-			if err := next(c); err != nil {
-				c.Error(err)
-			}
-
-			event := auditevent.NewAuditEventWithID(
-				auditID,
-				m.getEventType(t, method, path),
-				auditevent.EventSource{
-					Type: "IP",
-					// TODO we should implement logic like exists in gin for trusted proxies
-					// https://github.com/gin-gonic/gin/blob/457fabd7e14f36ca1b5f302f7247efeb4690e49c/context.go#L771
-					Value: c.RealIP(),
-				},
-				m.outcomeHandler(c),
-				m.subjectHandler(c),
-				m.component,
-			).WithTarget(map[string]string{
-				"path": path,
-			})
-
-			if data := c.Get(AuditDataContextKey); data != nil {
-				ed, ok := data.(*json.RawMessage)
-				if ok {
-					event.WithData(ed)
+			//nolint:errcheck // errors are handled by the failure policy
+			m.core.Audit(&adapter{c: c, m: m}, t, func() {
+				if err := next(c); err != nil {
+					c.Error(err)
 				}
-			}
-
-			// persist event
-			m.write(event)
+			})
 
 			return nil
 		}
 	}
 }
-
-func (m *Middleware) getEventType(preferredType, httpMethod, path string) string {
-	if preferredType != "" {
-		return preferredType
-	}
-
-	key := keyFromHTTPMethodAndPath(httpMethod, path)
-	rawEventType, ok := m.eventTypeMap.Load(key)
-	if ok {
-		etype, castok := rawEventType.(string)
-		if castok {
-			return etype
-		}
-	}
-	return key
-}
-
-// This function is wrapped to allow for easy testing and
-// easy replacement in case we run into concurrency issues.
-func (m *Middleware) write(event *auditevent.AuditEvent) {
-	//nolint:errcheck // TODO: We should come back to this and log the error
-	m.aew.Write(event)
-}
-
-func keyFromHTTPMethodAndPath(method, path string) string {
-	return fmt.Sprintf("%s:%s", method, path)
-}
@@ -16,11 +16,9 @@ limitations under the License.
 package echoaudit
 
 import (
-	"net/http"
-
 	"github.com/labstack/echo/v4"
 
-	"github.com/metal-toolbox/auditevent"
+	"github.com/metal-toolbox/auditevent/middleware/auditcore"
 )
 
 // OutcomeHandler is a function that returns the AuditEvent outcome
@@ -35,12 +33,5 @@ type OutcomeHandler func(c echo.Context) string
 // statuses 500 and above, `denied` for requests 400 and above and
 // `succeeded` otherwise.
 func GetOutcomeDefault(c echo.Context) string {
-	status := c.Response().Status
-	if status >= http.StatusBadRequest && status < http.StatusInternalServerError {
-		return auditevent.OutcomeDenied
-	}
-	if status >= http.StatusInternalServerError {
-		return auditevent.OutcomeFailed
-	}
-	return auditevent.OutcomeSucceeded
+	return auditcore.OutcomeFromStatus(c.Response().Status)
 }
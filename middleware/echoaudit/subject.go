@@ -17,31 +17,17 @@ package echoaudit
 
 import (
 	"github.com/labstack/echo/v4"
+
+	"github.com/metal-toolbox/auditevent/middleware/auditcore"
 )
 
 // SubjectHandler is a function that returns the AuditEvent subject map
 // for a given request. This will be called after other middleware; e.g.
-// the given gin context should already contain the subject information.
+// the given echo context should already contain the subject information.
 type SubjectHandler func(c echo.Context) map[string]string
 
+// GetSubjectDefault is the default subject handler that's set in the
+// middleware constructor. See auditcore.DefaultSubjects.
 func GetSubjectDefault(c echo.Context) map[string]string {
-	// These context keys come from github.com/metal-toolbox/hollow-toolbox/ginjwt
-	// TODO - these need to come from echo speciffic middlwares
-	sub := getString(c, "jwt.subject")
-	if sub == "" {
-		sub = "Unknown"
-	}
-
-	user := getString(c, "jwt.user")
-	if user == "" {
-		user = c.Request().Header.Get("X-User-Id")
-		if user == "" {
-			user = "Unknown"
-		}
-	}
-
-	return map[string]string{
-		"user": user,
-		"sub":  sub,
-	}
+	return auditcore.DefaultSubjects(&adapter{c: c})
 }
@@ -0,0 +1,240 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+/*
+Package grpcaudit provides gRPC server interceptors that write an audit
+event for every call they intercept.
+*/
+package grpcaudit
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"github.com/prometheus/client_golang/prometheus"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+
+	"github.com/metal-toolbox/auditevent"
+	"github.com/metal-toolbox/auditevent/middleware/auditcore"
+)
+
+const (
+	// AuditDataContextKey is the audit context key for additional audit data.
+	AuditDataContextKey = auditcore.AuditDataContextKey
+	// AuditIDContextKey is the audit context key for the audit ID.
+	AuditIDContextKey = auditcore.AuditIDContextKey
+)
+
+// grpcHTTPMethod is the HTTP method of every gRPC call. The failure
+// policies of gRPC methods are kept as those of routes with it.
+const grpcHTTPMethod = http.MethodPost
+
+type Interceptor struct {
+	core           *auditcore.Core
+	eventTypes     auditcore.EventTypes
+	outcomeHandler OutcomeHandler
+	subjectHandler SubjectHandler
+}
+
+// NewInterceptor returns a new instance of audit Interceptor.
+func NewInterceptor(component string, aew *auditevent.EventWriter) *Interceptor {
+	return &Interceptor{
+		core:           auditcore.New(component, aew),
+		outcomeHandler: GetOutcomeDefault,
+		subjectHandler: GetSubjectDefault,
+	}
+}
+
+// NewJSONInterceptor returns a new interceptor instance with a default JSON writer.
+func NewJSONInterceptor(component string, w io.Writer) *Interceptor {
+	return NewInterceptor(
+		component,
+		auditevent.NewDefaultAuditEventWriter(w),
+	)
+}
+
+// WithPrometheusMetrics enables prometheus metrics for this interceptor instance
+// using the default prometheus registerer (prometheus.DefaultRegisterer).
+func (i *Interceptor) WithPrometheusMetrics() *Interceptor {
+	i.core.WithPrometheusMetrics()
+	return i
+}
+
+// WithPrometheusMetricsForRegisterer enables prometheus metrics for this interceptor instance
+// using the given prometheus registerer.
+func (i *Interceptor) WithPrometheusMetricsForRegisterer(pr prometheus.Registerer) *Interceptor {
+	i.core.WithPrometheusMetricsForRegisterer(pr)
+	return i
+}
+
+// WithLogger sets the logger used to report the errors writing events.
+// See WithFailurePolicy.
+func (i *Interceptor) WithLogger(l logr.Logger) *Interceptor {
+	i.core.WithLogger(l)
+	return i
+}
+
+// WithFailurePolicy sets what happens to calls whose audit event can't
+// be written, unless a more specific policy is set for them. By default,
+// errors are ignored (auditcore.IgnoreFailures). Under auditcore.FailClosed,
+// the call fails with the Unavailable code instead; the messages a
+// streaming call already sent can't be taken back, though.
+func (i *Interceptor) WithFailurePolicy(p auditcore.FailurePolicy) *Interceptor {
+	i.core.SetFailurePolicy(p)
+	return i
+}
+
+// SetFailurePolicyForMethod sets the failure policy for the calls to the
+// given full gRPC method name, e.g. `/package.Service/Method`.
+func (i *Interceptor) SetFailurePolicyForMethod(fullMethod string, p auditcore.FailurePolicy) {
+	i.core.SetFailurePolicyForRoute(grpcHTTPMethod, fullMethod, p)
+}
+
+func (i *Interceptor) WithOutcomeHandler(handler OutcomeHandler) *Interceptor {
+	i.outcomeHandler = handler
+	return i
+}
+
+func (i *Interceptor) WithSubjectHandler(handler SubjectHandler) *Interceptor {
+	i.subjectHandler = handler
+	return i
+}
+
+// RegisterEventType registers an audit event type for a given full gRPC
+// method name, e.g. `/package.Service/Method`.
+func (i *Interceptor) RegisterEventType(eventType, fullMethod string) {
+	i.eventTypes.Register(eventType, fullMethod)
+}
+
+// UnaryServerInterceptor returns a gRPC interceptor that will audit unary calls.
+// This uses the pre-registered type for the event (see RegisterEventType).
+// If no type is registered, the event type is the full method name.
+func (i *Interceptor) UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(
+		ctx context.Context,
+		req any,
+		info *grpc.UnaryServerInfo,
+		handler grpc.UnaryHandler,
+	) (any, error) {
+		ctx = auditcore.NewContext(ctx)
+		auditID := uuid.New().String()
+		auditcore.Set(ctx, AuditIDContextKey, auditID)
+
+		// We audit after the call has been processed
+		resp, err := handler(ctx, req)
+
+		if werr := i.write(ctx, auditID, info.FullMethod, err); werr != nil {
+			return nil, werr
+		}
+
+		return resp, err
+	}
+}
+
+// StreamServerInterceptor returns a gRPC interceptor that will audit
+// streaming calls once the stream is finished. The event type is
+// determined as in UnaryServerInterceptor.
+func (i *Interceptor) StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(
+		srv any,
+		ss grpc.ServerStream,
+		info *grpc.StreamServerInfo,
+		handler grpc.StreamHandler,
+	) error {
+		ctx := auditcore.NewContext(ss.Context())
+		auditID := uuid.New().String()
+		auditcore.Set(ctx, AuditIDContextKey, auditID)
+
+		// We audit after the stream has been processed
+		err := handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+
+		if werr := i.write(ctx, auditID, info.FullMethod, err); werr != nil {
+			return werr
+		}
+
+		return err
+	}
+}
+
+// write writes the event of a call, and returns the status the call
+// fails with if it can't be written under the FailClosed policy.
+func (i *Interceptor) write(ctx context.Context, auditID, fullMethod string, err error) error {
+	event := i.newEvent(ctx, auditID, fullMethod, err)
+	policy := i.core.FailurePolicy(grpcHTTPMethod, fullMethod)
+
+	if werr := i.core.WriteWithPolicy(policy, event); werr != nil {
+		return status.Error(codes.Unavailable, "the call couldn't be audited")
+	}
+
+	return nil
+}
+
+func (i *Interceptor) newEvent(ctx context.Context, auditID, fullMethod string, err error) *auditevent.AuditEvent {
+	event := auditevent.NewAuditEventWithID(
+		auditID,
+		i.eventTypes.Lookup(fullMethod),
+		auditevent.EventSource{
+			Type:  auditcore.SourceTypeIP,
+			Value: peerIP(ctx),
+		},
+		i.outcomeHandler(ctx, fullMethod, err),
+		i.subjectHandler(ctx),
+		i.core.Component(),
+	).WithTarget(map[string]string{
+		"method": fullMethod,
+	})
+
+	if data := auditcore.AuditDataFromContext(ctx); data != nil {
+		event.WithData(data)
+	}
+
+	return event
+}
+
+// peerIP returns the IP address of the caller, or the whole
+// address if it has no port (e.g. unix sockets).
+func peerIP(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok || p.Addr == nil {
+		return auditcore.UnknownSubject
+	}
+
+	addr := p.Addr.String()
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return addr
+	}
+
+	return host
+}
+
+// serverStream overrides the context of a stream with the audit context.
+type serverStream struct {
+	grpc.ServerStream
+	//nolint:containedctx // the stream's context can only be replaced this way
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
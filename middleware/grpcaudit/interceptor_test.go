@@ -0,0 +1,386 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grpcaudit_test
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/json"
+	"errors"
+	"io"
+	"net"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/go-logr/logr/funcr"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+
+	"github.com/metal-toolbox/auditevent"
+	"github.com/metal-toolbox/auditevent/middleware/auditcore"
+	"github.com/metal-toolbox/auditevent/middleware/grpcaudit"
+)
+
+const (
+	comp = "test"
+
+	unaryMethod  = "/test.Audit/Unary"
+	streamMethod = "/test.Audit/Stream"
+)
+
+var testData = json.RawMessage(`{"foo":"bar"}`)
+
+// The requests' value tells the handlers which status code to return.
+func handle(ctx context.Context, in *wrapperspb.StringValue) error {
+	grpcaudit.SetAuditData(ctx, &testData)
+
+	switch in.GetValue() {
+	case "denied":
+		return status.Error(codes.PermissionDenied, "denied")
+	case "failed":
+		return status.Error(codes.Internal, "failed")
+	case "jwt":
+		grpcaudit.Set(ctx, "jwt.user", "user-ozz")
+		grpcaudit.Set(ctx, "jwt.subject", "sub-ozz")
+	}
+
+	return nil
+}
+
+// serviceDesc describes a service without the need for generated code.
+var serviceDesc = grpc.ServiceDesc{
+	ServiceName: "test.Audit",
+	HandlerType: (*any)(nil),
+	Methods: []grpc.MethodDesc{
+		{
+			MethodName: "Unary",
+			Handler: func(_ any, ctx context.Context, dec func(any) error, itc grpc.UnaryServerInterceptor) (any, error) {
+				in := &wrapperspb.StringValue{}
+				if err := dec(in); err != nil {
+					return nil, err
+				}
+
+				h := func(ctx context.Context, req any) (any, error) {
+					//nolint:forcetypeassert // test
+					return in, handle(ctx, req.(*wrapperspb.StringValue))
+				}
+
+				return itc(ctx, in, &grpc.UnaryServerInfo{FullMethod: unaryMethod}, h)
+			},
+		},
+	},
+	Streams: []grpc.StreamDesc{
+		{
+			StreamName: "Stream",
+			Handler: func(_ any, stream grpc.ServerStream) error {
+				in := &wrapperspb.StringValue{}
+				if err := stream.RecvMsg(in); err != nil {
+					return err
+				}
+
+				if err := handle(stream.Context(), in); err != nil {
+					return err
+				}
+
+				return stream.SendMsg(in)
+			},
+			ServerStreams: true,
+			ClientStreams: true,
+		},
+	},
+}
+
+// lockedBuffer is a buffer that can be written by the server
+// and read by the test.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) events(t *testing.T) []*auditevent.AuditEvent {
+	t.Helper()
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	var events []*auditevent.AuditEvent
+	dec := json.NewDecoder(&b.buf)
+	for {
+		event := &auditevent.AuditEvent{}
+		err := dec.Decode(event)
+		if errors.Is(err, io.EOF) {
+			return events
+		}
+		require.NoError(t, err)
+		events = append(events, event)
+	}
+}
+
+func setFixtures(t *testing.T) (*grpc.ClientConn, *lockedBuffer) {
+	t.Helper()
+
+	buf := &lockedBuffer{}
+	itc := grpcaudit.NewJSONInterceptor(comp, buf)
+	itc.RegisterEventType("UnaryCall", unaryMethod)
+
+	return serve(t, itc), buf
+}
+
+// serve serves the test service behind the interceptor,
+// and returns a client connection to it.
+func serve(t *testing.T, itc *grpcaudit.Interceptor) *grpc.ClientConn {
+	t.Helper()
+
+	lis := bufconn.Listen(1024 * 1024)
+	srv := grpc.NewServer(
+		grpc.UnaryInterceptor(itc.UnaryServerInterceptor()),
+		grpc.StreamInterceptor(itc.StreamServerInterceptor()),
+	)
+	srv.RegisterService(&serviceDesc, nil)
+
+	go srv.Serve(lis) //nolint:errcheck // test
+	t.Cleanup(srv.Stop)
+
+	conn, err := grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { conn.Close() })
+
+	return conn
+}
+
+func callStream(ctx context.Context, conn *grpc.ClientConn, value string) error {
+	stream, err := conn.NewStream(ctx, &serviceDesc.Streams[0], streamMethod)
+	if err != nil {
+		return err
+	}
+
+	if err := stream.SendMsg(wrapperspb.String(value)); err != nil {
+		return err
+	}
+
+	if err := stream.CloseSend(); err != nil {
+		return err
+	}
+
+	// Drain the stream until the server returns
+	for {
+		out := &wrapperspb.StringValue{}
+		if err := stream.RecvMsg(out); err != nil {
+			if errors.Is(err, io.EOF) {
+				return nil
+			}
+			return err
+		}
+	}
+}
+
+func callUnary(ctx context.Context, conn *grpc.ClientConn, value string) error {
+	return conn.Invoke(ctx, unaryMethod, wrapperspb.String(value), &wrapperspb.StringValue{})
+}
+
+func TestInterceptors(t *testing.T) {
+	t.Parallel()
+
+	calls := []struct {
+		name string
+		call func(context.Context, *grpc.ClientConn, string) error
+		typ  string
+	}{
+		{"unary", callUnary, "UnaryCall"},
+		{"stream", callStream, streamMethod},
+	}
+
+	tests := []struct {
+		name             string
+		value            string
+		md               metadata.MD
+		expectedOutcome  string
+		expectedSubjects map[string]string
+	}{
+		{
+			"succeeds with unknown subjects",
+			"ok",
+			nil,
+			auditevent.OutcomeSucceeded,
+			map[string]string{"user": "Unknown", "sub": "Unknown"},
+		},
+		{
+			"succeeds with subjects from the audit context",
+			"jwt",
+			nil,
+			auditevent.OutcomeSucceeded,
+			map[string]string{"user": "user-ozz", "sub": "sub-ozz"},
+		},
+		{
+			"denied with user from metadata",
+			"denied",
+			metadata.Pairs("x-user-id", "user-ozz-from-md"),
+			auditevent.OutcomeDenied,
+			map[string]string{"user": "user-ozz-from-md", "sub": "Unknown"},
+		},
+		{
+			"fails",
+			"failed",
+			nil,
+			auditevent.OutcomeFailed,
+			map[string]string{"user": "Unknown", "sub": "Unknown"},
+		},
+	}
+
+	for _, c := range calls {
+		for _, tc := range tests {
+			t.Run(c.name+" "+tc.name, func(t *testing.T) {
+				t.Parallel()
+
+				conn, buf := setFixtures(t)
+
+				ctx := context.Background()
+				if tc.md != nil {
+					ctx = metadata.NewOutgoingContext(ctx, tc.md)
+				}
+
+				err := c.call(ctx, conn, tc.value)
+				if tc.expectedOutcome == auditevent.OutcomeSucceeded {
+					require.NoError(t, err)
+				} else {
+					require.Error(t, err)
+				}
+
+				events := buf.events(t)
+				require.Len(t, events, 1, "a single event should be written")
+
+				gotEvent := events[0]
+				require.Equal(t, c.typ, gotEvent.Type, "type should match")
+				require.Equal(t, "IP", gotEvent.Source.Type, "source type should match")
+				require.Equal(t, tc.expectedOutcome, gotEvent.Outcome, "outcome should match")
+				require.Equal(t, tc.expectedSubjects, gotEvent.Subjects, "subjects should match")
+				require.Equal(t, comp, gotEvent.Component, "component should match")
+				require.Equal(t, &testData, gotEvent.Data, "data should match")
+				require.NotEmpty(t, gotEvent.Metadata.AuditID, "audit id is not empty")
+			})
+		}
+	}
+}
+
+// errorWriter is a writer that always fails.
+type errorWriter struct{}
+
+func (errorWriter) Write([]byte) (int, error) {
+	return 0, errors.New("boom") //nolint:err113 // test
+}
+
+func TestInterceptorsFailurePolicy(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		setup        func(itc *grpcaudit.Interceptor)
+		unaryCode    codes.Code
+		streamCode   codes.Code
+		expectLogged bool
+	}{
+		{
+			"ignored",
+			func(*grpcaudit.Interceptor) {},
+			codes.OK, codes.OK, false,
+		},
+		{
+			"logged",
+			func(itc *grpcaudit.Interceptor) { itc.WithFailurePolicy(auditcore.LogFailures) },
+			codes.OK, codes.OK, true,
+		},
+		{
+			"fail closed",
+			func(itc *grpcaudit.Interceptor) { itc.WithFailurePolicy(auditcore.FailClosed) },
+			codes.Unavailable, codes.Unavailable, true,
+		},
+		{
+			"fail closed for the method",
+			func(itc *grpcaudit.Interceptor) { itc.SetFailurePolicyForMethod(unaryMethod, auditcore.FailClosed) },
+			codes.Unavailable, codes.OK, true,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			t.Parallel()
+
+			var logged atomic.Bool
+			logger := funcr.New(func(_, _ string) { logged.Store(true) }, funcr.Options{})
+
+			itc := grpcaudit.NewJSONInterceptor(comp, errorWriter{}).WithLogger(logger)
+			tc.setup(itc)
+			conn := serve(t, itc)
+
+			err := callUnary(context.Background(), conn, "ok")
+			require.Equal(t, tc.unaryCode, status.Code(err), "unary code should match")
+
+			err = callStream(context.Background(), conn, "ok")
+			require.Equal(t, tc.streamCode, status.Code(err), "stream code should match")
+
+			require.Equal(t, tc.expectLogged, logged.Load(), "logging should match")
+		})
+	}
+}
+
+func TestOutcomeFromCode(t *testing.T) {
+	t.Parallel()
+
+	require.Equal(t, auditevent.OutcomeSucceeded, grpcaudit.OutcomeFromCode(codes.OK))
+	require.Equal(t, auditevent.OutcomeDenied, grpcaudit.OutcomeFromCode(codes.Unauthenticated))
+	require.Equal(t, auditevent.OutcomeDenied, grpcaudit.OutcomeFromCode(codes.NotFound))
+	require.Equal(t, auditevent.OutcomeFailed, grpcaudit.OutcomeFromCode(codes.Unavailable))
+	require.Equal(t, auditevent.OutcomeFailed, grpcaudit.OutcomeFromCode(codes.Unknown))
+}
+
+func TestSubjectFromPeerCertificate(t *testing.T) {
+	t.Parallel()
+
+	cert := &x509.Certificate{Subject: pkix.Name{CommonName: "my-service"}}
+	ctx := peer.NewContext(context.Background(), &peer.Peer{
+		AuthInfo: credentials.TLSInfo{
+			State: tls.ConnectionState{
+				PeerCertificates: []*x509.Certificate{cert},
+				VerifiedChains:   [][]*x509.Certificate{{cert}},
+			},
+		},
+	})
+
+	require.Equal(t, map[string]string{"user": "Unknown", "sub": "my-service"}, grpcaudit.GetSubjectDefault(ctx))
+}
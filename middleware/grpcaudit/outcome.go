@@ -0,0 +1,63 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grpcaudit
+
+import (
+	"context"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+// OutcomeHandler is a function that returns the AuditEvent outcome
+// for a given call. This will be called after the handler has
+// processed the call, with the error it returned.
+// It is recommended to return one of the samples defined in
+// `samples.go`.
+type OutcomeHandler func(ctx context.Context, fullMethod string, err error) string
+
+// GetOutcomeDefault is the default outcome handler that's set in
+// the interceptor constructor. See OutcomeFromCode.
+func GetOutcomeDefault(_ context.Context, _ string, err error) string {
+	return OutcomeFromCode(status.Code(err))
+}
+
+// OutcomeFromCode maps a gRPC status code to an outcome. Like the HTTP
+// middlewares, it returns `succeeded` for OK, `denied` for codes caused
+// by the client (those mapped to 4xx HTTP statuses) and `failed` for
+// any other code.
+func OutcomeFromCode(code codes.Code) string {
+	//nolint:exhaustive // the rest of the codes are failures
+	switch code {
+	case codes.OK:
+		return auditevent.OutcomeSucceeded
+	case codes.Canceled,
+		codes.InvalidArgument,
+		codes.NotFound,
+		codes.AlreadyExists,
+		codes.PermissionDenied,
+		codes.ResourceExhausted,
+		codes.FailedPrecondition,
+		codes.Aborted,
+		codes.OutOfRange,
+		codes.Unauthenticated:
+		return auditevent.OutcomeDenied
+	default:
+		return auditevent.OutcomeFailed
+	}
+}
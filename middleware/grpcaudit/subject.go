@@ -0,0 +1,91 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package grpcaudit
+
+import (
+	"context"
+	"strings"
+
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+
+	"github.com/metal-toolbox/auditevent/middleware/auditcore"
+)
+
+// SubjectHandler is a function that returns the AuditEvent subject map
+// for a given call. This will be called after other interceptors; e.g.
+// the given context should already contain the subject information.
+type SubjectHandler func(ctx context.Context) map[string]string
+
+// GetSubjectDefault is the default subject handler that's set in the
+// interceptor constructor.
+//
+// The `sub` subject is taken from the `jwt.subject` audit context key
+// (see Set). If it's missing, the common name of the verified TLS client
+// certificate of the peer is used.
+//
+// The `user` subject is taken from the `jwt.user` audit context key.
+// If it's missing, the `x-user-id` metadata is used.
+//
+// Subjects that can't be determined are "Unknown".
+func GetSubjectDefault(ctx context.Context) map[string]string {
+	sub := GetString(ctx, auditcore.JWTSubjectContextKey)
+	if sub == "" {
+		sub = peerCommonName(ctx)
+		if sub == "" {
+			sub = auditcore.UnknownSubject
+		}
+	}
+
+	user := GetString(ctx, auditcore.JWTUserContextKey)
+	if user == "" {
+		user = firstMetadataValue(ctx, strings.ToLower(auditcore.UserIDHeader))
+		if user == "" {
+			user = auditcore.UnknownSubject
+		}
+	}
+
+	return map[string]string{
+		"user": user,
+		"sub":  sub,
+	}
+}
+
+func firstMetadataValue(ctx context.Context, key string) string {
+	vals := metadata.ValueFromIncomingContext(ctx, key)
+	if len(vals) == 0 {
+		return ""
+	}
+
+	return vals[0]
+}
+
+// peerCommonName returns the subject common name of the peer's verified
+// TLS client certificate, or an empty string if there is none.
+func peerCommonName(ctx context.Context) string {
+	p, ok := peer.FromContext(ctx)
+	if !ok {
+		return ""
+	}
+
+	tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo)
+	if !ok || len(tlsInfo.State.VerifiedChains) == 0 || len(tlsInfo.State.VerifiedChains[0]) == 0 {
+		return ""
+	}
+
+	return tlsInfo.State.VerifiedChains[0][0].Subject.CommonName
+}
@@ -0,0 +1,92 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package httpaudit
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/metal-toolbox/auditevent/middleware/auditcore"
+)
+
+// adapter exposes a net/http request and its response to the audit core.
+type adapter struct {
+	w *ResponseWriter
+	r *http.Request
+	m *Middleware
+}
+
+var _ auditcore.Adapter = (*adapter)(nil)
+
+func (a *adapter) Request() *http.Request {
+	return a.r
+}
+
+// Route returns the template of the route that matched the request,
+// as returned by the middleware's route handler.
+func (a *adapter) Route() string {
+	return a.m.routeHandler(a.r)
+}
+
+// PathParams returns the values of the parameters of the route template,
+// e.g. `{id}`. Regular expressions, e.g. `{id:[0-9]+}`, aren't part of
+// their names.
+func (a *adapter) PathParams() map[string]string {
+	params := map[string]string{}
+	for _, seg := range strings.Split(a.Route(), "/") {
+		if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") {
+			continue
+		}
+
+		name := strings.TrimSuffix(strings.Trim(seg, "{}"), "...")
+		name, _, _ = strings.Cut(name, ":")
+		if name == "$" {
+			continue
+		}
+
+		params[name] = a.r.PathValue(name)
+	}
+	return params
+}
+
+func (a *adapter) Status() int {
+	return a.w.Status()
+}
+
+func (a *adapter) ClientIP() string {
+	return a.m.core.ClientIP(a.r)
+}
+
+func (a *adapter) Get(key string) (any, bool) {
+	return Get(a.r.Context(), key)
+}
+
+func (a *adapter) Set(key string, value any) {
+	Set(a.r.Context(), key, value)
+}
+
+func (a *adapter) HoldResponse() auditcore.ResponseHolder {
+	a.w.hold()
+	return a.w
+}
+
+func (a *adapter) Outcome() string {
+	return a.m.outcomeHandler(a.w, a.r)
+}
+
+func (a *adapter) Subjects() map[string]string {
+	return a.m.subjectHandler(a.r)
+}
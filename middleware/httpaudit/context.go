@@ -0,0 +1,57 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package httpaudit
+
+import (
+	"context"
+	"encoding/json"
+
+	"github.com/metal-toolbox/auditevent/middleware/auditcore"
+)
+
+// Set stores a value under the given key in the audit context of a
+// request. This is how handlers pass the subject information and the
+// audit data to the middleware, e.g. `Set(r.Context(), "jwt.user", user)`.
+// It's a no-op if the request isn't being audited.
+func Set(ctx context.Context, key string, value any) {
+	auditcore.Set(ctx, key, value)
+}
+
+// Get returns the value stored under the given key in the audit
+// context of a request.
+func Get(ctx context.Context, key string) (any, bool) {
+	return auditcore.Get(ctx, key)
+}
+
+// GetString returns the value stored under the given key in the audit
+// context of a request as a string. If the value is missing or not a
+// string, it returns an empty string ("").
+func GetString(ctx context.Context, key string) string {
+	return auditcore.GetString(ctx, key)
+}
+
+// AuditID returns the audit ID of the request, or an empty string if
+// the request isn't being audited.
+func AuditID(ctx context.Context) string {
+	return GetString(ctx, AuditIDContextKey)
+}
+
+// SetAuditData adds additional data to the audit event of the request.
+// This can be leveraged to enrich the audit events with diff information
+// or other data for forensic analysis.
+func SetAuditData(ctx context.Context, data *json.RawMessage) {
+	Set(ctx, AuditDataContextKey, data)
+}
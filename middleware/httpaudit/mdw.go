@@ -0,0 +1,163 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package httpaudit
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/metal-toolbox/auditevent"
+	"github.com/metal-toolbox/auditevent/middleware/auditcore"
+)
+
+const (
+	// AuditDataContextKey is the audit context key for additional audit data.
+	AuditDataContextKey = auditcore.AuditDataContextKey
+	// AuditIDContextKey is the audit context key for the audit ID.
+	AuditIDContextKey = auditcore.AuditIDContextKey
+)
+
+type Middleware struct {
+	core           *auditcore.Core
+	outcomeHandler OutcomeHandler
+	subjectHandler SubjectHandler
+	routeHandler   RouteHandler
+}
+
+// NewMiddleware returns a new instance of audit Middleware.
+func NewMiddleware(component string, aew *auditevent.EventWriter) *Middleware {
+	return &Middleware{
+		core:           auditcore.New(component, aew),
+		outcomeHandler: GetOutcomeDefault,
+		subjectHandler: GetSubjectDefault,
+		routeHandler:   GetRouteDefault,
+	}
+}
+
+// NewJSONMiddleware returns a new middleware instance with a default JSON writer.
+func NewJSONMiddleware(component string, w io.Writer) *Middleware {
+	return NewMiddleware(
+		component,
+		auditevent.NewDefaultAuditEventWriter(w),
+	)
+}
+
+// WithPrometheusMetrics enables prometheus metrics for this middleware instance
+// using the default prometheus registerer (prometheus.DefaultRegisterer).
+func (m *Middleware) WithPrometheusMetrics() *Middleware {
+	m.core.WithPrometheusMetrics()
+	return m
+}
+
+// WithPrometheusMetricsForRegisterer enables prometheus metrics for this middleware instance
+// using the given prometheus registerer.
+func (m *Middleware) WithPrometheusMetricsForRegisterer(pr prometheus.Registerer) *Middleware {
+	m.core.WithPrometheusMetricsForRegisterer(pr)
+	return m
+}
+
+func (m *Middleware) WithOutcomeHandler(handler OutcomeHandler) *Middleware {
+	m.outcomeHandler = handler
+	return m
+}
+
+func (m *Middleware) WithSubjectHandler(handler SubjectHandler) *Middleware {
+	m.subjectHandler = handler
+	return m
+}
+
+// WithRouteHandler sets how the template of the route that matched a
+// request is found, for routers other than http.ServeMux (see
+// GetRouteDefault). Event types and failure policies are registered
+// for these templates.
+func (m *Middleware) WithRouteHandler(handler RouteHandler) *Middleware {
+	m.routeHandler = handler
+	return m
+}
+
+// SetTrustedProxies sets the IP addresses or CIDRs of the proxies that
+// are trusted to report the client's IP address through the
+// X-Forwarded-For and X-Real-IP headers. When no trusted proxies are
+// set, the request's remote address is used.
+func (m *Middleware) SetTrustedProxies(proxies []string) error {
+	return m.core.SetTrustedProxies(proxies)
+}
+
+// WithLogger sets the logger used to report the errors writing events.
+// See WithFailurePolicy.
+func (m *Middleware) WithLogger(l logr.Logger) *Middleware {
+	m.core.WithLogger(l)
+	return m
+}
+
+// WithFailurePolicy sets what happens to requests whose audit event can't
+// be written, unless a policy is set for their method or route. By default,
+// errors are ignored (auditcore.IgnoreFailures). See auditcore.FailurePolicy.
+func (m *Middleware) WithFailurePolicy(p auditcore.FailurePolicy) *Middleware {
+	m.core.SetFailurePolicy(p)
+	return m
+}
+
+// SetFailurePolicyForMethod sets the failure policy for the requests with the
+// given HTTP method, e.g. auditcore.FailClosed for the methods that change state.
+func (m *Middleware) SetFailurePolicyForMethod(httpMethod string, p auditcore.FailurePolicy) {
+	m.core.SetFailurePolicyForMethod(httpMethod, p)
+}
+
+// SetFailurePolicyForRoute sets the failure policy for the requests to the given
+// HTTP method and path. The path is a route template, as in RegisterEventType.
+// It takes precedence over the policy of the method.
+func (m *Middleware) SetFailurePolicyForRoute(httpMethod, path string, p auditcore.FailurePolicy) {
+	m.core.SetFailurePolicyForRoute(httpMethod, path, p)
+}
+
+// RegisterEventType registers an audit event type for a given HTTP method and path.
+// The path is the template of the route, e.g. `/servers/{id}`, as in the http.ServeMux pattern without its method.
+func (m *Middleware) RegisterEventType(eventType, httpMethod, path string) {
+	m.core.RegisterEventType(eventType, httpMethod, path)
+}
+
+// Audit returns a net/http middleware that will audit the request.
+// This uses the a pre-registered type for the event (see RegisterEventType).
+// If no type is registered, the event type is the HTTP method and path.
+func (m *Middleware) Audit() func(http.Handler) http.Handler {
+	return m.AuditWithType("")
+}
+
+// AuditWithType returns a net/http middleware that will audit the request.
+// This uses the given type for the event.
+// If the type is empty, the event type will try to use a pre-registered
+// type (see RegisterEventType) and if it doesn't find it,
+// it'll use the HTTP method and path.
+func (m *Middleware) AuditWithType(t string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			a := &adapter{
+				w: NewResponseWriter(w),
+				r: r.WithContext(auditcore.NewContext(r.Context())),
+				m: m,
+			}
+
+			//nolint:errcheck // errors are handled by the failure policy
+			m.core.Audit(a, t, func() {
+				next.ServeHTTP(a.w, a.r)
+			})
+		})
+	}
+}
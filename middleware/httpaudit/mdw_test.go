@@ -0,0 +1,218 @@
+//go:build testtools
+// +build testtools
+
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+// This package was tagged with testtools to ensure we don't
+// pollute the library/binary with constants and functions.
+package httpaudit_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-toolbox/auditevent"
+	"github.com/metal-toolbox/auditevent/middleware/auditcore/auditcoretest"
+	"github.com/metal-toolbox/auditevent/middleware/httpaudit"
+)
+
+func setJWT(r *http.Request) {
+	httpaudit.Set(r.Context(), "jwt.user", "user-ozz")
+	httpaudit.Set(r.Context(), "jwt.subject", "sub-ozz")
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	//nolint:errcheck,errchkjson // test
+	json.NewEncoder(w).Encode(v)
+}
+
+func setFixtures(t *testing.T, w io.Writer, cfg auditcoretest.Config) http.Handler {
+	t.Helper()
+
+	mdw := httpaudit.NewJSONMiddleware(auditcoretest.Component, w)
+
+	if cfg.Registerer != nil {
+		mdw.WithPrometheusMetricsForRegisterer(cfg.Registerer)
+	}
+
+	if cfg.Outcome != "" {
+		mdw.WithOutcomeHandler(func(*httpaudit.ResponseWriter, *http.Request) string {
+			return cfg.Outcome
+		})
+	}
+
+	mdw.WithFailurePolicy(cfg.FailurePolicy)
+
+	if cfg.Subjects != nil {
+		mdw.WithSubjectHandler(func(*http.Request) map[string]string {
+			return cfg.Subjects
+		})
+	}
+
+	r := http.NewServeMux()
+
+	// Writing to `fails-with-user-header` breaks the app
+	r.Handle("POST /fails-with-user-header", mdw.AuditWithType("AlwaysBreaks")(
+		http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+			w.WriteHeader(http.StatusInternalServerError)
+		})))
+
+	audited := http.NewServeMux()
+
+	// allowed user with registered event type
+	mdw.RegisterEventType("MyEventType", http.MethodGet, "/ok")
+	audited.HandleFunc("GET /ok", func(w http.ResponseWriter, r *http.Request) {
+		setJWT(r)
+		writeJSON(w, http.StatusOK, "ok")
+	})
+
+	// denied with no user
+	audited.HandleFunc("GET /denied", func(w http.ResponseWriter, _ *http.Request) {
+		writeJSON(w, http.StatusForbidden, "denied")
+	})
+
+	// denied with user
+	audited.HandleFunc("GET /denied-user", func(w http.ResponseWriter, r *http.Request) {
+		setJWT(r)
+		writeJSON(w, http.StatusForbidden, "denied")
+	})
+
+	// allowed with user, enriched by context data
+	audited.HandleFunc("GET /changes", func(w http.ResponseWriter, r *http.Request) {
+		setJWT(r)
+		httpaudit.SetAuditData(r.Context(), &auditcoretest.TestData)
+		writeJSON(w, http.StatusOK, "ok")
+	})
+
+	// denied with no user, enriched by context data
+	audited.HandleFunc("GET /changes/denied", func(w http.ResponseWriter, r *http.Request) {
+		httpaudit.SetAuditData(r.Context(), &auditcoretest.TestData)
+		writeJSON(w, http.StatusForbidden, "denied")
+	})
+
+	// context data of wrong type
+	audited.HandleFunc("GET /nodata", func(w http.ResponseWriter, r *http.Request) {
+		setJWT(r)
+		httpaudit.Set(r.Context(), httpaudit.AuditDataContextKey, "some random string")
+		writeJSON(w, http.StatusOK, "ok")
+	})
+
+	// parameterized route with registered event type
+	mdw.RegisterEventType("GetServer", http.MethodGet, "/servers/{id}")
+	audited.HandleFunc("GET /servers/{id}", func(w http.ResponseWriter, r *http.Request) {
+		setJWT(r)
+		writeJSON(w, http.StatusOK, "ok")
+	})
+
+	// Everything else will be audited
+	r.Handle("/", mdw.Audit()(audited))
+
+	return r
+}
+
+func TestConformance(t *testing.T) {
+	t.Parallel()
+
+	auditcoretest.Run(t, auditcoretest.Harness{
+		Setup: setFixtures,
+		EnableDefaultPrometheusMetrics: func(w io.Writer) {
+			httpaudit.NewJSONMiddleware(auditcoretest.Component, w).WithPrometheusMetrics()
+		},
+	})
+}
+
+func TestAuditIDInContext(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	mdw := httpaudit.NewJSONMiddleware(auditcoretest.Component, &buf)
+
+	var auditID string
+	h := mdw.Audit()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auditID = httpaudit.AuditID(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	h.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodDelete, "/foo", http.NoBody))
+
+	gotEvent := &auditevent.AuditEvent{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), gotEvent))
+	require.NotEmpty(t, auditID, "audit id should be in the context")
+	require.Equal(t, auditID, gotEvent.Metadata.AuditID, "audit id should match")
+	require.Equal(t, "DELETE:/foo", gotEvent.Type, "type should match")
+	require.Equal(t, "192.0.2.1", gotEvent.Source.Value, "source should be the remote address")
+}
+
+// chiRouteContext stands in for chi's route context, which chi adds to the
+// request before running the middlewares, and fills in once a route matches.
+type chiRouteContext struct {
+	pattern string
+}
+
+type chiRouteContextKey struct{}
+
+func TestRouteHandler(t *testing.T) {
+	t.Parallel()
+
+	var buf bytes.Buffer
+	mdw := httpaudit.NewJSONMiddleware(auditcoretest.Component, &buf).
+		WithRouteHandler(func(r *http.Request) string {
+			rctx, _ := r.Context().Value(chiRouteContextKey{}).(*chiRouteContext)
+			return rctx.pattern
+		})
+	mdw.RegisterEventType("GetServer", http.MethodGet, "/servers/{id:[0-9]+}")
+
+	// The route is matched after the middlewares run, and chi sets the
+	// path values of the request it's given
+	routes := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rctx, _ := r.Context().Value(chiRouteContextKey{}).(*chiRouteContext)
+		rctx.pattern = "/servers/{id:[0-9]+}"
+		r.SetPathValue("id", "123")
+		w.WriteHeader(http.StatusOK)
+	})
+	h := mdw.Audit()(routes)
+	router := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), chiRouteContextKey{}, &chiRouteContext{})
+		h.ServeHTTP(w, r.WithContext(ctx))
+	})
+
+	router.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest(http.MethodGet, "/servers/123", http.NoBody))
+
+	gotEvent := &auditevent.AuditEvent{}
+	require.NoError(t, json.Unmarshal(buf.Bytes(), gotEvent))
+	require.Equal(t, "GetServer", gotEvent.Type, "the type should be registered for the route template")
+	require.Equal(t, map[string]string{"path": "/servers/123", "id": "123"}, gotEvent.Target)
+}
+
+func TestContextWithoutMiddleware(t *testing.T) {
+	t.Parallel()
+
+	req := httptest.NewRequest(http.MethodGet, "/", http.NoBody)
+	httpaudit.Set(req.Context(), "foo", "bar")
+
+	_, ok := httpaudit.Get(req.Context(), "foo")
+	require.False(t, ok, "values shouldn't be stored outside of the middleware")
+	require.Empty(t, httpaudit.AuditID(req.Context()))
+}
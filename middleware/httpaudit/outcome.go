@@ -0,0 +1,38 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package httpaudit
+
+import (
+	"net/http"
+
+	"github.com/metal-toolbox/auditevent/middleware/auditcore"
+)
+
+// OutcomeHandler is a function that returns the AuditEvent outcome
+// for a given request. This will be called after the handler has
+// processed the request; e.g. the given writer should already contain
+// a result status.
+// It is recommended to return one of the samples defined in
+// `samples.go`.
+type OutcomeHandler func(w *ResponseWriter, r *http.Request) string
+
+// GetOutcomeDefault is the default outcome handler that's set in
+// the middleware constructor. It will return `failed` for HTTP response
+// statuses 500 and above, `denied` for requests 400 and above and
+// `succeeded` otherwise.
+func GetOutcomeDefault(w *ResponseWriter, _ *http.Request) string {
+	return auditcore.OutcomeFromStatus(w.Status())
+}
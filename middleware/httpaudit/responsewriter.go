@@ -0,0 +1,183 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package httpaudit
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"net"
+	"net/http"
+
+	"github.com/metal-toolbox/auditevent/middleware/auditcore"
+)
+
+// ResponseWriter is an http.ResponseWriter that captures the status
+// of the response. It keeps http.Flusher and http.Hijacker working
+// if the wrapped writer implements them.
+type ResponseWriter struct {
+	http.ResponseWriter
+	status  int
+	written int64
+
+	// The response is held back by the FailClosed policy
+	held bool
+	body bytes.Buffer
+}
+
+var (
+	_ http.Flusher             = (*ResponseWriter)(nil)
+	_ http.Hijacker            = (*ResponseWriter)(nil)
+	_ auditcore.ResponseHolder = (*ResponseWriter)(nil)
+)
+
+// NewResponseWriter wraps the given writer. If it's already a
+// *ResponseWriter, it's returned as is.
+func NewResponseWriter(w http.ResponseWriter) *ResponseWriter {
+	if rw, ok := w.(*ResponseWriter); ok {
+		return rw
+	}
+
+	return &ResponseWriter{ResponseWriter: w}
+}
+
+// Status returns the HTTP status of the response. It's http.StatusOK if
+// the handler didn't write a header.
+func (w *ResponseWriter) Status() int {
+	if w.status == 0 {
+		return http.StatusOK
+	}
+
+	return w.status
+}
+
+// Written returns the number of bytes written to the response body.
+func (w *ResponseWriter) Written() int64 {
+	return w.written
+}
+
+func (w *ResponseWriter) WriteHeader(status int) {
+	// Informational headers may be followed by the actual one
+	if w.status == 0 && status >= http.StatusOK {
+		w.status = status
+	}
+
+	// Only the final header is held back
+	if w.held && status >= http.StatusOK {
+		return
+	}
+
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *ResponseWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	var n int
+	var err error
+	if w.held {
+		n, err = w.body.Write(b)
+	} else {
+		n, err = w.ResponseWriter.Write(b)
+	}
+	w.written += int64(n)
+
+	return n, err
+}
+
+// Flush sends any buffered data to the client. It's a no-op if the
+// wrapped writer isn't an http.Flusher or the response is held back.
+func (w *ResponseWriter) Flush() {
+	if w.held {
+		return
+	}
+
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		if w.status == 0 {
+			w.status = http.StatusOK
+		}
+
+		f.Flush()
+	}
+}
+
+// Hijack lets the handler take over the connection. It fails with
+// http.ErrNotSupported if the wrapped writer isn't an http.Hijacker or
+// the response is held back.
+func (w *ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok || w.held {
+		return nil, nil, fmt.Errorf("hijacking the connection: %w", http.ErrNotSupported)
+	}
+
+	conn, rw, err := h.Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+
+	return conn, rw, err
+}
+
+// Unwrap returns the wrapped writer. This is used by http.ResponseController.
+func (w *ResponseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+func (w *ResponseWriter) hold() {
+	w.held = true
+}
+
+// Release sends the response held back by the FailClosed policy.
+func (w *ResponseWriter) Release() {
+	if !w.held {
+		return
+	}
+
+	w.held = false
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+
+	if w.body.Len() > 0 {
+		//nolint:errcheck // the client is gone, there's nothing left to do
+		w.ResponseWriter.Write(w.body.Bytes())
+		w.body.Reset()
+	}
+}
+
+// Reject discards the response held back by the FailClosed policy
+// and responds with the given status instead.
+func (w *ResponseWriter) Reject(status int) {
+	if !w.held {
+		return
+	}
+
+	w.held = false
+	w.body.Reset()
+
+	h := w.ResponseWriter.Header()
+	for k := range h {
+		delete(h, k)
+	}
+
+	h.Set("Content-Type", "text/plain; charset=utf-8")
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+	//nolint:errcheck // the client is gone, there's nothing left to do
+	w.ResponseWriter.Write([]byte(http.StatusText(status)))
+}
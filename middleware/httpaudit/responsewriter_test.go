@@ -0,0 +1,84 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package httpaudit_test
+
+import (
+	"bufio"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-toolbox/auditevent/middleware/httpaudit"
+)
+
+type hijackableRecorder struct {
+	*httptest.ResponseRecorder
+	hijacked bool
+}
+
+func (h *hijackableRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	h.hijacked = true
+	return nil, nil, nil
+}
+
+// plainWriter hides the optional interfaces of the recorder.
+type plainWriter struct {
+	http.ResponseWriter
+}
+
+func TestResponseWriterStatus(t *testing.T) {
+	t.Parallel()
+
+	w := httpaudit.NewResponseWriter(httptest.NewRecorder())
+	require.Equal(t, http.StatusOK, w.Status(), "status should default to 200")
+
+	w.WriteHeader(http.StatusNotFound)
+	n, err := w.Write([]byte("not found"))
+	require.NoError(t, err)
+	require.Equal(t, http.StatusNotFound, w.Status(), "status should match")
+	require.Equal(t, int64(n), w.Written())
+
+	require.Same(t, w, httpaudit.NewResponseWriter(w), "writers shouldn't be wrapped twice")
+}
+
+func TestResponseWriterFlush(t *testing.T) {
+	t.Parallel()
+
+	rec := httptest.NewRecorder()
+	w := httpaudit.NewResponseWriter(rec)
+	require.NoError(t, http.NewResponseController(w).Flush())
+	require.True(t, rec.Flushed, "flush should reach the wrapped writer")
+
+	// Flushing a writer that can't flush does nothing
+	httpaudit.NewResponseWriter(plainWriter{httptest.NewRecorder()}).Flush()
+}
+
+func TestResponseWriterHijack(t *testing.T) {
+	t.Parallel()
+
+	hr := &hijackableRecorder{ResponseRecorder: httptest.NewRecorder()}
+	w := httpaudit.NewResponseWriter(hr)
+	_, _, err := w.Hijack()
+	require.NoError(t, err)
+	require.True(t, hr.hijacked, "hijack should reach the wrapped writer")
+	require.Equal(t, http.StatusSwitchingProtocols, w.Status())
+
+	_, _, err = httpaudit.NewResponseWriter(plainWriter{httptest.NewRecorder()}).Hijack()
+	require.ErrorIs(t, err, http.ErrNotSupported)
+}
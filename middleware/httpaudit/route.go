@@ -0,0 +1,57 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package httpaudit
+
+import (
+	"net/http"
+	"strings"
+)
+
+// RouteHandler is a function that returns the template of the route that
+// matched a request, e.g. `/servers/{id}`, or an empty string if none did.
+// This will be called after the handler has processed the request, once
+// the router has matched it. Path parameters in braces are added to the
+// event's target, with the values of the request's PathValue.
+type RouteHandler func(r *http.Request) string
+
+// GetRouteDefault is the default route handler that's set in the
+// middleware constructor. It returns the path of the http.ServeMux
+// pattern that matched the request. The mux sets it on the request it's
+// given, so this is empty unless the mux received the request passed on
+// by the middleware. Other routers need their own route handler; e.g.
+// with chi:
+//
+//	mdw.WithRouteHandler(func(r *http.Request) string {
+//		return chi.RouteContext(r.Context()).RoutePattern()
+//	})
+func GetRouteDefault(r *http.Request) string {
+	return patternPath(r.Pattern)
+}
+
+// patternPath strips the method and host from an http.ServeMux pattern,
+// which has the form `[METHOD ][HOST]/[PATH]`.
+func patternPath(pattern string) string {
+	if i := strings.IndexAny(pattern, " \t"); i >= 0 {
+		pattern = strings.TrimLeft(pattern[i+1:], " \t")
+	}
+
+	i := strings.Index(pattern, "/")
+	if i < 0 {
+		return ""
+	}
+
+	return pattern[i:]
+}
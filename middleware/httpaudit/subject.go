@@ -0,0 +1,34 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package httpaudit
+
+import (
+	"net/http"
+
+	"github.com/metal-toolbox/auditevent/middleware/auditcore"
+)
+
+// SubjectHandler is a function that returns the AuditEvent subject map
+// for a given request. This will be called after the handler has
+// processed the request; e.g. the audit context of the request should
+// already contain the subject information (see Set).
+type SubjectHandler func(r *http.Request) map[string]string
+
+// GetSubjectDefault is the default subject handler that's set in the
+// middleware constructor. See auditcore.DefaultSubjects.
+func GetSubjectDefault(r *http.Request) map[string]string {
+	return auditcore.DefaultSubjects(&adapter{r: r})
+}
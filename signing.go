@@ -0,0 +1,370 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package auditevent
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"hash"
+	"os"
+)
+
+// These are the signature algorithms supported by the built-in signers.
+const (
+	AlgorithmEd25519 = "Ed25519"
+	AlgorithmES256   = "ES256"
+	AlgorithmES384   = "ES384"
+	AlgorithmES512   = "ES512"
+	AlgorithmHS256   = "HS256"
+)
+
+var (
+	// ErrUnsigned is returned when verifying an event that has no signature.
+	ErrUnsigned = errors.New("audit event is not signed")
+	// ErrUnknownKeyID is returned when verifying an event signed with a key
+	// that is not part of the key set.
+	ErrUnknownKeyID = errors.New("unknown signing key ID")
+	// ErrInvalidSignature is returned when an event's signature doesn't verify.
+	ErrInvalidSignature = errors.New("invalid audit event signature")
+	// ErrUnsupportedKey is returned when a key or algorithm isn't supported.
+	ErrUnsupportedKey = errors.New("unsupported signing key")
+)
+
+// EventSignature is a detached signature over the canonical
+// serialization of an audit event (leaving out the signature itself).
+type EventSignature struct {
+	// KeyID identifies the key that produced the signature.
+	KeyID string `json:"keyId"`
+	// Algorithm is the signature algorithm. e.g. Ed25519, ES256 or HS256.
+	Algorithm string `json:"alg"`
+	// Value is the base64-encoded signature.
+	Value string `json:"value"`
+}
+
+// Signer produces signatures for audit events. Implementations may
+// hold keys in memory or delegate to an external key management service.
+type Signer interface {
+	// KeyID returns the ID of the key used to sign, which
+	// allows verifiers to pick the matching public key.
+	KeyID() string
+	// Algorithm returns the name of the signature algorithm.
+	Algorithm() string
+	// Sign returns the signature of the given message.
+	Sign(message []byte) ([]byte, error)
+}
+
+// PublicKeySet maps key IDs to the keys used to verify signatures.
+// Keys may be ed25519.PublicKey, *ecdsa.PublicKey or, for HMAC, the
+// shared secret as a []byte.
+type PublicKeySet map[string]crypto.PublicKey
+
+// WithSigner signs every event that is written with the given signer.
+// The signature is set in `Metadata.Signature`. When hash chaining is
+// also enabled, the signature covers the event's chain as well.
+// Note that the events passed to `Write` are modified.
+// It returns the writer itself for ease of use as the Builder pattern.
+func (w *EventWriter) WithSigner(s Signer) *EventWriter {
+	w.signer = s
+	return w
+}
+
+// Sign signs the event with the given signer and sets its signature.
+func (e *AuditEvent) Sign(s Signer) error {
+	e.Metadata.Signature = nil
+
+	msg, err := signedBytes(e)
+	if err != nil {
+		return err
+	}
+
+	sig, err := s.Sign(msg)
+	if err != nil {
+		return fmt.Errorf("signing audit event: %w", err)
+	}
+
+	e.Metadata.Signature = &EventSignature{
+		KeyID:     s.KeyID(),
+		Algorithm: s.Algorithm(),
+		Value:     base64.StdEncoding.EncodeToString(sig),
+	}
+
+	return nil
+}
+
+// Verify checks the signature of the given event against the key with
+// the matching ID in the given key set.
+func Verify(e *AuditEvent, keys PublicKeySet) error {
+	sig := e.Metadata.Signature
+	if sig == nil {
+		return ErrUnsigned
+	}
+
+	key, ok := keys[sig.KeyID]
+	if !ok {
+		return fmt.Errorf("%w: %s", ErrUnknownKeyID, sig.KeyID)
+	}
+
+	value, err := base64.StdEncoding.DecodeString(sig.Value)
+	if err != nil {
+		return fmt.Errorf("%w: decoding signature: %w", ErrInvalidSignature, err)
+	}
+
+	msg, err := signedBytes(e)
+	if err != nil {
+		return err
+	}
+
+	if err := verifySignature(key, sig.Algorithm, msg, value); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func verifySignature(key crypto.PublicKey, alg string, msg, sig []byte) error {
+	var valid bool
+
+	switch k := key.(type) {
+	case ed25519.PublicKey:
+		if alg != AlgorithmEd25519 {
+			return fmt.Errorf("%w: algorithm %s for an Ed25519 key", ErrUnsupportedKey, alg)
+		}
+
+		valid = ed25519.Verify(k, msg, sig)
+	case *ecdsa.PublicKey:
+		keyAlg, h, err := ecdsaAlgorithm(k.Curve)
+		if err != nil {
+			return err
+		}
+
+		if alg != keyAlg {
+			return fmt.Errorf("%w: algorithm %s for an %s key", ErrUnsupportedKey, alg, keyAlg)
+		}
+
+		valid = ecdsa.VerifyASN1(k, digest(h, msg), sig)
+	case []byte:
+		if alg != AlgorithmHS256 {
+			return fmt.Errorf("%w: algorithm %s for an HMAC key", ErrUnsupportedKey, alg)
+		}
+
+		valid = hmac.Equal(hmacSHA256(k, msg), sig)
+	default:
+		return fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+	}
+
+	if !valid {
+		return ErrInvalidSignature
+	}
+
+	return nil
+}
+
+// signedBytes returns the bytes covered by the event's signature.
+func signedBytes(e *AuditEvent) ([]byte, error) {
+	cpy := *e
+	cpy.Metadata.Signature = nil
+
+	return cpy.CanonicalBytes()
+}
+
+// cryptoSigner adapts a crypto.Signer to the Signer interface.
+type cryptoSigner struct {
+	keyID string
+	alg   string
+	hash  crypto.Hash
+	s     crypto.Signer
+}
+
+// NewCryptoSigner returns a Signer backed by the given crypto.Signer.
+// This allows signing with keys held by e.g. a key management service or
+// a hardware token, as long as their client implements crypto.Signer.
+// Ed25519 and ECDSA (P-256, P-384 and P-521) keys are supported.
+func NewCryptoSigner(keyID string, s crypto.Signer) (Signer, error) {
+	cs := &cryptoSigner{keyID: keyID, s: s}
+
+	switch pub := s.Public().(type) {
+	case ed25519.PublicKey:
+		cs.alg = AlgorithmEd25519
+	case *ecdsa.PublicKey:
+		alg, h, err := ecdsaAlgorithm(pub.Curve)
+		if err != nil {
+			return nil, err
+		}
+
+		cs.alg = alg
+		cs.hash = h
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, pub)
+	}
+
+	return cs, nil
+}
+
+func (s *cryptoSigner) KeyID() string {
+	return s.keyID
+}
+
+func (s *cryptoSigner) Algorithm() string {
+	return s.alg
+}
+
+func (s *cryptoSigner) Sign(message []byte) ([]byte, error) {
+	// Ed25519 signs the message itself while ECDSA signs its digest.
+	if s.hash == 0 {
+		return s.s.Sign(rand.Reader, message, crypto.Hash(0))
+	}
+
+	return s.s.Sign(rand.Reader, digest(s.hash, message), s.hash)
+}
+
+// NewEd25519Signer returns a Signer that uses the given Ed25519 private key.
+func NewEd25519Signer(keyID string, key ed25519.PrivateKey) Signer {
+	return &cryptoSigner{keyID: keyID, alg: AlgorithmEd25519, s: key}
+}
+
+// NewECDSASigner returns a Signer that uses the given ECDSA private key.
+// The algorithm is determined by the key's curve.
+func NewECDSASigner(keyID string, key *ecdsa.PrivateKey) (Signer, error) {
+	return NewCryptoSigner(keyID, key)
+}
+
+// NewSignerFromPEMFile returns a Signer that uses the PEM-encoded
+// Ed25519 or ECDSA private key stored in the given file. Both PKCS #8
+// ("PRIVATE KEY") and SEC 1 ("EC PRIVATE KEY") encodings are supported.
+func NewSignerFromPEMFile(keyID, path string) (Signer, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading signing key: %w", err)
+	}
+
+	block, _ := pem.Decode(raw)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM data found in %s", ErrUnsupportedKey, path)
+	}
+
+	var key any
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		key, err = x509.ParseECPrivateKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("%w: PEM block type %q", ErrUnsupportedKey, block.Type)
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("parsing signing key: %w", err)
+	}
+
+	s, ok := key.(crypto.Signer)
+	if !ok {
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, key)
+	}
+
+	return NewCryptoSigner(keyID, s)
+}
+
+// hmacSigner signs events with a shared secret.
+type hmacSigner struct {
+	keyID  string
+	secret []byte
+}
+
+// NewHMACSigner returns a Signer that computes an HMAC-SHA256 of the
+// event with the given shared secret. Note that anybody holding the
+// secret may both produce and verify signatures.
+func NewHMACSigner(keyID string, secret []byte) Signer {
+	return &hmacSigner{keyID: keyID, secret: bytes.Clone(secret)}
+}
+
+// NewHMACSignerFromFile returns an HMAC Signer whose shared secret is
+// the contents of the given file, with surrounding whitespace removed.
+func NewHMACSignerFromFile(keyID, path string) (Signer, error) {
+	raw, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("reading signing key: %w", err)
+	}
+
+	secret := bytes.TrimSpace(raw)
+	if len(secret) == 0 {
+		return nil, fmt.Errorf("%w: empty HMAC secret in %s", ErrUnsupportedKey, path)
+	}
+
+	return NewHMACSigner(keyID, secret), nil
+}
+
+func (s *hmacSigner) KeyID() string {
+	return s.keyID
+}
+
+func (s *hmacSigner) Algorithm() string {
+	return AlgorithmHS256
+}
+
+func (s *hmacSigner) Sign(message []byte) ([]byte, error) {
+	return hmacSHA256(s.secret, message), nil
+}
+
+func hmacSHA256(secret, message []byte) []byte {
+	mac := hmac.New(sha256.New, secret)
+	// Writing to a hash never fails.
+	mac.Write(message)
+
+	return mac.Sum(nil)
+}
+
+func ecdsaAlgorithm(c elliptic.Curve) (string, crypto.Hash, error) {
+	switch c {
+	case elliptic.P256():
+		return AlgorithmES256, crypto.SHA256, nil
+	case elliptic.P384():
+		return AlgorithmES384, crypto.SHA384, nil
+	case elliptic.P521():
+		return AlgorithmES512, crypto.SHA512, nil
+	default:
+		return "", 0, fmt.Errorf("%w: ECDSA curve %s", ErrUnsupportedKey, c.Params().Name)
+	}
+}
+
+func digest(h crypto.Hash, message []byte) []byte {
+	var hh hash.Hash
+
+	switch h {
+	case crypto.SHA384:
+		hh = sha512.New384()
+	case crypto.SHA512:
+		hh = sha512.New()
+	default:
+		hh = sha256.New()
+	}
+
+	// Writing to a hash never fails.
+	hh.Write(message)
+
+	return hh.Sum(nil)
+}
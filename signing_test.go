@@ -0,0 +1,245 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package auditevent_test
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+// fakeKMS is a crypto.Signer that stands in for a key management
+// service client. It never exposes the private key.
+type fakeKMS struct {
+	key   crypto.Signer
+	calls int
+}
+
+func (k *fakeKMS) Public() crypto.PublicKey {
+	return k.key.Public()
+}
+
+func (k *fakeKMS) Sign(r io.Reader, digest []byte, opts crypto.SignerOpts) ([]byte, error) {
+	k.calls++
+	return k.key.Sign(r, digest, opts)
+}
+
+// signAndDecode writes an event through a signing writer and
+// decodes it back, as a verifier reading the audit log would.
+func signAndDecode(t *testing.T, s auditevent.Signer) *auditevent.AuditEvent {
+	t.Helper()
+
+	var buf bytes.Buffer
+	w := auditevent.NewDefaultAuditEventWriter(&buf).WithSigner(s)
+
+	e := newTestEvent("UserLogin").WithTarget(map[string]string{
+		"path": "/login",
+	}).WithDataFromString(`{"b": 1, "a": [true, null]}`)
+	require.NoError(t, w.Write(e))
+
+	var got auditevent.AuditEvent
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &got))
+	require.NotNil(t, got.Metadata.Signature)
+	require.Equal(t, s.KeyID(), got.Metadata.Signature.KeyID)
+	require.Equal(t, s.Algorithm(), got.Metadata.Signature.Algorithm)
+
+	return &got
+}
+
+func TestSignAndVerify(t *testing.T) {
+	t.Parallel()
+
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	p256, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	p384, err := ecdsa.GenerateKey(elliptic.P384(), rand.Reader)
+	require.NoError(t, err)
+
+	ecSigner256, err := auditevent.NewECDSASigner("ec-256", p256)
+	require.NoError(t, err)
+	ecSigner384, err := auditevent.NewECDSASigner("ec-384", p384)
+	require.NoError(t, err)
+
+	secret := []byte("super-secret")
+
+	keys := auditevent.PublicKeySet{
+		"ed":     edPub,
+		"ec-256": &p256.PublicKey,
+		"ec-384": &p384.PublicKey,
+		"hmac":   secret,
+	}
+
+	tests := []struct {
+		name    string
+		signer  auditevent.Signer
+		wantAlg string
+	}{
+		{"ed25519", auditevent.NewEd25519Signer("ed", edPriv), auditevent.AlgorithmEd25519},
+		{"ecdsa p-256", ecSigner256, auditevent.AlgorithmES256},
+		{"ecdsa p-384", ecSigner384, auditevent.AlgorithmES384},
+		{"hmac", auditevent.NewHMACSigner("hmac", secret), auditevent.AlgorithmHS256},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			require.Equal(t, tt.wantAlg, tt.signer.Algorithm())
+
+			got := signAndDecode(t, tt.signer)
+			require.NoError(t, auditevent.Verify(got, keys))
+
+			got.Outcome = auditevent.OutcomeDenied
+			require.ErrorIs(t, auditevent.Verify(got, keys), auditevent.ErrInvalidSignature,
+				"tampered events should not verify")
+		})
+	}
+}
+
+func TestVerifyFailures(t *testing.T) {
+	t.Parallel()
+
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	otherPub, _, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+
+	signed := signAndDecode(t, auditevent.NewEd25519Signer("ed", edPriv))
+
+	require.ErrorIs(t, auditevent.Verify(newTestEvent("Unsigned"), auditevent.PublicKeySet{"ed": edPub}),
+		auditevent.ErrUnsigned)
+	require.ErrorIs(t, auditevent.Verify(signed, auditevent.PublicKeySet{"other": edPub}),
+		auditevent.ErrUnknownKeyID)
+	require.ErrorIs(t, auditevent.Verify(signed, auditevent.PublicKeySet{"ed": otherPub}),
+		auditevent.ErrInvalidSignature)
+	require.ErrorIs(t, auditevent.Verify(signed, auditevent.PublicKeySet{"ed": []byte("secret")}),
+		auditevent.ErrUnsupportedKey, "an HMAC key can't verify an Ed25519 signature")
+	require.ErrorIs(t, auditevent.Verify(signed, auditevent.PublicKeySet{"ed": "not a key"}),
+		auditevent.ErrUnsupportedKey)
+
+	signed.Metadata.Signature.Value = "not base64!"
+	require.ErrorIs(t, auditevent.Verify(signed, auditevent.PublicKeySet{"ed": edPub}),
+		auditevent.ErrInvalidSignature)
+}
+
+func TestCryptoSignerForKMS(t *testing.T) {
+	t.Parallel()
+
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+
+	kms := &fakeKMS{key: key}
+	s, err := auditevent.NewCryptoSigner("kms-key-1", kms)
+	require.NoError(t, err)
+
+	got := signAndDecode(t, s)
+	require.Equal(t, 1, kms.calls, "signing should be delegated to the KMS")
+	require.NoError(t, auditevent.Verify(got, auditevent.PublicKeySet{"kms-key-1": &key.PublicKey}))
+}
+
+func TestSignersFromFiles(t *testing.T) {
+	t.Parallel()
+
+	dir := t.TempDir()
+
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	edDER, err := x509.MarshalPKCS8PrivateKey(edPriv)
+	require.NoError(t, err)
+	edPath := filepath.Join(dir, "ed.pem")
+	require.NoError(t, os.WriteFile(edPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: edDER}), 0o600))
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecDER, err := x509.MarshalECPrivateKey(ecKey)
+	require.NoError(t, err)
+	ecPath := filepath.Join(dir, "ec.pem")
+	require.NoError(t, os.WriteFile(ecPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: ecDER}), 0o600))
+
+	hmacPath := filepath.Join(dir, "hmac.key")
+	require.NoError(t, os.WriteFile(hmacPath, []byte("super-secret\n"), 0o600))
+
+	keys := auditevent.PublicKeySet{
+		"ed":   edPub,
+		"ec":   &ecKey.PublicKey,
+		"hmac": []byte("super-secret"),
+	}
+
+	edSigner, err := auditevent.NewSignerFromPEMFile("ed", edPath)
+	require.NoError(t, err)
+	require.NoError(t, auditevent.Verify(signAndDecode(t, edSigner), keys))
+
+	ecSigner, err := auditevent.NewSignerFromPEMFile("ec", ecPath)
+	require.NoError(t, err)
+	require.NoError(t, auditevent.Verify(signAndDecode(t, ecSigner), keys))
+
+	hmacSigner, err := auditevent.NewHMACSignerFromFile("hmac", hmacPath)
+	require.NoError(t, err)
+	require.NoError(t, auditevent.Verify(signAndDecode(t, hmacSigner), keys))
+
+	_, err = auditevent.NewSignerFromPEMFile("nope", hmacPath)
+	require.ErrorIs(t, err, auditevent.ErrUnsupportedKey)
+
+	_, err = auditevent.NewSignerFromPEMFile("nope", filepath.Join(dir, "missing.pem"))
+	require.Error(t, err)
+}
+
+func TestSignedAndChainedEventsVerify(t *testing.T) {
+	t.Parallel()
+
+	edPub, edPriv, err := ed25519.GenerateKey(rand.Reader)
+	require.NoError(t, err)
+	keys := auditevent.PublicKeySet{"ed": edPub}
+
+	var buf bytes.Buffer
+	w := auditevent.NewDefaultAuditEventWriter(&buf).
+		WithHashChain(2).
+		WithSigner(auditevent.NewEd25519Signer("ed", edPriv))
+
+	for i := 0; i < 5; i++ {
+		require.NoError(t, w.Write(newTestEvent("Event")))
+	}
+
+	raw := buf.String()
+
+	report, err := auditevent.VerifyHashChain(bytes.NewBufferString(raw))
+	require.NoError(t, err)
+	require.Equal(t, 2, report.Checkpoints)
+
+	dec := json.NewDecoder(bytes.NewBufferString(raw))
+	for dec.More() {
+		var e auditevent.AuditEvent
+		require.NoError(t, dec.Decode(&e))
+		require.NotNil(t, e.Metadata.Chain)
+		require.NoError(t, auditevent.Verify(&e, keys), "checkpoints should be signed too")
+	}
+}
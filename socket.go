@@ -0,0 +1,129 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package auditevent
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"syscall"
+	"time"
+)
+
+const (
+	// UnixSocketStream sends events over a Unix stream socket, one
+	// newline-delimited event after the other. Events have no size limit.
+	UnixSocketStream = "unix"
+	// UnixSocketDatagram sends every event in its own Unix datagram.
+	// Events can't be larger than the socket's send buffer.
+	UnixSocketDatagram = "unixgram"
+
+	unixSocketDialTimeout = 5 * time.Second
+)
+
+// ErrUnsupportedSocketNetwork is returned when a UnixSocketWriter is
+// created for a network other than UnixSocketStream or UnixSocketDatagram.
+var ErrUnsupportedSocketNetwork = errors.New("audit socket network must be 'unix' or 'unixgram'")
+
+// UnixSocketWriter writes audit events to a Unix socket, such as the one
+// `audittail` listens on with the `--listen` flag. Each writer has a
+// connection of its own, so events from several writers are never
+// interleaved, and, unlike with a named pipe, their size isn't limited
+// by PIPE_BUF.
+//
+// Every call to Write must hold exactly one event, as the encoders of
+// this package do. The socket is connected on the first Write, and
+// connected again if the connection breaks, e.g. because the reader
+// restarted. A UnixSocketWriter is safe for concurrent use.
+type UnixSocketWriter struct {
+	network string
+	path    string
+
+	mu     sync.Mutex
+	conn   net.Conn
+	closed bool
+}
+
+// NewUnixSocketWriter returns a writer that sends audit events to the
+// Unix socket at path. The network is either UnixSocketStream or
+// UnixSocketDatagram. It may be used along with an EventWriter:
+//
+//	w, err := auditevent.NewUnixSocketWriter(auditevent.UnixSocketStream, "/app-audit/audit.sock")
+//	...
+//	aew := auditevent.NewDefaultAuditEventWriter(w)
+func NewUnixSocketWriter(network, path string) (*UnixSocketWriter, error) {
+	if network != UnixSocketStream && network != UnixSocketDatagram {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedSocketNetwork, network)
+	}
+
+	return &UnixSocketWriter{network: network, path: path}, nil
+}
+
+// Write sends an event to the socket. If the connection is broken, the
+// event is sent again over a new one, so it's delivered at least once.
+func (w *UnixSocketWriter) Write(p []byte) (int, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	if w.closed {
+		return 0, ErrWriterClosed
+	}
+
+	var err error
+	for range 2 {
+		if w.conn == nil {
+			conn, derr := net.DialTimeout(w.network, w.path, unixSocketDialTimeout)
+			if derr != nil {
+				return 0, fmt.Errorf("connecting to audit socket: %w", derr)
+			}
+			w.conn = conn
+		}
+
+		if _, err = w.conn.Write(p); err == nil {
+			return len(p), nil
+		}
+
+		// A new connection starts afresh, as the event may have been cut
+		// short. The reader discards the unfinished event.
+		w.conn.Close()
+		w.conn = nil
+
+		if errors.Is(err, syscall.EMSGSIZE) {
+			// The event doesn't fit in a datagram, retrying won't help
+			break
+		}
+	}
+
+	return 0, fmt.Errorf("writing to audit socket: %w", err)
+}
+
+// Close closes the connection to the socket. Writing afterwards
+// returns ErrWriterClosed.
+func (w *UnixSocketWriter) Close() error {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	w.closed = true
+	if w.conn == nil {
+		return nil
+	}
+
+	err := w.conn.Close()
+	w.conn = nil
+
+	return err
+}
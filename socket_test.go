@@ -0,0 +1,127 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package auditevent_test
+
+import (
+	"bufio"
+	"encoding/json"
+	"net"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-toolbox/auditevent"
+)
+
+func TestUnixSocketWriterStream(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit.sock")
+	ln, err := net.Listen("unix", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { ln.Close() })
+
+	w, err := auditevent.NewUnixSocketWriter(auditevent.UnixSocketStream, path)
+	require.NoError(t, err)
+	aew := auditevent.NewDefaultAuditEventWriter(w)
+
+	// Events aren't limited by PIPE_BUF
+	big := newTestEvent("big")
+	data := json.RawMessage(`"` + strings.Repeat("a", 1<<20) + `"`)
+	big.Data = &data
+	lines := make(chan string)
+	go func() {
+		defer close(lines)
+
+		conn, err := ln.Accept()
+		if err != nil {
+			return
+		}
+
+		line, _ := bufio.NewReader(conn).ReadString('\n')
+		conn.Close()
+		lines <- line
+	}()
+
+	require.NoError(t, aew.Write(big))
+	require.Len(t, <-lines, len(mustMarshal(t, big))+1)
+
+	// The connection breaks, e.g. because the reader restarted
+	require.Eventually(t, func() bool {
+		return aew.Write(newTestEvent("after-restart")) == nil
+	}, time.Second, 5*time.Millisecond)
+
+	conn, err := ln.Accept()
+	require.NoError(t, err)
+	defer conn.Close()
+
+	line, err := bufio.NewReader(conn).ReadString('\n')
+	require.NoError(t, err)
+	require.Contains(t, line, `"type":"after-restart"`)
+
+	require.NoError(t, w.Close())
+	require.ErrorIs(t, aew.Write(newTestEvent("closed")), auditevent.ErrWriterClosed)
+}
+
+func TestUnixSocketWriterDatagram(t *testing.T) {
+	t.Parallel()
+
+	path := filepath.Join(t.TempDir(), "audit.sock")
+	pc, err := net.ListenPacket("unixgram", path)
+	require.NoError(t, err)
+	t.Cleanup(func() { pc.Close() })
+
+	w, err := auditevent.NewUnixSocketWriter(auditevent.UnixSocketDatagram, path)
+	require.NoError(t, err)
+	t.Cleanup(func() { w.Close() })
+
+	aew := auditevent.NewDefaultAuditEventWriter(w)
+	for _, typ := range []string{"first", "second"} {
+		require.NoError(t, aew.Write(newTestEvent(typ)))
+	}
+
+	buf := make([]byte, 1<<16)
+	for _, typ := range []string{"first", "second"} {
+		n, _, err := pc.ReadFrom(buf)
+		require.NoError(t, err)
+		require.Contains(t, string(buf[:n]), `"type":"`+typ+`"`, "every event should be in a datagram of its own")
+	}
+}
+
+func TestUnixSocketWriterErrors(t *testing.T) {
+	t.Parallel()
+
+	_, err := auditevent.NewUnixSocketWriter("tcp", "localhost:514")
+	require.ErrorIs(t, err, auditevent.ErrUnsupportedSocketNetwork)
+
+	w, err := auditevent.NewUnixSocketWriter(auditevent.UnixSocketStream, filepath.Join(t.TempDir(), "missing.sock"))
+	require.NoError(t, err)
+
+	_, err = w.Write([]byte("{}\n"))
+	require.ErrorContains(t, err, "connecting to audit socket")
+}
+
+func mustMarshal(t *testing.T, e *auditevent.AuditEvent) []byte {
+	t.Helper()
+
+	b, err := json.Marshal(e)
+	require.NoError(t, err)
+
+	return b
+}
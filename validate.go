@@ -0,0 +1,158 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package auditevent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// These identify the NIST SP 800-53 Revision 5.1 AU-3 elements
+// that an audit event must contain.
+const (
+	// ControlAU3 is the content of audit records as a whole.
+	ControlAU3 = "AU-3"
+	// ControlAU3a is what type of event occurred.
+	ControlAU3a = "AU-3(a)"
+	// ControlAU3b is when the event occurred.
+	ControlAU3b = "AU-3(b)"
+	// ControlAU3c is where the event occurred.
+	ControlAU3c = "AU-3(c)"
+	// ControlAU3d is the source of the event.
+	ControlAU3d = "AU-3(d)"
+	// ControlAU3e is the outcome of the event.
+	ControlAU3e = "AU-3(e)"
+	// ControlAU3f is the identity of the individuals, subjects, or
+	// objects/entities associated with the event.
+	ControlAU3f = "AU-3(f)"
+	// ControlAU3Enh1 is the additional audit information.
+	ControlAU3Enh1 = "AU-3(1)"
+)
+
+// ErrInvalidEvent is returned when an audit event fails validation.
+var ErrInvalidEvent = errors.New("invalid audit event")
+
+// FieldError describes a single field of an audit event that is
+// missing or malformed.
+type FieldError struct {
+	// Field is the JSON path of the field. e.g. "source.value".
+	Field string
+	// Control is the AU-3 element the field satisfies. e.g. "AU-3(a)".
+	Control string
+	// Reason describes what is wrong with the field.
+	Reason string
+}
+
+func (e *FieldError) Error() string {
+	return fmt.Sprintf("%s (%s): %s", e.Field, e.Control, e.Reason)
+}
+
+// ValidationError holds every problem found while validating an audit event.
+// It matches ErrInvalidEvent with errors.Is, and each *FieldError may be
+// inspected with errors.As.
+type ValidationError struct {
+	Errors []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		msgs = append(msgs, fe.Error())
+	}
+
+	return fmt.Sprintf("%s: %s", ErrInvalidEvent, strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the individual field errors.
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, fe := range e.Errors {
+		errs = append(errs, fe)
+	}
+
+	return errs
+}
+
+// Is reports whether the target is ErrInvalidEvent.
+func (e *ValidationError) Is(target error) bool {
+	return target == ErrInvalidEvent
+}
+
+// Validate checks that the event contains the information required by
+// NIST SP 800-53 Revision 5.1 Control AU-3, and that its data (if any)
+// is valid JSON. It returns a *ValidationError naming every element
+// that is missing or malformed, or nil if the event is valid.
+func (e *AuditEvent) Validate() error {
+	var errs []*FieldError
+
+	add := func(field, control, reason string) {
+		errs = append(errs, &FieldError{Field: field, Control: control, Reason: reason})
+	}
+
+	if e.Metadata.AuditID == "" {
+		add("metadata.auditId", ControlAU3, "must not be empty")
+	}
+
+	if e.Type == "" {
+		add("type", ControlAU3a, "must not be empty")
+	}
+
+	if e.LoggedAt.IsZero() {
+		add("loggedAt", ControlAU3b, "must be set")
+	}
+
+	if e.Component == "" {
+		add("component", ControlAU3c, "must not be empty")
+	}
+
+	if e.Source.Type == "" {
+		add("source.type", ControlAU3d, "must not be empty")
+	}
+
+	if e.Source.Value == "" {
+		add("source.value", ControlAU3d, "must not be empty")
+	}
+
+	if e.Outcome == "" {
+		add("outcome", ControlAU3e, "must not be empty")
+	}
+
+	if len(e.Subjects) == 0 {
+		add("subjects", ControlAU3f, "must contain at least one subject")
+	}
+
+	if e.Data != nil && !json.Valid(*e.Data) {
+		add("data", ControlAU3Enh1, "must be valid JSON")
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return &ValidationError{Errors: errs}
+}
+
+// WithStrictValidation makes this writer validate every event before
+// writing it (see `AuditEvent.Validate`). Invalid events are rejected:
+// they are not written, `Write` returns the validation error and the
+// `audit_events_invalid_total` metric is increased.
+// It returns the writer itself for ease of use as the Builder pattern.
+func (w *EventWriter) WithStrictValidation() *EventWriter {
+	w.strict = true
+	return w
+}
@@ -0,0 +1,165 @@
+/*
+Copyright 2026 Equinix, Inc.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+	http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+package auditevent_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/require"
+
+	"github.com/metal-toolbox/auditevent"
+	"github.com/metal-toolbox/auditevent/metrics"
+)
+
+func TestValidate(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		name         string
+		mutate       func(e *auditevent.AuditEvent)
+		wantControls map[string]string
+	}{
+		{
+			name:   "valid event",
+			mutate: func(*auditevent.AuditEvent) {},
+		},
+		{
+			name: "valid event with data",
+			mutate: func(e *auditevent.AuditEvent) {
+				e.WithDataFromString(`{"scope":"valid-scope"}`)
+			},
+		},
+		{
+			name: "missing type",
+			mutate: func(e *auditevent.AuditEvent) {
+				e.Type = ""
+			},
+			wantControls: map[string]string{"type": auditevent.ControlAU3a},
+		},
+		{
+			name: "zero logging time",
+			mutate: func(e *auditevent.AuditEvent) {
+				e.LoggedAt = time.Time{}
+			},
+			wantControls: map[string]string{"loggedAt": auditevent.ControlAU3b},
+		},
+		{
+			name: "missing subjects",
+			mutate: func(e *auditevent.AuditEvent) {
+				e.Subjects = nil
+			},
+			wantControls: map[string]string{"subjects": auditevent.ControlAU3f},
+		},
+		{
+			name: "malformed data",
+			mutate: func(e *auditevent.AuditEvent) {
+				e.WithDataFromString(`{"scope":`)
+			},
+			wantControls: map[string]string{"data": auditevent.ControlAU3Enh1},
+		},
+		{
+			name: "everything missing",
+			mutate: func(e *auditevent.AuditEvent) {
+				*e = auditevent.AuditEvent{}
+			},
+			wantControls: map[string]string{
+				"metadata.auditId": auditevent.ControlAU3,
+				"type":             auditevent.ControlAU3a,
+				"loggedAt":         auditevent.ControlAU3b,
+				"component":        auditevent.ControlAU3c,
+				"source.type":      auditevent.ControlAU3d,
+				"source.value":     auditevent.ControlAU3d,
+				"outcome":          auditevent.ControlAU3e,
+				"subjects":         auditevent.ControlAU3f,
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			e := newTestEvent("UserLogin")
+			tt.mutate(e)
+
+			err := e.Validate()
+			if tt.wantControls == nil {
+				require.NoError(t, err)
+				return
+			}
+
+			require.ErrorIs(t, err, auditevent.ErrInvalidEvent)
+
+			var verr *auditevent.ValidationError
+			require.ErrorAs(t, err, &verr)
+
+			got := map[string]string{}
+			for _, fe := range verr.Errors {
+				got[fe.Field] = fe.Control
+				require.Contains(t, err.Error(), fe.Field)
+			}
+			require.Equal(t, tt.wantControls, got)
+
+			var fe *auditevent.FieldError
+			require.ErrorAs(t, err, &fe, "field errors should be reachable through errors.As")
+		})
+	}
+}
+
+func TestStrictWriterRejectsInvalidEvents(t *testing.T) {
+	t.Parallel()
+
+	var buf strings.Builder
+	pr := prometheus.NewRegistry()
+	w := auditevent.NewDefaultAuditEventWriter(&buf).
+		WithPrometheusMetricsForRegisterer("test", pr).
+		WithStrictValidation()
+
+	require.NoError(t, w.Write(newTestEvent("UserLogin")))
+
+	invalid := newTestEvent("").WithDataFromString("not json")
+	require.ErrorIs(t, w.Write(invalid), auditevent.ErrInvalidEvent)
+
+	require.Equal(t, 1, strings.Count(buf.String(), "\n"), "only the valid event should be written")
+	require.InDelta(t, 1, gatheredValue(t, pr, metrics.EventsTotalMetricsName), 0)
+	require.InDelta(t, 1, gatheredValue(t, pr, metrics.InvalidTotalMetricsName), 0)
+	require.InDelta(t, 0, gatheredValue(t, pr, metrics.ErrorsTotalMetricsName), 0)
+}
+
+func TestNonStrictWriterAcceptsInvalidEvents(t *testing.T) {
+	t.Parallel()
+
+	var buf strings.Builder
+	w := auditevent.NewDefaultAuditEventWriter(&buf)
+
+	require.NoError(t, w.Write(newTestEvent("")))
+}
+
+func TestStrictAsyncWriterRejectsBeforeQueueing(t *testing.T) {
+	t.Parallel()
+
+	var buf strings.Builder
+	w := auditevent.NewDefaultAuditEventWriter(&buf).
+		WithStrictValidation().
+		WithAsync(1, auditevent.OverflowBlock)
+
+	require.ErrorIs(t, w.Write(newTestEvent("")), auditevent.ErrInvalidEvent)
+	require.NoError(t, w.Close(t.Context()))
+	require.Empty(t, buf.String())
+}
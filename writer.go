@@ -34,8 +34,12 @@ type EventEncoder interface {
 // EventWriter writes audit events to a writer using
 // a given encoder.
 type EventWriter struct {
-	enc EventEncoder
-	mts *metrics.PrometheusMetricsProvider
+	enc    EventEncoder
+	mts    *metrics.PrometheusMetricsProvider
+	async  *asyncQueue
+	chain  *hashChain
+	signer Signer
+	strict bool
 }
 
 // AuditEventEncoderJSON is an encoder that encodes audit events
@@ -71,9 +75,55 @@ func (w *EventWriter) WithPrometheusMetrics(component string) *EventWriter {
 }
 
 // Write writes an audit event to the writer.
+// If the writer is asynchronous (see WithAsync), the event is queued
+// and written by a background worker instead.
+// If the writer is strict (see WithStrictValidation), invalid events
+// are rejected.
 func (w *EventWriter) Write(e *AuditEvent) error {
+	if w.strict {
+		if err := e.Validate(); err != nil {
+			if w.mts != nil {
+				w.mts.IncInvalid()
+			}
+
+			return err
+		}
+	}
+
+	if w.async != nil {
+		return w.async.enqueue(e)
+	}
+
+	return w.write(e)
+}
+
+// write encodes the event synchronously and records the result
+// in the metrics provider.
+func (w *EventWriter) write(e *AuditEvent) error {
+	if w.chain != nil {
+		return w.writeChained(e)
+	}
+
+	return w.encode(e)
+}
+
+// encode signs the event if needed, encodes it and records the result in
+// the metrics provider.
+func (w *EventWriter) encode(e *AuditEvent) error {
+	if w.signer != nil {
+		if err := e.Sign(w.signer); err != nil {
+			w.countResult(err)
+			return err
+		}
+	}
+
 	err := w.enc.Encode(e)
+	w.countResult(err)
 
+	return err
+}
+
+func (w *EventWriter) countResult(err error) {
 	// We only increment the metrics if the
 	// provider is available and not nil
 	if w.mts != nil {
@@ -83,6 +133,4 @@ func (w *EventWriter) Write(e *AuditEvent) error {
 			w.mts.IncErrors()
 		}
 	}
-
-	return err
 }